@@ -0,0 +1,517 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/cloudogu/dogu-additional-mounts-init/internal/copy"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// mountOptionFlag collects the values for the source and target pair started by the preceding --source flag.
+type mountOptionFlag struct {
+	sourcePaths *stringSliceFlag
+	values      map[int][]string
+}
+
+func newMountOptionFlag(sourcePaths *stringSliceFlag) *mountOptionFlag {
+	return &mountOptionFlag{sourcePaths: sourcePaths, values: map[int][]string{}}
+}
+
+func (f *mountOptionFlag) String() string {
+	if f == nil || f.values == nil {
+		return ""
+	}
+
+	var values []string
+	for _, v := range f.values {
+		values = append(values, v...)
+	}
+
+	return strings.Join(values, ",")
+}
+
+func (f *mountOptionFlag) Set(value string) error {
+	index := len(*f.sourcePaths) - 1
+	if index < 0 {
+		return errors.New("mount options have to follow a --source flag")
+	}
+
+	f.values[index] = append(f.values[index], value)
+	return nil
+}
+
+// mountOptionBoolFlag is a mountOptionFlag which can be used without value, e.g. --template instead of --template=true.
+type mountOptionBoolFlag struct {
+	*mountOptionFlag
+}
+
+func (f mountOptionBoolFlag) IsBoolFlag() bool {
+	return true
+}
+
+// get returns the last value given for the pair with the index.
+func (f *mountOptionFlag) get(index int) (string, bool) {
+	values := f.values[index]
+	if len(values) == 0 {
+		return "", false
+	}
+
+	return values[len(values)-1], true
+}
+
+// getAll returns all values given for the pair with the index.
+func (f *mountOptionFlag) getAll(index int) []string {
+	return f.values[index]
+}
+
+// mountOptions contains all options which can be defined for every source and target pair.
+type mountOptions struct {
+	owner                  *mountOptionFlag
+	group                  *mountOptionFlag
+	fileMode               *mountOptionFlag
+	dirMode                *mountOptionFlag
+	include                *mountOptionFlag
+	exclude                *mountOptionFlag
+	symlinks               *mountOptionFlag
+	conflict               *mountOptionFlag
+	backupSuffix           *mountOptionFlag
+	template               *mountOptionFlag
+	templateSuffix         *mountOptionFlag
+	extract                *mountOptionFlag
+	extractMaxSize         *mountOptionFlag
+	verify                 *mountOptionFlag
+	manifest               *mountOptionFlag
+	maxFileSize            *mountOptionFlag
+	maxBytes               *mountOptionFlag
+	maxFiles               *mountOptionFlag
+	merge                  *mountOptionFlag
+	mergeLists             *mountOptionFlag
+	assemble               *mountOptionFlag
+	priority               *mountOptionFlag
+	header                 *mountOptionFlag
+	separator              *mountOptionFlag
+	certificates           *mountOptionFlag
+	truststoreFormat       *mountOptionFlag
+	truststoreBase         *mountOptionFlag
+	truststoreBasePassword *mountOptionFlag
+	truststorePasswordFile *mountOptionFlag
+	truststorePasswordKey  *mountOptionFlag
+	validateCertificates   *mountOptionFlag
+}
+
+func registerMountOptions(flagSet *flag.FlagSet, sourcePaths *stringSliceFlag) *mountOptions {
+	options := &mountOptions{
+		owner:                  newMountOptionFlag(sourcePaths),
+		group:                  newMountOptionFlag(sourcePaths),
+		fileMode:               newMountOptionFlag(sourcePaths),
+		dirMode:                newMountOptionFlag(sourcePaths),
+		include:                newMountOptionFlag(sourcePaths),
+		exclude:                newMountOptionFlag(sourcePaths),
+		symlinks:               newMountOptionFlag(sourcePaths),
+		conflict:               newMountOptionFlag(sourcePaths),
+		backupSuffix:           newMountOptionFlag(sourcePaths),
+		template:               newMountOptionFlag(sourcePaths),
+		templateSuffix:         newMountOptionFlag(sourcePaths),
+		extract:                newMountOptionFlag(sourcePaths),
+		extractMaxSize:         newMountOptionFlag(sourcePaths),
+		verify:                 newMountOptionFlag(sourcePaths),
+		manifest:               newMountOptionFlag(sourcePaths),
+		maxFileSize:            newMountOptionFlag(sourcePaths),
+		maxBytes:               newMountOptionFlag(sourcePaths),
+		maxFiles:               newMountOptionFlag(sourcePaths),
+		merge:                  newMountOptionFlag(sourcePaths),
+		mergeLists:             newMountOptionFlag(sourcePaths),
+		assemble:               newMountOptionFlag(sourcePaths),
+		priority:               newMountOptionFlag(sourcePaths),
+		header:                 newMountOptionFlag(sourcePaths),
+		separator:              newMountOptionFlag(sourcePaths),
+		certificates:           newMountOptionFlag(sourcePaths),
+		truststoreFormat:       newMountOptionFlag(sourcePaths),
+		truststoreBase:         newMountOptionFlag(sourcePaths),
+		truststoreBasePassword: newMountOptionFlag(sourcePaths),
+		truststorePasswordFile: newMountOptionFlag(sourcePaths),
+		truststorePasswordKey:  newMountOptionFlag(sourcePaths),
+		validateCertificates:   newMountOptionFlag(sourcePaths),
+	}
+
+	flagSet.Var(options.owner, "owner", "Defines the uid of the copied files and created dirs of the preceding source")
+	flagSet.Var(options.group, "group", "Defines the gid of the copied files and created dirs of the preceding source")
+	flagSet.Var(options.fileMode, "fileMode", "Defines the octal permission (e.g. 0640) of the copied files of the preceding source")
+	flagSet.Var(options.dirMode, "dirMode", "Defines the octal permission (e.g. 0750) of the created dirs of the preceding source")
+	flagSet.Var(options.include, "include", "Defines a glob pattern (e.g. **/*.xml) of files to copy from the preceding source - can be repeated")
+	flagSet.Var(options.exclude, "exclude", "Defines a glob pattern of files to skip from the preceding source - can be repeated")
+	flagSet.Var(options.symlinks, "symlinks", "Defines how symlinks of the preceding source are handled: skip (default), preserve or dereference")
+	flagSet.Var(options.conflict, "conflict", "Defines how existing destination files of the preceding source are handled which were not copied before: overwrite (default), skip, fail or backup")
+	flagSet.Var(options.backupSuffix, "backupSuffix", fmt.Sprintf("Defines the suffix of backups of the preceding source with --conflict=backup - defaults to %s", copy.DefaultBackupSuffix))
+	flagSet.Var(mountOptionBoolFlag{options.template}, "template", "Renders the files of the preceding source as Go templates with access to the dogu config, the global config and environment variables")
+	flagSet.Var(options.templateSuffix, "templateSuffix", "Restricts the rendering of the preceding source to files with the suffix (e.g. .tpl) which is removed from the destination file name")
+	flagSet.Var(mountOptionBoolFlag{options.extract}, "extract", "Extracts archives (.tar, .tar.gz, .tgz, .tar.zst, .tzst, .zip) and decompresses files (.gz, .zst) of the preceding source into the destination")
+	flagSet.Var(options.extractMaxSize, "extractMaxSize", fmt.Sprintf("Defines the maximum uncompressed size in bytes of the files extracted from one archive of the preceding source - defaults to %d", copy.DefaultExtractMaxSize))
+	flagSet.Var(options.verify, "verify", "Verifies the files of the preceding source against its checksum manifest before anything is copied: report or enforce")
+	flagSet.Var(options.manifest, "manifest", fmt.Sprintf("Defines the name of the checksum manifest in the root of the preceding source - defaults to %s", copy.DefaultManifest))
+	flagSet.Var(options.maxFileSize, "maxFileSize", "Defines the maximum size in bytes of a single file of the preceding source")
+	flagSet.Var(options.maxBytes, "maxBytes", "Defines the maximum size in bytes of all files of the preceding source")
+	flagSet.Var(options.maxFiles, "maxFiles", "Defines the maximum number of files of the preceding source")
+	flagSet.Var(mountOptionBoolFlag{options.merge}, "merge", "Merges YAML, JSON, INI and properties files of the preceding source into the existing destination files - requires the conflict policy overwrite or backup")
+	flagSet.Var(options.mergeLists, "mergeLists", "Defines how lists of merged YAML and JSON files of the preceding source are merged: replace (default), append or unique")
+	flagSet.Var(mountOptionBoolFlag{options.assemble}, "assemble", "Concatenates the files of the preceding source and of all other assembled sources with the same target into the target file")
+	flagSet.Var(options.priority, "priority", "Defines the order of the assembled files of the preceding source - files of sources with a lower priority come first - defaults to 0")
+	flagSet.Var(options.header, "header", "Defines the line written at the beginning of the assembled target file of the preceding source")
+	flagSet.Var(options.separator, "separator", "Defines the line written between the assembled files of the preceding source")
+	flagSet.Var(options.certificates, "certificates", "Installs the PEM encoded certificates of the preceding source instead of copying the files: dir (certificate files and OpenSSL hash links in the target dir), bundle (appended to the target file) or truststore (written to the target truststore)")
+	flagSet.Var(options.truststoreFormat, "truststoreFormat", "Defines the format of the truststore of the preceding source: pkcs12 (default) or jks")
+	flagSet.Var(options.truststoreBase, "truststoreBase", "Defines a PKCS#12 or JKS truststore whose certificates are added to the truststore of the preceding source")
+	flagSet.Var(options.truststoreBasePassword, "truststoreBasePassword", "Defines the password of the base truststore of the preceding source, e.g. changeit for the cacerts of the JDK, if it differs from the password of the truststore")
+	flagSet.Var(options.truststorePasswordFile, "truststorePasswordFile", "Defines the file containing the password of the truststore of the preceding source")
+	flagSet.Var(options.truststorePasswordKey, "truststorePasswordKey", "Defines the dogu config key of the password of the truststore of the preceding source")
+	flagSet.Var(options.validateCertificates, "validateCertificates", "Validates the expiry, chains and key pairs of the PEM encoded certificates and keys of the preceding source before anything is copied: report or enforce - templates are not rendered and archives are not extracted for the validation")
+
+	return options
+}
+
+// apply sets the options given for the pair with the index to the mount.
+func (o *mountOptions) apply(index int, mount *copy.SrcAndDestination) error {
+	var err error
+	mount.Owner, err = parseID(o.owner, index)
+	if err != nil {
+		return fmt.Errorf("invalid owner for source %s: %w", mount.Src, err)
+	}
+
+	mount.Group, err = parseID(o.group, index)
+	if err != nil {
+		return fmt.Errorf("invalid group for source %s: %w", mount.Src, err)
+	}
+
+	mount.FileMode, err = parseMode(o.fileMode, index)
+	if err != nil {
+		return fmt.Errorf("invalid file mode for source %s: %w", mount.Src, err)
+	}
+
+	mount.DirMode, err = parseMode(o.dirMode, index)
+	if err != nil {
+		return fmt.Errorf("invalid dir mode for source %s: %w", mount.Src, err)
+	}
+
+	mount.Include = o.include.getAll(index)
+	mount.Exclude = o.exclude.getAll(index)
+	err = copy.ValidatePatterns(append(mount.Include, mount.Exclude...))
+	if err != nil {
+		return fmt.Errorf("invalid filter for source %s: %w", mount.Src, err)
+	}
+
+	if value, ok := o.symlinks.get(index); ok {
+		mount.Symlinks, err = copy.ParseSymlinkPolicy(value)
+		if err != nil {
+			return fmt.Errorf("invalid symlink policy for source %s: %w", mount.Src, err)
+		}
+	}
+
+	if value, ok := o.conflict.get(index); ok {
+		mount.Conflict, err = copy.ParseConflictPolicy(value)
+		if err != nil {
+			return fmt.Errorf("invalid conflict policy for source %s: %w", mount.Src, err)
+		}
+	}
+
+	if value, ok := o.backupSuffix.get(index); ok {
+		err = copy.ValidateBackupSuffix(value)
+		if err != nil {
+			return fmt.Errorf("invalid backup suffix for source %s: %w", mount.Src, err)
+		}
+
+		mount.BackupSuffix = value
+	}
+
+	if value, ok := o.template.get(index); ok {
+		mount.Templates, err = strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid template option for source %s: %w", mount.Src, err)
+		}
+	}
+
+	if value, ok := o.templateSuffix.get(index); ok {
+		if !mount.Templates {
+			return fmt.Errorf("template suffix for source %s requires the template option", mount.Src)
+		}
+
+		mount.TemplateSuffix = value
+	}
+
+	if value, ok := o.extract.get(index); ok {
+		mount.Extract, err = strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid extract option for source %s: %w", mount.Src, err)
+		}
+	}
+
+	if value, ok := o.extractMaxSize.get(index); ok {
+		if !mount.Extract {
+			return fmt.Errorf("extract max size for source %s requires the extract option", mount.Src)
+		}
+
+		mount.ExtractMaxSize, err = strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid extract max size for source %s: %w", mount.Src, err)
+		}
+
+		if mount.ExtractMaxSize <= 0 {
+			return fmt.Errorf("invalid extract max size for source %s: size %d must be positive", mount.Src, mount.ExtractMaxSize)
+		}
+	}
+
+	if value, ok := o.verify.get(index); ok {
+		mount.Verify, err = copy.ParseVerifyPolicy(value)
+		if err != nil {
+			return fmt.Errorf("invalid verify policy for source %s: %w", mount.Src, err)
+		}
+	}
+
+	if value, ok := o.validateCertificates.get(index); ok {
+		mount.ValidateCertificates, err = copy.ParseValidationPolicy(value)
+		if err != nil {
+			return fmt.Errorf("invalid validation policy for source %s: %w", mount.Src, err)
+		}
+	}
+
+	if value, ok := o.manifest.get(index); ok {
+		if mount.Verify == "" {
+			return fmt.Errorf("manifest for source %s requires the verify option", mount.Src)
+		}
+
+		err = copy.ValidateManifest(value)
+		if err != nil {
+			return fmt.Errorf("invalid manifest for source %s: %w", mount.Src, err)
+		}
+
+		mount.Manifest = value
+	}
+
+	mount.Quota.MaxFileSize, err = parseLimit(o.maxFileSize, index)
+	if err != nil {
+		return fmt.Errorf("invalid max file size for source %s: %w", mount.Src, err)
+	}
+
+	mount.Quota.MaxBytes, err = parseLimit(o.maxBytes, index)
+	if err != nil {
+		return fmt.Errorf("invalid max bytes for source %s: %w", mount.Src, err)
+	}
+
+	maxFiles, err := parseLimit(o.maxFiles, index)
+	if err != nil {
+		return fmt.Errorf("invalid max files for source %s: %w", mount.Src, err)
+	}
+
+	mount.Quota.MaxFiles = int(maxFiles)
+
+	if value, ok := o.merge.get(index); ok {
+		mount.Merge, err = strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid merge option for source %s: %w", mount.Src, err)
+		}
+	}
+
+	// Merged files need the original of the destination file, which is only kept if it is overwritten or backed up.
+	if mount.Merge && (mount.Conflict == copy.ConflictSkip || mount.Conflict == copy.ConflictFail) {
+		return fmt.Errorf("merge option for source %s cannot be combined with the conflict policy %s", mount.Src, mount.Conflict)
+	}
+
+	if value, ok := o.mergeLists.get(index); ok {
+		if !mount.Merge {
+			return fmt.Errorf("list merge strategy for source %s requires the merge option", mount.Src)
+		}
+
+		mount.MergeLists, err = copy.ParseListMergeStrategy(value)
+		if err != nil {
+			return fmt.Errorf("invalid list merge strategy for source %s: %w", mount.Src, err)
+		}
+	}
+
+	err = o.applyAssembly(index, mount)
+	if err != nil {
+		return err
+	}
+
+	err = o.applyCertificates(index, mount)
+	if err != nil {
+		return err
+	}
+
+	return o.applyTruststore(index, mount)
+}
+
+// applyCertificates sets the certificate mode given for the pair with the index to the mount.
+func (o *mountOptions) applyCertificates(index int, mount *copy.SrcAndDestination) error {
+	value, ok := o.certificates.get(index)
+	if !ok {
+		return nil
+	}
+
+	if mount.Templates || mount.Extract || mount.Merge || mount.Assemble {
+		return fmt.Errorf("certificate mode for source %s cannot be combined with the template, extract, merge or assemble option", mount.Src)
+	}
+
+	var err error
+	mount.Certificates, err = copy.ParseCertificateMode(value)
+	if err != nil {
+		return fmt.Errorf("invalid certificate mode for source %s: %w", mount.Src, err)
+	}
+
+	return nil
+}
+
+// applyTruststore sets the truststore options given for the pair with the index to the mount.
+func (o *mountOptions) applyTruststore(index int, mount *copy.SrcAndDestination) error {
+	isTruststore := mount.Certificates == copy.CertificatesTruststore
+	if value, ok := o.truststoreFormat.get(index); ok {
+		if !isTruststore {
+			return fmt.Errorf("truststore format for source %s requires the certificate mode truststore", mount.Src)
+		}
+
+		var err error
+		mount.Truststore.Format, err = copy.ParseTruststoreFormat(value)
+		if err != nil {
+			return fmt.Errorf("invalid truststore format for source %s: %w", mount.Src, err)
+		}
+	}
+
+	if value, ok := o.truststoreBase.get(index); ok {
+		if !isTruststore {
+			return fmt.Errorf("truststore base for source %s requires the certificate mode truststore", mount.Src)
+		}
+
+		mount.Truststore.Base = value
+	}
+
+	if value, ok := o.truststoreBasePassword.get(index); ok {
+		if mount.Truststore.Base == "" {
+			return fmt.Errorf("truststore base password for source %s requires a truststore base", mount.Src)
+		}
+
+		mount.Truststore.BasePassword = value
+	}
+
+	if value, ok := o.truststorePasswordFile.get(index); ok {
+		if !isTruststore {
+			return fmt.Errorf("truststore password file for source %s requires the certificate mode truststore", mount.Src)
+		}
+
+		mount.Truststore.PasswordFile = value
+	}
+
+	if value, ok := o.truststorePasswordKey.get(index); ok {
+		if !isTruststore {
+			return fmt.Errorf("truststore password key for source %s requires the certificate mode truststore", mount.Src)
+		}
+
+		mount.Truststore.PasswordKey = value
+	}
+
+	if isTruststore && (mount.Truststore.PasswordFile == "") == (mount.Truststore.PasswordKey == "") {
+		return fmt.Errorf("truststore for source %s requires either a password file or a password key", mount.Src)
+	}
+
+	return nil
+}
+
+// applyAssembly sets the assembly options given for the pair with the index to the mount.
+func (o *mountOptions) applyAssembly(index int, mount *copy.SrcAndDestination) error {
+	var err error
+	if value, ok := o.assemble.get(index); ok {
+		mount.Assemble, err = strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid assemble option for source %s: %w", mount.Src, err)
+		}
+	}
+
+	if mount.Assemble && (mount.Extract || mount.Merge) {
+		return fmt.Errorf("assemble option for source %s cannot be combined with the extract or merge option", mount.Src)
+	}
+
+	if value, ok := o.priority.get(index); ok {
+		if !mount.Assemble {
+			return fmt.Errorf("priority for source %s requires the assemble option", mount.Src)
+		}
+
+		mount.Priority, err = strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid priority for source %s: %w", mount.Src, err)
+		}
+	}
+
+	if value, ok := o.header.get(index); ok {
+		if !mount.Assemble {
+			return fmt.Errorf("header for source %s requires the assemble option", mount.Src)
+		}
+
+		mount.AssembleHeader = value
+	}
+
+	if value, ok := o.separator.get(index); ok {
+		if !mount.Assemble {
+			return fmt.Errorf("separator for source %s requires the assemble option", mount.Src)
+		}
+
+		mount.AssembleSeparator = value
+	}
+
+	return nil
+}
+
+// parseLimit returns the positive limit given for the pair with the index or 0 if no limit is given.
+func parseLimit(f *mountOptionFlag, index int) (int64, error) {
+	value, ok := f.get(index)
+	if !ok {
+		return 0, nil
+	}
+
+	limit, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	if limit <= 0 {
+		return 0, fmt.Errorf("limit %d must be positive", limit)
+	}
+
+	return limit, nil
+}
+
+func parseID(f *mountOptionFlag, index int) (*int, error) {
+	value, ok := f.get(index)
+	if !ok {
+		return nil, nil
+	}
+
+	id, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, err
+	}
+
+	if id < 0 {
+		return nil, fmt.Errorf("id %d must not be negative", id)
+	}
+
+	return &id, nil
+}
+
+func parseMode(f *mountOptionFlag, index int) (*os.FileMode, error) {
+	value, ok := f.get(index)
+	if !ok {
+		return nil, nil
+	}
+
+	mode, err := strconv.ParseUint(value, 8, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	if mode > uint64(os.ModePerm) {
+		return nil, fmt.Errorf("mode %s exceeds the permission bits", value)
+	}
+
+	fileMode := os.FileMode(mode)
+	return &fileMode, nil
+}
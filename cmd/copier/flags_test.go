@@ -0,0 +1,601 @@
+package main
+
+import (
+	"flag"
+	"github.com/cloudogu/dogu-additional-mounts-init/internal/copy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"testing"
+)
+
+func Test_mountOptionFlag(t *testing.T) {
+	t.Run("should assign values to the preceding source", func(t *testing.T) {
+		// given
+		flagSet := flag.NewFlagSet("test", flag.ContinueOnError)
+		var sourcePaths stringSliceFlag
+		flagSet.Var(&sourcePaths, "source", "")
+		option := newMountOptionFlag(&sourcePaths)
+		flagSet.Var(option, "option", "")
+
+		// when
+		err := flagSet.Parse([]string{"--source=/src1", "--option=a", "--source=/src2", "--source=/src3", "--option=b", "--option=c"})
+
+		// then
+		require.NoError(t, err)
+		value, ok := option.get(0)
+		assert.True(t, ok)
+		assert.Equal(t, "a", value)
+		_, ok = option.get(1)
+		assert.False(t, ok)
+		value, ok = option.get(2)
+		assert.True(t, ok)
+		assert.Equal(t, "c", value)
+	})
+
+	t.Run("should return error if no source precedes the option", func(t *testing.T) {
+		// given
+		flagSet := flag.NewFlagSet("test", flag.ContinueOnError)
+		var sourcePaths stringSliceFlag
+		flagSet.Var(&sourcePaths, "source", "")
+		flagSet.Var(newMountOptionFlag(&sourcePaths), "option", "")
+
+		// when
+		err := flagSet.Parse([]string{"--option=a", "--source=/src1"})
+
+		// then
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "mount options have to follow a --source flag")
+	})
+}
+
+func Test_mountOptions_apply(t *testing.T) {
+	parse := func(t *testing.T, args ...string) *mountOptions {
+		flagSet := flag.NewFlagSet("test", flag.ContinueOnError)
+		var sourcePaths stringSliceFlag
+		flagSet.Var(&sourcePaths, "source", "")
+		options := registerMountOptions(flagSet, &sourcePaths)
+		require.NoError(t, flagSet.Parse(args))
+		return options
+	}
+
+	t.Run("should set owner, group and modes", func(t *testing.T) {
+		// given
+		options := parse(t, "--source=/src", "--owner=1000", "--group=1001", "--fileMode=0640", "--dirMode=750")
+		mount := copy.SrcAndDestination{Src: "/src", Dest: "/dest"}
+
+		// when
+		err := options.apply(0, &mount)
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, 1000, *mount.Owner)
+		assert.Equal(t, 1001, *mount.Group)
+		assert.Equal(t, os.FileMode(0640), *mount.FileMode)
+		assert.Equal(t, os.FileMode(0750), *mount.DirMode)
+	})
+
+	t.Run("should set include and exclude patterns", func(t *testing.T) {
+		// given
+		options := parse(t, "--source=/src", "--include=**/*.xml", "--include=*.yaml", "--exclude=test/**")
+		mount := copy.SrcAndDestination{Src: "/src", Dest: "/dest"}
+
+		// when
+		err := options.apply(0, &mount)
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, []string{"**/*.xml", "*.yaml"}, mount.Include)
+		assert.Equal(t, []string{"test/**"}, mount.Exclude)
+	})
+
+	t.Run("should return error on invalid pattern", func(t *testing.T) {
+		// given
+		options := parse(t, "--source=/src", "--exclude=[a")
+		mount := copy.SrcAndDestination{Src: "/src"}
+
+		// when
+		err := options.apply(0, &mount)
+
+		// then
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "invalid filter for source /src")
+	})
+
+	t.Run("should set symlink policy", func(t *testing.T) {
+		// given
+		options := parse(t, "--source=/src", "--symlinks=dereference")
+		mount := copy.SrcAndDestination{Src: "/src", Dest: "/dest"}
+
+		// when
+		err := options.apply(0, &mount)
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, copy.SymlinkDereference, mount.Symlinks)
+	})
+
+	t.Run("should return error on unknown symlink policy", func(t *testing.T) {
+		// given
+		options := parse(t, "--source=/src", "--symlinks=follow")
+		mount := copy.SrcAndDestination{Src: "/src"}
+
+		// when
+		err := options.apply(0, &mount)
+
+		// then
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "invalid symlink policy for source /src")
+		assert.ErrorContains(t, err, `unknown symlink policy "follow"`)
+	})
+
+	t.Run("should set conflict policy and backup suffix", func(t *testing.T) {
+		// given
+		options := parse(t, "--source=/src", "--conflict=backup", "--backupSuffix=.orig")
+		mount := copy.SrcAndDestination{Src: "/src", Dest: "/dest"}
+
+		// when
+		err := options.apply(0, &mount)
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, copy.ConflictBackup, mount.Conflict)
+		assert.Equal(t, ".orig", mount.BackupSuffix)
+	})
+
+	t.Run("should return error on unknown conflict policy", func(t *testing.T) {
+		// given
+		options := parse(t, "--source=/src", "--conflict=keep")
+		mount := copy.SrcAndDestination{Src: "/src"}
+
+		// when
+		err := options.apply(0, &mount)
+
+		// then
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "invalid conflict policy for source /src")
+	})
+
+	t.Run("should return error on invalid backup suffix", func(t *testing.T) {
+		// given
+		options := parse(t, "--source=/src", "--backupSuffix=")
+		mount := copy.SrcAndDestination{Src: "/src"}
+
+		// when
+		err := options.apply(0, &mount)
+
+		// then
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "invalid backup suffix for source /src")
+	})
+
+	t.Run("should enable templates with suffix", func(t *testing.T) {
+		// given
+		options := parse(t, "--source=/src", "--template", "--templateSuffix=.tpl")
+		mount := copy.SrcAndDestination{Src: "/src", Dest: "/dest"}
+
+		// when
+		err := options.apply(0, &mount)
+
+		// then
+		require.NoError(t, err)
+		assert.True(t, mount.Templates)
+		assert.Equal(t, ".tpl", mount.TemplateSuffix)
+	})
+
+	t.Run("should return error on template suffix without template option", func(t *testing.T) {
+		// given
+		options := parse(t, "--source=/src", "--templateSuffix=.tpl")
+		mount := copy.SrcAndDestination{Src: "/src"}
+
+		// when
+		err := options.apply(0, &mount)
+
+		// then
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "template suffix for source /src requires the template option")
+	})
+
+	t.Run("should enable extraction with max size", func(t *testing.T) {
+		// given
+		options := parse(t, "--source=/src", "--extract", "--extractMaxSize=1048576")
+		mount := copy.SrcAndDestination{Src: "/src", Dest: "/dest"}
+
+		// when
+		err := options.apply(0, &mount)
+
+		// then
+		require.NoError(t, err)
+		assert.True(t, mount.Extract)
+		assert.Equal(t, int64(1048576), mount.ExtractMaxSize)
+	})
+
+	t.Run("should return error on invalid extract max size", func(t *testing.T) {
+		for _, value := range []string{"1GiB", "0"} {
+			// given
+			options := parse(t, "--source=/src", "--extract", "--extractMaxSize="+value)
+			mount := copy.SrcAndDestination{Src: "/src"}
+
+			// when
+			err := options.apply(0, &mount)
+
+			// then
+			require.Error(t, err)
+			assert.ErrorContains(t, err, "invalid extract max size for source /src")
+		}
+	})
+
+	t.Run("should return error on extract max size without extract option", func(t *testing.T) {
+		// given
+		options := parse(t, "--source=/src", "--extractMaxSize=100")
+		mount := copy.SrcAndDestination{Src: "/src"}
+
+		// when
+		err := options.apply(0, &mount)
+
+		// then
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "extract max size for source /src requires the extract option")
+	})
+
+	t.Run("should enable verification with manifest", func(t *testing.T) {
+		// given
+		options := parse(t, "--source=/src", "--verify=enforce", "--manifest=checksums.txt")
+		mount := copy.SrcAndDestination{Src: "/src", Dest: "/dest"}
+
+		// when
+		err := options.apply(0, &mount)
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, copy.VerifyEnforce, mount.Verify)
+		assert.Equal(t, "checksums.txt", mount.Manifest)
+	})
+
+	t.Run("should return error on unknown verify policy", func(t *testing.T) {
+		// given
+		options := parse(t, "--source=/src", "--verify=strict")
+		mount := copy.SrcAndDestination{Src: "/src"}
+
+		// when
+		err := options.apply(0, &mount)
+
+		// then
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "invalid verify policy for source /src")
+	})
+
+	t.Run("should return error on manifest in sub dir", func(t *testing.T) {
+		// given
+		options := parse(t, "--source=/src", "--verify=report", "--manifest=sub/SHA256SUMS")
+		mount := copy.SrcAndDestination{Src: "/src"}
+
+		// when
+		err := options.apply(0, &mount)
+
+		// then
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "invalid manifest for source /src")
+	})
+
+	t.Run("should return error on manifest without verify option", func(t *testing.T) {
+		// given
+		options := parse(t, "--source=/src", "--manifest=SHA256SUMS")
+		mount := copy.SrcAndDestination{Src: "/src"}
+
+		// when
+		err := options.apply(0, &mount)
+
+		// then
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "manifest for source /src requires the verify option")
+	})
+
+	t.Run("should set quota", func(t *testing.T) {
+		// given
+		options := parse(t, "--source=/src", "--maxFileSize=1024", "--maxBytes=1048576", "--maxFiles=100")
+		mount := copy.SrcAndDestination{Src: "/src", Dest: "/dest"}
+
+		// when
+		err := options.apply(0, &mount)
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, copy.Quota{MaxFileSize: 1024, MaxBytes: 1048576, MaxFiles: 100}, mount.Quota)
+	})
+
+	t.Run("should return error on limit which is not positive", func(t *testing.T) {
+		// given
+		options := parse(t, "--source=/src", "--maxFiles=0")
+		mount := copy.SrcAndDestination{Src: "/src"}
+
+		// when
+		err := options.apply(0, &mount)
+
+		// then
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "invalid max files for source /src: limit 0 must be positive")
+	})
+
+	t.Run("should enable merge with list strategy", func(t *testing.T) {
+		// given
+		options := parse(t, "--source=/src", "--merge", "--mergeLists=unique")
+		mount := copy.SrcAndDestination{Src: "/src", Dest: "/dest"}
+
+		// when
+		err := options.apply(0, &mount)
+
+		// then
+		require.NoError(t, err)
+		assert.True(t, mount.Merge)
+		assert.Equal(t, copy.ListUnique, mount.MergeLists)
+	})
+
+	t.Run("should return error on list strategy without merge option", func(t *testing.T) {
+		// given
+		options := parse(t, "--source=/src", "--mergeLists=append")
+		mount := copy.SrcAndDestination{Src: "/src"}
+
+		// when
+		err := options.apply(0, &mount)
+
+		// then
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "list merge strategy for source /src requires the merge option")
+	})
+
+	t.Run("should return error on unknown list strategy", func(t *testing.T) {
+		// given
+		options := parse(t, "--source=/src", "--merge", "--mergeLists=zip")
+		mount := copy.SrcAndDestination{Src: "/src"}
+
+		// when
+		err := options.apply(0, &mount)
+
+		// then
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "invalid list merge strategy for source /src")
+	})
+
+	t.Run("should enable assembly with priority, header and separator", func(t *testing.T) {
+		// given
+		options := parse(t, "--source=/src", "--assemble", "--priority=-10", "--header=# generated", "--separator=# ---")
+		mount := copy.SrcAndDestination{Src: "/src", Dest: "/dest/app.conf"}
+
+		// when
+		err := options.apply(0, &mount)
+
+		// then
+		require.NoError(t, err)
+		assert.True(t, mount.Assemble)
+		assert.Equal(t, -10, mount.Priority)
+		assert.Equal(t, "# generated", mount.AssembleHeader)
+		assert.Equal(t, "# ---", mount.AssembleSeparator)
+	})
+
+	t.Run("should return error on priority without assemble option", func(t *testing.T) {
+		// given
+		options := parse(t, "--source=/src", "--priority=1")
+		mount := copy.SrcAndDestination{Src: "/src"}
+
+		// when
+		err := options.apply(0, &mount)
+
+		// then
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "priority for source /src requires the assemble option")
+	})
+
+	t.Run("should return error on merged source with conflict policy skip or fail", func(t *testing.T) {
+		for _, conflict := range []string{"skip", "fail"} {
+			t.Run(conflict, func(t *testing.T) {
+				// given
+				options := parse(t, "--source=/src", "--merge", "--conflict="+conflict)
+				mount := copy.SrcAndDestination{Src: "/src"}
+
+				// when
+				err := options.apply(0, &mount)
+
+				// then
+				require.Error(t, err)
+				assert.ErrorContains(t, err, "merge option for source /src cannot be combined with the conflict policy "+conflict)
+			})
+		}
+	})
+
+	t.Run("should return error on assembly of merged source", func(t *testing.T) {
+		// given
+		options := parse(t, "--source=/src", "--merge", "--assemble")
+		mount := copy.SrcAndDestination{Src: "/src"}
+
+		// when
+		err := options.apply(0, &mount)
+
+		// then
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "assemble option for source /src cannot be combined with the extract or merge option")
+	})
+
+	t.Run("should set certificate mode", func(t *testing.T) {
+		// given
+		options := parse(t, "--source=/src", "--certificates=bundle")
+		mount := copy.SrcAndDestination{Src: "/src", Dest: "/etc/ssl/certs/ca-certificates.crt"}
+
+		// when
+		err := options.apply(0, &mount)
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, copy.CertificatesBundle, mount.Certificates)
+	})
+
+	t.Run("should return error on certificate mode of extracted source", func(t *testing.T) {
+		// given
+		options := parse(t, "--source=/src", "--extract", "--certificates=dir")
+		mount := copy.SrcAndDestination{Src: "/src"}
+
+		// when
+		err := options.apply(0, &mount)
+
+		// then
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "certificate mode for source /src cannot be combined with the template, extract, merge or assemble option")
+	})
+
+	t.Run("should return error on unknown certificate mode", func(t *testing.T) {
+		// given
+		options := parse(t, "--source=/src", "--certificates=store")
+		mount := copy.SrcAndDestination{Src: "/src"}
+
+		// when
+		err := options.apply(0, &mount)
+
+		// then
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "invalid certificate mode for source /src")
+	})
+
+	t.Run("should set truststore options", func(t *testing.T) {
+		// given
+		options := parse(t, "--source=/src", "--certificates=truststore", "--truststoreFormat=jks", "--truststoreBase=/opt/java/cacerts", "--truststoreBasePassword=changeit", "--truststorePasswordKey=truststore_password")
+		mount := copy.SrcAndDestination{Src: "/src", Dest: "/var/lib/app/truststore.jks"}
+
+		// when
+		err := options.apply(0, &mount)
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, copy.CertificatesTruststore, mount.Certificates)
+		assert.Equal(t, copy.Truststore{Format: copy.TruststoreJKS, Base: "/opt/java/cacerts", BasePassword: "changeit", PasswordKey: "truststore_password"}, mount.Truststore)
+	})
+
+	t.Run("should return error on truststore without password", func(t *testing.T) {
+		// given
+		options := parse(t, "--source=/src", "--certificates=truststore")
+		mount := copy.SrcAndDestination{Src: "/src"}
+
+		// when
+		err := options.apply(0, &mount)
+
+		// then
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "truststore for source /src requires either a password file or a password key")
+	})
+
+	t.Run("should return error on truststore option without truststore", func(t *testing.T) {
+		// given
+		options := parse(t, "--source=/src", "--certificates=bundle", "--truststorePasswordFile=/secrets/password")
+		mount := copy.SrcAndDestination{Src: "/src"}
+
+		// when
+		err := options.apply(0, &mount)
+
+		// then
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "truststore password file for source /src requires the certificate mode truststore")
+	})
+
+	t.Run("should return error on truststore base password without truststore base", func(t *testing.T) {
+		// given
+		options := parse(t, "--source=/src", "--certificates=truststore", "--truststoreBasePassword=changeit", "--truststorePasswordFile=/secrets/password")
+		mount := copy.SrcAndDestination{Src: "/src"}
+
+		// when
+		err := options.apply(0, &mount)
+
+		// then
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "truststore base password for source /src requires a truststore base")
+	})
+
+	t.Run("should set certificate validation policy", func(t *testing.T) {
+		// given
+		options := parse(t, "--source=/src", "--validateCertificates=enforce")
+		mount := copy.SrcAndDestination{Src: "/src", Dest: "/dest"}
+
+		// when
+		err := options.apply(0, &mount)
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, copy.ValidationEnforce, mount.ValidateCertificates)
+	})
+
+	t.Run("should return error on unknown validation policy", func(t *testing.T) {
+		// given
+		options := parse(t, "--source=/src", "--validateCertificates=strict")
+		mount := copy.SrcAndDestination{Src: "/src"}
+
+		// when
+		err := options.apply(0, &mount)
+
+		// then
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "invalid validation policy for source /src")
+	})
+
+	t.Run("should keep unset options nil", func(t *testing.T) {
+		// given
+		options := parse(t, "--source=/src")
+		mount := copy.SrcAndDestination{Src: "/src", Dest: "/dest"}
+
+		// when
+		err := options.apply(0, &mount)
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, copy.SrcAndDestination{Src: "/src", Dest: "/dest"}, mount)
+	})
+
+	t.Run("should return error on invalid owner", func(t *testing.T) {
+		// given
+		options := parse(t, "--source=/src", "--owner=root")
+		mount := copy.SrcAndDestination{Src: "/src"}
+
+		// when
+		err := options.apply(0, &mount)
+
+		// then
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "invalid owner for source /src")
+	})
+
+	t.Run("should return error on negative group", func(t *testing.T) {
+		// given
+		options := parse(t, "--source=/src", "--group=-1")
+		mount := copy.SrcAndDestination{Src: "/src"}
+
+		// when
+		err := options.apply(0, &mount)
+
+		// then
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "invalid group for source /src: id -1 must not be negative")
+	})
+
+	t.Run("should return error on invalid file mode", func(t *testing.T) {
+		// given
+		options := parse(t, "--source=/src", "--fileMode=0948")
+		mount := copy.SrcAndDestination{Src: "/src"}
+
+		// when
+		err := options.apply(0, &mount)
+
+		// then
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "invalid file mode for source /src")
+	})
+
+	t.Run("should return error on dir mode exceeding permission bits", func(t *testing.T) {
+		// given
+		options := parse(t, "--source=/src", "--dirMode=4755")
+		mount := copy.SrcAndDestination{Src: "/src"}
+
+		// when
+		err := options.apply(0, &mount)
+
+		// then
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "invalid dir mode for source /src: mode 4755 exceeds the permission bits")
+	})
+}
@@ -12,7 +12,15 @@ type filesystem interface {
 
 type fileTracker interface {
 	AddFile(path string) error
+	RemoveFile(path string) error
+	AddDir(path string) error
+	GetChecksum(path string) (copy.FileChecksum, bool, error)
+	SetChecksum(path string, checksum copy.FileChecksum) error
+	IsTracked(path string) (bool, error)
+	SetBackup(path, backupPath string) error
+	GetBackup(path string) (string, bool, error)
 	DeleteAllTrackedFiles() error
+	DeleteStaleTrackedFiles() error
 }
 
 type doguConfigReaderWriter interface {
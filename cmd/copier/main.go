@@ -8,12 +8,20 @@ import (
 	"github.com/cloudogu/doguctl/registry"
 	"log"
 	"os"
+	"path/filepath"
+	"slices"
 	"strings"
 )
 
 const (
 	defaultCesConfigBaseDir   = "/dogumount/etc/ces/config"
 	defaultLocalConfigBaseDir = "/dogumount/var/ces/config"
+	// globalConfigFile is the path of the global config relative to the cesConfigBaseDir.
+	globalConfigFile = "global/config.yaml"
+	// journalFile is the path of the journal of transactional runs relative to the localConfigBaseDir.
+	journalFile = "additionalMounts.journal"
+	// originalsDir is the dir of the originals of overwritten files relative to the localConfigBaseDir.
+	originalsDir = "additionalMounts.originals"
 )
 
 var (
@@ -42,54 +50,152 @@ func main() {
 func handleCopyCommand(args []string, volumeMountCopyGetter copierGetter, configGetter doguConfigGetter, fileTrackerGetter fileTrackerGetter) error {
 	cesConfigBaseDir := copyCmd.String("cesConfigBaseDir", defaultCesConfigBaseDir, fmt.Sprintf("Defines the base dir for the dogu config - defaults to %s", defaultCesConfigBaseDir))
 	localConfigBaseDir := copyCmd.String("localConfigBaseDir", defaultLocalConfigBaseDir, fmt.Sprintf("Defines the base dir for the local dogu config - defaults to %s", defaultLocalConfigBaseDir))
+	concurrency := copyCmd.Int("concurrency", 1, "Defines the number of files copied in parallel - defaults to 1")
+	dryRun := copyCmd.Bool("dry-run", false, "Logs the planned deletions, creations, overwrites and skips without modifying the filesystem or the local dogu config")
+	copyCmd.BoolVar(dryRun, "dryRun", false, "Alias of --dry-run")
+	preserveMetadata := copyCmd.Bool("preserveMetadata", false, "Preserves permission bits, modification time and, if permitted, owner and group of the source files")
+	transactional := copyCmd.Bool("transactional", false, "Rolls back all modifications of the run if any file fails")
+	globalMaxFileSize := copyCmd.Int64("globalMaxFileSize", 0, "Defines the maximum size in bytes of a single file of all sources - unlimited by default")
+	globalMaxBytes := copyCmd.Int64("globalMaxBytes", 0, "Defines the maximum size in bytes of all files of all sources together - unlimited by default")
+	globalMaxFiles := copyCmd.Int("globalMaxFiles", 0, "Defines the maximum number of files of all sources together - unlimited by default")
 
 	var sourcePaths stringSliceFlag
 	var targetPaths stringSliceFlag
+	var allowedRoots stringSliceFlag
 	copyCmd.Var(&sourcePaths, "source", "")
 	copyCmd.Var(&targetPaths, "target", "")
+	copyCmd.Var(&allowedRoots, "allowedRoot", "Restricts all modifications to paths beneath the dir without following symlinks. Can be repeated")
+	options := registerMountOptions(copyCmd, &sourcePaths)
 	err := copyCmd.Parse(args)
 	if err != nil {
 		return fmt.Errorf("failed to parse arguments: %w", err)
 	}
 
+	if *concurrency < 1 {
+		return fmt.Errorf("concurrency must be at least 1 but is %d", *concurrency)
+	}
+
+	if *globalMaxFileSize < 0 || *globalMaxBytes < 0 || *globalMaxFiles < 0 {
+		return fmt.Errorf("global quotas must not be negative")
+	}
+
 	doguConfigRegistry, err := configGetter(*cesConfigBaseDir, *localConfigBaseDir)
 	if err != nil {
 		return fmt.Errorf("failed to generate dogu file config with config dir %s and local config dir %s: %w", *cesConfigBaseDir, *localConfigBaseDir, err)
 	}
 
-	fileSystem := &copy.FileSystem{}
-	fileTracker := fileTrackerGetter(doguConfigRegistry, fileSystem)
-	log.Println("delete old tracked files")
-	err = fileTracker.DeleteAllTrackedFiles()
-	if err != nil {
-		return err
+	var fileSystem filesystem = &copy.FileSystem{}
+	journalFileSystem := fileSystem
+	originalsPath := filepath.Join(*localConfigBaseDir, originalsDir)
+	var confinedFileSystem *copy.ConfinedFileSystem
+	if len(allowedRoots) > 0 {
+		confined, err := copy.NewConfinedFileSystem(allowedRoots)
+		if err != nil {
+			return err
+		}
+
+		// The targets are checked against the allowed roots only, but the originals are kept in the local config dir.
+		confinedFileSystem = &confined
+		fileSystem, err = copy.NewConfinedFileSystem(append(slices.Clone(allowedRoots), originalsPath))
+		if err != nil {
+			return err
+		}
+
+		// The rollback is confined like the run. Only the journal itself is written to the local config dir.
+		journalFileSystem, err = copy.NewConfinedFileSystem(append(slices.Clone(allowedRoots), *localConfigBaseDir))
+		if err != nil {
+			return err
+		}
 	}
 
-	volumeMountCopy := volumeMountCopyGetter(fileSystem, fileTracker)
+	journal := copy.NewJournal(filepath.Join(*localConfigBaseDir, journalFile), journalFileSystem, doguConfigRegistry)
+
+	if *dryRun {
+		log.Println("dry run: the filesystem and the local dogu config will not be modified")
+		fileSystem = copy.NewDryRunFileSystem(fileSystem)
+		doguConfigRegistry = copy.NewDryRunDoguConfig(doguConfigRegistry)
+	} else {
+		// A journal is left if a previous run was killed. Its modifications have to be rolled back first.
+		err = journal.Recover()
+		if err != nil {
+			return fmt.Errorf("failed to recover interrupted copy run: %w", err)
+		}
+	}
 
-	if len(sourcePaths) != len(targetPaths) {
-		return fmt.Errorf("amount of source and target paths aren't equal")
+	if *transactional && !*dryRun {
+		fileSystem = copy.NewTransactionalFileSystem(fileSystem, journal)
 	}
 
-	if len(sourcePaths) == 0 && len(targetPaths) == 0 {
-		log.Println("no source and target paths given")
-		return nil
+	fileTracker := fileTrackerGetter(doguConfigRegistry, fileSystem)
+
+	if len(sourcePaths) != len(targetPaths) {
+		return fmt.Errorf("amount of source and target paths aren't equal")
 	}
 
 	copyList := make([]copy.SrcAndDestination, 0, len(sourcePaths))
 	for i := range sourcePaths {
-		copyList = append(copyList, copy.SrcAndDestination{
+		mount := copy.SrcAndDestination{
 			Src:  sourcePaths[i],
 			Dest: targetPaths[i],
-		})
+		}
+
+		err = options.apply(i, &mount)
+		if err != nil {
+			return err
+		}
+
+		if confinedFileSystem != nil {
+			err = confinedFileSystem.CheckPath(mount.Dest)
+			if err != nil {
+				return fmt.Errorf("invalid target for source %s: %w", mount.Src, err)
+			}
+		}
+
+		copyList = append(copyList, mount)
 	}
 
-	err = volumeMountCopy.CopyVolumeMount(copyList)
-	if err != nil {
-		return err
+	run := func() error {
+		if len(copyList) == 0 {
+			log.Println("no source and target paths given")
+			log.Println("delete old tracked files")
+			return fileTracker.DeleteAllTrackedFiles()
+		}
+
+		globalConfig := copy.NewGlobalFileConfig(filepath.Join(*cesConfigBaseDir, globalConfigFile), fileSystem)
+		copyOptions := copy.Options{
+			PreserveMetadata: *preserveMetadata,
+			Concurrency:      *concurrency,
+			Quota: copy.Quota{
+				MaxFileSize: *globalMaxFileSize,
+				MaxBytes:    *globalMaxBytes,
+				MaxFiles:    *globalMaxFiles,
+			},
+			DryRun:           *dryRun,
+			TemplateRenderer: copy.NewTemplateRenderer(doguConfigRegistry, globalConfig),
+			DoguConfig:       doguConfigRegistry,
+			OriginalsDir:     originalsPath,
+		}
+		volumeMountCopy := volumeMountCopyGetter(fileSystem, fileTracker, copyOptions)
+		copyErr := volumeMountCopy.CopyVolumeMount(copyList)
+		if errors.Is(copyErr, copy.ErrVerificationFailed) || errors.Is(copyErr, copy.ErrValidationFailed) ||
+			errors.Is(copyErr, copy.ErrPreflightFailed) || errors.Is(copyErr, copy.ErrQuotaExceeded) {
+			// Nothing was copied, so all tracked files would be considered stale.
+			log.Println("skip deleting stale tracked files because the copy was aborted before any file was copied")
+			return copyErr
+		}
+
+		// Stale files are deleted even if the copy failed because their sources are not part of the mounts anymore.
+		log.Println("delete stale tracked files")
+		deleteErr := fileTracker.DeleteStaleTrackedFiles()
+
+		return errors.Join(copyErr, deleteErr)
 	}
 
-	return nil
+	if *transactional && !*dryRun {
+		return journal.Run(run)
+	}
+
+	return run()
 }
 
 type stringSliceFlag []string
@@ -115,8 +221,8 @@ func getfileTracker(doguConfigRegistry doguConfigReaderWriter, filesystem filesy
 	return copy.NewLocalConfigFileTracker(doguConfigRegistry, filesystem)
 }
 
-type copierGetter = func(filesystem filesystem, fileTracker fileTracker) volumeCopier
+type copierGetter = func(filesystem filesystem, fileTracker fileTracker, options copy.Options) volumeCopier
 
-func getCopier(filesystem filesystem, fileTracker fileTracker) volumeCopier {
-	return copy.NewVolumeMountCopier(filesystem, fileTracker)
+func getCopier(filesystem filesystem, fileTracker fileTracker, options copy.Options) volumeCopier {
+	return copy.NewVolumeMountCopier(filesystem, fileTracker, options)
 }
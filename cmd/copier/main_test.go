@@ -1,10 +1,16 @@
 package main
 
 import (
+	"errors"
 	"flag"
+	"fmt"
 	"github.com/cloudogu/dogu-additional-mounts-init/internal/copy"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"runtime"
 	"testing"
 )
 
@@ -17,7 +23,7 @@ func Test_handleCopyCommand(t *testing.T) {
 			{Src: "/src1", Dest: "/target1"}, {Src: "/src2", Dest: "/target2"},
 		}
 
-		getter := func(filesystem filesystem, fileTracker fileTracker) volumeCopier {
+		getter := func(filesystem filesystem, fileTracker fileTracker, options copy.Options) volumeCopier {
 			copier := newMockVolumeCopier(t)
 			copier.EXPECT().CopyVolumeMount(expectedCopyList).Return(nil)
 			return copier
@@ -28,7 +34,141 @@ func Test_handleCopyCommand(t *testing.T) {
 		}
 		trackerGetter := func(doguConfigRegistry doguConfigReaderWriter, filesystem filesystem) fileTracker {
 			tracker := newMockFileTracker(t)
-			tracker.EXPECT().DeleteAllTrackedFiles().Return(nil)
+			tracker.EXPECT().DeleteStaleTrackedFiles().Return(nil)
+			return tracker
+		}
+
+		// when
+		err := handleCopyCommand(args, getter, configGetter, trackerGetter)
+
+		// then
+		require.NoError(t, err)
+	})
+
+	t.Run("should pass global options to the copier", func(t *testing.T) {
+		// given
+		copyCmd = flag.NewFlagSet("copy", flag.ExitOnError)
+		args := []string{"--preserveMetadata", "--concurrency=8", "--globalMaxFileSize=1024", "--globalMaxBytes=4096", "--globalMaxFiles=10", "--source=/src1", "--target=/target1"}
+		expectedCopyList := []copy.SrcAndDestination{{Src: "/src1", Dest: "/target1"}}
+
+		getter := func(filesystem filesystem, fileTracker fileTracker, options copy.Options) volumeCopier {
+			assert.True(t, options.PreserveMetadata)
+			assert.Equal(t, 8, options.Concurrency)
+			assert.False(t, options.DryRun)
+			assert.NotNil(t, options.TemplateRenderer)
+			assert.NotNil(t, options.DoguConfig)
+			assert.Equal(t, copy.Quota{MaxFileSize: 1024, MaxBytes: 4096, MaxFiles: 10}, options.Quota)
+			assert.Equal(t, "/dogumount/var/ces/config/additionalMounts.originals", options.OriginalsDir)
+			copier := newMockVolumeCopier(t)
+			copier.EXPECT().CopyVolumeMount(expectedCopyList).Return(nil)
+			return copier
+		}
+
+		configGetter := func(cesConfigBaseDir, localConfigBaseDir string) (doguConfigReaderWriter, error) {
+			return newMockDoguConfigReaderWriter(t), nil
+		}
+		trackerGetter := func(doguConfigRegistry doguConfigReaderWriter, filesystem filesystem) fileTracker {
+			tracker := newMockFileTracker(t)
+			tracker.EXPECT().DeleteStaleTrackedFiles().Return(nil)
+			return tracker
+		}
+
+		// when
+		err := handleCopyCommand(args, getter, configGetter, trackerGetter)
+
+		// then
+		require.NoError(t, err)
+	})
+
+	t.Run("should pass mount options to the preceding source", func(t *testing.T) {
+		// given
+		copyCmd = flag.NewFlagSet("copy", flag.ExitOnError)
+		args := []string{"--source=/src1", "--target=/target1", "--source=/src2", "--owner=1000", "--fileMode=0600", "--target=/target2"}
+		owner := 1000
+		fileMode := os.FileMode(0600)
+		expectedCopyList := []copy.SrcAndDestination{
+			{Src: "/src1", Dest: "/target1"}, {Src: "/src2", Dest: "/target2", Owner: &owner, FileMode: &fileMode},
+		}
+
+		getter := func(filesystem filesystem, fileTracker fileTracker, options copy.Options) volumeCopier {
+			copier := newMockVolumeCopier(t)
+			copier.EXPECT().CopyVolumeMount(expectedCopyList).Return(nil)
+			return copier
+		}
+
+		configGetter := func(cesConfigBaseDir, localConfigBaseDir string) (doguConfigReaderWriter, error) {
+			return newMockDoguConfigReaderWriter(t), nil
+		}
+		trackerGetter := func(doguConfigRegistry doguConfigReaderWriter, filesystem filesystem) fileTracker {
+			tracker := newMockFileTracker(t)
+			tracker.EXPECT().DeleteStaleTrackedFiles().Return(nil)
+			return tracker
+		}
+
+		// when
+		err := handleCopyCommand(args, getter, configGetter, trackerGetter)
+
+		// then
+		require.NoError(t, err)
+	})
+
+	t.Run("should wrap filesystem and dogu config in dry run", func(t *testing.T) {
+		// given
+		copyCmd = flag.NewFlagSet("copy", flag.ExitOnError)
+		args := []string{"--dry-run", "--source=/src1", "--target=/target1"}
+		expectedCopyList := []copy.SrcAndDestination{{Src: "/src1", Dest: "/target1"}}
+
+		getter := func(filesystem filesystem, fileTracker fileTracker, options copy.Options) volumeCopier {
+			assert.IsType(t, copy.DryRunFileSystem{}, filesystem)
+			assert.True(t, options.DryRun)
+			copier := newMockVolumeCopier(t)
+			copier.EXPECT().CopyVolumeMount(expectedCopyList).Return(nil)
+			return copier
+		}
+
+		configGetter := func(cesConfigBaseDir, localConfigBaseDir string) (doguConfigReaderWriter, error) {
+			return newMockDoguConfigReaderWriter(t), nil
+		}
+		trackerGetter := func(doguConfigRegistry doguConfigReaderWriter, filesystem filesystem) fileTracker {
+			assert.IsType(t, copy.DryRunDoguConfig{}, doguConfigRegistry)
+			assert.IsType(t, copy.DryRunFileSystem{}, filesystem)
+			tracker := newMockFileTracker(t)
+			tracker.EXPECT().DeleteStaleTrackedFiles().Return(nil)
+			return tracker
+		}
+
+		// when
+		err := handleCopyCommand(args, getter, configGetter, trackerGetter)
+
+		// then
+		require.NoError(t, err)
+	})
+
+	t.Run("should confine the filesystem to the allowed roots", func(t *testing.T) {
+		if runtime.GOOS != "linux" {
+			t.Skip("confining the filesystem is only supported on linux")
+		}
+
+		// given
+		copyCmd = flag.NewFlagSet("copy", flag.ExitOnError)
+		args := []string{"--dryRun", "--allowedRoot=/var/lib", "--source=/src1", "--target=/var/lib/app"}
+		expectedCopyList := []copy.SrcAndDestination{{Src: "/src1", Dest: "/var/lib/app"}}
+
+		getter := func(filesystem filesystem, fileTracker fileTracker, options copy.Options) volumeCopier {
+			dryRunFileSystem, ok := filesystem.(copy.DryRunFileSystem)
+			require.True(t, ok)
+			assert.IsType(t, copy.ConfinedFileSystem{}, dryRunFileSystem.Filesystem)
+			copier := newMockVolumeCopier(t)
+			copier.EXPECT().CopyVolumeMount(expectedCopyList).Return(nil)
+			return copier
+		}
+
+		configGetter := func(cesConfigBaseDir, localConfigBaseDir string) (doguConfigReaderWriter, error) {
+			return newMockDoguConfigReaderWriter(t), nil
+		}
+		trackerGetter := func(doguConfigRegistry doguConfigReaderWriter, filesystem filesystem) fileTracker {
+			tracker := newMockFileTracker(t)
+			tracker.EXPECT().DeleteStaleTrackedFiles().Return(nil)
 			return tracker
 		}
 
@@ -39,6 +179,35 @@ func Test_handleCopyCommand(t *testing.T) {
 		require.NoError(t, err)
 	})
 
+	t.Run("should return error on target outside of the allowed roots", func(t *testing.T) {
+		if runtime.GOOS != "linux" {
+			t.Skip("confining the filesystem is only supported on linux")
+		}
+
+		// given
+		copyCmd = flag.NewFlagSet("copy", flag.ExitOnError)
+		args := []string{"--dryRun", "--allowedRoot=/var/lib/app", "--source=/src1", "--target=/var/lib/app/../other"}
+
+		getter := func(filesystem filesystem, fileTracker fileTracker, options copy.Options) volumeCopier {
+			return newMockVolumeCopier(t)
+		}
+
+		configGetter := func(cesConfigBaseDir, localConfigBaseDir string) (doguConfigReaderWriter, error) {
+			return newMockDoguConfigReaderWriter(t), nil
+		}
+		trackerGetter := func(doguConfigRegistry doguConfigReaderWriter, filesystem filesystem) fileTracker {
+			return newMockFileTracker(t)
+		}
+
+		// when
+		err := handleCopyCommand(args, getter, configGetter, trackerGetter)
+
+		// then
+		require.Error(t, err)
+		assert.ErrorIs(t, err, copy.ErrNotConfined)
+		assert.ErrorContains(t, err, "invalid target for source /src1")
+	})
+
 	t.Run("should return error on copy error", func(t *testing.T) {
 		// given
 		copyCmd = flag.NewFlagSet("copy", flag.ExitOnError)
@@ -46,7 +215,7 @@ func Test_handleCopyCommand(t *testing.T) {
 		expectedCopyList := []copy.SrcAndDestination{
 			{Src: "/src1", Dest: "/target1"}, {Src: "/src2", Dest: "/target2"},
 		}
-		getter := func(filesystem filesystem, fileTracker fileTracker) volumeCopier {
+		getter := func(filesystem filesystem, fileTracker fileTracker, options copy.Options) volumeCopier {
 			copier := newMockVolumeCopier(t)
 			copier.EXPECT().CopyVolumeMount(expectedCopyList).Return(assert.AnError)
 			return copier
@@ -57,7 +226,7 @@ func Test_handleCopyCommand(t *testing.T) {
 		}
 		trackerGetter := func(doguConfigRegistry doguConfigReaderWriter, filesystem filesystem) fileTracker {
 			tracker := newMockFileTracker(t)
-			tracker.EXPECT().DeleteAllTrackedFiles().Return(nil)
+			tracker.EXPECT().DeleteStaleTrackedFiles().Return(nil)
 			return tracker
 		}
 
@@ -73,7 +242,7 @@ func Test_handleCopyCommand(t *testing.T) {
 		copyCmd = flag.NewFlagSet("copy", flag.ExitOnError)
 		var args []string
 
-		getter := func(filesystem filesystem, fileTracker fileTracker) volumeCopier {
+		getter := func(filesystem filesystem, fileTracker fileTracker, options copy.Options) volumeCopier {
 			copier := newMockVolumeCopier(t)
 			return copier
 		}
@@ -99,17 +268,45 @@ func Test_handleCopyCommand(t *testing.T) {
 		copyCmd = flag.NewFlagSet("copy", flag.ExitOnError)
 		args := []string{"--source=/src1", "--target=/target1", "--source=/src2"}
 
-		getter := func(filesystem filesystem, fileTracker fileTracker) volumeCopier {
+		getter := func(filesystem filesystem, fileTracker fileTracker, options copy.Options) volumeCopier {
 			copier := newMockVolumeCopier(t)
 			return copier
 		}
 
+		configGetter := func(cesConfigBaseDir, localConfigBaseDir string) (doguConfigReaderWriter, error) {
+			return newMockDoguConfigReaderWriter(t), nil
+		}
+		trackerGetter := func(doguConfigRegistry doguConfigReaderWriter, filesystem filesystem) fileTracker {
+			return newMockFileTracker(t)
+		}
+
+		// when
+		err := handleCopyCommand(args, getter, configGetter, trackerGetter)
+
+		// then
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "amount of source and target paths aren't equal")
+	})
+
+	t.Run("should delete stale tracked files even on copy error", func(t *testing.T) {
+		// given
+		copyCmd = flag.NewFlagSet("copy", flag.ExitOnError)
+		args := []string{"--source=/src1", "--target=/target1"}
+		expectedCopyList := []copy.SrcAndDestination{{Src: "/src1", Dest: "/target1"}}
+		copyErr := errors.New("copy error")
+
+		getter := func(filesystem filesystem, fileTracker fileTracker, options copy.Options) volumeCopier {
+			copier := newMockVolumeCopier(t)
+			copier.EXPECT().CopyVolumeMount(expectedCopyList).Return(copyErr)
+			return copier
+		}
+
 		configGetter := func(cesConfigBaseDir, localConfigBaseDir string) (doguConfigReaderWriter, error) {
 			return newMockDoguConfigReaderWriter(t), nil
 		}
 		trackerGetter := func(doguConfigRegistry doguConfigReaderWriter, filesystem filesystem) fileTracker {
 			tracker := newMockFileTracker(t)
-			tracker.EXPECT().DeleteAllTrackedFiles().Return(nil)
+			tracker.EXPECT().DeleteStaleTrackedFiles().Return(assert.AnError)
 			return tracker
 		}
 
@@ -118,6 +315,208 @@ func Test_handleCopyCommand(t *testing.T) {
 
 		// then
 		require.Error(t, err)
-		assert.ErrorContains(t, err, "amount of source and target paths aren't equal")
+		assert.ErrorIs(t, err, copyErr)
+		assert.ErrorIs(t, err, assert.AnError)
+	})
+
+	t.Run("should not delete stale tracked files if the verification failed", func(t *testing.T) {
+		// given
+		copyCmd = flag.NewFlagSet("copy", flag.ExitOnError)
+		args := []string{"--source=/src1", "--verify=enforce", "--target=/target1"}
+		expectedCopyList := []copy.SrcAndDestination{{Src: "/src1", Dest: "/target1", Verify: copy.VerifyEnforce}}
+		copyErr := fmt.Errorf("%w: digest mismatch", copy.ErrVerificationFailed)
+
+		getter := func(filesystem filesystem, fileTracker fileTracker, options copy.Options) volumeCopier {
+			copier := newMockVolumeCopier(t)
+			copier.EXPECT().CopyVolumeMount(expectedCopyList).Return(copyErr)
+			return copier
+		}
+
+		configGetter := func(cesConfigBaseDir, localConfigBaseDir string) (doguConfigReaderWriter, error) {
+			return newMockDoguConfigReaderWriter(t), nil
+		}
+		trackerGetter := func(doguConfigRegistry doguConfigReaderWriter, filesystem filesystem) fileTracker {
+			return newMockFileTracker(t)
+		}
+
+		// when
+		err := handleCopyCommand(args, getter, configGetter, trackerGetter)
+
+		// then
+		require.Error(t, err)
+		assert.ErrorIs(t, err, copy.ErrVerificationFailed)
+	})
+
+	t.Run("should not delete stale tracked files if the certificate validation failed", func(t *testing.T) {
+		// given
+		copyCmd = flag.NewFlagSet("copy", flag.ExitOnError)
+		args := []string{"--source=/src1", "--validateCertificates=enforce", "--target=/target1"}
+		expectedCopyList := []copy.SrcAndDestination{{Src: "/src1", Dest: "/target1", ValidateCertificates: copy.ValidationEnforce}}
+		copyErr := fmt.Errorf("%w: certificate expired", copy.ErrValidationFailed)
+
+		getter := func(filesystem filesystem, fileTracker fileTracker, options copy.Options) volumeCopier {
+			copier := newMockVolumeCopier(t)
+			copier.EXPECT().CopyVolumeMount(expectedCopyList).Return(copyErr)
+			return copier
+		}
+
+		configGetter := func(cesConfigBaseDir, localConfigBaseDir string) (doguConfigReaderWriter, error) {
+			return newMockDoguConfigReaderWriter(t), nil
+		}
+		trackerGetter := func(doguConfigRegistry doguConfigReaderWriter, filesystem filesystem) fileTracker {
+			return newMockFileTracker(t)
+		}
+
+		// when
+		err := handleCopyCommand(args, getter, configGetter, trackerGetter)
+
+		// then
+		require.Error(t, err)
+		assert.ErrorIs(t, err, copy.ErrValidationFailed)
+	})
+
+	t.Run("should not delete stale tracked files if the capacity is insufficient", func(t *testing.T) {
+		// given
+		copyCmd = flag.NewFlagSet("copy", flag.ExitOnError)
+		args := []string{"--source=/src1", "--target=/target1"}
+		expectedCopyList := []copy.SrcAndDestination{{Src: "/src1", Dest: "/target1"}}
+		copyErr := fmt.Errorf("%w: volume is full", copy.ErrPreflightFailed)
+
+		getter := func(filesystem filesystem, fileTracker fileTracker, options copy.Options) volumeCopier {
+			copier := newMockVolumeCopier(t)
+			copier.EXPECT().CopyVolumeMount(expectedCopyList).Return(copyErr)
+			return copier
+		}
+
+		configGetter := func(cesConfigBaseDir, localConfigBaseDir string) (doguConfigReaderWriter, error) {
+			return newMockDoguConfigReaderWriter(t), nil
+		}
+		trackerGetter := func(doguConfigRegistry doguConfigReaderWriter, filesystem filesystem) fileTracker {
+			return newMockFileTracker(t)
+		}
+
+		// when
+		err := handleCopyCommand(args, getter, configGetter, trackerGetter)
+
+		// then
+		require.Error(t, err)
+		assert.ErrorIs(t, err, copy.ErrPreflightFailed)
+	})
+
+	t.Run("should not delete stale tracked files if a quota was exceeded", func(t *testing.T) {
+		// given
+		copyCmd = flag.NewFlagSet("copy", flag.ExitOnError)
+		args := []string{"--source=/src1", "--target=/target1"}
+		expectedCopyList := []copy.SrcAndDestination{{Src: "/src1", Dest: "/target1"}}
+		copyErr := fmt.Errorf("%w: too many files", copy.ErrQuotaExceeded)
+
+		getter := func(filesystem filesystem, fileTracker fileTracker, options copy.Options) volumeCopier {
+			copier := newMockVolumeCopier(t)
+			copier.EXPECT().CopyVolumeMount(expectedCopyList).Return(copyErr)
+			return copier
+		}
+
+		configGetter := func(cesConfigBaseDir, localConfigBaseDir string) (doguConfigReaderWriter, error) {
+			return newMockDoguConfigReaderWriter(t), nil
+		}
+		trackerGetter := func(doguConfigRegistry doguConfigReaderWriter, filesystem filesystem) fileTracker {
+			return newMockFileTracker(t)
+		}
+
+		// when
+		err := handleCopyCommand(args, getter, configGetter, trackerGetter)
+
+		// then
+		require.Error(t, err)
+		assert.ErrorIs(t, err, copy.ErrQuotaExceeded)
+	})
+
+	t.Run("should roll back a transactional run on copy error", func(t *testing.T) {
+		// given
+		copyCmd = flag.NewFlagSet("copy", flag.ExitOnError)
+		localConfigBaseDir := t.TempDir()
+		dest := filepath.Join(t.TempDir(), "file")
+		args := []string{"--localConfigBaseDir=" + localConfigBaseDir, "--transactional", "--source=/src1", "--target=/target1"}
+		expectedCopyList := []copy.SrcAndDestination{{Src: "/src1", Dest: "/target1"}}
+
+		getter := func(filesystem filesystem, fileTracker fileTracker, options copy.Options) volumeCopier {
+			assert.IsType(t, copy.TransactionalFileSystem{}, filesystem)
+			copier := newMockVolumeCopier(t)
+			copier.EXPECT().CopyVolumeMount(expectedCopyList).RunAndReturn(func([]copy.SrcAndDestination) error {
+				file, err := filesystem.Create(dest)
+				require.NoError(t, err)
+				require.NoError(t, file.Close())
+				return assert.AnError
+			})
+			return copier
+		}
+
+		configGetter := func(cesConfigBaseDir, localConfigBaseDir string) (doguConfigReaderWriter, error) {
+			doguConfig := newMockDoguConfigReaderWriter(t)
+			doguConfig.EXPECT().Exists(mock.Anything).Return(false, nil)
+			return doguConfig, nil
+		}
+		trackerGetter := func(doguConfigRegistry doguConfigReaderWriter, filesystem filesystem) fileTracker {
+			tracker := newMockFileTracker(t)
+			tracker.EXPECT().DeleteStaleTrackedFiles().Return(nil)
+			return tracker
+		}
+
+		// when
+		err := handleCopyCommand(args, getter, configGetter, trackerGetter)
+
+		// then
+		require.ErrorIs(t, err, assert.AnError)
+		assert.NoFileExists(t, dest)
+		assert.NoFileExists(t, filepath.Join(localConfigBaseDir, journalFile))
+	})
+
+	t.Run("should recover an interrupted run before copying", func(t *testing.T) {
+		// given
+		copyCmd = flag.NewFlagSet("copy", flag.ExitOnError)
+		localConfigBaseDir := t.TempDir()
+		leftover := filepath.Join(t.TempDir(), ".file.tmp")
+		require.NoError(t, os.WriteFile(leftover, []byte("partial"), 0644))
+		journal := `{"op":"begin","config":{}}` + "\n" + `{"op":"create","path":"` + leftover + `"}` + "\n"
+		require.NoError(t, os.WriteFile(filepath.Join(localConfigBaseDir, journalFile), []byte(journal), 0600))
+		args := []string{"--localConfigBaseDir=" + localConfigBaseDir, "--source=/src1", "--target=/target1"}
+
+		getter := func(filesystem filesystem, fileTracker fileTracker, options copy.Options) volumeCopier {
+			copier := newMockVolumeCopier(t)
+			copier.EXPECT().CopyVolumeMount(mock.Anything).Return(nil)
+			return copier
+		}
+
+		configGetter := func(cesConfigBaseDir, localConfigBaseDir string) (doguConfigReaderWriter, error) {
+			doguConfig := newMockDoguConfigReaderWriter(t)
+			doguConfig.EXPECT().Exists(mock.Anything).Return(false, nil)
+			return doguConfig, nil
+		}
+		trackerGetter := func(doguConfigRegistry doguConfigReaderWriter, filesystem filesystem) fileTracker {
+			tracker := newMockFileTracker(t)
+			tracker.EXPECT().DeleteStaleTrackedFiles().Return(nil)
+			return tracker
+		}
+
+		// when
+		err := handleCopyCommand(args, getter, configGetter, trackerGetter)
+
+		// then
+		require.NoError(t, err)
+		assert.NoFileExists(t, leftover)
+		assert.NoFileExists(t, filepath.Join(localConfigBaseDir, journalFile))
+	})
+
+	t.Run("should return error on invalid concurrency", func(t *testing.T) {
+		// given
+		copyCmd = flag.NewFlagSet("copy", flag.ExitOnError)
+		args := []string{"--concurrency=0", "--source=/src1", "--target=/target1"}
+
+		// when
+		err := handleCopyCommand(args, nil, nil, nil)
+
+		// then
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "concurrency must be at least 1 but is 0")
 	})
 }
@@ -3,11 +3,15 @@
 package main
 
 import (
+	copy "github.com/cloudogu/dogu-additional-mounts-init/internal/copy"
+
 	io "io"
 	fs "io/fs"
 
 	os "os"
 
+	time "time"
+
 	mock "github.com/stretchr/testify/mock"
 )
 
@@ -24,6 +28,149 @@ func (_m *mockFilesystem) EXPECT() *mockFilesystem_Expecter {
 	return &mockFilesystem_Expecter{mock: &_m.Mock}
 }
 
+// Chmod provides a mock function with given fields: name, mode
+func (_m *mockFilesystem) Chmod(name string, mode fs.FileMode) error {
+	ret := _m.Called(name, mode)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Chmod")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, fs.FileMode) error); ok {
+		r0 = rf(name, mode)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// mockFilesystem_Chmod_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Chmod'
+type mockFilesystem_Chmod_Call struct {
+	*mock.Call
+}
+
+// Chmod is a helper method to define mock.On call
+//   - name string
+//   - mode fs.FileMode
+func (_e *mockFilesystem_Expecter) Chmod(name interface{}, mode interface{}) *mockFilesystem_Chmod_Call {
+	return &mockFilesystem_Chmod_Call{Call: _e.mock.On("Chmod", name, mode)}
+}
+
+func (_c *mockFilesystem_Chmod_Call) Run(run func(name string, mode fs.FileMode)) *mockFilesystem_Chmod_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(string), args[1].(fs.FileMode))
+	})
+	return _c
+}
+
+func (_c *mockFilesystem_Chmod_Call) Return(_a0 error) *mockFilesystem_Chmod_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *mockFilesystem_Chmod_Call) RunAndReturn(run func(string, fs.FileMode) error) *mockFilesystem_Chmod_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// Chown provides a mock function with given fields: name, uid, gid
+func (_m *mockFilesystem) Chown(name string, uid int, gid int) error {
+	ret := _m.Called(name, uid, gid)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Chown")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, int, int) error); ok {
+		r0 = rf(name, uid, gid)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// mockFilesystem_Chown_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Chown'
+type mockFilesystem_Chown_Call struct {
+	*mock.Call
+}
+
+// Chown is a helper method to define mock.On call
+//   - name string
+//   - uid int
+//   - gid int
+func (_e *mockFilesystem_Expecter) Chown(name interface{}, uid interface{}, gid interface{}) *mockFilesystem_Chown_Call {
+	return &mockFilesystem_Chown_Call{Call: _e.mock.On("Chown", name, uid, gid)}
+}
+
+func (_c *mockFilesystem_Chown_Call) Run(run func(name string, uid int, gid int)) *mockFilesystem_Chown_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(string), args[1].(int), args[2].(int))
+	})
+	return _c
+}
+
+func (_c *mockFilesystem_Chown_Call) Return(_a0 error) *mockFilesystem_Chown_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *mockFilesystem_Chown_Call) RunAndReturn(run func(string, int, int) error) *mockFilesystem_Chown_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// Chtimes provides a mock function with given fields: name, atime, mtime
+func (_m *mockFilesystem) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	ret := _m.Called(name, atime, mtime)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Chtimes")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, time.Time, time.Time) error); ok {
+		r0 = rf(name, atime, mtime)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// mockFilesystem_Chtimes_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Chtimes'
+type mockFilesystem_Chtimes_Call struct {
+	*mock.Call
+}
+
+// Chtimes is a helper method to define mock.On call
+//   - name string
+//   - atime time.Time
+//   - mtime time.Time
+func (_e *mockFilesystem_Expecter) Chtimes(name interface{}, atime interface{}, mtime interface{}) *mockFilesystem_Chtimes_Call {
+	return &mockFilesystem_Chtimes_Call{Call: _e.mock.On("Chtimes", name, atime, mtime)}
+}
+
+func (_c *mockFilesystem_Chtimes_Call) Run(run func(name string, atime time.Time, mtime time.Time)) *mockFilesystem_Chtimes_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(string), args[1].(time.Time), args[2].(time.Time))
+	})
+	return _c
+}
+
+func (_c *mockFilesystem_Chtimes_Call) Return(_a0 error) *mockFilesystem_Chtimes_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *mockFilesystem_Chtimes_Call) RunAndReturn(run func(string, time.Time, time.Time) error) *mockFilesystem_Chtimes_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // CloseFile provides a mock function with given fields: file
 func (_m *mockFilesystem) CloseFile(file *os.File) error {
 	ret := _m.Called(file)
@@ -71,7 +218,7 @@ func (_c *mockFilesystem_CloseFile_Call) RunAndReturn(run func(*os.File) error)
 }
 
 // Copy provides a mock function with given fields: dst, src
-func (_m *mockFilesystem) Copy(dst io.Writer, src io.Reader) (int64, error) {
+func (_m *mockFilesystem) Copy(dst io.Writer, src io.Reader) (int64, copy.CopyMethod, error) {
 	ret := _m.Called(dst, src)
 
 	if len(ret) == 0 {
@@ -79,8 +226,9 @@ func (_m *mockFilesystem) Copy(dst io.Writer, src io.Reader) (int64, error) {
 	}
 
 	var r0 int64
-	var r1 error
-	if rf, ok := ret.Get(0).(func(io.Writer, io.Reader) (int64, error)); ok {
+	var r1 copy.CopyMethod
+	var r2 error
+	if rf, ok := ret.Get(0).(func(io.Writer, io.Reader) (int64, copy.CopyMethod, error)); ok {
 		return rf(dst, src)
 	}
 	if rf, ok := ret.Get(0).(func(io.Writer, io.Reader) int64); ok {
@@ -89,13 +237,19 @@ func (_m *mockFilesystem) Copy(dst io.Writer, src io.Reader) (int64, error) {
 		r0 = ret.Get(0).(int64)
 	}
 
-	if rf, ok := ret.Get(1).(func(io.Writer, io.Reader) error); ok {
+	if rf, ok := ret.Get(1).(func(io.Writer, io.Reader) copy.CopyMethod); ok {
 		r1 = rf(dst, src)
 	} else {
-		r1 = ret.Error(1)
+		r1 = ret.Get(1).(copy.CopyMethod)
 	}
 
-	return r0, r1
+	if rf, ok := ret.Get(2).(func(io.Writer, io.Reader) error); ok {
+		r2 = rf(dst, src)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
 }
 
 // mockFilesystem_Copy_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Copy'
@@ -117,12 +271,12 @@ func (_c *mockFilesystem_Copy_Call) Run(run func(dst io.Writer, src io.Reader))
 	return _c
 }
 
-func (_c *mockFilesystem_Copy_Call) Return(written int64, err error) *mockFilesystem_Copy_Call {
-	_c.Call.Return(written, err)
+func (_c *mockFilesystem_Copy_Call) Return(written int64, method copy.CopyMethod, err error) *mockFilesystem_Copy_Call {
+	_c.Call.Return(written, method, err)
 	return _c
 }
 
-func (_c *mockFilesystem_Copy_Call) RunAndReturn(run func(io.Writer, io.Reader) (int64, error)) *mockFilesystem_Copy_Call {
+func (_c *mockFilesystem_Copy_Call) RunAndReturn(run func(io.Writer, io.Reader) (int64, copy.CopyMethod, error)) *mockFilesystem_Copy_Call {
 	_c.Call.Return(run)
 	return _c
 }
@@ -287,6 +441,53 @@ func (_c *mockFilesystem_EvalSymlinks_Call) RunAndReturn(run func(string) (strin
 	return _c
 }
 
+// Link provides a mock function with given fields: oldname, newname
+func (_m *mockFilesystem) Link(oldname string, newname string) error {
+	ret := _m.Called(oldname, newname)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Link")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, string) error); ok {
+		r0 = rf(oldname, newname)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// mockFilesystem_Link_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Link'
+type mockFilesystem_Link_Call struct {
+	*mock.Call
+}
+
+// Link is a helper method to define mock.On call
+//   - oldname string
+//   - newname string
+func (_e *mockFilesystem_Expecter) Link(oldname interface{}, newname interface{}) *mockFilesystem_Link_Call {
+	return &mockFilesystem_Link_Call{Call: _e.mock.On("Link", oldname, newname)}
+}
+
+func (_c *mockFilesystem_Link_Call) Run(run func(oldname string, newname string)) *mockFilesystem_Link_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(string), args[1].(string))
+	})
+	return _c
+}
+
+func (_c *mockFilesystem_Link_Call) Return(_a0 error) *mockFilesystem_Link_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *mockFilesystem_Link_Call) RunAndReturn(run func(string, string) error) *mockFilesystem_Link_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // Lstat provides a mock function with given fields: path
 func (_m *mockFilesystem) Lstat(path string) (fs.FileInfo, error) {
 	ret := _m.Called(path)
@@ -450,6 +651,215 @@ func (_c *mockFilesystem_Open_Call) RunAndReturn(run func(string) (*os.File, err
 	return _c
 }
 
+// OpenFile provides a mock function with given fields: name, flag, perm
+func (_m *mockFilesystem) OpenFile(name string, flag int, perm fs.FileMode) (*os.File, error) {
+	ret := _m.Called(name, flag, perm)
+
+	if len(ret) == 0 {
+		panic("no return value specified for OpenFile")
+	}
+
+	var r0 *os.File
+	var r1 error
+	if rf, ok := ret.Get(0).(func(string, int, fs.FileMode) (*os.File, error)); ok {
+		return rf(name, flag, perm)
+	}
+	if rf, ok := ret.Get(0).(func(string, int, fs.FileMode) *os.File); ok {
+		r0 = rf(name, flag, perm)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*os.File)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(string, int, fs.FileMode) error); ok {
+		r1 = rf(name, flag, perm)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// mockFilesystem_OpenFile_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'OpenFile'
+type mockFilesystem_OpenFile_Call struct {
+	*mock.Call
+}
+
+// OpenFile is a helper method to define mock.On call
+//   - name string
+//   - flag int
+//   - perm fs.FileMode
+func (_e *mockFilesystem_Expecter) OpenFile(name interface{}, flag interface{}, perm interface{}) *mockFilesystem_OpenFile_Call {
+	return &mockFilesystem_OpenFile_Call{Call: _e.mock.On("OpenFile", name, flag, perm)}
+}
+
+func (_c *mockFilesystem_OpenFile_Call) Run(run func(name string, flag int, perm fs.FileMode)) *mockFilesystem_OpenFile_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(string), args[1].(int), args[2].(fs.FileMode))
+	})
+	return _c
+}
+
+func (_c *mockFilesystem_OpenFile_Call) Return(_a0 *os.File, _a1 error) *mockFilesystem_OpenFile_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *mockFilesystem_OpenFile_Call) RunAndReturn(run func(string, int, fs.FileMode) (*os.File, error)) *mockFilesystem_OpenFile_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// Readlink provides a mock function with given fields: name
+func (_m *mockFilesystem) Readlink(name string) (string, error) {
+	ret := _m.Called(name)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Readlink")
+	}
+
+	var r0 string
+	var r1 error
+	if rf, ok := ret.Get(0).(func(string) (string, error)); ok {
+		return rf(name)
+	}
+	if rf, ok := ret.Get(0).(func(string) string); ok {
+		r0 = rf(name)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(name)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// mockFilesystem_Readlink_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Readlink'
+type mockFilesystem_Readlink_Call struct {
+	*mock.Call
+}
+
+// Readlink is a helper method to define mock.On call
+//   - name string
+func (_e *mockFilesystem_Expecter) Readlink(name interface{}) *mockFilesystem_Readlink_Call {
+	return &mockFilesystem_Readlink_Call{Call: _e.mock.On("Readlink", name)}
+}
+
+func (_c *mockFilesystem_Readlink_Call) Run(run func(name string)) *mockFilesystem_Readlink_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(string))
+	})
+	return _c
+}
+
+func (_c *mockFilesystem_Readlink_Call) Return(_a0 string, _a1 error) *mockFilesystem_Readlink_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *mockFilesystem_Readlink_Call) RunAndReturn(run func(string) (string, error)) *mockFilesystem_Readlink_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// RemoveDir provides a mock function with given fields: path
+func (_m *mockFilesystem) RemoveDir(path string) error {
+	ret := _m.Called(path)
+
+	if len(ret) == 0 {
+		panic("no return value specified for RemoveDir")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string) error); ok {
+		r0 = rf(path)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// mockFilesystem_RemoveDir_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'RemoveDir'
+type mockFilesystem_RemoveDir_Call struct {
+	*mock.Call
+}
+
+// RemoveDir is a helper method to define mock.On call
+//   - path string
+func (_e *mockFilesystem_Expecter) RemoveDir(path interface{}) *mockFilesystem_RemoveDir_Call {
+	return &mockFilesystem_RemoveDir_Call{Call: _e.mock.On("RemoveDir", path)}
+}
+
+func (_c *mockFilesystem_RemoveDir_Call) Run(run func(path string)) *mockFilesystem_RemoveDir_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(string))
+	})
+	return _c
+}
+
+func (_c *mockFilesystem_RemoveDir_Call) Return(_a0 error) *mockFilesystem_RemoveDir_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *mockFilesystem_RemoveDir_Call) RunAndReturn(run func(string) error) *mockFilesystem_RemoveDir_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// Rename provides a mock function with given fields: oldPath, newPath
+func (_m *mockFilesystem) Rename(oldPath string, newPath string) error {
+	ret := _m.Called(oldPath, newPath)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Rename")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, string) error); ok {
+		r0 = rf(oldPath, newPath)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// mockFilesystem_Rename_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Rename'
+type mockFilesystem_Rename_Call struct {
+	*mock.Call
+}
+
+// Rename is a helper method to define mock.On call
+//   - oldPath string
+//   - newPath string
+func (_e *mockFilesystem_Expecter) Rename(oldPath interface{}, newPath interface{}) *mockFilesystem_Rename_Call {
+	return &mockFilesystem_Rename_Call{Call: _e.mock.On("Rename", oldPath, newPath)}
+}
+
+func (_c *mockFilesystem_Rename_Call) Run(run func(oldPath string, newPath string)) *mockFilesystem_Rename_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(string), args[1].(string))
+	})
+	return _c
+}
+
+func (_c *mockFilesystem_Rename_Call) Return(_a0 error) *mockFilesystem_Rename_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *mockFilesystem_Rename_Call) RunAndReturn(run func(string, string) error) *mockFilesystem_Rename_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // SameFile provides a mock function with given fields: fi1, fi2
 func (_m *mockFilesystem) SameFile(fi1 fs.FileInfo, fi2 fs.FileInfo) bool {
 	ret := _m.Called(fi1, fi2)
@@ -555,6 +965,155 @@ func (_c *mockFilesystem_Stat_Call) RunAndReturn(run func(string) (fs.FileInfo,
 	return _c
 }
 
+// Statfs provides a mock function with given fields: path
+func (_m *mockFilesystem) Statfs(path string) (copy.FilesystemStats, error) {
+	ret := _m.Called(path)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Statfs")
+	}
+
+	var r0 copy.FilesystemStats
+	var r1 error
+	if rf, ok := ret.Get(0).(func(string) (copy.FilesystemStats, error)); ok {
+		return rf(path)
+	}
+	if rf, ok := ret.Get(0).(func(string) copy.FilesystemStats); ok {
+		r0 = rf(path)
+	} else {
+		r0 = ret.Get(0).(copy.FilesystemStats)
+	}
+
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(path)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// mockFilesystem_Statfs_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Statfs'
+type mockFilesystem_Statfs_Call struct {
+	*mock.Call
+}
+
+// Statfs is a helper method to define mock.On call
+//   - path string
+func (_e *mockFilesystem_Expecter) Statfs(path interface{}) *mockFilesystem_Statfs_Call {
+	return &mockFilesystem_Statfs_Call{Call: _e.mock.On("Statfs", path)}
+}
+
+func (_c *mockFilesystem_Statfs_Call) Run(run func(path string)) *mockFilesystem_Statfs_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(string))
+	})
+	return _c
+}
+
+func (_c *mockFilesystem_Statfs_Call) Return(_a0 copy.FilesystemStats, _a1 error) *mockFilesystem_Statfs_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *mockFilesystem_Statfs_Call) RunAndReturn(run func(string) (copy.FilesystemStats, error)) *mockFilesystem_Statfs_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// Symlink provides a mock function with given fields: oldname, newname
+func (_m *mockFilesystem) Symlink(oldname string, newname string) error {
+	ret := _m.Called(oldname, newname)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Symlink")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, string) error); ok {
+		r0 = rf(oldname, newname)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// mockFilesystem_Symlink_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Symlink'
+type mockFilesystem_Symlink_Call struct {
+	*mock.Call
+}
+
+// Symlink is a helper method to define mock.On call
+//   - oldname string
+//   - newname string
+func (_e *mockFilesystem_Expecter) Symlink(oldname interface{}, newname interface{}) *mockFilesystem_Symlink_Call {
+	return &mockFilesystem_Symlink_Call{Call: _e.mock.On("Symlink", oldname, newname)}
+}
+
+func (_c *mockFilesystem_Symlink_Call) Run(run func(oldname string, newname string)) *mockFilesystem_Symlink_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(string), args[1].(string))
+	})
+	return _c
+}
+
+func (_c *mockFilesystem_Symlink_Call) Return(_a0 error) *mockFilesystem_Symlink_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *mockFilesystem_Symlink_Call) RunAndReturn(run func(string, string) error) *mockFilesystem_Symlink_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// SyncDir provides a mock function with given fields: path
+func (_m *mockFilesystem) SyncDir(path string) error {
+	ret := _m.Called(path)
+
+	if len(ret) == 0 {
+		panic("no return value specified for SyncDir")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string) error); ok {
+		r0 = rf(path)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// mockFilesystem_SyncDir_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'SyncDir'
+type mockFilesystem_SyncDir_Call struct {
+	*mock.Call
+}
+
+// SyncDir is a helper method to define mock.On call
+//   - path string
+func (_e *mockFilesystem_Expecter) SyncDir(path interface{}) *mockFilesystem_SyncDir_Call {
+	return &mockFilesystem_SyncDir_Call{Call: _e.mock.On("SyncDir", path)}
+}
+
+func (_c *mockFilesystem_SyncDir_Call) Run(run func(path string)) *mockFilesystem_SyncDir_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(string))
+	})
+	return _c
+}
+
+func (_c *mockFilesystem_SyncDir_Call) Return(_a0 error) *mockFilesystem_SyncDir_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *mockFilesystem_SyncDir_Call) RunAndReturn(run func(string) error) *mockFilesystem_SyncDir_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // SyncFile provides a mock function with given fields: file
 func (_m *mockFilesystem) SyncFile(file *os.File) error {
 	ret := _m.Called(file)
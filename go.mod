@@ -3,9 +3,13 @@ module github.com/cloudogu/dogu-additional-mounts-init
 go 1.24.2
 
 require (
+	github.com/bmatcuk/doublestar/v4 v4.8.1
 	github.com/cloudogu/doguctl v0.13.2
+	github.com/klauspost/compress v1.18.0
 	github.com/stretchr/testify v1.10.0
+	golang.org/x/sys v0.33.0
 	gopkg.in/yaml.v3 v3.0.1
+	software.sslmate.com/src/go-pkcs12 v0.5.0
 )
 
 require (
@@ -25,5 +29,5 @@ require (
 	go.etcd.io/etcd/api/v3 v3.6.0 // indirect
 	go.etcd.io/etcd/client/pkg/v3 v3.6.0 // indirect
 	go.etcd.io/etcd/client/v2 v2.305.21 // indirect
-	golang.org/x/sys v0.33.0 // indirect
+	golang.org/x/crypto v0.11.0 // indirect
 )
@@ -0,0 +1,345 @@
+package copy
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"path"
+	"slices"
+	"strings"
+)
+
+// fragment is a source file which is assembled into a destination file.
+type fragment struct {
+	mount SrcAndDestination
+	// mountIndex orders fragments of mounts with the same priority and path.
+	mountIndex int
+	rel        string
+	filePath   string
+}
+
+// assembly contains all mounts whose files are assembled into the same destination.
+type assembly struct {
+	dest   string
+	mounts []SrcAndDestination
+}
+
+// splitAssemblies separates the mounts which are copied one-to-one from the mounts assembled into destination files.
+// The assemblies are grouped by their destination in the order of their first mount.
+func splitAssemblies(srcToDest []SrcAndDestination) ([]SrcAndDestination, []*assembly) {
+	return groupByDestination(srcToDest, func(mount SrcAndDestination) bool {
+		return mount.Assemble
+	})
+}
+
+// groupByDestination separates the selected mounts from the other ones and groups them by their destination in the
+// order of their first mount.
+func groupByDestination(srcToDest []SrcAndDestination, selected func(SrcAndDestination) bool) ([]SrcAndDestination, []*assembly) {
+	var mounts []SrcAndDestination
+	var assemblies []*assembly
+	byDest := map[string]*assembly{}
+	for _, mount := range srcToDest {
+		if !selected(mount) {
+			mounts = append(mounts, mount)
+			continue
+		}
+
+		dest := path.Clean(mount.Dest)
+		group, ok := byDest[dest]
+		if !ok {
+			group = &assembly{dest: dest}
+			byDest[dest] = group
+			assemblies = append(assemblies, group)
+		}
+
+		group.mounts = append(group.mounts, mount)
+	}
+
+	return mounts, assemblies
+}
+
+// getHeaderAndSeparator returns the header and the separator defined by the mounts of the assembly.
+// Mounts may omit them, but different values are rejected.
+func (a *assembly) getHeaderAndSeparator() (string, string, error) {
+	var header, separator string
+	for _, mount := range a.mounts {
+		if mount.AssembleHeader != "" {
+			if header != "" && header != mount.AssembleHeader {
+				return "", "", fmt.Errorf("mounts of assembled file %s define different headers", a.dest)
+			}
+
+			header = mount.AssembleHeader
+		}
+
+		if mount.AssembleSeparator != "" {
+			if separator != "" && separator != mount.AssembleSeparator {
+				return "", "", fmt.Errorf("mounts of assembled file %s define different separators", a.dest)
+			}
+
+			separator = mount.AssembleSeparator
+		}
+	}
+
+	return header, separator, nil
+}
+
+// getDestinationMount returns a mount with the owner, group, modes, conflict policy and backup suffix defined by the
+// mounts of the assembly, which are applied to the destination file. Mounts may omit them, but different values are
+// rejected. description names the kind of the destination in errors.
+func (a *assembly) getDestinationMount(description string) (SrcAndDestination, error) {
+	destMount := SrcAndDestination{Dest: a.dest}
+	for _, mount := range a.mounts {
+		if !mergePointer(&destMount.Owner, mount.Owner) {
+			return SrcAndDestination{}, fmt.Errorf("mounts of %s %s define different owners", description, a.dest)
+		}
+
+		if !mergePointer(&destMount.Group, mount.Group) {
+			return SrcAndDestination{}, fmt.Errorf("mounts of %s %s define different groups", description, a.dest)
+		}
+
+		if !mergePointer(&destMount.FileMode, mount.FileMode) {
+			return SrcAndDestination{}, fmt.Errorf("mounts of %s %s define different file modes", description, a.dest)
+		}
+
+		if !mergePointer(&destMount.DirMode, mount.DirMode) {
+			return SrcAndDestination{}, fmt.Errorf("mounts of %s %s define different dir modes", description, a.dest)
+		}
+
+		if !mergeValue(&destMount.Conflict, mount.Conflict) {
+			return SrcAndDestination{}, fmt.Errorf("mounts of %s %s define different conflict policies", description, a.dest)
+		}
+
+		if !mergeValue(&destMount.BackupSuffix, mount.BackupSuffix) {
+			return SrcAndDestination{}, fmt.Errorf("mounts of %s %s define different backup suffixes", description, a.dest)
+		}
+	}
+
+	return destMount, nil
+}
+
+// mergePointer sets merged to the value unless the value is nil. It returns false if merged points to a different value.
+func mergePointer[T comparable](merged **T, value *T) bool {
+	if value == nil {
+		return true
+	}
+
+	if *merged != nil && **merged != *value {
+		return false
+	}
+
+	*merged = value
+	return true
+}
+
+// mergeValue sets merged to the value unless the value is empty. It returns false if merged has a different value.
+func mergeValue[T comparable](merged *T, value T) bool {
+	var empty T
+	if value == empty {
+		return true
+	}
+
+	if *merged != empty && *merged != value {
+		return false
+	}
+
+	*merged = value
+	return true
+}
+
+// assembleFiles collects the fragments of every destination file and submits its assembly to the pool.
+func (v *VolumeMountCopier) assembleFiles(assemblies []*assembly, pool *workerPool) error {
+	var multiErr []error
+	for _, group := range assemblies {
+		fragments, err := v.getFragments(group)
+		if err != nil {
+			v.summary.addFailed()
+			multiErr = append(multiErr, fmt.Errorf("failed to assemble file %s: %w", group.dest, err))
+			continue
+		}
+
+		pool.submit(func() error {
+			err := v.assembleFile(group, fragments)
+			if err != nil {
+				v.summary.addFailed()
+				return fmt.Errorf("failed to assemble file %s: %w", group.dest, err)
+			}
+
+			return nil
+		})
+	}
+
+	return errors.Join(multiErr...)
+}
+
+// assembleFile concatenates the fragments of all mounts of the assembly and writes them to the destination file.
+// The fragments are ordered by the priority of their mount and lexically by their path relative to the source.
+// The header is written first and the separator between the fragments. Every fragment, the header and the separator
+// end with a line break. The existing destination file is handled like a copied file.
+func (v *VolumeMountCopier) assembleFile(group *assembly, fragments []fragment) error {
+	header, separator, err := group.getHeaderAndSeparator()
+	if err != nil {
+		return err
+	}
+
+	destMount, err := group.getDestinationMount("assembled file")
+	if err != nil {
+		return err
+	}
+
+	var content bytes.Buffer
+	appendLines(&content, []byte(header))
+	for i, f := range fragments {
+		if i > 0 {
+			appendLines(&content, []byte(separator))
+		}
+
+		var fragmentContent *bytes.Buffer
+		if f.mount.isTemplate(f.filePath) {
+			if v.options.TemplateRenderer == nil {
+				return fmt.Errorf("failed to render template %s because no template renderer is configured", f.filePath)
+			}
+
+			fragmentContent, err = v.options.TemplateRenderer.render(f.filePath, v.fileSystem)
+		} else {
+			fragmentContent, err = readFile(f.filePath, v.fileSystem)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		appendLines(&content, fragmentContent.Bytes())
+	}
+
+	log.Printf("Assembled %d fragment(s) for file %s", len(fragments), group.dest)
+
+	return v.writeGeneratedFile(destMount, "fragments of "+group.dest, group.dest, content.Bytes())
+}
+
+// getFragments returns the ordered fragments of all mounts of the assembly.
+func (v *VolumeMountCopier) getFragments(group *assembly) ([]fragment, error) {
+	var fragments []fragment
+	for i, mount := range group.mounts {
+		files, err := v.getSourceFiles(mount.Src, SymlinkSkip)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, rel := range slices.Sorted(maps.Keys(files)) {
+			filePath := files[rel]
+			if mount.isManifest(rel) {
+				continue
+			}
+
+			if !mount.isIncluded(rel) {
+				log.Printf("skip fragment %s because it does not match the include and exclude patterns", filePath)
+				v.summary.addFiltered()
+				continue
+			}
+
+			fragments = append(fragments, fragment{mount: mount, mountIndex: i, rel: rel, filePath: filePath})
+		}
+	}
+
+	slices.SortFunc(fragments, func(a, b fragment) int {
+		return cmp.Or(
+			cmp.Compare(a.mount.Priority, b.mount.Priority),
+			strings.Compare(a.rel, b.rel),
+			cmp.Compare(a.mountIndex, b.mountIndex),
+		)
+	})
+
+	return fragments, nil
+}
+
+// appendLines appends the content and a line break if the content does not end with one.
+func appendLines(buffer *bytes.Buffer, content []byte) {
+	if len(content) == 0 {
+		return
+	}
+
+	buffer.Write(content)
+	if !bytes.HasSuffix(content, []byte("\n")) {
+		buffer.WriteByte('\n')
+	}
+}
+
+// writeGeneratedFile writes the content generated from the source to the destination file. The existing destination
+// file is handled like a copied file according to the conflict policy of the mount.
+func (v *VolumeMountCopier) writeGeneratedFile(mount SrcAndDestination, source, dest string, content []byte) error {
+	// The content is generated, so the metadata of the sources is not preserved.
+	attributes := FileAttributes{
+		Owner:    mount.Owner,
+		Group:    mount.Group,
+		FileMode: mount.FileMode,
+		DirMode:  mount.DirMode,
+	}
+
+	unlock := v.destinationLocks.lock(dest)
+	defer unlock()
+
+	destFileInfo, err := v.fileSystem.Stat(dest)
+	destExists := err == nil
+	if destExists {
+		if !destFileInfo.Mode().IsRegular() {
+			return fmt.Errorf("destination file %s exists and is not a regular file", dest)
+		}
+
+		conflict, err := v.isConflict(dest)
+		if err != nil {
+			return err
+		}
+
+		existing, err := readFile(dest, v.fileSystem)
+		if err != nil {
+			return err
+		}
+
+		unchanged := bytes.Equal(existing.Bytes(), content)
+		switch {
+		case conflict && (mount.conflictPolicy() != ConflictOverwrite || !unchanged):
+			write, err := v.resolveConflict(mount, source, dest)
+			if err != nil || !write {
+				return err
+			}
+
+			destExists = false
+		case conflict:
+			log.Printf("skip %s because the existing destination file has the same content", source)
+			v.summary.addUnchanged()
+			return nil
+		case unchanged:
+			log.Printf("skip %s because the destination file has the same content", source)
+			v.summary.addUnchanged()
+			err = v.updateFileAttributes(attributes, source, nil, dest, destFileInfo)
+			if err != nil {
+				return err
+			}
+
+			return v.fileTracker.AddFile(dest)
+		}
+	}
+
+	if v.options.DryRun {
+		if destExists {
+			log.Printf("Dry run: would overwrite file %s with %s", dest, source)
+		} else {
+			log.Printf("Dry run: would create file %s from %s", dest, source)
+		}
+
+		v.summary.addCopied()
+		return v.fileTracker.AddFile(dest)
+	}
+
+	err = writeAtomically(source, dest, bytes.NewReader(content), v.fileSystem, attributes)
+	if err != nil {
+		return err
+	}
+
+	v.summary.addCopied()
+
+	return v.fileTracker.AddFile(dest)
+}
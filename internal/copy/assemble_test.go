@@ -0,0 +1,201 @@
+package copy
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestVolumeMountCopier_CopyVolumeMount_assemble(t *testing.T) {
+	t.Run("should assemble the fragments of all sources ordered by priority and path", func(t *testing.T) {
+		// given
+		src := t.TempDir()
+		otherSrc := t.TempDir()
+		destDir := t.TempDir()
+		dest := filepath.Join(destDir, "app.conf")
+		writeTestFile(t, filepath.Join(src, "20-b.conf"), "b")
+		writeTestFile(t, filepath.Join(src, "10-a.conf"), "a\n")
+		writeTestFile(t, filepath.Join(src, "ignored.txt"), "ignored")
+		writeTestFile(t, filepath.Join(otherSrc, "00-first.conf"), "first")
+		fileSystem := FileSystem{}
+		tracker := NewLocalConfigFileTracker(newMemoryDoguConfig(), fileSystem)
+		mounts := []SrcAndDestination{
+			{Src: src, Dest: dest, Assemble: true, Priority: 10, Include: []string{"*.conf"}, AssembleHeader: "# generated", AssembleSeparator: "# ---"},
+			{Src: otherSrc, Dest: dest, Assemble: true, Priority: 0, AssembleHeader: "# generated"},
+		}
+
+		// when
+		sut := NewVolumeMountCopier(fileSystem, tracker, Options{})
+		err := sut.CopyVolumeMount(mounts)
+
+		// then
+		require.NoError(t, err)
+		content, err := os.ReadFile(dest)
+		require.NoError(t, err)
+		assert.Equal(t, "# generated\nfirst\n# ---\na\n# ---\nb\n", string(content))
+		assert.Equal(t, 1, sut.summary.copied)
+		assert.Equal(t, 1, sut.summary.filtered)
+
+		// when
+		sut = NewVolumeMountCopier(fileSystem, tracker, Options{})
+		err = sut.CopyVolumeMount(mounts)
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, 1, sut.summary.unchanged)
+	})
+
+	t.Run("should restore the original destination file on cleanup", func(t *testing.T) {
+		// given
+		src := t.TempDir()
+		dest := filepath.Join(t.TempDir(), "app.conf")
+		writeTestFile(t, dest, "original")
+		writeTestFile(t, filepath.Join(src, "a.conf"), "a")
+		fileSystem := FileSystem{}
+		tracker := NewLocalConfigFileTracker(newMemoryDoguConfig(), fileSystem)
+
+		// when
+		err := NewVolumeMountCopier(fileSystem, tracker, Options{}).CopyVolumeMount([]SrcAndDestination{{Src: src, Dest: dest, Assemble: true}})
+
+		// then
+		require.NoError(t, err)
+		content, err := os.ReadFile(dest)
+		require.NoError(t, err)
+		assert.Equal(t, "a\n", string(content))
+
+		// when
+		err = tracker.DeleteAllTrackedFiles()
+
+		// then
+		require.NoError(t, err)
+		content, err = os.ReadFile(dest)
+		require.NoError(t, err)
+		assert.Equal(t, "original", string(content))
+	})
+
+	t.Run("should update the file mode of an unchanged assembled file", func(t *testing.T) {
+		// given
+		src := t.TempDir()
+		dest := filepath.Join(t.TempDir(), "app.conf")
+		writeTestFile(t, filepath.Join(src, "a.conf"), "a")
+		fileSystem := FileSystem{}
+		tracker := NewLocalConfigFileTracker(newMemoryDoguConfig(), fileSystem)
+		require.NoError(t, NewVolumeMountCopier(fileSystem, tracker, Options{}).CopyVolumeMount([]SrcAndDestination{{Src: src, Dest: dest, Assemble: true}}))
+		modTime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		require.NoError(t, os.Chtimes(dest, modTime, modTime))
+		fileMode := os.FileMode(0600)
+		sut := NewVolumeMountCopier(fileSystem, tracker, Options{})
+
+		// when
+		err := sut.CopyVolumeMount([]SrcAndDestination{{Src: src, Dest: dest, Assemble: true, FileMode: &fileMode}})
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, 1, sut.summary.unchanged)
+		fileInfo, err := os.Stat(dest)
+		require.NoError(t, err)
+		assert.Equal(t, fileMode, fileInfo.Mode().Perm())
+		assert.True(t, modTime.Equal(fileInfo.ModTime()))
+	})
+
+	t.Run("should return error on different headers", func(t *testing.T) {
+		// given
+		src := t.TempDir()
+		dest := filepath.Join(t.TempDir(), "app.conf")
+		writeTestFile(t, filepath.Join(src, "a.conf"), "a")
+		fileSystem := FileSystem{}
+		mounts := []SrcAndDestination{
+			{Src: src, Dest: dest, Assemble: true, AssembleHeader: "# one"},
+			{Src: src, Dest: dest, Assemble: true, AssembleHeader: "# two"},
+		}
+
+		// when
+		err := NewVolumeMountCopier(fileSystem, NewLocalConfigFileTracker(newMemoryDoguConfig(), fileSystem), Options{}).CopyVolumeMount(mounts)
+
+		// then
+		assert.ErrorContains(t, err, "failed to assemble file "+dest+": mounts of assembled file "+dest+" define different headers")
+		assert.NoFileExists(t, dest)
+	})
+
+	t.Run("should return error on different file modes", func(t *testing.T) {
+		// given
+		src := t.TempDir()
+		dest := filepath.Join(t.TempDir(), "app.conf")
+		writeTestFile(t, filepath.Join(src, "a.conf"), "a")
+		fileSystem := FileSystem{}
+		fileMode := os.FileMode(0600)
+		otherFileMode := os.FileMode(0644)
+		mounts := []SrcAndDestination{
+			{Src: src, Dest: dest, Assemble: true, FileMode: &fileMode},
+			{Src: src, Dest: dest, Assemble: true, FileMode: &otherFileMode},
+		}
+
+		// when
+		err := NewVolumeMountCopier(fileSystem, NewLocalConfigFileTracker(newMemoryDoguConfig(), fileSystem), Options{}).CopyVolumeMount(mounts)
+
+		// then
+		assert.ErrorContains(t, err, "failed to assemble file "+dest+": mounts of assembled file "+dest+" define different file modes")
+		assert.NoFileExists(t, dest)
+	})
+
+	t.Run("should return error on different conflict policies", func(t *testing.T) {
+		// given
+		src := t.TempDir()
+		dest := filepath.Join(t.TempDir(), "app.conf")
+		writeTestFile(t, filepath.Join(src, "a.conf"), "a")
+		fileSystem := FileSystem{}
+		mounts := []SrcAndDestination{
+			{Src: src, Dest: dest, Assemble: true, Conflict: ConflictSkip},
+			{Src: src, Dest: dest, Assemble: true, Conflict: ConflictFail},
+		}
+
+		// when
+		err := NewVolumeMountCopier(fileSystem, NewLocalConfigFileTracker(newMemoryDoguConfig(), fileSystem), Options{}).CopyVolumeMount(mounts)
+
+		// then
+		assert.ErrorContains(t, err, "failed to assemble file "+dest+": mounts of assembled file "+dest+" define different conflict policies")
+		assert.NoFileExists(t, dest)
+	})
+
+	t.Run("should apply the conflict policy of a later source if the others omit it", func(t *testing.T) {
+		// given
+		src := t.TempDir()
+		dest := filepath.Join(t.TempDir(), "app.conf")
+		writeTestFile(t, filepath.Join(src, "a.conf"), "a")
+		writeTestFile(t, dest, "original")
+		fileSystem := FileSystem{}
+		mounts := []SrcAndDestination{
+			{Src: src, Dest: dest, Assemble: true},
+			{Src: src, Dest: dest, Assemble: true, Conflict: ConflictSkip},
+		}
+
+		// when
+		err := NewVolumeMountCopier(fileSystem, NewLocalConfigFileTracker(newMemoryDoguConfig(), fileSystem), Options{}).CopyVolumeMount(mounts)
+
+		// then
+		require.NoError(t, err)
+		content, err := os.ReadFile(dest)
+		require.NoError(t, err)
+		assert.Equal(t, "original", string(content))
+	})
+
+	t.Run("should not assemble the file if a quota is exceeded", func(t *testing.T) {
+		// given
+		src := t.TempDir()
+		dest := filepath.Join(t.TempDir(), "app.conf")
+		writeTestFile(t, filepath.Join(src, "a.conf"), "a")
+		writeTestFile(t, filepath.Join(src, "b.conf"), "b")
+		fileSystem := FileSystem{}
+		mount := SrcAndDestination{Src: src, Dest: dest, Assemble: true, Quota: Quota{MaxFiles: 1}}
+
+		// when
+		err := NewVolumeMountCopier(fileSystem, NewLocalConfigFileTracker(newMemoryDoguConfig(), fileSystem), Options{}).CopyVolumeMount([]SrcAndDestination{mount})
+
+		// then
+		require.ErrorIs(t, err, ErrQuotaExceeded)
+		assert.NoFileExists(t, dest)
+	})
+}
@@ -0,0 +1,554 @@
+package copy
+
+import (
+	"bytes"
+	"cmp"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// CertificateMode defines how the certificates of a source are installed.
+type CertificateMode string
+
+const (
+	// CertificatesDir writes every certificate to its own file in the destination dir and creates the links named
+	// after the subject hash, which OpenSSL uses to look up certificates in a dir like `c_rehash`.
+	CertificatesDir CertificateMode = "dir"
+	// CertificatesBundle appends the certificates to the destination file.
+	CertificatesBundle CertificateMode = "bundle"
+	// CertificatesTruststore writes the certificates to the truststore at the destination, e.g. for Java.
+	CertificatesTruststore CertificateMode = "truststore"
+)
+
+const pemCertificateType = "CERTIFICATE"
+
+// ParseCertificateMode returns the certificate mode with the given name.
+func ParseCertificateMode(name string) (CertificateMode, error) {
+	mode := CertificateMode(name)
+	switch mode {
+	case CertificatesDir, CertificatesBundle, CertificatesTruststore:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown certificate mode %q, expected one of %s, %s, %s", name, CertificatesDir, CertificatesBundle, CertificatesTruststore)
+	}
+}
+
+// certificate is a certificate parsed from a source file.
+type certificate struct {
+	cert   *x509.Certificate
+	source fragment
+	// name is the path of the certificate file relative to the destination dir.
+	name string
+}
+
+// splitCertificates separates the mounts which are copied one-to-one from the mounts installing certificates.
+// The certificates are grouped by their destination, so that they are deduplicated over all mounts.
+func splitCertificates(srcToDest []SrcAndDestination) ([]SrcAndDestination, []*assembly) {
+	return groupByDestination(srcToDest, func(mount SrcAndDestination) bool {
+		return mount.Certificates != ""
+	})
+}
+
+// getCertificateMode returns the certificate mode of the mounts. Different modes for the same destination are rejected.
+func (a *assembly) getCertificateMode() (CertificateMode, error) {
+	mode := a.mounts[0].Certificates
+	for _, mount := range a.mounts[1:] {
+		if mount.Certificates != mode {
+			return "", fmt.Errorf("mounts of certificate destination %s define different certificate modes", a.dest)
+		}
+	}
+
+	return mode, nil
+}
+
+// installCertificates collects the source files of every certificate destination and submits the installation to
+// the pool.
+func (v *VolumeMountCopier) installCertificates(groups []*assembly, pool *workerPool) error {
+	var multiErr []error
+	for _, group := range groups {
+		fragments, err := v.getFragments(group)
+		if err != nil {
+			v.summary.addFailed()
+			multiErr = append(multiErr, fmt.Errorf("failed to install certificates to %s: %w", group.dest, err))
+			continue
+		}
+
+		pool.submit(func() error {
+			err := v.installCertificateGroup(group, fragments)
+			if err != nil {
+				v.summary.addFailed()
+				return fmt.Errorf("failed to install certificates to %s: %w", group.dest, err)
+			}
+
+			return nil
+		})
+	}
+
+	return errors.Join(multiErr...)
+}
+
+func (v *VolumeMountCopier) installCertificateGroup(group *assembly, fragments []fragment) error {
+	mode, err := group.getCertificateMode()
+	if err != nil {
+		return err
+	}
+
+	certificates, err := v.readCertificates(fragments)
+	if err != nil {
+		return err
+	}
+
+	switch mode {
+	case CertificatesBundle:
+		return v.writeCertificateBundle(group, certificates)
+	case CertificatesTruststore:
+		return v.writeTruststore(group, certificates)
+	default:
+		return v.writeCertificateDir(group, certificates)
+	}
+}
+
+// readCertificates parses the PEM encoded certificates of the source files. Other PEM blocks are ignored.
+// Certificates contained in several source files are only returned once.
+func (v *VolumeMountCopier) readCertificates(fragments []fragment) ([]certificate, error) {
+	var certificates []certificate
+	seen := map[[sha256.Size]byte]bool{}
+	for _, f := range fragments {
+		content, err := readFile(f.filePath, v.fileSystem)
+		if err != nil {
+			return nil, err
+		}
+
+		certs, err := parseCertificates(content.Bytes())
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificates of %s: %w", f.filePath, err)
+		}
+
+		if len(certs) == 0 {
+			log.Printf("skip source file %s because it contains no certificates", f.filePath)
+			continue
+		}
+
+		for i, cert := range certs {
+			fingerprint := sha256.Sum256(cert.Raw)
+			if seen[fingerprint] {
+				log.Printf("skip duplicate certificate %q of %s", cert.Subject, f.filePath)
+				continue
+			}
+
+			seen[fingerprint] = true
+			certificates = append(certificates, certificate{cert: cert, source: f, name: getCertificateFileName(f.rel, i, len(certs))})
+		}
+	}
+
+	return certificates, nil
+}
+
+func parseCertificates(content []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, content = pem.Decode(content)
+		if block == nil {
+			return certs, nil
+		}
+
+		if block.Type != pemCertificateType {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+
+		certs = append(certs, cert)
+	}
+}
+
+// getCertificateFileName returns the name of the file of the certificate with the index in the source file.
+// Certificates of source files with several certificates are numbered.
+func getCertificateFileName(rel string, index, count int) string {
+	name := strings.TrimSuffix(rel, path.Ext(rel))
+	if count > 1 {
+		name = fmt.Sprintf("%s-%d", name, index+1)
+	}
+
+	return name + ".pem"
+}
+
+func encodeCertificate(cert *x509.Certificate) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: pemCertificateType, Bytes: cert.Raw})
+}
+
+// writeCertificateBundle appends the certificates to the original bundle. The original is the existing destination
+// file which was not written by this application or its backup, so that every run appends to the bundle shipped
+// with the dogu. Certificates already contained in the original are not appended again.
+func (v *VolumeMountCopier) writeCertificateBundle(group *assembly, certificates []certificate) error {
+	destMount, err := group.getDestinationMount("certificate destination")
+	if err != nil {
+		return err
+	}
+
+	original, err := v.getOriginal(group.dest)
+	if err != nil {
+		return err
+	}
+
+	var content bytes.Buffer
+	appendLines(&content, original)
+	contained := getCertificateFingerprints(original)
+	for _, c := range certificates {
+		if contained[sha256.Sum256(c.cert.Raw)] {
+			log.Printf("skip certificate %q of %s because the bundle %s already contains it", c.cert.Subject, c.source.filePath, group.dest)
+			continue
+		}
+
+		content.Write(encodeCertificate(c.cert))
+	}
+
+	return v.writeGeneratedFile(destMount, "certificates of "+group.dest, group.dest, content.Bytes())
+}
+
+// getOriginal returns the content of the destination file before it was written by this application. It is the
+// existing file if it was not written by this application yet or its backup. It returns nil if there is no original.
+func (v *VolumeMountCopier) getOriginal(dest string) ([]byte, error) {
+	_, err := v.fileSystem.Stat(dest)
+	if err == nil {
+		conflict, err := v.isConflict(dest)
+		if err != nil {
+			return nil, err
+		}
+
+		if conflict {
+			content, err := readFile(dest, v.fileSystem)
+			if err != nil {
+				return nil, err
+			}
+
+			return content.Bytes(), nil
+		}
+	}
+
+	originalPath, ok, err := v.fileTracker.GetBackup(dest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get original of destination file %s: %w", dest, err)
+	}
+
+	if !ok {
+		return nil, nil
+	}
+
+	content, err := readFile(originalPath, v.fileSystem)
+	if err != nil {
+		return nil, err
+	}
+
+	return content.Bytes(), nil
+}
+
+// getCertificateFingerprints returns the fingerprints of the PEM encoded certificates without parsing them, so that
+// invalid certificates of an original bundle do not prevent appending to it.
+func getCertificateFingerprints(content []byte) map[[sha256.Size]byte]bool {
+	fingerprints := map[[sha256.Size]byte]bool{}
+	for {
+		var block *pem.Block
+		block, content = pem.Decode(content)
+		if block == nil {
+			return fingerprints
+		}
+
+		if block.Type == pemCertificateType {
+			fingerprints[sha256.Sum256(block.Bytes)] = true
+		}
+	}
+}
+
+// writeCertificateDir writes every certificate to its own file in the destination dir and links it with the name
+// `<subject hash>.<n>` in the destination dir. The number n distinguishes certificates with the same subject hash.
+// Existing links which were not created by this application are kept and skipped.
+func (v *VolumeMountCopier) writeCertificateDir(group *assembly, certificates []certificate) error {
+	sources := map[string]string{}
+	hashes := make(map[string]uint32, len(certificates))
+	for _, c := range certificates {
+		if other, ok := sources[c.name]; ok {
+			return fmt.Errorf("certificates of %s and %s have the same destination file %s", other, c.source.filePath, path.Join(group.dest, c.name))
+		}
+
+		sources[c.name] = c.source.filePath
+		hash, err := getSubjectHash(c.cert)
+		if err != nil {
+			return fmt.Errorf("failed to get subject hash of certificate %q of %s: %w", c.cert.Subject, c.source.filePath, err)
+		}
+
+		hashes[c.name] = hash
+		source := fmt.Sprintf("certificate %q of %s", c.cert.Subject, c.source.filePath)
+		err = v.writeGeneratedFile(c.source.mount, source, path.Join(group.dest, c.name), encodeCertificate(c.cert))
+		if err != nil {
+			return err
+		}
+	}
+
+	// Number the links independently of the order of the sources.
+	slices.SortFunc(certificates, func(a, b certificate) int {
+		return cmp.Or(cmp.Compare(hashes[a.name], hashes[b.name]), strings.Compare(a.name, b.name))
+	})
+
+	next := map[uint32]int{}
+	for _, c := range certificates {
+		err := v.writeHashLink(c.source.mount, group.dest, hashes[c.name], c.name, next)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeHashLink links the certificate file with the first free name for the hash, beginning with the number in next.
+func (v *VolumeMountCopier) writeHashLink(mount SrcAndDestination, dir string, hash uint32, target string, next map[uint32]int) error {
+	for n := next[hash]; ; n++ {
+		linkPath := path.Join(dir, fmt.Sprintf("%08x.%d", hash, n))
+		written, err := v.tryWriteHashLink(mount, linkPath, target)
+		if err != nil {
+			return err
+		}
+
+		if written {
+			next[hash] = n + 1
+			return nil
+		}
+	}
+}
+
+// tryWriteHashLink creates the link to the target unless the path is taken by a file which was not created by this
+// application. It returns false if the path is taken.
+func (v *VolumeMountCopier) tryWriteHashLink(mount SrcAndDestination, linkPath, target string) (bool, error) {
+	unlock := v.destinationLocks.lock(linkPath)
+	defer unlock()
+
+	linkInfo, err := v.fileSystem.Lstat(linkPath)
+	if err == nil {
+		conflict, err := v.isConflict(linkPath)
+		if err != nil {
+			return false, err
+		}
+
+		if conflict {
+			return false, nil
+		}
+
+		if linkInfo.Mode()&os.ModeSymlink != 0 {
+			existingTarget, err := v.fileSystem.Readlink(linkPath)
+			if err != nil {
+				return false, fmt.Errorf("failed to read symlink %s: %w", linkPath, err)
+			}
+
+			if existingTarget == target {
+				v.summary.addUnchanged()
+				return true, v.fileTracker.AddFile(linkPath)
+			}
+		}
+	}
+
+	if v.options.DryRun {
+		log.Printf("Dry run: would create symlink %s to %s", linkPath, target)
+		v.summary.addCopied()
+		return true, v.fileTracker.AddFile(linkPath)
+	}
+
+	attributes := FileAttributes{Owner: mount.Owner, Group: mount.Group, DirMode: mount.DirMode}
+	err = createSymlink(target, linkPath, v.fileSystem, attributes)
+	if err != nil {
+		return false, err
+	}
+
+	v.summary.addCopied()
+
+	return true, v.fileTracker.AddFile(linkPath)
+}
+
+// getSubjectHash returns the hash of the subject like X509_NAME_hash of OpenSSL. It consists of the first four bytes
+// of the SHA-1 hash of the canonical encoding of the subject in little-endian order.
+func getSubjectHash(cert *x509.Certificate) (uint32, error) {
+	canonical, err := canonicalizeName(cert.RawSubject)
+	if err != nil {
+		return 0, err
+	}
+
+	sum := sha1.Sum(canonical)
+	return binary.LittleEndian.Uint32(sum[:4]), nil
+}
+
+// canonicalizeName returns the canonical encoding of the name used by OpenSSL. It is the concatenation of the
+// encoded relative distinguished names without the outer sequence. Their string values are converted to lower case
+// UTF8Strings without leading, trailing and repeated whitespace.
+func canonicalizeName(rawName []byte) ([]byte, error) {
+	var rdns []asn1.RawValue
+	rest, err := asn1.Unmarshal(rawName, &rdns)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rest) > 0 {
+		return nil, errors.New("trailing data after name")
+	}
+
+	var canonical []byte
+	for _, rdn := range rdns {
+		var attributes [][]byte
+		for content := rdn.Bytes; len(content) > 0; {
+			var attribute asn1.RawValue
+			content, err = asn1.Unmarshal(content, &attribute)
+			if err != nil {
+				return nil, err
+			}
+
+			canonicalAttribute, err := canonicalizeAttribute(attribute)
+			if err != nil {
+				return nil, err
+			}
+
+			attributes = append(attributes, canonicalAttribute)
+		}
+
+		// The attributes of a set are ordered by their encoding.
+		slices.SortFunc(attributes, bytes.Compare)
+		set, err := asn1.Marshal(asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: bytes.Join(attributes, nil)})
+		if err != nil {
+			return nil, err
+		}
+
+		canonical = append(canonical, set...)
+	}
+
+	return canonical, nil
+}
+
+func canonicalizeAttribute(attribute asn1.RawValue) ([]byte, error) {
+	var oid asn1.RawValue
+	rest, err := asn1.Unmarshal(attribute.Bytes, &oid)
+	if err != nil {
+		return nil, err
+	}
+
+	var value asn1.RawValue
+	_, err = asn1.Unmarshal(rest, &value)
+	if err != nil {
+		return nil, err
+	}
+
+	canonicalValue := value.FullBytes
+	text, ok, err := decodeNameString(value)
+	if err != nil {
+		return nil, err
+	}
+
+	if ok {
+		canonicalValue, err = asn1.Marshal(asn1.RawValue{Tag: asn1.TagUTF8String, Bytes: []byte(canonicalizeNameString(text))})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return asn1.Marshal(asn1.RawValue{Tag: asn1.TagSequence, IsCompound: true, Bytes: append(slices.Clone(oid.FullBytes), canonicalValue...)})
+}
+
+const (
+	tagT61String       = 20
+	tagVisibleString   = 26
+	tagUniversalString = 28
+	tagBMPString       = 30
+)
+
+// decodeNameString decodes the string types canonicalized by OpenSSL. It returns false for other types.
+func decodeNameString(value asn1.RawValue) (string, bool, error) {
+	if value.Class != asn1.ClassUniversal {
+		return "", false, nil
+	}
+
+	switch value.Tag {
+	case asn1.TagUTF8String:
+		return string(value.Bytes), true, nil
+	case asn1.TagPrintableString, tagT61String, asn1.TagIA5String, tagVisibleString:
+		// Every byte is a character like in Latin-1.
+		runes := make([]rune, len(value.Bytes))
+		for i, b := range value.Bytes {
+			runes[i] = rune(b)
+		}
+
+		return string(runes), true, nil
+	case tagBMPString:
+		if len(value.Bytes)%2 != 0 {
+			return "", false, errors.New("invalid length of BMPString")
+		}
+
+		units := make([]uint16, len(value.Bytes)/2)
+		for i := range units {
+			units[i] = binary.BigEndian.Uint16(value.Bytes[2*i:])
+		}
+
+		return string(utf16.Decode(units)), true, nil
+	case tagUniversalString:
+		if len(value.Bytes)%4 != 0 {
+			return "", false, errors.New("invalid length of UniversalString")
+		}
+
+		var text []byte
+		for i := 0; i < len(value.Bytes); i += 4 {
+			text = utf8.AppendRune(text, rune(binary.BigEndian.Uint32(value.Bytes[i:])))
+		}
+
+		return string(text), true, nil
+	default:
+		return "", false, nil
+	}
+}
+
+// canonicalizeNameString removes leading and trailing whitespace, replaces repeated whitespace with a single space
+// and converts ASCII letters to lower case.
+func canonicalizeNameString(text string) string {
+	isSpace := func(b byte) bool {
+		return b == ' ' || (b >= '\t' && b <= '\r')
+	}
+
+	var canonical strings.Builder
+	start, end := 0, len(text)
+	for start < end && isSpace(text[start]) {
+		start++
+	}
+
+	for end > start && isSpace(text[end-1]) {
+		end--
+	}
+
+	for i := start; i < end; i++ {
+		b := text[i]
+		switch {
+		case isSpace(b):
+			canonical.WriteByte(' ')
+			for i+1 < end && isSpace(text[i+1]) {
+				i++
+			}
+		case b >= 'A' && b <= 'Z':
+			canonical.WriteByte(b + 'a' - 'A')
+		default:
+			canonical.WriteByte(b)
+		}
+	}
+
+	return canonical.String()
+}
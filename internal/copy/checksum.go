@@ -0,0 +1,90 @@
+package copy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// FileChecksum is the cached digest of a destination file.
+// It is only valid as long as the size and the modification time of the file did not change.
+type FileChecksum struct {
+	Digest  string    `yaml:"sha256"`
+	Size    int64     `yaml:"size"`
+	ModTime time.Time `yaml:"modTime"`
+}
+
+func (c FileChecksum) matches(fileInfo os.FileInfo) bool {
+	return c.Digest != "" && c.Size == fileInfo.Size() && c.ModTime.Equal(fileInfo.ModTime())
+}
+
+// isUnchanged checks if the destination file already has the content of the source file.
+// The files are compared by size first and by their SHA-256 digest afterward. The digest of the destination file
+// is cached in the file tracker to avoid reading the file again in the next run.
+func (v *VolumeMountCopier) isUnchanged(srcFilePath string, srcFileInfo os.FileInfo, destFilePath string, destFileInfo os.FileInfo) (bool, error) {
+	if srcFileInfo.Size() != destFileInfo.Size() {
+		return false, nil
+	}
+
+	srcDigest, err := getFileDigest(srcFilePath, v.fileSystem)
+	if err != nil {
+		return false, err
+	}
+
+	destDigest, err := v.getDestinationDigest(destFilePath, destFileInfo)
+	if err != nil {
+		return false, err
+	}
+
+	return srcDigest == destDigest, nil
+}
+
+func (v *VolumeMountCopier) getDestinationDigest(destFilePath string, destFileInfo os.FileInfo) (string, error) {
+	checksum, ok, err := v.fileTracker.GetChecksum(destFilePath)
+	if err != nil {
+		return "", err
+	}
+
+	if ok && checksum.matches(destFileInfo) {
+		return checksum.Digest, nil
+	}
+
+	digest, err := getFileDigest(destFilePath, v.fileSystem)
+	if err != nil {
+		return "", err
+	}
+
+	checksum = FileChecksum{Digest: digest, Size: destFileInfo.Size(), ModTime: destFileInfo.ModTime()}
+	err = v.fileTracker.SetChecksum(destFilePath, checksum)
+	if err != nil {
+		return "", err
+	}
+
+	return digest, nil
+}
+
+// getFileDigest returns the hex encoded SHA-256 digest of the file content.
+func getFileDigest(filePath string, fileSystem Filesystem) (string, error) {
+	file, err := fileSystem.Open(filePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file %s: %w", filePath, err)
+	}
+
+	defer func() {
+		closeErr := fileSystem.CloseFile(file)
+		if closeErr != nil {
+			log.Println(fmt.Errorf("failed to close fd: %w", closeErr))
+		}
+	}()
+
+	hash := sha256.New()
+	_, _, err = fileSystem.Copy(hash, file)
+	if err != nil {
+		return "", fmt.Errorf("failed to calculate digest of file %s: %w", filePath, err)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,179 @@
+package copy
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"io"
+	"os"
+	"testing"
+	"time"
+)
+
+// digest of "content"
+const contentDigest = "ed7002b439e9ac845f22357d822bac1444730fbdb6016d3ec9432297b9ec9f73"
+
+func writeContent(content string) func(dst io.Writer, src io.Reader) (int64, CopyMethod, error) {
+	return func(dst io.Writer, src io.Reader) (int64, CopyMethod, error) {
+		n, err := dst.Write([]byte(content))
+		return int64(n), CopyMethodStream, err
+	}
+}
+
+func TestCopier_getFileDigest(t *testing.T) {
+	t.Run("should return sha256 digest of file", func(t *testing.T) {
+		// given
+		file := &os.File{}
+		filesystemMock := NewMockFilesystem(t)
+		filesystemMock.EXPECT().Open("/file").Return(file, nil)
+		filesystemMock.EXPECT().Copy(mock.Anything, file).RunAndReturn(writeContent("content"))
+		filesystemMock.EXPECT().CloseFile(file).Return(nil)
+
+		// when
+		digest, err := getFileDigest("/file", filesystemMock)
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, contentDigest, digest)
+	})
+
+	t.Run("should return error on open error", func(t *testing.T) {
+		// given
+		filesystemMock := NewMockFilesystem(t)
+		filesystemMock.EXPECT().Open("/file").Return(nil, assert.AnError)
+
+		// when
+		_, err := getFileDigest("/file", filesystemMock)
+
+		// then
+		require.Error(t, err)
+		assert.ErrorIs(t, err, assert.AnError)
+		assert.ErrorContains(t, err, "failed to open file /file")
+	})
+
+	t.Run("should return error on read error", func(t *testing.T) {
+		// given
+		file := &os.File{}
+		filesystemMock := NewMockFilesystem(t)
+		filesystemMock.EXPECT().Open("/file").Return(file, nil)
+		filesystemMock.EXPECT().Copy(mock.Anything, file).Return(0, CopyMethodStream, assert.AnError)
+		filesystemMock.EXPECT().CloseFile(file).Return(nil)
+
+		// when
+		_, err := getFileDigest("/file", filesystemMock)
+
+		// then
+		require.Error(t, err)
+		assert.ErrorIs(t, err, assert.AnError)
+		assert.ErrorContains(t, err, "failed to calculate digest of file /file")
+	})
+}
+
+func TestVolumeMountCopier_isUnchanged(t *testing.T) {
+	modTime := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	srcFileInfo := &myFileInfo{size: 7}
+	destFileInfo := &myFileInfo{size: 7, modTime: modTime}
+
+	t.Run("should return false on different size without reading the files", func(t *testing.T) {
+		// given
+		sut := &VolumeMountCopier{}
+
+		// when
+		unchanged, err := sut.isUnchanged("/src", srcFileInfo, "/dest", &myFileInfo{size: 8})
+
+		// then
+		require.NoError(t, err)
+		assert.False(t, unchanged)
+	})
+
+	t.Run("should compare digests and cache the destination digest", func(t *testing.T) {
+		// given
+		srcFile := &os.File{}
+		destFile := &os.File{}
+		filesystemMock := NewMockFilesystem(t)
+		filesystemMock.EXPECT().Open("/src").Return(srcFile, nil)
+		filesystemMock.EXPECT().Copy(mock.Anything, srcFile).RunAndReturn(writeContent("content"))
+		filesystemMock.EXPECT().CloseFile(srcFile).Return(nil)
+		filesystemMock.EXPECT().Open("/dest").Return(destFile, nil)
+		filesystemMock.EXPECT().Copy(mock.Anything, destFile).RunAndReturn(writeContent("content"))
+		filesystemMock.EXPECT().CloseFile(destFile).Return(nil)
+		fileTrackerMock := newMockFileTracker(t)
+		fileTrackerMock.EXPECT().GetChecksum("/dest").Return(FileChecksum{}, false, nil)
+		fileTrackerMock.EXPECT().SetChecksum("/dest", FileChecksum{Digest: contentDigest, Size: 7, ModTime: modTime}).Return(nil)
+
+		sut := &VolumeMountCopier{fileSystem: filesystemMock, fileTracker: fileTrackerMock}
+
+		// when
+		unchanged, err := sut.isUnchanged("/src", srcFileInfo, "/dest", destFileInfo)
+
+		// then
+		require.NoError(t, err)
+		assert.True(t, unchanged)
+	})
+
+	t.Run("should use cached digest if size and modification time match", func(t *testing.T) {
+		// given
+		srcFile := &os.File{}
+		filesystemMock := NewMockFilesystem(t)
+		filesystemMock.EXPECT().Open("/src").Return(srcFile, nil)
+		filesystemMock.EXPECT().Copy(mock.Anything, srcFile).RunAndReturn(writeContent("changed"))
+		filesystemMock.EXPECT().CloseFile(srcFile).Return(nil)
+		fileTrackerMock := newMockFileTracker(t)
+		fileTrackerMock.EXPECT().GetChecksum("/dest").Return(FileChecksum{Digest: contentDigest, Size: 7, ModTime: modTime}, true, nil)
+
+		sut := &VolumeMountCopier{fileSystem: filesystemMock, fileTracker: fileTrackerMock}
+
+		// when
+		unchanged, err := sut.isUnchanged("/src", srcFileInfo, "/dest", destFileInfo)
+
+		// then
+		require.NoError(t, err)
+		assert.False(t, unchanged)
+	})
+
+	t.Run("should ignore outdated cached digest", func(t *testing.T) {
+		// given
+		srcFile := &os.File{}
+		destFile := &os.File{}
+		filesystemMock := NewMockFilesystem(t)
+		filesystemMock.EXPECT().Open("/src").Return(srcFile, nil)
+		filesystemMock.EXPECT().Copy(mock.Anything, srcFile).RunAndReturn(writeContent("content"))
+		filesystemMock.EXPECT().CloseFile(srcFile).Return(nil)
+		filesystemMock.EXPECT().Open("/dest").Return(destFile, nil)
+		filesystemMock.EXPECT().Copy(mock.Anything, destFile).RunAndReturn(writeContent("content"))
+		filesystemMock.EXPECT().CloseFile(destFile).Return(nil)
+		fileTrackerMock := newMockFileTracker(t)
+		outdated := FileChecksum{Digest: "outdated", Size: 7, ModTime: modTime.Add(-time.Hour)}
+		fileTrackerMock.EXPECT().GetChecksum("/dest").Return(outdated, true, nil)
+		fileTrackerMock.EXPECT().SetChecksum("/dest", FileChecksum{Digest: contentDigest, Size: 7, ModTime: modTime}).Return(nil)
+
+		sut := &VolumeMountCopier{fileSystem: filesystemMock, fileTracker: fileTrackerMock}
+
+		// when
+		unchanged, err := sut.isUnchanged("/src", srcFileInfo, "/dest", destFileInfo)
+
+		// then
+		require.NoError(t, err)
+		assert.True(t, unchanged)
+	})
+
+	t.Run("should return error on error getting cached digest", func(t *testing.T) {
+		// given
+		srcFile := &os.File{}
+		filesystemMock := NewMockFilesystem(t)
+		filesystemMock.EXPECT().Open("/src").Return(srcFile, nil)
+		filesystemMock.EXPECT().Copy(mock.Anything, srcFile).RunAndReturn(writeContent("content"))
+		filesystemMock.EXPECT().CloseFile(srcFile).Return(nil)
+		fileTrackerMock := newMockFileTracker(t)
+		fileTrackerMock.EXPECT().GetChecksum("/dest").Return(FileChecksum{}, false, assert.AnError)
+
+		sut := &VolumeMountCopier{fileSystem: filesystemMock, fileTracker: fileTrackerMock}
+
+		// when
+		_, err := sut.isUnchanged("/src", srcFileInfo, "/dest", destFileInfo)
+
+		// then
+		require.Error(t, err)
+		assert.ErrorIs(t, err, assert.AnError)
+	})
+}
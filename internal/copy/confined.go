@@ -0,0 +1,112 @@
+package copy
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// ErrNotConfined is returned for modifications of paths which are not confined to the allowed roots.
+var ErrNotConfined = errors.New("path is not confined to the allowed roots")
+
+// ConfinedFileSystem is a FileSystem which rejects all modifications of paths outside the allowed roots.
+// Paths beneath a root are opened with openat2 and RESOLVE_BENEATH and RESOLVE_NO_SYMLINKS relative to the root,
+// so that the kernel resolves them atomically and rejects every symlink below the root. Modifications are applied
+// with the file descriptor of the resolved dir, so that components replaced concurrently cannot redirect them.
+// Operations which do not follow a symlink in the last component, e.g. renaming or deleting, may act on a symlink.
+// Reading the metadata and the content of paths beneath the roots is resolved the same way. Other paths, e.g. the
+// sources, are read without restrictions. Walks and the resolution of symlinks are not confined.
+// The ConfinedFileSystem is only supported on linux.
+type ConfinedFileSystem struct {
+	FileSystem
+	roots []string
+}
+
+// NewConfinedFileSystem creates a ConfinedFileSystem for the roots. The roots themselves may be symlinks.
+func NewConfinedFileSystem(roots []string) (ConfinedFileSystem, error) {
+	err := checkConfinementSupport()
+	if err != nil {
+		return ConfinedFileSystem{}, err
+	}
+
+	absRoots := make([]string, 0, len(roots))
+	for _, root := range roots {
+		absRoot, err := filepath.Abs(root)
+		if err != nil {
+			return ConfinedFileSystem{}, fmt.Errorf("failed to get absolute path of allowed root %s: %w", root, err)
+		}
+
+		absRoots = append(absRoots, absRoot)
+	}
+
+	return ConfinedFileSystem{roots: absRoots}, nil
+}
+
+// confinedPath is a path beneath an allowed root.
+type confinedPath struct {
+	root string
+	// rel is the cleaned path relative to the root. It is "." for the root itself.
+	rel string
+	// abs is the cleaned absolute path, which is used in errors.
+	abs string
+}
+
+// CheckPath checks if the path is confined to the allowed roots and does not resolve through a symlink.
+func (f ConfinedFileSystem) CheckPath(filePath string) error {
+	p, err := f.resolve(filePath)
+	if err != nil {
+		return err
+	}
+
+	return checkBeneath(p)
+}
+
+// resolve returns the path relative to the matching root. Paths outside all roots result in ErrNotConfined.
+func (f ConfinedFileSystem) resolve(filePath string) (confinedPath, error) {
+	p, ok, err := f.lookup(filePath)
+	if err != nil {
+		return confinedPath{}, err
+	}
+
+	if !ok {
+		return confinedPath{}, fmt.Errorf("%w: %s is outside of %s", ErrNotConfined, filePath, strings.Join(f.roots, ", "))
+	}
+
+	return p, nil
+}
+
+// lookup returns the path relative to the matching root and whether such a root exists.
+func (f ConfinedFileSystem) lookup(filePath string) (confinedPath, bool, error) {
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return confinedPath{}, false, fmt.Errorf("failed to get absolute path of %s: %w", filePath, err)
+	}
+
+	for _, root := range f.roots {
+		if !isWithin(root, absPath) {
+			continue
+		}
+
+		rel, err := filepath.Rel(root, absPath)
+		if err != nil {
+			return confinedPath{}, false, fmt.Errorf("failed to get path of %s relative to %s: %w", absPath, root, err)
+		}
+
+		return confinedPath{root: root, rel: rel, abs: absPath}, true, nil
+	}
+
+	return confinedPath{}, false, nil
+}
+
+func (p confinedPath) isRoot() bool {
+	return p.rel == "."
+}
+
+func (p confinedPath) parent() confinedPath {
+	return confinedPath{root: p.root, rel: filepath.Dir(p.rel), abs: filepath.Dir(p.abs)}
+}
+
+func (p confinedPath) base() string {
+	return filepath.Base(p.rel)
+}
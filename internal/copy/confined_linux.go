@@ -0,0 +1,451 @@
+//go:build linux
+
+package copy
+
+import (
+	"errors"
+	"fmt"
+	"golang.org/x/sys/unix"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// confinedResolve keeps the resolution beneath the dir and rejects all symlinks, including the last component.
+// With O_PATH and O_NOFOLLOW a symlink as last component is opened itself.
+const confinedResolve = unix.RESOLVE_BENEATH | unix.RESOLVE_NO_SYMLINKS
+
+// checkConfinementSupport checks if the kernel supports openat2, which was added in linux 5.6.
+func checkConfinementSupport() error {
+	rootFd, err := unix.Open("/", unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return &os.PathError{Op: "open", Path: "/", Err: err}
+	}
+	defer closeFd(rootFd)
+
+	fd, err := openat2(rootFd, ".", unix.O_PATH, 0)
+	if errors.Is(err, unix.ENOSYS) {
+		return fmt.Errorf("confining the filesystem requires openat2 of linux 5.6 or newer: %w", errors.ErrUnsupported)
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to check support of openat2: %w", err)
+	}
+
+	closeFd(fd)
+	return nil
+}
+
+// checkBeneath checks that the existing part of the path does not resolve through a symlink.
+// Missing components are allowed because they are created by the operation.
+func checkBeneath(p confinedPath) error {
+	for {
+		fd, err := openBeneath(p, unix.O_PATH|unix.O_NOFOLLOW, 0)
+		if err == nil {
+			closeFd(fd)
+			return nil
+		}
+
+		if !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+
+		if p.isRoot() {
+			return nil
+		}
+
+		p = p.parent()
+	}
+}
+
+// openat2 opens the name relative to the dir with confinedResolve. It is retried if the kernel detected a
+// concurrent rename which could have affected the resolution.
+func openat2(dirFd int, name string, flags int, perm os.FileMode) (int, error) {
+	how := &unix.OpenHow{Flags: uint64(flags | unix.O_CLOEXEC), Resolve: confinedResolve}
+	if flags&unix.O_CREAT != 0 {
+		how.Mode = uint64(toUnixMode(perm))
+	}
+
+	for {
+		fd, err := unix.Openat2(dirFd, name, how)
+		if !errors.Is(err, unix.EINTR) && !errors.Is(err, unix.EAGAIN) {
+			return fd, err
+		}
+	}
+}
+
+// openBeneath opens the path relative to its root with openat2. The root itself may be a symlink.
+func openBeneath(p confinedPath, flags int, perm os.FileMode) (int, error) {
+	rootFd, err := unix.Open(p.root, unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return -1, &os.PathError{Op: "open", Path: p.root, Err: err}
+	}
+	defer closeFd(rootFd)
+
+	fd, err := openat2(rootFd, p.rel, flags, perm)
+	if err != nil {
+		return -1, confinedError("open", p, err)
+	}
+
+	return fd, nil
+}
+
+// openParent opens the dir containing the path, so that the path can be modified with its name relative to the dir.
+func openParent(p confinedPath) (int, error) {
+	if p.isRoot() {
+		return -1, fmt.Errorf("%w: %s is an allowed root and cannot be modified itself", ErrNotConfined, p.abs)
+	}
+
+	return openBeneath(p.parent(), unix.O_PATH|unix.O_DIRECTORY, 0)
+}
+
+// confinedError converts the errors of openat2 for paths through symlinks or outside the root into ErrNotConfined.
+func confinedError(op string, p confinedPath, err error) error {
+	if errors.Is(err, unix.ELOOP) || errors.Is(err, unix.EXDEV) {
+		return fmt.Errorf("%w: %s resolves through a symlink or leaves %s", ErrNotConfined, p.abs, p.root)
+	}
+
+	return &os.PathError{Op: op, Path: p.abs, Err: err}
+}
+
+// toUnixMode converts the permission bits and the special bits of the mode like os.Chmod.
+func toUnixMode(mode os.FileMode) uint32 {
+	unixMode := uint32(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		unixMode |= unix.S_ISUID
+	}
+	if mode&os.ModeSetgid != 0 {
+		unixMode |= unix.S_ISGID
+	}
+	if mode&os.ModeSticky != 0 {
+		unixMode |= unix.S_ISVTX
+	}
+
+	return unixMode
+}
+
+func closeFd(fd int) {
+	err := unix.Close(fd)
+	if err != nil {
+		log.Println(fmt.Errorf("failed to close fd: %w", err))
+	}
+}
+
+func (f ConfinedFileSystem) Lstat(name string) (os.FileInfo, error) {
+	p, ok, err := f.lookup(name)
+	if err != nil || !ok {
+		return f.FileSystem.Lstat(name)
+	}
+
+	return statBeneath(p, unix.O_NOFOLLOW)
+}
+
+func (f ConfinedFileSystem) Stat(name string) (os.FileInfo, error) {
+	p, ok, err := f.lookup(name)
+	if err != nil || !ok {
+		return f.FileSystem.Stat(name)
+	}
+
+	return statBeneath(p, 0)
+}
+
+func statBeneath(p confinedPath, flags int) (os.FileInfo, error) {
+	fd, err := openBeneath(p, unix.O_PATH|flags, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	file := os.NewFile(uintptr(fd), p.abs)
+	defer func() {
+		closeErr := file.Close()
+		if closeErr != nil {
+			log.Println(fmt.Errorf("failed to close fd: %w", closeErr))
+		}
+	}()
+
+	return file.Stat()
+}
+
+func (f ConfinedFileSystem) Open(name string) (*os.File, error) {
+	p, ok, err := f.lookup(name)
+	if err != nil || !ok {
+		return f.FileSystem.Open(name)
+	}
+
+	fd, err := openBeneath(p, unix.O_RDONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return os.NewFile(uintptr(fd), p.abs), nil
+}
+
+func (f ConfinedFileSystem) Create(name string) (*os.File, error) {
+	return f.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+func (f ConfinedFileSystem) OpenFile(name string, flag int, perm os.FileMode) (*os.File, error) {
+	p, err := f.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+
+	fd, err := openBeneath(p, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+
+	return os.NewFile(uintptr(fd), p.abs), nil
+}
+
+// MkdirAll creates the missing dirs one by one relative to the file descriptor of their parent. The root is created
+// without restrictions if it does not exist.
+func (f ConfinedFileSystem) MkdirAll(dirPath string, perm os.FileMode) error {
+	p, err := f.resolve(dirPath)
+	if err != nil {
+		return err
+	}
+
+	dirFd, err := unix.Open(p.root, unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if errors.Is(err, unix.ENOENT) {
+		err = f.FileSystem.MkdirAll(p.root, perm)
+		if err != nil {
+			return err
+		}
+
+		dirFd, err = unix.Open(p.root, unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	}
+
+	if err != nil {
+		return &os.PathError{Op: "open", Path: p.root, Err: err}
+	}
+
+	defer func() { closeFd(dirFd) }()
+	if p.isRoot() {
+		return nil
+	}
+
+	current := confinedPath{root: p.root, rel: "."}
+	for _, component := range strings.Split(p.rel, string(filepath.Separator)) {
+		current.rel = filepath.Join(current.rel, component)
+		current.abs = filepath.Join(p.root, current.rel)
+		nextFd, err := openat2(dirFd, component, unix.O_PATH|unix.O_DIRECTORY, 0)
+		if errors.Is(err, unix.ENOENT) {
+			err = unix.Mkdirat(dirFd, component, toUnixMode(perm))
+			if err != nil && !errors.Is(err, unix.EEXIST) {
+				return &os.PathError{Op: "mkdir", Path: current.abs, Err: err}
+			}
+
+			nextFd, err = openat2(dirFd, component, unix.O_PATH|unix.O_DIRECTORY, 0)
+		}
+
+		if err != nil {
+			return confinedError("mkdir", current, err)
+		}
+
+		closeFd(dirFd)
+		dirFd = nextFd
+	}
+
+	return nil
+}
+
+// DeleteFile removes the file, symlink or empty dir. Like FileSystem.DeleteFile, it ignores files which do not exist.
+func (f ConfinedFileSystem) DeleteFile(filePath string) error {
+	return f.unlink(filePath, "remove", 0)
+}
+
+// RemoveDir removes the dir if it is empty. Like FileSystem.RemoveDir, it ignores dirs which do not exist.
+func (f ConfinedFileSystem) RemoveDir(dirPath string) error {
+	return f.unlink(dirPath, "rmdir", unix.AT_REMOVEDIR)
+}
+
+func (f ConfinedFileSystem) unlink(filePath, op string, flags int) error {
+	p, err := f.resolve(filePath)
+	if err != nil {
+		return err
+	}
+
+	dirFd, err := openParent(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+	defer closeFd(dirFd)
+
+	var stat unix.Stat_t
+	if unix.Fstatat(dirFd, p.base(), &stat, unix.AT_SYMLINK_NOFOLLOW) != nil {
+		return nil
+	}
+
+	err = unix.Unlinkat(dirFd, p.base(), flags)
+	if flags == 0 && errors.Is(err, unix.EISDIR) {
+		err = unix.Unlinkat(dirFd, p.base(), unix.AT_REMOVEDIR)
+	}
+
+	if err != nil {
+		return &os.PathError{Op: op, Path: p.abs, Err: err}
+	}
+
+	return nil
+}
+
+func (f ConfinedFileSystem) Rename(oldPath, newPath string) error {
+	return f.linkAt(oldPath, newPath, "rename", func(oldDirFd int, oldName string, newDirFd int, newName string) error {
+		return unix.Renameat(oldDirFd, oldName, newDirFd, newName)
+	})
+}
+
+func (f ConfinedFileSystem) Link(oldname, newname string) error {
+	return f.linkAt(oldname, newname, "link", func(oldDirFd int, oldName string, newDirFd int, newName string) error {
+		// Like link(2), linkat does not follow a symlink as old name without AT_SYMLINK_FOLLOW.
+		return unix.Linkat(oldDirFd, oldName, newDirFd, newName, 0)
+	})
+}
+
+// linkAt applies the operation to the names of both paths relative to the file descriptors of their dirs.
+func (f ConfinedFileSystem) linkAt(oldPath, newPath, op string, operation func(oldDirFd int, oldName string, newDirFd int, newName string) error) error {
+	oldP, err := f.resolve(oldPath)
+	if err != nil {
+		return err
+	}
+
+	newP, err := f.resolve(newPath)
+	if err != nil {
+		return err
+	}
+
+	oldDirFd, err := openParent(oldP)
+	if err != nil {
+		return err
+	}
+	defer closeFd(oldDirFd)
+
+	newDirFd, err := openParent(newP)
+	if err != nil {
+		return err
+	}
+	defer closeFd(newDirFd)
+
+	err = operation(oldDirFd, oldP.base(), newDirFd, newP.base())
+	if err != nil {
+		return &os.LinkError{Op: op, Old: oldP.abs, New: newP.abs, Err: err}
+	}
+
+	return nil
+}
+
+func (f ConfinedFileSystem) Symlink(oldname, newname string) error {
+	p, err := f.resolve(newname)
+	if err != nil {
+		return err
+	}
+
+	dirFd, err := openParent(p)
+	if err != nil {
+		return err
+	}
+	defer closeFd(dirFd)
+
+	err = unix.Symlinkat(oldname, dirFd, p.base())
+	if err != nil {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: p.abs, Err: err}
+	}
+
+	return nil
+}
+
+func (f ConfinedFileSystem) Readlink(name string) (string, error) {
+	p, ok, err := f.lookup(name)
+	if err != nil || !ok {
+		return f.FileSystem.Readlink(name)
+	}
+
+	fd, err := openBeneath(p, unix.O_PATH|unix.O_NOFOLLOW, 0)
+	if err != nil {
+		return "", err
+	}
+	defer closeFd(fd)
+
+	// The empty name refers to the symlink opened with O_PATH itself.
+	for size := 256; ; size *= 2 {
+		buffer := make([]byte, size)
+		n, err := unix.Readlinkat(fd, "", buffer)
+		if err != nil {
+			return "", &os.PathError{Op: "readlink", Path: p.abs, Err: err}
+		}
+
+		if n < size {
+			return string(buffer[:n]), nil
+		}
+	}
+}
+
+func (f ConfinedFileSystem) SyncDir(dirPath string) error {
+	p, ok, err := f.lookup(dirPath)
+	if err != nil || !ok {
+		return f.FileSystem.SyncDir(dirPath)
+	}
+
+	fd, err := openBeneath(p, unix.O_RDONLY|unix.O_DIRECTORY, 0)
+	if err != nil {
+		return err
+	}
+	defer closeFd(fd)
+
+	err = unix.Fsync(fd)
+	if err != nil {
+		return &os.PathError{Op: "sync", Path: p.abs, Err: err}
+	}
+
+	return nil
+}
+
+func (f ConfinedFileSystem) Chmod(name string, mode os.FileMode) error {
+	return f.changeMetadata(name, func(filePath string) error {
+		return os.Chmod(filePath, mode)
+	})
+}
+
+func (f ConfinedFileSystem) Chown(name string, uid, gid int) error {
+	return f.changeMetadata(name, func(filePath string) error {
+		return os.Chown(filePath, uid, gid)
+	})
+}
+
+func (f ConfinedFileSystem) Chtimes(name string, atime, mtime time.Time) error {
+	return f.changeMetadata(name, func(filePath string) error {
+		return os.Chtimes(filePath, atime, mtime)
+	})
+}
+
+// changeMetadata applies the change to the file opened with O_PATH. The change is applied via the magic link of the
+// file descriptor in /proc, which refers to the opened file itself, so that it cannot be redirected. A symlink as
+// last component is rejected because the change would follow it.
+func (f ConfinedFileSystem) changeMetadata(name string, change func(filePath string) error) error {
+	p, err := f.resolve(name)
+	if err != nil {
+		return err
+	}
+
+	fd, err := openBeneath(p, unix.O_PATH, 0)
+	if err != nil {
+		return err
+	}
+	defer closeFd(fd)
+
+	err = change("/proc/self/fd/" + strconv.Itoa(fd))
+	var pathErr *os.PathError
+	if errors.As(err, &pathErr) {
+		pathErr.Path = p.abs
+	}
+
+	return err
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+
+package copy
+
+import (
+	"errors"
+	"fmt"
+)
+
+// checkConfinementSupport returns an error because the ConfinedFileSystem depends on openat2 of linux.
+func checkConfinementSupport() error {
+	return fmt.Errorf("confining the filesystem is only supported on linux: %w", errors.ErrUnsupported)
+}
+
+func checkBeneath(_ confinedPath) error {
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,178 @@
+//go:build linux
+
+package copy
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConfinedFileSystem(t *testing.T) {
+	type fixture struct {
+		root    string
+		outside string
+		sut     ConfinedFileSystem
+	}
+	setUp := func(t *testing.T) fixture {
+		root := t.TempDir()
+		outside := t.TempDir()
+		require.NoError(t, os.Symlink(outside, filepath.Join(root, "escape")))
+		writeTestFile(t, filepath.Join(outside, "target"), "outside")
+		require.NoError(t, os.Symlink(filepath.Join(outside, "target"), filepath.Join(root, "link")))
+		sut, err := NewConfinedFileSystem([]string{root})
+		require.NoError(t, err)
+		return fixture{root: root, outside: outside, sut: sut}
+	}
+
+	t.Run("should write files and create dirs beneath the root", func(t *testing.T) {
+		// given
+		f := setUp(t)
+
+		// when
+		err := writeAtomically("src", filepath.Join(f.root, "sub", "dir", "app.conf"), strings.NewReader("app"), f.sut, FileAttributes{})
+
+		// then
+		require.NoError(t, err)
+		assert.FileExists(t, filepath.Join(f.root, "sub", "dir", "app.conf"))
+	})
+
+	t.Run("should reject paths outside of the roots", func(t *testing.T) {
+		// given
+		f := setUp(t)
+
+		// when
+		err := f.sut.MkdirAll(filepath.Join(f.root, "..", "sibling"), 0770)
+
+		// then
+		require.ErrorIs(t, err, ErrNotConfined)
+		assert.ErrorContains(t, err, "is outside of "+f.root)
+		assert.NoDirExists(t, filepath.Join(f.root, "..", "sibling"))
+	})
+
+	t.Run("should reject paths through symlinks", func(t *testing.T) {
+		// given
+		f := setUp(t)
+
+		// when
+		mkdirErr := f.sut.MkdirAll(filepath.Join(f.root, "escape", "dir"), 0770)
+		createErr := writeAtomically("src", filepath.Join(f.root, "escape", "app.conf"), strings.NewReader("app"), f.sut, FileAttributes{})
+		deleteErr := f.sut.DeleteFile(filepath.Join(f.root, "escape", "target"))
+
+		// then
+		require.ErrorIs(t, mkdirErr, ErrNotConfined)
+		assert.ErrorContains(t, mkdirErr, filepath.Join(f.root, "escape")+" resolves through a symlink")
+		require.ErrorIs(t, createErr, ErrNotConfined)
+		require.ErrorIs(t, deleteErr, ErrNotConfined)
+		entries, err := os.ReadDir(f.outside)
+		require.NoError(t, err)
+		assert.Len(t, entries, 1)
+	})
+
+	t.Run("should only follow a symlink as last component if the operation does not follow it", func(t *testing.T) {
+		// given
+		f := setUp(t)
+
+		// when
+		chmodErr := f.sut.Chmod(filepath.Join(f.root, "link"), 0600)
+		deleteErr := f.sut.DeleteFile(filepath.Join(f.root, "link"))
+
+		// then
+		require.ErrorIs(t, chmodErr, ErrNotConfined)
+		require.NoError(t, deleteErr)
+		assert.NoFileExists(t, filepath.Join(f.root, "link"))
+		assert.FileExists(t, filepath.Join(f.outside, "target"))
+	})
+
+	t.Run("should change metadata, link and rename files beneath the root", func(t *testing.T) {
+		// given
+		f := setUp(t)
+		filePath := filepath.Join(f.root, "app.conf")
+		writeTestFile(t, filePath, "app")
+
+		// when
+		chmodErr := f.sut.Chmod(filePath, 0600)
+		linkErr := f.sut.Link(filePath, filepath.Join(f.root, "linked.conf"))
+		renameErr := f.sut.Rename(filepath.Join(f.root, "linked.conf"), filepath.Join(f.root, "renamed.conf"))
+		target, readlinkErr := f.sut.Readlink(filepath.Join(f.root, "link"))
+
+		// then
+		require.NoError(t, chmodErr)
+		require.NoError(t, linkErr)
+		require.NoError(t, renameErr)
+		require.NoError(t, readlinkErr)
+		fileInfo, err := f.sut.Stat(filepath.Join(f.root, "renamed.conf"))
+		require.NoError(t, err)
+		assert.Equal(t, "renamed.conf", fileInfo.Name())
+		assert.Equal(t, os.FileMode(0600), fileInfo.Mode().Perm())
+		assert.Equal(t, filepath.Join(f.outside, "target"), target)
+	})
+
+	t.Run("should reject reads through symlinks beneath the root but read other paths", func(t *testing.T) {
+		// given
+		f := setUp(t)
+
+		// when
+		_, statErr := f.sut.Stat(filepath.Join(f.root, "link"))
+		_, openErr := f.sut.Open(filepath.Join(f.root, "escape", "target"))
+		syncErr := f.sut.SyncDir(filepath.Join(f.root, "escape"))
+		linkInfo, lstatErr := f.sut.Lstat(filepath.Join(f.root, "link"))
+		file, outsideErr := f.sut.Open(filepath.Join(f.outside, "target"))
+
+		// then
+		require.ErrorIs(t, statErr, ErrNotConfined)
+		require.ErrorIs(t, openErr, ErrNotConfined)
+		require.ErrorIs(t, syncErr, ErrNotConfined)
+		require.NoError(t, lstatErr)
+		assert.NotZero(t, linkInfo.Mode()&os.ModeSymlink)
+		require.NoError(t, outsideErr)
+		require.NoError(t, file.Close())
+	})
+
+	t.Run("should apply the operation to the cleaned path", func(t *testing.T) {
+		// given
+		f := setUp(t)
+
+		// when
+		err := f.sut.MkdirAll(filepath.Join(f.root, "escape")+"/../dir", 0770)
+
+		// then
+		require.NoError(t, err)
+		assert.DirExists(t, filepath.Join(f.root, "dir"))
+		assert.NoDirExists(t, filepath.Join(filepath.Dir(f.outside), "dir"))
+	})
+
+	t.Run("should reject deleting tracked files outside of the roots", func(t *testing.T) {
+		// given
+		f := setUp(t)
+		doguConfig := newMemoryDoguConfig()
+		doguConfig.values[additionalMountsConfigKey] = "- " + filepath.Join(f.outside, "target") + "\n"
+		tracker := NewLocalConfigFileTracker(doguConfig, f.sut)
+
+		// when
+		err := tracker.DeleteAllTrackedFiles()
+
+		// then
+		require.ErrorIs(t, err, ErrNotConfined)
+		assert.FileExists(t, filepath.Join(f.outside, "target"))
+	})
+	t.Run("should reject deleting tracked dirs outside of the roots", func(t *testing.T) {
+		// given
+		f := setUp(t)
+		dir := filepath.Join(f.outside, "empty")
+		require.NoError(t, os.Mkdir(dir, 0755))
+		doguConfig := newMemoryDoguConfig()
+		doguConfig.values[additionalMountsDirsConfigKey] = "- " + dir + "\n"
+		tracker := NewLocalConfigFileTracker(doguConfig, f.sut)
+
+		// when
+		err := tracker.DeleteAllTrackedFiles()
+
+		// then
+		require.ErrorIs(t, err, ErrNotConfined)
+		assert.DirExists(t, dir)
+	})
+}
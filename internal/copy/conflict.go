@@ -0,0 +1,212 @@
+package copy
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ConflictPolicy defines how existing destination files are handled which were not copied by this application.
+type ConflictPolicy string
+
+const (
+	// ConflictOverwrite overwrites existing files. This is the default.
+	// The original file is kept in the OriginalsDir or as hidden file next to the destination and restored when the
+	// copied file is cleaned up.
+	ConflictOverwrite ConflictPolicy = "overwrite"
+	// ConflictSkip keeps existing files and skips the source file.
+	ConflictSkip ConflictPolicy = "skip"
+	// ConflictFail fails the source file if the destination file already exists.
+	ConflictFail ConflictPolicy = "fail"
+	// ConflictBackup keeps existing files with the backup suffix appended to their name before overwriting them.
+	// The backup is restored when the copied file is cleaned up.
+	ConflictBackup ConflictPolicy = "backup"
+)
+
+// originalFileSuffix is appended to the hidden copy of an original file which is overwritten with ConflictOverwrite.
+const originalFileSuffix = ".orig"
+
+// DefaultBackupSuffix is appended to backups of existing files if no other suffix is defined.
+const DefaultBackupSuffix = ".bak"
+
+// ParseConflictPolicy returns the conflict policy with the given name.
+func ParseConflictPolicy(name string) (ConflictPolicy, error) {
+	policy := ConflictPolicy(name)
+	switch policy {
+	case ConflictOverwrite, ConflictSkip, ConflictFail, ConflictBackup:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown conflict policy %q, expected one of %s, %s, %s, %s", name, ConflictOverwrite, ConflictSkip, ConflictFail, ConflictBackup)
+	}
+}
+
+// ValidateBackupSuffix checks if the suffix can be appended to a file name.
+func ValidateBackupSuffix(suffix string) error {
+	if suffix == "" {
+		return fmt.Errorf("backup suffix must not be empty")
+	}
+
+	if strings.Contains(suffix, "/") {
+		return fmt.Errorf("backup suffix %q must not contain a slash", suffix)
+	}
+
+	return nil
+}
+
+func (m SrcAndDestination) conflictPolicy() ConflictPolicy {
+	if m.Conflict == "" {
+		return ConflictOverwrite
+	}
+
+	return m.Conflict
+}
+
+func (m SrcAndDestination) backupSuffix() string {
+	if m.BackupSuffix == "" {
+		return DefaultBackupSuffix
+	}
+
+	return m.BackupSuffix
+}
+
+// isConflict checks if the existing destination file was not copied by this application in this or a previous run.
+func (v *VolumeMountCopier) isConflict(destinationFilePath string) (bool, error) {
+	tracked, err := v.fileTracker.IsTracked(destinationFilePath)
+	if err != nil {
+		return false, fmt.Errorf("failed to check if destination file %s is tracked: %w", destinationFilePath, err)
+	}
+
+	return !tracked, nil
+}
+
+// resolveConflict handles the existing destination file according to the conflict policy of the mount.
+// It returns true if the source file should be written to the destination.
+func (v *VolumeMountCopier) resolveConflict(mount SrcAndDestination, filePath, destinationFilePath string) (bool, error) {
+	switch mount.conflictPolicy() {
+	case ConflictSkip:
+		log.Printf("skip source file %s because destination file %s already exists", filePath, destinationFilePath)
+		v.summary.addKept()
+		return false, nil
+	case ConflictFail:
+		return false, fmt.Errorf("destination file %s of source file %s already exists", destinationFilePath, filePath)
+	case ConflictBackup:
+		err := v.backupFile(destinationFilePath, destinationFilePath+mount.backupSuffix())
+		if err != nil {
+			return false, err
+		}
+
+		return true, nil
+	default:
+		// Keep the original file, e.g. shipped with the dogu image, so that it can be restored on cleanup.
+		err := v.backupFile(destinationFilePath, v.getOriginalFilePath(destinationFilePath))
+		if err != nil {
+			return false, err
+		}
+
+		return true, nil
+	}
+}
+
+// backupFile keeps a snapshot of the file at the backup path and records the backup, so that it is restored on cleanup.
+// The original file stays in place until it is replaced by the written file. The file is tracked before, so that the
+// backup is restored on cleanup even if writing fails. An existing backup is never overwritten unless it is a
+// leftover hard link to the file from an interrupted run. Files in the OriginalsDir are only written by this
+// application, so an existing original of a file which is not tracked is a leftover of an interrupted run as well
+// and is replaced.
+func (v *VolumeMountCopier) backupFile(filePath, backupPath string) error {
+	backupFileInfo, err := v.fileSystem.Lstat(backupPath)
+	backupExists := err == nil
+	inOriginalsDir := v.options.OriginalsDir != "" && isWithin(v.options.OriginalsDir, backupPath)
+	leftover := backupExists && inOriginalsDir
+	if backupExists && !leftover && !v.isHardLinkOf(filePath, backupFileInfo) {
+		return fmt.Errorf("failed to back up file %s because backup %s already exists", filePath, backupPath)
+	}
+
+	if v.options.DryRun {
+		log.Printf("Dry run: would back up file %s to %s", filePath, backupPath)
+		return nil
+	}
+
+	if leftover && !v.isHardLinkOf(filePath, backupFileInfo) {
+		log.Printf("Remove leftover original %s of an interrupted run", backupPath)
+		err = v.fileSystem.DeleteFile(backupPath)
+		if err != nil {
+			return fmt.Errorf("failed to remove leftover original %s: %w", backupPath, err)
+		}
+
+		backupExists = false
+	}
+
+	if !backupExists && inOriginalsDir {
+		err = createDirs(path.Dir(backupPath), FileAttributes{}, v.fileSystem)
+		if err != nil {
+			return fmt.Errorf("failed to create dirs for backup %s: %w", backupPath, err)
+		}
+	}
+
+	if !backupExists {
+		err = v.snapshotFile(filePath, backupPath)
+		if err != nil {
+			return fmt.Errorf("failed to back up file %s to %s: %w", filePath, backupPath, err)
+		}
+	}
+
+	log.Printf("Backed up file %s to %s", filePath, backupPath)
+
+	err = v.fileTracker.SetBackup(filePath, backupPath)
+	if err != nil {
+		return err
+	}
+
+	return v.fileTracker.AddFile(filePath)
+}
+
+// snapshotFile creates a hard link to the file at the backup path. If the filesystem does not permit the link, e.g.
+// because of protected hard links or because the backup is on another filesystem, the file is copied with its
+// metadata instead.
+func (v *VolumeMountCopier) snapshotFile(filePath, backupPath string) error {
+	err := v.fileSystem.Link(filePath, backupPath)
+	if err == nil {
+		return nil
+	}
+
+	log.Printf("failed to link %s to %s, falling back to copy: %s", filePath, backupPath, err)
+
+	fileInfo, err := v.fileSystem.Lstat(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to get file info of %s: %w", filePath, err)
+	}
+
+	if fileInfo.Mode()&os.ModeSymlink == 0 {
+		return copyFile(filePath, backupPath, v.fileSystem, FileAttributes{PreserveMetadata: true})
+	}
+
+	target, err := v.fileSystem.Readlink(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to read symlink %s: %w", filePath, err)
+	}
+
+	return createSymlink(target, backupPath, v.fileSystem, FileAttributes{})
+}
+
+func (v *VolumeMountCopier) isHardLinkOf(filePath string, backupFileInfo os.FileInfo) bool {
+	fileInfo, err := v.fileSystem.Lstat(filePath)
+	return err == nil && v.fileSystem.SameFile(fileInfo, backupFileInfo)
+}
+
+// getOriginalFilePath returns the path of the original file below the OriginalsDir or, if it is not configured, the
+// path of the hidden original file next to the destination file.
+func (v *VolumeMountCopier) getOriginalFilePath(destFilePath string) string {
+	if v.options.OriginalsDir != "" {
+		absPath, err := filepath.Abs(destFilePath)
+		if err == nil {
+			return filepath.Join(v.options.OriginalsDir, absPath)
+		}
+	}
+
+	dir, file := path.Split(destFilePath)
+	return path.Join(dir, "."+file+originalFileSuffix)
+}
@@ -0,0 +1,254 @@
+package copy
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseConflictPolicy(t *testing.T) {
+	t.Run("should parse known policies", func(t *testing.T) {
+		for _, name := range []string{"overwrite", "skip", "fail", "backup"} {
+			policy, err := ParseConflictPolicy(name)
+
+			require.NoError(t, err)
+			assert.Equal(t, ConflictPolicy(name), policy)
+		}
+	})
+
+	t.Run("should return error on unknown policy", func(t *testing.T) {
+		_, err := ParseConflictPolicy("keep")
+
+		assert.ErrorContains(t, err, `unknown conflict policy "keep"`)
+	})
+}
+
+func TestValidateBackupSuffix(t *testing.T) {
+	assert.NoError(t, ValidateBackupSuffix(".orig"))
+	assert.ErrorContains(t, ValidateBackupSuffix(""), "must not be empty")
+	assert.ErrorContains(t, ValidateBackupSuffix("/.bak"), "must not contain a slash")
+}
+
+func TestVolumeMountCopier_CopyVolumeMount_conflicts(t *testing.T) {
+	setup := func(t *testing.T) (src, dest string, tracker *LocalConfigFileTracker) {
+		src = t.TempDir()
+		dest = t.TempDir()
+		writeTestFile(t, filepath.Join(src, "config"), "new")
+		writeTestFile(t, filepath.Join(dest, "config"), "existing")
+		fileSystem := FileSystem{}
+		return src, dest, NewLocalConfigFileTracker(newMemoryDoguConfig(), fileSystem)
+	}
+	readFile := func(t *testing.T, filePath string) string {
+		content, err := os.ReadFile(filePath)
+		require.NoError(t, err)
+		return string(content)
+	}
+
+	t.Run("should overwrite existing file by default and restore the original on cleanup", func(t *testing.T) {
+		// given
+		src, dest, tracker := setup(t)
+		sut := NewVolumeMountCopier(FileSystem{}, tracker, Options{})
+
+		// when
+		err := sut.CopyVolumeMount([]SrcAndDestination{{Src: src, Dest: dest}})
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, "new", readFile(t, filepath.Join(dest, "config")))
+		assert.Equal(t, "existing", readFile(t, filepath.Join(dest, ".config.orig")))
+
+		// when
+		err = tracker.DeleteAllTrackedFiles()
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, "existing", readFile(t, filepath.Join(dest, "config")))
+		assert.NoFileExists(t, filepath.Join(dest, ".config.orig"))
+	})
+
+	t.Run("should keep untracked file with the same content on cleanup", func(t *testing.T) {
+		// given
+		src, dest, tracker := setup(t)
+		writeTestFile(t, filepath.Join(dest, "config"), "new")
+		sut := NewVolumeMountCopier(FileSystem{}, tracker, Options{})
+
+		// when
+		err := sut.CopyVolumeMount([]SrcAndDestination{{Src: src, Dest: dest}})
+		require.NoError(t, err)
+		err = tracker.DeleteStaleTrackedFiles()
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, 1, sut.summary.unchanged)
+		assert.Equal(t, "new", readFile(t, filepath.Join(dest, "config")))
+	})
+
+	t.Run("should keep existing file and not track it", func(t *testing.T) {
+		// given
+		src, dest, tracker := setup(t)
+		sut := NewVolumeMountCopier(FileSystem{}, tracker, Options{})
+
+		// when
+		err := sut.CopyVolumeMount([]SrcAndDestination{{Src: src, Dest: dest, Conflict: ConflictSkip}})
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, 1, sut.summary.kept)
+		assert.Equal(t, "existing", readFile(t, filepath.Join(dest, "config")))
+		tracked, err := tracker.IsTracked(filepath.Join(dest, "config"))
+		require.NoError(t, err)
+		assert.False(t, tracked)
+	})
+
+	t.Run("should overwrite tracked file regardless of the policy", func(t *testing.T) {
+		// given
+		src, dest, tracker := setup(t)
+		require.NoError(t, tracker.AddFile(filepath.Join(dest, "config")))
+		sut := NewVolumeMountCopier(FileSystem{}, tracker, Options{})
+
+		// when
+		err := sut.CopyVolumeMount([]SrcAndDestination{{Src: src, Dest: dest, Conflict: ConflictFail}})
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, "new", readFile(t, filepath.Join(dest, "config")))
+	})
+
+	t.Run("should fail on existing file", func(t *testing.T) {
+		// given
+		src, dest, tracker := setup(t)
+		sut := NewVolumeMountCopier(FileSystem{}, tracker, Options{})
+
+		// when
+		err := sut.CopyVolumeMount([]SrcAndDestination{{Src: src, Dest: dest, Conflict: ConflictFail}})
+
+		// then
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "already exists")
+		assert.Equal(t, 1, sut.summary.failed)
+		assert.Equal(t, "existing", readFile(t, filepath.Join(dest, "config")))
+	})
+
+	t.Run("should back up existing file and restore it on cleanup", func(t *testing.T) {
+		// given
+		src, dest, tracker := setup(t)
+		sut := NewVolumeMountCopier(FileSystem{}, tracker, Options{})
+
+		// when
+		err := sut.CopyVolumeMount([]SrcAndDestination{{Src: src, Dest: dest, Conflict: ConflictBackup, BackupSuffix: ".orig"}})
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, "new", readFile(t, filepath.Join(dest, "config")))
+		assert.Equal(t, "existing", readFile(t, filepath.Join(dest, "config.orig")))
+
+		// when
+		err = tracker.DeleteAllTrackedFiles()
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, "existing", readFile(t, filepath.Join(dest, "config")))
+		assert.NoFileExists(t, filepath.Join(dest, "config.orig"))
+	})
+
+	t.Run("should not overwrite an existing backup", func(t *testing.T) {
+		// given
+		src, dest, tracker := setup(t)
+		writeTestFile(t, filepath.Join(dest, "config.bak"), "backup")
+		sut := NewVolumeMountCopier(FileSystem{}, tracker, Options{})
+
+		// when
+		err := sut.CopyVolumeMount([]SrcAndDestination{{Src: src, Dest: dest, Conflict: ConflictBackup}})
+
+		// then
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "backup")
+		assert.Equal(t, "existing", readFile(t, filepath.Join(dest, "config")))
+		assert.Equal(t, "backup", readFile(t, filepath.Join(dest, "config.bak")))
+	})
+	t.Run("should keep the original in place and restore it on cleanup if writing fails", func(t *testing.T) {
+		// given
+		src, dest, _ := setup(t)
+		doguConfig := newMemoryDoguConfig()
+		sut := NewVolumeMountCopier(FileSystem{}, NewLocalConfigFileTracker(doguConfig, FileSystem{}), Options{})
+		sut.copier = func(string, string, Filesystem, FileAttributes) error {
+			return assert.AnError
+		}
+
+		// when
+		err := sut.CopyVolumeMount([]SrcAndDestination{{Src: src, Dest: dest}})
+
+		// then
+		require.ErrorIs(t, err, assert.AnError)
+		assert.Equal(t, "existing", readFile(t, filepath.Join(dest, "config")))
+		assert.Equal(t, "existing", readFile(t, filepath.Join(dest, ".config.orig")))
+
+		// when
+		err = NewLocalConfigFileTracker(doguConfig, FileSystem{}).DeleteStaleTrackedFiles()
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, "existing", readFile(t, filepath.Join(dest, "config")))
+		assert.NoFileExists(t, filepath.Join(dest, ".config.orig"))
+	})
+
+	t.Run("should reuse the hard link of an interrupted backup", func(t *testing.T) {
+		// given
+		src, dest, tracker := setup(t)
+		require.NoError(t, os.Link(filepath.Join(dest, "config"), filepath.Join(dest, ".config.orig")))
+		sut := NewVolumeMountCopier(FileSystem{}, tracker, Options{})
+
+		// when
+		err := sut.CopyVolumeMount([]SrcAndDestination{{Src: src, Dest: dest}})
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, "new", readFile(t, filepath.Join(dest, "config")))
+		assert.Equal(t, "existing", readFile(t, filepath.Join(dest, ".config.orig")))
+	})
+
+	t.Run("should keep the original in the originals dir and restore it on cleanup", func(t *testing.T) {
+		// given
+		src, dest, tracker := setup(t)
+		originalsDir := t.TempDir()
+		original := filepath.Join(originalsDir, dest, "config")
+		sut := NewVolumeMountCopier(FileSystem{}, tracker, Options{OriginalsDir: originalsDir})
+
+		// when
+		err := sut.CopyVolumeMount([]SrcAndDestination{{Src: src, Dest: dest}})
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, "new", readFile(t, filepath.Join(dest, "config")))
+		assert.Equal(t, "existing", readFile(t, original))
+		assert.NoFileExists(t, filepath.Join(dest, ".config.orig"))
+
+		// when
+		err = tracker.DeleteAllTrackedFiles()
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, "existing", readFile(t, filepath.Join(dest, "config")))
+		assert.NoFileExists(t, original)
+		assert.NoDirExists(t, filepath.Join(originalsDir, dest))
+	})
+
+	t.Run("should replace a leftover original in the originals dir", func(t *testing.T) {
+		// given
+		src, dest, tracker := setup(t)
+		originalsDir := t.TempDir()
+		original := filepath.Join(originalsDir, dest, "config")
+		writeTestFile(t, original, "leftover")
+		sut := NewVolumeMountCopier(FileSystem{}, tracker, Options{OriginalsDir: originalsDir})
+
+		// when
+		err := sut.CopyVolumeMount([]SrcAndDestination{{Src: src, Dest: dest}})
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, "new", readFile(t, filepath.Join(dest, "config")))
+		assert.Equal(t, "existing", readFile(t, original))
+	})
+}
@@ -1,12 +1,47 @@
 package copy
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"log"
+	"math/rand/v2"
+	"os"
 	"path"
+	"regexp"
+	"strconv"
+	"syscall"
+	"time"
 )
 
-func copyFile(srcfilePath, destFilePath string, fileSystem Filesystem) error {
+const (
+	tempFileSuffix = ".tmp"
+	defaultDirMode = os.FileMode(0770)
+)
+
+// FileAttributes define the metadata of a copied destination file.
+type FileAttributes struct {
+	// PreserveMetadata carries over the permission bits, the modification time and, if permitted, the ownership
+	// of the source file.
+	PreserveMetadata bool
+	// Owner is the uid of the destination file and of created parent dirs. It takes precedence over a preserved owner.
+	Owner *int
+	// Group is the gid of the destination file and of created parent dirs. It takes precedence over a preserved group.
+	Group *int
+	// FileMode is the permission of the destination file. It takes precedence over preserved permission bits.
+	FileMode *os.FileMode
+	// DirMode is the permission of created parent dirs.
+	DirMode *os.FileMode
+}
+
+// copyFile copies the source file atomically to the destination.
+// The content is written to a temporary file in the destination directory which is flushed and renamed to the
+// destination file afterward. This way the destination contains either the old or the new content but never a
+// partially written file.
+func copyFile(srcfilePath, destFilePath string, fileSystem Filesystem, attributes FileAttributes) error {
 	from, err := fileSystem.Open(srcfilePath)
 	if err != nil {
 		return fmt.Errorf("failed to open file %s: %w", srcfilePath, err)
@@ -19,14 +54,81 @@ func copyFile(srcfilePath, destFilePath string, fileSystem Filesystem) error {
 		}
 	}()
 
-	err = fileSystem.MkdirAll(path.Dir(destFilePath), 0770)
+	return writeAtomically(srcfilePath, destFilePath, from, fileSystem, attributes)
+}
+
+// writeAtomically writes the content of the source file read from the reader atomically to the destination.
+func writeAtomically(srcfilePath, destFilePath string, from io.Reader, fileSystem Filesystem, attributes FileAttributes) error {
+	_, err := writeAtomicallyIfReplaced(srcfilePath, destFilePath, from, fileSystem, attributes, nil)
+	return err
+}
+
+// writeAtomicallyIfReplaced writes the content like writeAtomically. If replace is set, it is called with the hex
+// encoded SHA-256 digest of the content before the destination file is replaced and the destination file is kept if
+// it returns false. This allows to compare content which can only be read once, e.g. archive entries. It returns
+// whether the destination file was replaced.
+func writeAtomicallyIfReplaced(srcfilePath, destFilePath string, from io.Reader, fileSystem Filesystem, attributes FileAttributes, replace func(digest string) (bool, error)) (bool, error) {
+	destDir := path.Dir(destFilePath)
+	err := createDirs(destDir, attributes, fileSystem)
+	if err != nil {
+		return false, fmt.Errorf("failed to create dirs for path %s: %w", destFilePath, err)
+	}
+
+	// The hash is only calculated if needed because the reader prevents accelerated copies.
+	hash := sha256.New()
+	if replace != nil {
+		from = io.TeeReader(from, hash)
+	}
+
+	tempFilePath := getTempFilePath(destFilePath)
+	start := time.Now()
+	written, method, err := writeTempFile(srcfilePath, tempFilePath, from, fileSystem)
+	if err != nil {
+		removeTempFile(tempFilePath, fileSystem)
+		return false, err
+	}
+
+	if replace != nil {
+		ok, err := replace(hex.EncodeToString(hash.Sum(nil)))
+		if err != nil || !ok {
+			removeTempFile(tempFilePath, fileSystem)
+			return false, err
+		}
+	}
+
+	err = applyExistingMetadata(destFilePath, tempFilePath, attributes, fileSystem)
+	if err != nil {
+		removeTempFile(tempFilePath, fileSystem)
+		return false, err
+	}
+
+	err = applyFileAttributes(srcfilePath, tempFilePath, attributes, fileSystem)
 	if err != nil {
-		return fmt.Errorf("failed to create dirs for path %s: %w", destFilePath, err)
+		removeTempFile(tempFilePath, fileSystem)
+		return false, err
 	}
 
-	to, err := fileSystem.Create(destFilePath)
+	err = fileSystem.Rename(tempFilePath, destFilePath)
 	if err != nil {
-		return fmt.Errorf("failed to open file %s: %w", destFilePath, err)
+		removeTempFile(tempFilePath, fileSystem)
+		return false, fmt.Errorf("failed to rename temporary file %s to %s: %w", tempFilePath, destFilePath, err)
+	}
+
+	err = fileSystem.SyncDir(destDir)
+	if err != nil {
+		return false, fmt.Errorf("failed to sync dir %s: %w", destDir, err)
+	}
+
+	duration := time.Since(start)
+	log.Printf("Copied file %s to %s (%d bytes in %s, %s, %s)", srcfilePath, destFilePath, written, duration, formatThroughput(written, duration), method)
+
+	return true, nil
+}
+
+func writeTempFile(srcfilePath, tempFilePath string, from io.Reader, fileSystem Filesystem) (int64, CopyMethod, error) {
+	to, err := fileSystem.Create(tempFilePath)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to open file %s: %w", tempFilePath, err)
 	}
 
 	defer func() {
@@ -36,17 +138,263 @@ func copyFile(srcfilePath, destFilePath string, fileSystem Filesystem) error {
 		}
 	}()
 
-	_, err = fileSystem.Copy(to, from)
+	written, method, err := fileSystem.Copy(to, from)
 	if err != nil {
-		return fmt.Errorf("failed to copy from %s to %s: %w", srcfilePath, destFilePath, err)
+		return 0, "", fmt.Errorf("failed to copy from %s to %s: %w", srcfilePath, tempFilePath, err)
 	}
 
 	err = fileSystem.SyncFile(to)
 	if err != nil {
-		return fmt.Errorf("failed to flush buffer to file %s: %w", destFilePath, err)
+		return 0, "", fmt.Errorf("failed to flush buffer to file %s: %w", tempFilePath, err)
 	}
 
-	log.Printf("Copied file %s to %s", srcfilePath, destFilePath)
+	return written, method, nil
+}
+
+// formatThroughput returns the throughput in MiB/s.
+func formatThroughput(written int64, duration time.Duration) string {
+	if duration <= 0 {
+		return "n/a MiB/s"
+	}
+
+	return fmt.Sprintf("%.2f MiB/s", float64(written)/(1<<20)/duration.Seconds())
+}
+
+// createDirs creates the dir and all missing parents.
+// If the attributes define a dir mode or an owner, they are set explicitly on every created dir because
+// MkdirAll is subject to the umask and creates the dirs with the uid and gid of the process.
+func createDirs(dir string, attributes FileAttributes, fileSystem Filesystem) error {
+	dirMode := defaultDirMode
+	if attributes.DirMode != nil {
+		dirMode = *attributes.DirMode
+	}
+
+	if attributes.DirMode == nil && attributes.Owner == nil && attributes.Group == nil {
+		return fileSystem.MkdirAll(dir, dirMode)
+	}
+
+	missingDirs, err := getMissingDirs(dir, fileSystem)
+	if err != nil {
+		return err
+	}
+
+	err = fileSystem.MkdirAll(dir, dirMode)
+	if err != nil {
+		return err
+	}
+
+	for _, missingDir := range missingDirs {
+		err = applyOwnerAndMode(missingDir, attributes.Owner, attributes.Group, attributes.DirMode, fileSystem)
+		if err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
+
+// getMissingDirs returns the dir and all of its parents which do not exist yet, starting with the topmost one.
+func getMissingDirs(dir string, fileSystem Filesystem) ([]string, error) {
+	var missingDirs []string
+	for current := dir; ; current = path.Dir(current) {
+		_, err := fileSystem.Stat(current)
+		if err == nil {
+			break
+		}
+
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("failed to get file info of dir %s: %w", current, err)
+		}
+
+		missingDirs = append([]string{current}, missingDirs...)
+		if path.Dir(current) == current {
+			break
+		}
+	}
+
+	return missingDirs, nil
+}
+
+// applyExistingMetadata carries over the permission bits and the ownership of an existing destination file to the
+// temporary file, so that replacing the destination does not change them. Metadata defined by the attributes is applied
+// afterward and takes precedence. The ownership is only carried over if the process is permitted to do so.
+func applyExistingMetadata(destFilePath, tempFilePath string, attributes FileAttributes, fileSystem Filesystem) error {
+	if attributes.PreserveMetadata {
+		return nil
+	}
+
+	destFileInfo, err := fileSystem.Lstat(destFilePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to get file info of destination file %s: %w", destFilePath, err)
+	}
+
+	if !destFileInfo.Mode().IsRegular() {
+		return nil
+	}
+
+	uid, gid, ok := getFileOwner(destFileInfo)
+	if ok && (attributes.Owner == nil || attributes.Group == nil) {
+		err = fileSystem.Chown(tempFilePath, uid, gid)
+		if errors.Is(err, fs.ErrPermission) {
+			log.Printf("skip keeping owner %d:%d of file %s because of missing permissions", uid, gid, destFilePath)
+		} else if err != nil {
+			return fmt.Errorf("failed to change owner of file %s to %d:%d: %w", tempFilePath, uid, gid, err)
+		}
+	}
+
+	if attributes.FileMode == nil {
+		mode := destFileInfo.Mode() & (fs.ModePerm | fs.ModeSetuid | fs.ModeSetgid | fs.ModeSticky)
+		err = fileSystem.Chmod(tempFilePath, mode)
+		if err != nil {
+			return fmt.Errorf("failed to change mode of file %s to %s: %w", tempFilePath, mode, err)
+		}
+	}
+
+	return nil
+}
+
+// applyFileAttributes sets the metadata defined by the attributes on the written file.
+func applyFileAttributes(srcfilePath, filePath string, attributes FileAttributes, fileSystem Filesystem) error {
+	if attributes.PreserveMetadata {
+		err := preserveMetadata(srcfilePath, filePath, fileSystem)
+		if err != nil {
+			return err
+		}
+	}
+
+	return applyOwnerAndMode(filePath, attributes.Owner, attributes.Group, attributes.FileMode, fileSystem)
+}
+
+// hasFileAttributes checks if the destination file already has the metadata defined by the attributes for a file
+// copied from the source file. The owner is only compared if the file infos provide it.
+func hasFileAttributes(srcFileInfo, destFileInfo os.FileInfo, attributes FileAttributes) bool {
+	const modeMask = fs.ModePerm | fs.ModeSetuid | fs.ModeSetgid | fs.ModeSticky
+	owner, group, mode := attributes.Owner, attributes.Group, attributes.FileMode
+	if attributes.PreserveMetadata {
+		if !srcFileInfo.ModTime().Equal(destFileInfo.ModTime()) {
+			return false
+		}
+
+		srcMode := srcFileInfo.Mode()
+		if mode == nil {
+			mode = &srcMode
+		}
+
+		if srcUID, srcGID, ok := getFileOwner(srcFileInfo); ok {
+			if owner == nil {
+				owner = &srcUID
+			}
+			if group == nil {
+				group = &srcGID
+			}
+		}
+	}
+
+	if mode != nil && *mode&modeMask != destFileInfo.Mode()&modeMask {
+		return false
+	}
+
+	uid, gid, ok := getFileOwner(destFileInfo)
+	if !ok {
+		return true
+	}
+
+	return (owner == nil || *owner == uid) && (group == nil || *group == gid)
+}
+
+// applyOwnerAndMode changes the owner, the group and the mode of the file if they are set.
+func applyOwnerAndMode(filePath string, owner, group *int, mode *os.FileMode, fileSystem Filesystem) error {
+	if owner != nil || group != nil {
+		// -1 keeps the current value
+		uid, gid := -1, -1
+		if owner != nil {
+			uid = *owner
+		}
+		if group != nil {
+			gid = *group
+		}
+
+		err := fileSystem.Chown(filePath, uid, gid)
+		if err != nil {
+			return fmt.Errorf("failed to change owner of %s to %d:%d: %w", filePath, uid, gid, err)
+		}
+	}
+
+	if mode != nil {
+		err := fileSystem.Chmod(filePath, *mode)
+		if err != nil {
+			return fmt.Errorf("failed to change mode of %s to %s: %w", filePath, *mode, err)
+		}
+	}
+
+	return nil
+}
+
+// preserveMetadata carries over the permission bits, the modification time and the ownership of the source file.
+// Ownership is only carried over if the process is permitted to do so. Otherwise, the file keeps the uid and gid
+// of the running process.
+func preserveMetadata(srcfilePath, filePath string, fileSystem Filesystem) error {
+	srcFileInfo, err := fileSystem.Stat(srcfilePath)
+	if err != nil {
+		return fmt.Errorf("failed to get file info of source file %s: %w", srcfilePath, err)
+	}
+
+	uid, gid, ok := getFileOwner(srcFileInfo)
+	if ok {
+		err = fileSystem.Chown(filePath, uid, gid)
+		if errors.Is(err, fs.ErrPermission) {
+			log.Printf("skip preserving owner %d:%d of file %s because of missing permissions", uid, gid, srcfilePath)
+		} else if err != nil {
+			return fmt.Errorf("failed to change owner of file %s to %d:%d: %w", filePath, uid, gid, err)
+		}
+	}
+
+	mode := srcFileInfo.Mode() & (fs.ModePerm | fs.ModeSetuid | fs.ModeSetgid | fs.ModeSticky)
+	err = fileSystem.Chmod(filePath, mode)
+	if err != nil {
+		return fmt.Errorf("failed to change mode of file %s to %s: %w", filePath, mode, err)
+	}
+
+	modTime := srcFileInfo.ModTime()
+	err = fileSystem.Chtimes(filePath, modTime, modTime)
+	if err != nil {
+		return fmt.Errorf("failed to change modification time of file %s: %w", filePath, err)
+	}
+
+	return nil
+}
+
+// getFileOwner returns the uid and gid of the file if the file info provides them.
+func getFileOwner(fileInfo os.FileInfo) (uid, gid int, ok bool) {
+	stat, ok := fileInfo.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+
+	return int(stat.Uid), int(stat.Gid), true
+}
+
+// getTempFilePath returns the path of a hidden temporary file next to the destination file. Like os.CreateTemp, the
+// name contains a random number, so that the temporary files of different runs and writers never collide.
+func getTempFilePath(destFilePath string) string {
+	dir, file := path.Split(destFilePath)
+	return path.Join(dir, "."+file+"."+strconv.FormatUint(uint64(rand.Uint32()), 10)+tempFileSuffix)
+}
+
+// tempFilePattern matches the names of the temporary files created with getTempFilePath.
+var tempFilePattern = regexp.MustCompile(`^\..+\.[0-9]+\.tmp$`)
+
+// legacyTempFilePattern matches the names of the temporary files of previous versions which did not contain a random
+// number. The submatch is the name of the destination file.
+var legacyTempFilePattern = regexp.MustCompile(`^\.(.+)\.tmp$`)
+
+func removeTempFile(tempFilePath string, fileSystem Filesystem) {
+	err := fileSystem.DeleteFile(tempFilePath)
+	if err != nil {
+		log.Println(fmt.Errorf("failed to remove temporary file %s: %w", tempFilePath, err))
+	}
+}
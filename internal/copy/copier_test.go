@@ -2,9 +2,15 @@ package copy
 
 import (
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
+	"io/fs"
 	"os"
+	"path"
+	"strings"
+	"syscall"
 	"testing"
+	"time"
 )
 
 func TestCopier_copyFile(t *testing.T) {
@@ -12,20 +18,24 @@ func TestCopier_copyFile(t *testing.T) {
 		// given
 		src := "/mount/source"
 		dest := "/dir/destination"
+		tempFile := anyTempFileOf(dest)
 		srcFile := &os.File{}
 		destFile := &os.File{}
 
 		filesystemMock := NewMockFilesystem(t)
 		filesystemMock.EXPECT().Open(src).Return(srcFile, nil)
 		filesystemMock.EXPECT().MkdirAll("/dir", os.FileMode(0770)).Return(nil)
-		filesystemMock.EXPECT().Create(dest).Return(destFile, nil)
-		filesystemMock.EXPECT().Copy(destFile, srcFile).Return(0, nil)
+		filesystemMock.EXPECT().Create(tempFile).Return(destFile, nil)
+		filesystemMock.EXPECT().Copy(destFile, srcFile).Return(0, CopyMethodStream, nil)
 		filesystemMock.EXPECT().SyncFile(destFile).Return(nil)
 		filesystemMock.EXPECT().CloseFile(srcFile).Return(nil)
 		filesystemMock.EXPECT().CloseFile(destFile).Return(nil)
+		filesystemMock.EXPECT().Lstat(dest).Return(nil, fs.ErrNotExist)
+		filesystemMock.EXPECT().Rename(tempFile, dest).Return(nil)
+		filesystemMock.EXPECT().SyncDir("/dir").Return(nil)
 
 		// when
-		err := copyFile(src, dest, filesystemMock)
+		err := copyFile(src, dest, filesystemMock, FileAttributes{})
 
 		// then
 		require.NoError(t, err)
@@ -39,7 +49,7 @@ func TestCopier_copyFile(t *testing.T) {
 		filesystemMock.EXPECT().Open(src).Return(nil, assert.AnError)
 
 		// when
-		err := copyFile(src, "", filesystemMock)
+		err := copyFile(src, "", filesystemMock, FileAttributes{})
 
 		// then
 		require.Error(t, err)
@@ -58,17 +68,18 @@ func TestCopier_copyFile(t *testing.T) {
 		filesystemMock.EXPECT().MkdirAll("/dir", os.FileMode(0770)).Return(assert.AnError)
 
 		// when
-		err := copyFile(src, dest, filesystemMock)
+		err := copyFile(src, dest, filesystemMock, FileAttributes{})
 
 		// then
 		require.Error(t, err)
 		assert.ErrorContains(t, err, "failed to create dirs for path /dir/destination")
 	})
 
-	t.Run("should return error on error creating destination file", func(t *testing.T) {
+	t.Run("should return error on error creating temporary file", func(t *testing.T) {
 		// given
 		src := "/mount/source"
 		dest := "/dir/destination"
+		tempFile := anyTempFileOf(dest)
 		srcFile := &os.File{}
 		destFile := &os.File{}
 
@@ -76,60 +87,493 @@ func TestCopier_copyFile(t *testing.T) {
 		filesystemMock.EXPECT().Open(src).Return(srcFile, nil)
 		filesystemMock.EXPECT().CloseFile(srcFile).Return(nil)
 		filesystemMock.EXPECT().MkdirAll("/dir", os.FileMode(0770)).Return(nil)
-		filesystemMock.EXPECT().Create(dest).Return(destFile, assert.AnError)
+		filesystemMock.EXPECT().Create(tempFile).Return(destFile, assert.AnError)
+		filesystemMock.EXPECT().DeleteFile(tempFile).Return(nil)
 
 		// when
-		err := copyFile(src, dest, filesystemMock)
+		err := copyFile(src, dest, filesystemMock, FileAttributes{})
 
 		// then
 		require.Error(t, err)
-		assert.ErrorContains(t, err, "failed to open file /dir/destination")
+		assert.ErrorContains(t, err, "failed to open file /dir/.destination.")
 	})
 
-	t.Run("should return error on error copy file", func(t *testing.T) {
+	t.Run("should return error and remove temporary file on error copy file", func(t *testing.T) {
 		// given
 		src := "/mount/source"
 		dest := "/dir/destination"
+		tempFile := anyTempFileOf(dest)
 		srcFile := &os.File{}
 		destFile := &os.File{}
 
 		filesystemMock := NewMockFilesystem(t)
 		filesystemMock.EXPECT().Open(src).Return(srcFile, nil)
 		filesystemMock.EXPECT().MkdirAll("/dir", os.FileMode(0770)).Return(nil)
-		filesystemMock.EXPECT().Create(dest).Return(destFile, nil)
+		filesystemMock.EXPECT().Create(tempFile).Return(destFile, nil)
 		filesystemMock.EXPECT().CloseFile(srcFile).Return(nil)
 		filesystemMock.EXPECT().CloseFile(destFile).Return(nil)
-		filesystemMock.EXPECT().Copy(destFile, srcFile).Return(0, assert.AnError)
+		filesystemMock.EXPECT().Copy(destFile, srcFile).Return(0, CopyMethodStream, assert.AnError)
+		filesystemMock.EXPECT().DeleteFile(tempFile).Return(nil)
 
 		// when
-		err := copyFile(src, dest, filesystemMock)
+		err := copyFile(src, dest, filesystemMock, FileAttributes{})
 
 		// then
 		require.Error(t, err)
-		assert.ErrorContains(t, err, "failed to copy from /mount/source to /dir/destination")
+		assert.ErrorContains(t, err, "failed to copy from /mount/source to /dir/.destination.")
 	})
 
-	t.Run("should return error on syncing file", func(t *testing.T) {
+	t.Run("should return error and remove temporary file on syncing file", func(t *testing.T) {
 		// given
 		src := "/mount/source"
 		dest := "/dir/destination"
+		tempFile := anyTempFileOf(dest)
 		srcFile := &os.File{}
 		destFile := &os.File{}
 
 		filesystemMock := NewMockFilesystem(t)
 		filesystemMock.EXPECT().Open(src).Return(srcFile, nil)
 		filesystemMock.EXPECT().MkdirAll("/dir", os.FileMode(0770)).Return(nil)
-		filesystemMock.EXPECT().Create(dest).Return(destFile, nil)
+		filesystemMock.EXPECT().Create(tempFile).Return(destFile, nil)
 		filesystemMock.EXPECT().CloseFile(srcFile).Return(nil)
 		filesystemMock.EXPECT().CloseFile(destFile).Return(nil)
-		filesystemMock.EXPECT().Copy(destFile, srcFile).Return(0, nil)
+		filesystemMock.EXPECT().Copy(destFile, srcFile).Return(0, CopyMethodStream, nil)
 		filesystemMock.EXPECT().SyncFile(destFile).Return(assert.AnError)
+		filesystemMock.EXPECT().DeleteFile(tempFile).Return(nil)
 
 		// when
-		err := copyFile(src, dest, filesystemMock)
+		err := copyFile(src, dest, filesystemMock, FileAttributes{})
 
 		// then
 		require.Error(t, err)
-		assert.ErrorContains(t, err, "failed to flush buffer to file /dir/destination")
+		assert.ErrorContains(t, err, "failed to flush buffer to file /dir/.destination.")
 	})
+
+	t.Run("should return error and remove temporary file on rename error", func(t *testing.T) {
+		// given
+		src := "/mount/source"
+		dest := "/dir/destination"
+		tempFile := anyTempFileOf(dest)
+		srcFile := &os.File{}
+		destFile := &os.File{}
+
+		filesystemMock := NewMockFilesystem(t)
+		filesystemMock.EXPECT().Open(src).Return(srcFile, nil)
+		filesystemMock.EXPECT().MkdirAll("/dir", os.FileMode(0770)).Return(nil)
+		filesystemMock.EXPECT().Create(tempFile).Return(destFile, nil)
+		filesystemMock.EXPECT().CloseFile(srcFile).Return(nil)
+		filesystemMock.EXPECT().CloseFile(destFile).Return(nil)
+		filesystemMock.EXPECT().Copy(destFile, srcFile).Return(0, CopyMethodStream, nil)
+		filesystemMock.EXPECT().SyncFile(destFile).Return(nil)
+		filesystemMock.EXPECT().Lstat(dest).Return(nil, fs.ErrNotExist)
+		filesystemMock.EXPECT().Rename(tempFile, dest).Return(assert.AnError)
+		filesystemMock.EXPECT().DeleteFile(tempFile).Return(nil)
+
+		// when
+		err := copyFile(src, dest, filesystemMock, FileAttributes{})
+
+		// then
+		require.Error(t, err)
+		assert.ErrorIs(t, err, assert.AnError)
+		assert.Regexp(t, `failed to rename temporary file /dir/\.destination\.[0-9]+\.tmp to /dir/destination`, err.Error())
+	})
+
+	t.Run("should return error on syncing destination dir", func(t *testing.T) {
+		// given
+		src := "/mount/source"
+		dest := "/dir/destination"
+		tempFile := anyTempFileOf(dest)
+		srcFile := &os.File{}
+		destFile := &os.File{}
+
+		filesystemMock := NewMockFilesystem(t)
+		filesystemMock.EXPECT().Open(src).Return(srcFile, nil)
+		filesystemMock.EXPECT().MkdirAll("/dir", os.FileMode(0770)).Return(nil)
+		filesystemMock.EXPECT().Create(tempFile).Return(destFile, nil)
+		filesystemMock.EXPECT().CloseFile(srcFile).Return(nil)
+		filesystemMock.EXPECT().CloseFile(destFile).Return(nil)
+		filesystemMock.EXPECT().Copy(destFile, srcFile).Return(0, CopyMethodStream, nil)
+		filesystemMock.EXPECT().SyncFile(destFile).Return(nil)
+		filesystemMock.EXPECT().Lstat(dest).Return(nil, fs.ErrNotExist)
+		filesystemMock.EXPECT().Rename(tempFile, dest).Return(nil)
+		filesystemMock.EXPECT().SyncDir("/dir").Return(assert.AnError)
+
+		// when
+		err := copyFile(src, dest, filesystemMock, FileAttributes{})
+
+		// then
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "failed to sync dir /dir")
+	})
+
+	t.Run("should preserve metadata of source file", func(t *testing.T) {
+		// given
+		src := "/mount/source"
+		dest := "/dir/destination"
+		tempFile := anyTempFileOf(dest)
+		srcFile := &os.File{}
+		destFile := &os.File{}
+		modTime := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+		srcFileInfo := &myFileInfo{mode: 0750, modTime: modTime, sys: &syscall.Stat_t{Uid: 1000, Gid: 1001}}
+
+		filesystemMock := NewMockFilesystem(t)
+		filesystemMock.EXPECT().Open(src).Return(srcFile, nil)
+		filesystemMock.EXPECT().MkdirAll("/dir", os.FileMode(0770)).Return(nil)
+		filesystemMock.EXPECT().Create(tempFile).Return(destFile, nil)
+		filesystemMock.EXPECT().Copy(destFile, srcFile).Return(0, CopyMethodStream, nil)
+		filesystemMock.EXPECT().SyncFile(destFile).Return(nil)
+		filesystemMock.EXPECT().CloseFile(srcFile).Return(nil)
+		filesystemMock.EXPECT().CloseFile(destFile).Return(nil)
+		filesystemMock.EXPECT().Stat(src).Return(srcFileInfo, nil)
+		filesystemMock.EXPECT().Chown(tempFile, 1000, 1001).Return(nil)
+		filesystemMock.EXPECT().Chmod(tempFile, os.FileMode(0750)).Return(nil)
+		filesystemMock.EXPECT().Chtimes(tempFile, modTime, modTime).Return(nil)
+		filesystemMock.EXPECT().Rename(tempFile, dest).Return(nil)
+		filesystemMock.EXPECT().SyncDir("/dir").Return(nil)
+
+		// when
+		err := copyFile(src, dest, filesystemMock, FileAttributes{PreserveMetadata: true})
+
+		// then
+		require.NoError(t, err)
+	})
+
+	t.Run("should keep mode and owner of existing destination file", func(t *testing.T) {
+		// given
+		src := "/mount/source"
+		dest := "/dir/destination"
+		tempFile := anyTempFileOf(dest)
+		srcFile := &os.File{}
+		destFile := &os.File{}
+		destFileInfo := &myFileInfo{mode: 0640 | fs.ModeSetgid, sys: &syscall.Stat_t{Uid: 1000, Gid: 1001}}
+
+		filesystemMock := NewMockFilesystem(t)
+		filesystemMock.EXPECT().Open(src).Return(srcFile, nil)
+		filesystemMock.EXPECT().MkdirAll("/dir", os.FileMode(0770)).Return(nil)
+		filesystemMock.EXPECT().Create(tempFile).Return(destFile, nil)
+		filesystemMock.EXPECT().Copy(destFile, srcFile).Return(0, CopyMethodStream, nil)
+		filesystemMock.EXPECT().SyncFile(destFile).Return(nil)
+		filesystemMock.EXPECT().CloseFile(srcFile).Return(nil)
+		filesystemMock.EXPECT().CloseFile(destFile).Return(nil)
+		filesystemMock.EXPECT().Lstat(dest).Return(destFileInfo, nil)
+		filesystemMock.EXPECT().Chown(tempFile, 1000, 1001).Return(&fs.PathError{Op: "chown", Err: syscall.EPERM})
+		filesystemMock.EXPECT().Chmod(tempFile, 0640|fs.ModeSetgid).Return(nil)
+		filesystemMock.EXPECT().Rename(tempFile, dest).Return(nil)
+		filesystemMock.EXPECT().SyncDir("/dir").Return(nil)
+
+		// when
+		err := copyFile(src, dest, filesystemMock, FileAttributes{})
+
+		// then
+		require.NoError(t, err)
+	})
+
+	t.Run("should override mode of existing destination file with file mode", func(t *testing.T) {
+		// given
+		src := "/mount/source"
+		dest := "/dir/destination"
+		tempFile := anyTempFileOf(dest)
+		srcFile := &os.File{}
+		destFile := &os.File{}
+		owner := 1002
+		fileMode := os.FileMode(0600)
+		destFileInfo := &myFileInfo{mode: 0644, sys: &syscall.Stat_t{Uid: 1000, Gid: 1001}}
+
+		filesystemMock := NewMockFilesystem(t)
+		filesystemMock.EXPECT().Open(src).Return(srcFile, nil)
+		filesystemMock.EXPECT().Stat("/dir").Return(&myFileInfo{isDir: true}, nil)
+		filesystemMock.EXPECT().MkdirAll("/dir", os.FileMode(0770)).Return(nil)
+		filesystemMock.EXPECT().Create(tempFile).Return(destFile, nil)
+		filesystemMock.EXPECT().Copy(destFile, srcFile).Return(0, CopyMethodStream, nil)
+		filesystemMock.EXPECT().SyncFile(destFile).Return(nil)
+		filesystemMock.EXPECT().CloseFile(srcFile).Return(nil)
+		filesystemMock.EXPECT().CloseFile(destFile).Return(nil)
+		filesystemMock.EXPECT().Lstat(dest).Return(destFileInfo, nil)
+		filesystemMock.EXPECT().Chown(tempFile, 1000, 1001).Return(nil)
+		filesystemMock.EXPECT().Chown(tempFile, 1002, -1).Return(nil)
+		filesystemMock.EXPECT().Chmod(tempFile, os.FileMode(0600)).Return(nil)
+		filesystemMock.EXPECT().Rename(tempFile, dest).Return(nil)
+		filesystemMock.EXPECT().SyncDir("/dir").Return(nil)
+
+		// when
+		err := copyFile(src, dest, filesystemMock, FileAttributes{Owner: &owner, FileMode: &fileMode})
+
+		// then
+		require.NoError(t, err)
+	})
+}
+
+// anyTempFileOf matches the temporary files with random names of the destination file.
+func anyTempFileOf(destFilePath string) interface{} {
+	dir, file := path.Split(destFilePath)
+	return mock.MatchedBy(func(tempFilePath string) bool {
+		tempDir, name := path.Split(tempFilePath)
+		return tempDir == dir && strings.HasPrefix(name, "."+file+".") && tempFilePattern.MatchString(name)
+	})
+}
+
+func TestCopier_applyFileAttributes(t *testing.T) {
+	src := "/mount/source"
+	dest := "/dir/destination"
+	modTime := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("should do nothing if metadata should not be preserved", func(t *testing.T) {
+		// given
+		filesystemMock := NewMockFilesystem(t)
+
+		// when
+		err := applyFileAttributes(src, dest, FileAttributes{}, filesystemMock)
+
+		// then
+		require.NoError(t, err)
+	})
+
+	t.Run("should skip owner if the process is not permitted to change it", func(t *testing.T) {
+		// given
+		srcFileInfo := &myFileInfo{mode: 0600 | fs.ModeSetgid, modTime: modTime, sys: &syscall.Stat_t{Uid: 0, Gid: 0}}
+
+		filesystemMock := NewMockFilesystem(t)
+		filesystemMock.EXPECT().Stat(src).Return(srcFileInfo, nil)
+		filesystemMock.EXPECT().Chown(dest, 0, 0).Return(&fs.PathError{Op: "chown", Path: dest, Err: syscall.EPERM})
+		filesystemMock.EXPECT().Chmod(dest, 0600|fs.ModeSetgid).Return(nil)
+		filesystemMock.EXPECT().Chtimes(dest, modTime, modTime).Return(nil)
+
+		// when
+		err := applyFileAttributes(src, dest, FileAttributes{PreserveMetadata: true}, filesystemMock)
+
+		// then
+		require.NoError(t, err)
+	})
+
+	t.Run("should skip owner if the file info does not provide it", func(t *testing.T) {
+		// given
+		srcFileInfo := &myFileInfo{mode: 0640, modTime: modTime}
+
+		filesystemMock := NewMockFilesystem(t)
+		filesystemMock.EXPECT().Stat(src).Return(srcFileInfo, nil)
+		filesystemMock.EXPECT().Chmod(dest, os.FileMode(0640)).Return(nil)
+		filesystemMock.EXPECT().Chtimes(dest, modTime, modTime).Return(nil)
+
+		// when
+		err := applyFileAttributes(src, dest, FileAttributes{PreserveMetadata: true}, filesystemMock)
+
+		// then
+		require.NoError(t, err)
+	})
+
+	t.Run("should return error on stat error", func(t *testing.T) {
+		// given
+		filesystemMock := NewMockFilesystem(t)
+		filesystemMock.EXPECT().Stat(src).Return(nil, assert.AnError)
+
+		// when
+		err := applyFileAttributes(src, dest, FileAttributes{PreserveMetadata: true}, filesystemMock)
+
+		// then
+		require.Error(t, err)
+		assert.ErrorIs(t, err, assert.AnError)
+		assert.ErrorContains(t, err, "failed to get file info of source file /mount/source")
+	})
+
+	t.Run("should return error on chown error", func(t *testing.T) {
+		// given
+		srcFileInfo := &myFileInfo{mode: 0640, modTime: modTime, sys: &syscall.Stat_t{Uid: 1000, Gid: 1000}}
+
+		filesystemMock := NewMockFilesystem(t)
+		filesystemMock.EXPECT().Stat(src).Return(srcFileInfo, nil)
+		filesystemMock.EXPECT().Chown(dest, 1000, 1000).Return(assert.AnError)
+
+		// when
+		err := applyFileAttributes(src, dest, FileAttributes{PreserveMetadata: true}, filesystemMock)
+
+		// then
+		require.Error(t, err)
+		assert.ErrorIs(t, err, assert.AnError)
+		assert.ErrorContains(t, err, "failed to change owner of file /dir/destination to 1000:1000")
+	})
+
+	t.Run("should return error on chmod error", func(t *testing.T) {
+		// given
+		srcFileInfo := &myFileInfo{mode: 0640, modTime: modTime}
+
+		filesystemMock := NewMockFilesystem(t)
+		filesystemMock.EXPECT().Stat(src).Return(srcFileInfo, nil)
+		filesystemMock.EXPECT().Chmod(dest, os.FileMode(0640)).Return(assert.AnError)
+
+		// when
+		err := applyFileAttributes(src, dest, FileAttributes{PreserveMetadata: true}, filesystemMock)
+
+		// then
+		require.Error(t, err)
+		assert.ErrorIs(t, err, assert.AnError)
+		assert.ErrorContains(t, err, "failed to change mode of file /dir/destination")
+	})
+
+	t.Run("should return error on chtimes error", func(t *testing.T) {
+		// given
+		srcFileInfo := &myFileInfo{mode: 0640, modTime: modTime}
+
+		filesystemMock := NewMockFilesystem(t)
+		filesystemMock.EXPECT().Stat(src).Return(srcFileInfo, nil)
+		filesystemMock.EXPECT().Chmod(dest, os.FileMode(0640)).Return(nil)
+		filesystemMock.EXPECT().Chtimes(dest, modTime, modTime).Return(assert.AnError)
+
+		// when
+		err := applyFileAttributes(src, dest, FileAttributes{PreserveMetadata: true}, filesystemMock)
+
+		// then
+		require.Error(t, err)
+		assert.ErrorIs(t, err, assert.AnError)
+		assert.ErrorContains(t, err, "failed to change modification time of file /dir/destination")
+	})
+}
+
+func TestCopier_applyFileAttributes_overrides(t *testing.T) {
+	src := "/mount/source"
+	dest := "/dir/destination"
+	owner := 1000
+	group := 1001
+	fileMode := os.FileMode(0640)
+
+	t.Run("should apply owner, group and mode", func(t *testing.T) {
+		// given
+		filesystemMock := NewMockFilesystem(t)
+		filesystemMock.EXPECT().Chown(dest, 1000, 1001).Return(nil)
+		filesystemMock.EXPECT().Chmod(dest, os.FileMode(0640)).Return(nil)
+
+		// when
+		err := applyFileAttributes(src, dest, FileAttributes{Owner: &owner, Group: &group, FileMode: &fileMode}, filesystemMock)
+
+		// then
+		require.NoError(t, err)
+	})
+
+	t.Run("should keep group if only owner is set", func(t *testing.T) {
+		// given
+		filesystemMock := NewMockFilesystem(t)
+		filesystemMock.EXPECT().Chown(dest, 1000, -1).Return(nil)
+
+		// when
+		err := applyFileAttributes(src, dest, FileAttributes{Owner: &owner}, filesystemMock)
+
+		// then
+		require.NoError(t, err)
+	})
+
+	t.Run("should override preserved metadata", func(t *testing.T) {
+		// given
+		modTime := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+		srcFileInfo := &myFileInfo{mode: 0755, modTime: modTime}
+
+		filesystemMock := NewMockFilesystem(t)
+		filesystemMock.EXPECT().Stat(src).Return(srcFileInfo, nil)
+		filesystemMock.EXPECT().Chmod(dest, os.FileMode(0755)).Return(nil).Once()
+		filesystemMock.EXPECT().Chtimes(dest, modTime, modTime).Return(nil)
+		filesystemMock.EXPECT().Chown(dest, -1, 1001).Return(nil)
+		filesystemMock.EXPECT().Chmod(dest, os.FileMode(0640)).Return(nil).Once()
+
+		// when
+		err := applyFileAttributes(src, dest, FileAttributes{PreserveMetadata: true, Group: &group, FileMode: &fileMode}, filesystemMock)
+
+		// then
+		require.NoError(t, err)
+	})
+
+	t.Run("should return error on chown error", func(t *testing.T) {
+		// given
+		filesystemMock := NewMockFilesystem(t)
+		filesystemMock.EXPECT().Chown(dest, 1000, 1001).Return(assert.AnError)
+
+		// when
+		err := applyFileAttributes(src, dest, FileAttributes{Owner: &owner, Group: &group}, filesystemMock)
+
+		// then
+		require.Error(t, err)
+		assert.ErrorIs(t, err, assert.AnError)
+		assert.ErrorContains(t, err, "failed to change owner of /dir/destination to 1000:1001")
+	})
+
+	t.Run("should return error on chmod error", func(t *testing.T) {
+		// given
+		filesystemMock := NewMockFilesystem(t)
+		filesystemMock.EXPECT().Chmod(dest, os.FileMode(0640)).Return(assert.AnError)
+
+		// when
+		err := applyFileAttributes(src, dest, FileAttributes{FileMode: &fileMode}, filesystemMock)
+
+		// then
+		require.Error(t, err)
+		assert.ErrorIs(t, err, assert.AnError)
+		assert.ErrorContains(t, err, "failed to change mode of /dir/destination to -rw-r-----")
+	})
+}
+
+func TestCopier_createDirs(t *testing.T) {
+	owner := 1000
+	dirMode := os.FileMode(0750)
+
+	t.Run("should create dirs with default mode without attributes", func(t *testing.T) {
+		// given
+		filesystemMock := NewMockFilesystem(t)
+		filesystemMock.EXPECT().MkdirAll("/dir/sub", os.FileMode(0770)).Return(nil)
+
+		// when
+		err := createDirs("/dir/sub", FileAttributes{}, filesystemMock)
+
+		// then
+		require.NoError(t, err)
+	})
+
+	t.Run("should apply owner and mode to all created dirs", func(t *testing.T) {
+		// given
+		filesystemMock := NewMockFilesystem(t)
+		filesystemMock.EXPECT().Stat("/dir/sub/leaf").Return(nil, fs.ErrNotExist)
+		filesystemMock.EXPECT().Stat("/dir/sub").Return(nil, fs.ErrNotExist)
+		filesystemMock.EXPECT().Stat("/dir").Return(&myFileInfo{isDir: true}, nil)
+		filesystemMock.EXPECT().MkdirAll("/dir/sub/leaf", os.FileMode(0750)).Return(nil)
+		filesystemMock.EXPECT().Chown("/dir/sub", 1000, -1).Return(nil)
+		filesystemMock.EXPECT().Chmod("/dir/sub", os.FileMode(0750)).Return(nil)
+		filesystemMock.EXPECT().Chown("/dir/sub/leaf", 1000, -1).Return(nil)
+		filesystemMock.EXPECT().Chmod("/dir/sub/leaf", os.FileMode(0750)).Return(nil)
+
+		// when
+		err := createDirs("/dir/sub/leaf", FileAttributes{Owner: &owner, DirMode: &dirMode}, filesystemMock)
+
+		// then
+		require.NoError(t, err)
+	})
+
+	t.Run("should return error on stat error", func(t *testing.T) {
+		// given
+		filesystemMock := NewMockFilesystem(t)
+		filesystemMock.EXPECT().Stat("/dir/sub").Return(nil, assert.AnError)
+
+		// when
+		err := createDirs("/dir/sub", FileAttributes{DirMode: &dirMode}, filesystemMock)
+
+		// then
+		require.Error(t, err)
+		assert.ErrorIs(t, err, assert.AnError)
+		assert.ErrorContains(t, err, "failed to get file info of dir /dir/sub")
+	})
+
+	t.Run("should return error on mkdir error", func(t *testing.T) {
+		// given
+		filesystemMock := NewMockFilesystem(t)
+		filesystemMock.EXPECT().Stat("/dir/sub").Return(nil, fs.ErrNotExist)
+		filesystemMock.EXPECT().Stat("/dir").Return(&myFileInfo{isDir: true}, nil)
+		filesystemMock.EXPECT().MkdirAll("/dir/sub", os.FileMode(0750)).Return(assert.AnError)
+
+		// when
+		err := createDirs("/dir/sub", FileAttributes{DirMode: &dirMode}, filesystemMock)
+
+		// then
+		require.Error(t, err)
+		assert.ErrorIs(t, err, assert.AnError)
+	})
+}
+
+func Test_formatThroughput(t *testing.T) {
+	assert.Equal(t, "2.00 MiB/s", formatThroughput(1<<20, 500*time.Millisecond))
+	assert.Equal(t, "n/a MiB/s", formatThroughput(1<<20, 0))
 }
@@ -0,0 +1,67 @@
+//go:build linux
+
+package copy
+
+import (
+	"errors"
+	"fmt"
+	"golang.org/x/sys/unix"
+	"os"
+)
+
+// maxCopyFileRangeChunk limits the bytes copied by a single copy_file_range call.
+const maxCopyFileRangeChunk = 1 << 30
+
+// copyFileAccelerated copies the content of src to dst without passing it through userspace buffers.
+// It tries to create a reflink with FICLONE first, which shares the data blocks if both files are on the same
+// filesystem with reflink support (e.g. btrfs or xfs). Otherwise, it uses copy_file_range. If neither is supported,
+// an error wrapping errors.ErrUnsupported is returned together with the bytes written so far.
+func copyFileAccelerated(dst, src *os.File) (int64, CopyMethod, error) {
+	srcInfo, err := src.Stat()
+	if err != nil {
+		return 0, "", err
+	}
+
+	// FICLONE either clones the whole file or nothing. It does not change the offsets of the files.
+	err = unix.IoctlFileClone(int(dst.Fd()), int(src.Fd()))
+	if err == nil {
+		return srcInfo.Size(), CopyMethodReflink, nil
+	}
+
+	written, err := copyFileRange(dst, src)
+	return written, CopyMethodCopyFileRange, err
+}
+
+func copyFileRange(dst, src *os.File) (int64, error) {
+	var written int64
+	for {
+		n, err := unix.CopyFileRange(int(src.Fd()), nil, int(dst.Fd()), nil, maxCopyFileRangeChunk, 0)
+		if errors.Is(err, unix.EINTR) {
+			continue
+		}
+
+		if err != nil {
+			if isCopyFileRangeUnsupported(err) {
+				return written, fmt.Errorf("copy_file_range from %s to %s is not supported: %w: %w", src.Name(), dst.Name(), errors.ErrUnsupported, err)
+			}
+
+			return written, err
+		}
+
+		if n == 0 {
+			return written, nil
+		}
+
+		written += int64(n)
+	}
+}
+
+// isCopyFileRangeUnsupported checks if the error indicates that copy_file_range can not be used for the files,
+// e.g. because of an old kernel, different filesystems or a seccomp profile blocking the syscall.
+func isCopyFileRangeUnsupported(err error) bool {
+	return errors.Is(err, unix.ENOSYS) ||
+		errors.Is(err, unix.EXDEV) ||
+		errors.Is(err, unix.EINVAL) ||
+		errors.Is(err, unix.EOPNOTSUPP) ||
+		errors.Is(err, unix.EPERM)
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package copy
+
+import (
+	"errors"
+	"os"
+)
+
+// copyFileAccelerated is only supported on linux. Other platforms always use the streaming copy.
+func copyFileAccelerated(_, _ *os.File) (int64, CopyMethod, error) {
+	return 0, "", errors.ErrUnsupported
+}
@@ -0,0 +1,34 @@
+package copy
+
+import (
+	"fmt"
+	"os"
+)
+
+// dirTrackingFileSystem tracks the dirs created with MkdirAll, so that they are deleted on cleanup if they are empty.
+// Dirs which already existed are not tracked.
+type dirTrackingFileSystem struct {
+	Filesystem
+	fileTracker fileTracker
+}
+
+func (f dirTrackingFileSystem) MkdirAll(dirPath string, perm os.FileMode) error {
+	missingDirs, err := getMissingDirs(dirPath, f.Filesystem)
+	if err != nil {
+		return err
+	}
+
+	err = f.Filesystem.MkdirAll(dirPath, perm)
+	if err != nil {
+		return err
+	}
+
+	for _, missingDir := range missingDirs {
+		err = f.fileTracker.AddDir(missingDir)
+		if err != nil {
+			return fmt.Errorf("failed to track dir %s: %w", missingDir, err)
+		}
+	}
+
+	return nil
+}
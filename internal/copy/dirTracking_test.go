@@ -0,0 +1,53 @@
+package copy
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"testing"
+)
+
+func TestVolumeMountCopier_CopyVolumeMount_trackDirs(t *testing.T) {
+	t.Run("should track created dirs and delete them on cleanup", func(t *testing.T) {
+		// given
+		src := t.TempDir()
+		parent := t.TempDir()
+		dest := filepath.Join(parent, "dest")
+		writeTestFile(t, filepath.Join(src, "sub", "dir", "file"), "content")
+		writeTestFile(t, filepath.Join(src, "root"), "content")
+		doguConfig := newMemoryDoguConfig()
+		fileSystem := FileSystem{}
+		tracker := NewLocalConfigFileTracker(doguConfig, fileSystem)
+
+		// when
+		err := NewVolumeMountCopier(fileSystem, tracker, Options{}).CopyVolumeMount([]SrcAndDestination{{Src: src, Dest: dest}})
+		require.NoError(t, err)
+		trackedDirs := tracker.trackedDirs
+		cleanupErr := tracker.DeleteAllTrackedFiles()
+
+		// then
+		require.NoError(t, cleanupErr)
+		assert.ElementsMatch(t, []string{dest, filepath.Join(dest, "sub"), filepath.Join(dest, "sub", "dir")}, trackedDirs)
+		assert.NoDirExists(t, dest)
+		assert.DirExists(t, parent)
+	})
+
+	t.Run("should not track existing dirs", func(t *testing.T) {
+		// given
+		src := t.TempDir()
+		dest := t.TempDir()
+		writeTestFile(t, filepath.Join(src, "file"), "content")
+		tracker := NewLocalConfigFileTracker(newMemoryDoguConfig(), FileSystem{})
+
+		// when
+		err := NewVolumeMountCopier(FileSystem{}, tracker, Options{}).CopyVolumeMount([]SrcAndDestination{{Src: src, Dest: dest}})
+		require.NoError(t, err)
+		cleanupErr := tracker.DeleteAllTrackedFiles()
+
+		// then
+		require.NoError(t, cleanupErr)
+		assert.Empty(t, tracker.trackedDirs)
+		assert.DirExists(t, dest)
+		assert.NoFileExists(t, filepath.Join(dest, "file"))
+	})
+}
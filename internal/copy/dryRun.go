@@ -0,0 +1,94 @@
+package copy
+
+import (
+	"errors"
+	"log"
+	"os"
+	"time"
+)
+
+// errDryRun is returned for every modification of the filesystem in a dry run.
+var errDryRun = errors.New("modification is not allowed in a dry run")
+
+// DryRunFileSystem wraps a Filesystem and prevents all modifications.
+// Deletions and renames are logged as planned because they are used on cleanup to delete stale files and to restore
+// their backups. All other modifying operations fail, because they must not be reached in a dry run.
+type DryRunFileSystem struct {
+	Filesystem
+}
+
+func NewDryRunFileSystem(fileSystem Filesystem) DryRunFileSystem {
+	return DryRunFileSystem{Filesystem: fileSystem}
+}
+
+func (f DryRunFileSystem) DeleteFile(path string) error {
+	if _, err := f.Lstat(path); err == nil {
+		log.Printf("Dry run: would delete file %s", path)
+	}
+
+	return nil
+}
+
+func (f DryRunFileSystem) RemoveDir(path string) error {
+	if _, err := f.Lstat(path); err == nil {
+		log.Printf("Dry run: would delete dir %s if it is empty", path)
+	}
+
+	return nil
+}
+
+func (f DryRunFileSystem) MkdirAll(string, os.FileMode) error {
+	return errDryRun
+}
+
+func (f DryRunFileSystem) Create(string) (*os.File, error) {
+	return nil, errDryRun
+}
+
+func (f DryRunFileSystem) Rename(oldPath, newPath string) error {
+	log.Printf("Dry run: would rename %s to %s", oldPath, newPath)
+	return nil
+}
+
+func (f DryRunFileSystem) SyncDir(string) error {
+	return errDryRun
+}
+
+func (f DryRunFileSystem) Chmod(string, os.FileMode) error {
+	return errDryRun
+}
+
+func (f DryRunFileSystem) Chown(string, int, int) error {
+	return errDryRun
+}
+
+func (f DryRunFileSystem) Chtimes(string, time.Time, time.Time) error {
+	return errDryRun
+}
+
+func (f DryRunFileSystem) Symlink(string, string) error {
+	return errDryRun
+}
+
+func (f DryRunFileSystem) Link(string, string) error {
+	return errDryRun
+}
+
+func (f DryRunFileSystem) OpenFile(string, int, os.FileMode) (*os.File, error) {
+	return nil, errDryRun
+}
+
+// DryRunDoguConfig wraps a dogu config and discards all writes.
+// The file tracker still works on its in-memory state, so that stale files can be determined in a dry run.
+type DryRunDoguConfig struct {
+	doguConfigReaderWriter
+}
+
+func NewDryRunDoguConfig(doguConfig doguConfigReaderWriter) DryRunDoguConfig {
+	return DryRunDoguConfig{doguConfigReaderWriter: doguConfig}
+}
+
+func (c DryRunDoguConfig) Set(key, _ string) error {
+	log.Printf("Dry run: skip writing local config key %s", key)
+	return nil
+}
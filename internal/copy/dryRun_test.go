@@ -0,0 +1,146 @@
+package copy
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDryRunFileSystem(t *testing.T) {
+	t.Run("should not delete file", func(t *testing.T) {
+		// given
+		file := filepath.Join(t.TempDir(), "file")
+		writeTestFile(t, file, "content")
+
+		// when
+		err := NewDryRunFileSystem(FileSystem{}).DeleteFile(file)
+
+		// then
+		require.NoError(t, err)
+		assert.FileExists(t, file)
+	})
+
+	t.Run("should not delete dir", func(t *testing.T) {
+		// given
+		dir := filepath.Join(t.TempDir(), "dir")
+		require.NoError(t, os.Mkdir(dir, 0755))
+
+		// when
+		err := NewDryRunFileSystem(FileSystem{}).RemoveDir(dir)
+
+		// then
+		require.NoError(t, err)
+		assert.DirExists(t, dir)
+	})
+
+	t.Run("should fail on modifications", func(t *testing.T) {
+		// given
+		dir := t.TempDir()
+		sut := NewDryRunFileSystem(FileSystem{})
+
+		// when
+		_, createErr := sut.Create(filepath.Join(dir, "file"))
+		mkdirErr := sut.MkdirAll(filepath.Join(dir, "dir"), 0755)
+
+		// then
+		assert.ErrorIs(t, createErr, errDryRun)
+		assert.ErrorIs(t, mkdirErr, errDryRun)
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+}
+
+func TestDryRunDoguConfig_Set(t *testing.T) {
+	// given
+	doguConfig := newMockDoguConfigReaderWriter(t)
+
+	// when
+	err := NewDryRunDoguConfig(doguConfig).Set(additionalMountsConfigKey, "/file")
+
+	// then
+	require.NoError(t, err)
+}
+
+func TestVolumeMountCopier_CopyVolumeMount_dryRun(t *testing.T) {
+	t.Run("should plan changes without modifying destination and config", func(t *testing.T) {
+		// given
+		src := t.TempDir()
+		dest := t.TempDir()
+		writeTestFile(t, filepath.Join(src, "new"), "new")
+		writeTestFile(t, filepath.Join(src, "changed"), "changed")
+		writeTestFile(t, filepath.Join(src, "unchanged"), "unchanged")
+		writeTestFile(t, filepath.Join(dest, "changed"), "old")
+		writeTestFile(t, filepath.Join(dest, "unchanged"), "unchanged")
+		writeTestFile(t, filepath.Join(dest, "stale"), "stale")
+
+		doguConfig := newMemoryDoguConfig()
+		staleConfig := "- " + filepath.Join(dest, "stale") + "\n"
+		doguConfig.values[additionalMountsConfigKey] = staleConfig
+		fileSystem := NewDryRunFileSystem(FileSystem{})
+		tracker := NewLocalConfigFileTracker(NewDryRunDoguConfig(doguConfig), fileSystem)
+		sut := NewVolumeMountCopier(fileSystem, tracker, Options{DryRun: true})
+
+		// when
+		err := sut.CopyVolumeMount([]SrcAndDestination{{Src: src, Dest: dest}})
+		deleteErr := tracker.DeleteStaleTrackedFiles()
+
+		// then
+		require.NoError(t, err)
+		require.NoError(t, deleteErr)
+		assert.Equal(t, 2, sut.summary.copied)
+		assert.Equal(t, 1, sut.summary.unchanged)
+		assert.NoFileExists(t, filepath.Join(dest, "new"))
+		assert.FileExists(t, filepath.Join(dest, "stale"))
+		content, err := os.ReadFile(filepath.Join(dest, "changed"))
+		require.NoError(t, err)
+		assert.Equal(t, "old", string(content))
+		assert.Equal(t, map[string]string{additionalMountsConfigKey: staleConfig}, doguConfig.values)
+	})
+
+	t.Run("should plan restoring the backup of a stale file", func(t *testing.T) {
+		// given
+		dest := t.TempDir()
+		writeTestFile(t, filepath.Join(dest, "stale"), "copied")
+		writeTestFile(t, filepath.Join(dest, ".stale.orig"), "original")
+
+		doguConfig := newMemoryDoguConfig()
+		doguConfig.values[additionalMountsConfigKey] = "- " + filepath.Join(dest, "stale") + "\n"
+		doguConfig.values[additionalMountsBackupsConfigKey] = filepath.Join(dest, "stale") + ": " + filepath.Join(dest, ".stale.orig") + "\n"
+		fileSystem := NewDryRunFileSystem(FileSystem{})
+		tracker := NewLocalConfigFileTracker(NewDryRunDoguConfig(doguConfig), fileSystem)
+
+		// when
+		err := tracker.DeleteStaleTrackedFiles()
+
+		// then
+		require.NoError(t, err)
+		content, err := os.ReadFile(filepath.Join(dest, "stale"))
+		require.NoError(t, err)
+		assert.Equal(t, "copied", string(content))
+		assert.FileExists(t, filepath.Join(dest, ".stale.orig"))
+	})
+
+	t.Run("should report template errors", func(t *testing.T) {
+		// given
+		src := t.TempDir()
+		dest := t.TempDir()
+		writeTestFile(t, filepath.Join(src, "app.conf"), `level={{ dogu "missing" }}`)
+
+		fileSystem := NewDryRunFileSystem(FileSystem{})
+		tracker := NewLocalConfigFileTracker(NewDryRunDoguConfig(newMemoryDoguConfig()), fileSystem)
+		renderer := NewTemplateRenderer(newMemoryDoguConfig(), newMemoryDoguConfig())
+		sut := NewVolumeMountCopier(fileSystem, tracker, Options{DryRun: true, TemplateRenderer: renderer})
+
+		// when
+		err := sut.CopyVolumeMount([]SrcAndDestination{{Src: src, Dest: dest, Templates: true}})
+
+		// then
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "failed to render template "+filepath.Join(src, "app.conf"))
+		assert.Equal(t, 1, sut.summary.failed)
+		assert.NoFileExists(t, filepath.Join(dest, "app.conf"))
+	})
+}
@@ -0,0 +1,534 @@
+package copy
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultExtractMaxSize is the default limit of the uncompressed size of all files extracted from one archive.
+const DefaultExtractMaxSize int64 = 1 << 30
+
+type archiveFormat int
+
+const (
+	formatNone archiveFormat = iota
+	formatTar
+	formatTarGzip
+	formatTarZstd
+	formatZip
+	formatGzip
+	formatZstd
+)
+
+// archiveSuffixes maps the file suffixes to the archive formats. Longer suffixes have to be checked first.
+var archiveSuffixes = []struct {
+	suffix string
+	format archiveFormat
+}{
+	{".tar.gz", formatTarGzip},
+	{".tgz", formatTarGzip},
+	{".tar.zst", formatTarZstd},
+	{".tzst", formatTarZstd},
+	{".tar", formatTar},
+	{".zip", formatZip},
+	{".gz", formatGzip},
+	{".zst", formatZstd},
+}
+
+// getArchiveFormat returns the archive format and the matching suffix of the file.
+func getArchiveFormat(filePath string) (archiveFormat, string) {
+	name := strings.ToLower(filePath)
+	for _, archiveSuffix := range archiveSuffixes {
+		if strings.HasSuffix(name, archiveSuffix.suffix) {
+			return archiveSuffix.format, filePath[len(filePath)-len(archiveSuffix.suffix):]
+		}
+	}
+
+	return formatNone, ""
+}
+
+// isExtracted returns true if the source file is an archive which is extracted instead of copied.
+func (m SrcAndDestination) isExtracted(rel string) bool {
+	if !m.Extract {
+		return false
+	}
+
+	format, _ := getArchiveFormat(rel)
+	return format != formatNone
+}
+
+func (m SrcAndDestination) extractMaxSize() int64 {
+	if m.ExtractMaxSize <= 0 {
+		return DefaultExtractMaxSize
+	}
+
+	return m.ExtractMaxSize
+}
+
+// archiveExtractor extracts the entries of one archive into the destination of the mount.
+type archiveExtractor struct {
+	copier      *VolumeMountCopier
+	mount       SrcAndDestination
+	archivePath string
+	// archiveDir is the dir of the archive relative to the source. The entries are extracted relative to it.
+	archiveDir string
+	// remaining is the number of bytes which may still be written to the destination files.
+	remaining int64
+	// extracted contains the destination files created from the entries, so that they are removed on errors.
+	extracted []string
+	// scan only reads the entries and collects them in scanned instead of writing them.
+	scan    bool
+	scanned []extractedFile
+}
+
+// extractedFile is a file which would be extracted from an archive.
+type extractedFile struct {
+	// entryPath is the path of the archive and the name of the entry separated by a colon.
+	entryPath string
+	// rel is the path of the file relative to the destination of the mount.
+	rel string
+	// size is the uncompressed size of the file.
+	size int64
+}
+
+// extractArchive extracts all regular files of the archive, or the decompressed file of a single compressed file,
+// into the destination dir corresponding to the dir of the archive.
+// Entries which would be written outside the destination and archives exceeding the size limit of the mount
+// result in an error. In this case, the files which were created from previous entries are removed again.
+// Extracted files are handled like copied files, i.e. they are filtered, tracked and existing files are handled
+// according to the conflict policy.
+func (v *VolumeMountCopier) extractArchive(mount SrcAndDestination, filePath string, sourceFileInfo os.FileInfo, rel string, format archiveFormat, suffix string) error {
+	file, err := v.fileSystem.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to open file %s: %w", filePath, err)
+	}
+
+	defer func() {
+		closeErr := v.fileSystem.CloseFile(file)
+		if closeErr != nil {
+			log.Println(fmt.Errorf("failed to close fd: %w", closeErr))
+		}
+	}()
+
+	log.Printf("Extracting archive %s", filePath)
+	extractor := &archiveExtractor{
+		copier:      v,
+		mount:       mount,
+		archivePath: filePath,
+		archiveDir:  path.Dir(rel),
+		remaining:   mount.extractMaxSize(),
+	}
+
+	err = extractor.extract(file, sourceFileInfo.Size(), rel, format, suffix)
+	if err != nil {
+		err = fmt.Errorf("failed to extract archive %s: %w", filePath, err)
+		return errors.Join(err, extractor.removeExtracted())
+	}
+
+	return nil
+}
+
+// scanArchive returns the files which would be extracted from the archive with their uncompressed sizes without
+// writing anything, so that they can be counted before anything is copied. The entries are read up to the size limit
+// of the mount. Archives which cannot be extracted completely result in no files because their extraction fails and
+// removes the files which were already extracted.
+func (v *VolumeMountCopier) scanArchive(mount SrcAndDestination, filePath, rel string) ([]extractedFile, error) {
+	format, suffix := getArchiveFormat(rel)
+	sourceFileInfo, err := v.fileSystem.Stat(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file info of source file %s: %w", filePath, err)
+	}
+
+	file, err := v.fileSystem.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file %s: %w", filePath, err)
+	}
+
+	defer func() {
+		closeErr := v.fileSystem.CloseFile(file)
+		if closeErr != nil {
+			log.Println(fmt.Errorf("failed to close fd: %w", closeErr))
+		}
+	}()
+
+	scanner := &archiveExtractor{
+		copier:      v,
+		mount:       mount,
+		archivePath: filePath,
+		archiveDir:  path.Dir(rel),
+		remaining:   mount.extractMaxSize(),
+		scan:        true,
+	}
+
+	err = scanner.extract(file, sourceFileInfo.Size(), rel, format, suffix)
+	if err != nil {
+		log.Printf("skip counting the files of archive %s because it cannot be extracted: %s", filePath, err)
+		return nil, nil
+	}
+
+	return scanner.scanned, nil
+}
+
+// extract reads the entries of the archive file with the given size according to its format.
+func (x *archiveExtractor) extract(file *os.File, size int64, rel string, format archiveFormat, suffix string) error {
+	switch format {
+	case formatZip:
+		return x.extractZip(file, size)
+	case formatGzip, formatZstd:
+		return x.extractCompressedFile(file, format, strings.TrimSuffix(path.Base(rel), suffix))
+	default:
+		return x.extractTar(file, format)
+	}
+}
+
+// removeExtracted removes the destination files which were created from the entries of the archive and stops
+// tracking them. Files which existed before are kept because they are handled by the conflict policy.
+func (x *archiveExtractor) removeExtracted() error {
+	var multiErr []error
+	for _, filePath := range x.extracted {
+		log.Printf("Remove file %s extracted from incomplete archive %s", filePath, x.archivePath)
+		err := x.copier.fileSystem.DeleteFile(filePath)
+		if err != nil {
+			multiErr = append(multiErr, fmt.Errorf("failed to remove extracted file %s: %w", filePath, err))
+			continue
+		}
+
+		err = x.copier.fileTracker.RemoveFile(filePath)
+		if err != nil {
+			multiErr = append(multiErr, fmt.Errorf("failed to untrack extracted file %s: %w", filePath, err))
+		}
+	}
+
+	return errors.Join(multiErr...)
+}
+
+func (x *archiveExtractor) extractTar(file io.Reader, format archiveFormat) error {
+	reader, closeReader, err := decompress(file, format)
+	if err != nil {
+		return err
+	}
+	defer closeReader()
+
+	tarReader := tar.NewReader(reader)
+	for {
+		header, err := tarReader.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		// Insecure paths are rejected with a more specific error when the entry is extracted.
+		if err != nil && !errors.Is(err, tar.ErrInsecurePath) {
+			return fmt.Errorf("failed to read tar entry: %w", err)
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			continue
+		case tar.TypeReg:
+			err = x.extractEntry(header.Name, header.Size, tarReader)
+			if err != nil {
+				return err
+			}
+		default:
+			log.Printf("skip entry %s of archive %s because it is not a regular file", header.Name, x.archivePath)
+		}
+	}
+}
+
+func (x *archiveExtractor) extractZip(file io.ReaderAt, size int64) error {
+	zipReader, err := zip.NewReader(file, size)
+	// Insecure paths are rejected with a more specific error when the entry is extracted.
+	if err != nil && !errors.Is(err, zip.ErrInsecurePath) {
+		return fmt.Errorf("failed to read zip archive: %w", err)
+	}
+
+	for _, zipFile := range zipReader.File {
+		if zipFile.FileInfo().IsDir() {
+			continue
+		}
+
+		if !zipFile.Mode().IsRegular() {
+			log.Printf("skip entry %s of archive %s because it is not a regular file", zipFile.Name, x.archivePath)
+			continue
+		}
+
+		err = x.extractZipEntry(zipFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (x *archiveExtractor) extractZipEntry(zipFile *zip.File) error {
+	reader, err := zipFile.Open()
+	if err != nil {
+		return fmt.Errorf("failed to open zip entry %s: %w", zipFile.Name, err)
+	}
+
+	defer func() {
+		closeErr := reader.Close()
+		if closeErr != nil {
+			log.Println(fmt.Errorf("failed to close zip entry %s: %w", zipFile.Name, closeErr))
+		}
+	}()
+
+	size := int64(min(zipFile.UncompressedSize64, math.MaxInt64))
+
+	return x.extractEntry(zipFile.Name, size, reader)
+}
+
+func (x *archiveExtractor) extractCompressedFile(file io.Reader, format archiveFormat, name string) error {
+	reader, closeReader, err := decompress(file, format)
+	if err != nil {
+		return err
+	}
+	defer closeReader()
+
+	return x.extractEntry(name, -1, reader)
+}
+
+// decompress returns a reader of the decompressed content and a function to release it.
+func decompress(reader io.Reader, format archiveFormat) (io.Reader, func(), error) {
+	switch format {
+	case formatTarGzip, formatGzip:
+		gzipReader, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read gzip header: %w", err)
+		}
+
+		return gzipReader, func() { _ = gzipReader.Close() }, nil
+	case formatTarZstd, formatZstd:
+		decoder, err := zstd.NewReader(reader, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create zstd decoder: %w", err)
+		}
+
+		return decoder, decoder.Close, nil
+	default:
+		return reader, func() {}, nil
+	}
+}
+
+// extractEntry writes the content of the entry to its destination. The size is the uncompressed size declared by
+// the archive or -1 if it is unknown. The declared size is only used to fail early because the content is limited
+// while it is read anyway.
+func (x *archiveExtractor) extractEntry(name string, size int64, reader io.Reader) error {
+	v := x.copier
+	entryPath := x.archivePath + ":" + name
+	rel, err := getEntryRel(x.archiveDir, name)
+	if err != nil {
+		return err
+	}
+
+	if !x.mount.isIncluded(rel) {
+		if !x.scan {
+			log.Printf("skip entry %s because it does not match the include and exclude patterns", entryPath)
+			v.summary.addFiltered()
+		}
+		return nil
+	}
+
+	if size > x.remaining {
+		return x.limitError()
+	}
+
+	if x.scan {
+		read, err := io.Copy(io.Discard, &extractLimitReader{reader: reader, extractor: x})
+		if err != nil {
+			return fmt.Errorf("failed to read entry %s: %w", entryPath, err)
+		}
+
+		x.scanned = append(x.scanned, extractedFile{entryPath: entryPath, rel: rel, size: read})
+		return nil
+	}
+
+	destinationFilePath := path.Join(x.mount.Dest, rel)
+	unlock := v.destinationLocks.lock(destinationFilePath)
+	defer unlock()
+
+	destFileInfo, err := v.fileSystem.Stat(destinationFilePath)
+	destExists := err == nil
+	created := !destExists
+	conflict := false
+	if destExists {
+		if !destFileInfo.Mode().IsRegular() {
+			return fmt.Errorf("destination file %s exists and is not a regular file", destinationFilePath)
+		}
+
+		conflict, err = v.isConflict(destinationFilePath)
+		if err != nil {
+			return err
+		}
+
+		// Like copied files, only overwritten destination files are compared with the entry.
+		if conflict && x.mount.conflictPolicy() != ConflictOverwrite {
+			write, err := v.resolveConflict(x.mount, entryPath, destinationFilePath)
+			if err != nil || !write {
+				return err
+			}
+
+			destExists = false
+			conflict = false
+		}
+	}
+
+	// The entry can only be read once, so its digest is calculated while it is written and compared afterward.
+	// Entries whose declared size differs from the destination file are not compared at all.
+	destDigest := ""
+	if destExists && (size < 0 || size == destFileInfo.Size()) {
+		destDigest, err = v.getDestinationDigest(destinationFilePath, destFileInfo)
+		if err != nil {
+			return fmt.Errorf("failed to compare entry %s with destination file %s: %w", entryPath, destinationFilePath, err)
+		}
+	}
+
+	// The metadata of the archive file does not belong to the entries, so it is not preserved.
+	attributes := FileAttributes{
+		Owner:    x.mount.Owner,
+		Group:    x.mount.Group,
+		FileMode: x.mount.FileMode,
+		DirMode:  x.mount.DirMode,
+	}
+
+	limitedReader := &extractLimitReader{reader: reader, extractor: x}
+	if v.options.DryRun {
+		// Read the entry nevertheless, so that a dry run reports exceeded limits and corrupt archives as well.
+		hash := sha256.New()
+		_, err = io.Copy(hash, limitedReader)
+		if err != nil {
+			return fmt.Errorf("failed to read entry %s: %w", entryPath, err)
+		}
+
+		if destDigest != "" && destDigest == hex.EncodeToString(hash.Sum(nil)) {
+			return x.skipUnchanged(entryPath, destinationFilePath, destFileInfo, conflict, attributes)
+		}
+
+		if conflict {
+			_, err = v.resolveConflict(x.mount, entryPath, destinationFilePath)
+			if err != nil {
+				return err
+			}
+		}
+
+		if destExists {
+			log.Printf("Dry run: would overwrite file %s with entry %s", destinationFilePath, entryPath)
+		} else {
+			log.Printf("Dry run: would extract entry %s to %s", entryPath, destinationFilePath)
+		}
+
+		v.summary.addCopied()
+		return v.fileTracker.AddFile(destinationFilePath)
+	}
+
+	var replace func(digest string) (bool, error)
+	unchanged := false
+	if destExists {
+		replace = func(digest string) (bool, error) {
+			if digest == destDigest {
+				unchanged = true
+				return false, nil
+			}
+
+			if conflict {
+				return v.resolveConflict(x.mount, entryPath, destinationFilePath)
+			}
+
+			return true, nil
+		}
+	}
+
+	_, err = writeAtomicallyIfReplaced(entryPath, destinationFilePath, limitedReader, v.fileSystem, attributes, replace)
+	if err != nil {
+		return err
+	}
+
+	if unchanged {
+		return x.skipUnchanged(entryPath, destinationFilePath, destFileInfo, conflict, attributes)
+	}
+
+	if created {
+		x.extracted = append(x.extracted, destinationFilePath)
+	}
+	v.summary.addCopied()
+
+	return v.fileTracker.AddFile(destinationFilePath)
+}
+
+// skipUnchanged handles an existing destination file which already has the content of the entry like an unchanged
+// copied file, i.e. only its metadata is updated and it is only tracked if it was extracted before.
+func (x *archiveExtractor) skipUnchanged(entryPath, destinationFilePath string, destFileInfo os.FileInfo, conflict bool, attributes FileAttributes) error {
+	v := x.copier
+	v.summary.addUnchanged()
+	if conflict {
+		// The file was not extracted before and is not tracked, so that it is not removed on cleanup.
+		log.Printf("skip entry %s because the existing destination file %s has the same content", entryPath, destinationFilePath)
+		return nil
+	}
+
+	log.Printf("skip entry %s because destination file %s has the same content", entryPath, destinationFilePath)
+	err := v.updateFileAttributes(attributes, entryPath, nil, destinationFilePath, destFileInfo)
+	if err != nil {
+		return err
+	}
+
+	// Track the file nevertheless, so that it is not removed as stale file.
+	return v.fileTracker.AddFile(destinationFilePath)
+}
+
+func (x *archiveExtractor) limitError() error {
+	return fmt.Errorf("uncompressed content exceeds the limit of %d bytes", x.mount.extractMaxSize())
+}
+
+// extractLimitReader never returns more bytes than the remaining limit of the archive allows, so that the limit
+// applies to the bytes written to the destination files. It fails as soon as the entry has more content.
+type extractLimitReader struct {
+	reader    io.Reader
+	extractor *archiveExtractor
+}
+
+func (r *extractLimitReader) Read(p []byte) (int, error) {
+	if r.extractor.remaining <= 0 {
+		// Only the end of the entry is allowed after the limit was reached.
+		var probe [1]byte
+		n, err := io.ReadFull(r.reader, probe[:])
+		if n > 0 {
+			return 0, r.extractor.limitError()
+		}
+
+		return 0, err
+	}
+
+	if int64(len(p)) > r.extractor.remaining {
+		p = p[:r.extractor.remaining]
+	}
+
+	n, err := r.reader.Read(p)
+	r.extractor.remaining -= int64(n)
+
+	return n, err
+}
+
+// getEntryRel returns the path of the archive entry relative to the destination of the mount.
+// Entries with absolute paths or paths leaving the destination are rejected.
+func getEntryRel(archiveDir, name string) (string, error) {
+	if !filepath.IsLocal(name) {
+		return "", fmt.Errorf("entry %s is outside of the destination", name)
+	}
+
+	return path.Join(archiveDir, filepath.ToSlash(filepath.Clean(name))), nil
+}
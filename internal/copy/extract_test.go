@@ -0,0 +1,312 @@
+package copy
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testArchiveEntry struct {
+	name    string
+	content string
+}
+
+func createTarGz(t *testing.T, filePath string, entries ...testArchiveEntry) {
+	t.Helper()
+	var buffer bytes.Buffer
+	gzipWriter := gzip.NewWriter(&buffer)
+	tarWriter := tar.NewWriter(gzipWriter)
+	for _, entry := range entries {
+		require.NoError(t, tarWriter.WriteHeader(&tar.Header{Name: entry.name, Mode: 0644, Size: int64(len(entry.content)), Typeflag: tar.TypeReg}))
+		_, err := tarWriter.Write([]byte(entry.content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tarWriter.Close())
+	require.NoError(t, gzipWriter.Close())
+	writeTestFile(t, filePath, buffer.String())
+}
+
+func createZip(t *testing.T, filePath string, entries ...testArchiveEntry) {
+	t.Helper()
+	var buffer bytes.Buffer
+	zipWriter := zip.NewWriter(&buffer)
+	for _, entry := range entries {
+		writer, err := zipWriter.Create(entry.name)
+		require.NoError(t, err)
+		_, err = writer.Write([]byte(entry.content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zipWriter.Close())
+	writeTestFile(t, filePath, buffer.String())
+}
+
+func TestGetArchiveFormat(t *testing.T) {
+	tests := []struct {
+		filePath       string
+		expectedFormat archiveFormat
+		expectedSuffix string
+	}{
+		{"conf.tar", formatTar, ".tar"},
+		{"conf.tar.gz", formatTarGzip, ".tar.gz"},
+		{"conf.TGZ", formatTarGzip, ".TGZ"},
+		{"conf.tar.zst", formatTarZstd, ".tar.zst"},
+		{"conf.tzst", formatTarZstd, ".tzst"},
+		{"conf.zip", formatZip, ".zip"},
+		{"app.conf.gz", formatGzip, ".gz"},
+		{"app.conf.zst", formatZstd, ".zst"},
+		{"app.conf", formatNone, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.filePath, func(t *testing.T) {
+			format, suffix := getArchiveFormat(tt.filePath)
+
+			assert.Equal(t, tt.expectedFormat, format)
+			assert.Equal(t, tt.expectedSuffix, suffix)
+		})
+	}
+}
+
+func TestVolumeMountCopier_CopyVolumeMount_extract(t *testing.T) {
+	copyMount := func(t *testing.T, tracker *LocalConfigFileTracker, mount SrcAndDestination) (*VolumeMountCopier, error) {
+		sut := NewVolumeMountCopier(FileSystem{}, tracker, Options{})
+		return sut, sut.CopyVolumeMount([]SrcAndDestination{mount})
+	}
+	readFile := func(t *testing.T, filePath string) string {
+		content, err := os.ReadFile(filePath)
+		require.NoError(t, err)
+		return string(content)
+	}
+
+	t.Run("should extract tar.gz and zip archives into the dir of the archive and track the files", func(t *testing.T) {
+		// given
+		src := t.TempDir()
+		dest := t.TempDir()
+		createTarGz(t, filepath.Join(src, "conf.tar.gz"), testArchiveEntry{"app.conf", "app"}, testArchiveEntry{"sub/log.xml", "log"})
+		createZip(t, filepath.Join(src, "dir", "more.zip"), testArchiveEntry{"other.conf", "other"})
+		writeTestFile(t, filepath.Join(src, "plain.conf"), "plain")
+		tracker := NewLocalConfigFileTracker(newMemoryDoguConfig(), FileSystem{})
+
+		// when
+		sut, err := copyMount(t, tracker, SrcAndDestination{Src: src, Dest: dest, Extract: true})
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, 4, sut.summary.copied)
+		assert.Equal(t, "app", readFile(t, filepath.Join(dest, "app.conf")))
+		assert.Equal(t, "log", readFile(t, filepath.Join(dest, "sub", "log.xml")))
+		assert.Equal(t, "other", readFile(t, filepath.Join(dest, "dir", "other.conf")))
+		assert.Equal(t, "plain", readFile(t, filepath.Join(dest, "plain.conf")))
+		assert.NoFileExists(t, filepath.Join(dest, "conf.tar.gz"))
+		for _, file := range []string{"app.conf", "sub/log.xml", "dir/other.conf"} {
+			tracked, err := tracker.IsTracked(filepath.Join(dest, file))
+			require.NoError(t, err)
+			assert.True(t, tracked, file)
+		}
+	})
+
+	t.Run("should decompress single gz and zst files", func(t *testing.T) {
+		// given
+		src := t.TempDir()
+		dest := t.TempDir()
+		var gzipBuffer bytes.Buffer
+		gzipWriter := gzip.NewWriter(&gzipBuffer)
+		_, err := gzipWriter.Write([]byte("gzip"))
+		require.NoError(t, err)
+		require.NoError(t, gzipWriter.Close())
+		writeTestFile(t, filepath.Join(src, "app.conf.gz"), gzipBuffer.String())
+		encoder, err := zstd.NewWriter(nil)
+		require.NoError(t, err)
+		writeTestFile(t, filepath.Join(src, "other.conf.zst"), string(encoder.EncodeAll([]byte("zstd"), nil)))
+
+		// when
+		_, err = copyMount(t, NewLocalConfigFileTracker(newMemoryDoguConfig(), FileSystem{}), SrcAndDestination{Src: src, Dest: dest, Extract: true})
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, "gzip", readFile(t, filepath.Join(dest, "app.conf")))
+		assert.Equal(t, "zstd", readFile(t, filepath.Join(dest, "other.conf")))
+	})
+
+	t.Run("should copy archives without extraction", func(t *testing.T) {
+		// given
+		src := t.TempDir()
+		dest := t.TempDir()
+		createZip(t, filepath.Join(src, "conf.zip"), testArchiveEntry{"app.conf", "app"})
+
+		// when
+		_, err := copyMount(t, NewLocalConfigFileTracker(newMemoryDoguConfig(), FileSystem{}), SrcAndDestination{Src: src, Dest: dest})
+
+		// then
+		require.NoError(t, err)
+		assert.FileExists(t, filepath.Join(dest, "conf.zip"))
+		assert.NoFileExists(t, filepath.Join(dest, "app.conf"))
+	})
+
+	t.Run("should apply filters to the extracted files", func(t *testing.T) {
+		// given
+		src := t.TempDir()
+		dest := t.TempDir()
+		createTarGz(t, filepath.Join(src, "conf.tgz"), testArchiveEntry{"app.xml", "app"}, testArchiveEntry{"README", "readme"})
+
+		// when
+		sut, err := copyMount(t, NewLocalConfigFileTracker(newMemoryDoguConfig(), FileSystem{}), SrcAndDestination{Src: src, Dest: dest, Extract: true, Include: []string{"*.xml"}})
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, 1, sut.summary.filtered)
+		assert.FileExists(t, filepath.Join(dest, "app.xml"))
+		assert.NoFileExists(t, filepath.Join(dest, "README"))
+	})
+
+	t.Run("should reject entries outside of the destination", func(t *testing.T) {
+		for _, name := range []string{"../escape.conf", "sub/../../escape.conf", "/etc/escape.conf"} {
+			t.Run(name, func(t *testing.T) {
+				// given
+				root := t.TempDir()
+				src := filepath.Join(root, "src")
+				dest := filepath.Join(root, "dest", "conf")
+				createZip(t, filepath.Join(src, "conf.zip"), testArchiveEntry{name, "evil"})
+
+				// when
+				sut, err := copyMount(t, NewLocalConfigFileTracker(newMemoryDoguConfig(), FileSystem{}), SrcAndDestination{Src: src, Dest: dest, Extract: true})
+
+				// then
+				require.Error(t, err)
+				assert.ErrorContains(t, err, "is outside of the destination")
+				assert.Equal(t, 1, sut.summary.failed)
+				assert.NoFileExists(t, filepath.Join(root, "dest", "escape.conf"))
+				assert.NoFileExists(t, "/etc/escape.conf")
+			})
+		}
+	})
+
+	t.Run("should fail if the archive exceeds the size limit", func(t *testing.T) {
+		// given
+		src := t.TempDir()
+		dest := t.TempDir()
+		createTarGz(t, filepath.Join(src, "conf.tar.gz"), testArchiveEntry{"small.conf", "12345"}, testArchiveEntry{"big.conf", strings.Repeat("x", 100)})
+		tracker := NewLocalConfigFileTracker(newMemoryDoguConfig(), FileSystem{})
+
+		// when
+		_, err := copyMount(t, tracker, SrcAndDestination{Src: src, Dest: dest, Extract: true, ExtractMaxSize: 50})
+
+		// then
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "uncompressed content exceeds the limit of 50 bytes")
+		assert.NoFileExists(t, filepath.Join(dest, "small.conf"))
+		assert.NoFileExists(t, filepath.Join(dest, "big.conf"))
+		tracked, err := tracker.IsTracked(filepath.Join(dest, "small.conf"))
+		require.NoError(t, err)
+		assert.False(t, tracked)
+	})
+
+	t.Run("should keep unchanged extracted files and update their metadata", func(t *testing.T) {
+		// given
+		src := t.TempDir()
+		dest := t.TempDir()
+		createTarGz(t, filepath.Join(src, "conf.tar.gz"), testArchiveEntry{"app.conf", "app"}, testArchiveEntry{"log.xml", "log"})
+		tracker := NewLocalConfigFileTracker(newMemoryDoguConfig(), FileSystem{})
+		_, err := copyMount(t, tracker, SrcAndDestination{Src: src, Dest: dest, Extract: true})
+		require.NoError(t, err)
+		modTime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		require.NoError(t, os.Chtimes(filepath.Join(dest, "app.conf"), modTime, modTime))
+		createTarGz(t, filepath.Join(src, "conf.tar.gz"), testArchiveEntry{"app.conf", "app"}, testArchiveEntry{"log.xml", "changed"})
+		fileMode := os.FileMode(0600)
+
+		// when
+		sut, err := copyMount(t, tracker, SrcAndDestination{Src: src, Dest: dest, Extract: true, FileMode: &fileMode})
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, 1, sut.summary.unchanged)
+		assert.Equal(t, 1, sut.summary.copied)
+		appFileInfo, err := os.Stat(filepath.Join(dest, "app.conf"))
+		require.NoError(t, err)
+		assert.True(t, modTime.Equal(appFileInfo.ModTime()))
+		assert.Equal(t, fileMode, appFileInfo.Mode().Perm())
+		assert.Equal(t, "changed", readFile(t, filepath.Join(dest, "log.xml")))
+		tracked, err := tracker.IsTracked(filepath.Join(dest, "app.conf"))
+		require.NoError(t, err)
+		assert.True(t, tracked)
+	})
+
+	t.Run("should extract entries up to exactly the size limit and keep existing files on errors", func(t *testing.T) {
+		// given
+		src := t.TempDir()
+		dest := t.TempDir()
+		createZip(t, filepath.Join(src, "conf.zip"), testArchiveEntry{"app.conf", strings.Repeat("x", 50)})
+		createZip(t, filepath.Join(src, "other.zip"), testArchiveEntry{"existing.conf", "new"}, testArchiveEntry{"big.conf", strings.Repeat("x", 51)})
+		writeTestFile(t, filepath.Join(dest, "existing.conf"), "existing")
+
+		// when
+		_, err := copyMount(t, NewLocalConfigFileTracker(newMemoryDoguConfig(), FileSystem{}), SrcAndDestination{Src: src, Dest: dest, Extract: true, ExtractMaxSize: 50})
+
+		// then
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "failed to extract archive "+filepath.Join(src, "other.zip"))
+		assert.Equal(t, strings.Repeat("x", 50), readFile(t, filepath.Join(dest, "app.conf")))
+		assert.Equal(t, "new", readFile(t, filepath.Join(dest, "existing.conf")))
+		assert.NoFileExists(t, filepath.Join(dest, "big.conf"))
+	})
+
+	t.Run("should fail if a compressed file without declared size exceeds the size limit", func(t *testing.T) {
+		// given
+		src := t.TempDir()
+		dest := t.TempDir()
+		var buffer bytes.Buffer
+		gzipWriter := gzip.NewWriter(&buffer)
+		_, err := gzipWriter.Write([]byte(strings.Repeat("x", 100)))
+		require.NoError(t, err)
+		require.NoError(t, gzipWriter.Close())
+		writeTestFile(t, filepath.Join(src, "big.conf.gz"), buffer.String())
+
+		// when
+		_, err = copyMount(t, NewLocalConfigFileTracker(newMemoryDoguConfig(), FileSystem{}), SrcAndDestination{Src: src, Dest: dest, Extract: true, ExtractMaxSize: 50})
+
+		// then
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "uncompressed content exceeds the limit of 50 bytes")
+		entries, err := os.ReadDir(dest)
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+
+	t.Run("should apply the conflict policy to existing files", func(t *testing.T) {
+		// given
+		src := t.TempDir()
+		dest := t.TempDir()
+		createZip(t, filepath.Join(src, "conf.zip"), testArchiveEntry{"app.conf", "new"})
+		writeTestFile(t, filepath.Join(dest, "app.conf"), "existing")
+
+		// when
+		sut, err := copyMount(t, NewLocalConfigFileTracker(newMemoryDoguConfig(), FileSystem{}), SrcAndDestination{Src: src, Dest: dest, Extract: true, Conflict: ConflictSkip})
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, 1, sut.summary.kept)
+		assert.Equal(t, "existing", readFile(t, filepath.Join(dest, "app.conf")))
+	})
+
+	t.Run("should return error on corrupt archive", func(t *testing.T) {
+		// given
+		src := t.TempDir()
+		dest := t.TempDir()
+		writeTestFile(t, filepath.Join(src, "conf.tar.gz"), "no archive")
+
+		// when
+		_, err := copyMount(t, NewLocalConfigFileTracker(newMemoryDoguConfig(), FileSystem{}), SrcAndDestination{Src: src, Dest: dest, Extract: true})
+
+		// then
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "failed to extract archive")
+	})
+}
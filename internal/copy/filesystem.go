@@ -1,10 +1,26 @@
 package copy
 
 import (
+	"errors"
 	"io"
 	"io/fs"
+	"log"
 	"os"
 	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// CopyMethod describes how the content of a file was copied.
+type CopyMethod string
+
+const (
+	// CopyMethodReflink shares the data blocks of the source with the destination.
+	CopyMethodReflink CopyMethod = "reflink"
+	// CopyMethodCopyFileRange copies the content in the kernel with copy_file_range.
+	CopyMethodCopyFileRange CopyMethod = "copy_file_range"
+	// CopyMethodStream streams the content through userspace buffers.
+	CopyMethodStream CopyMethod = "streaming"
 )
 
 type Filesystem interface {
@@ -14,12 +30,36 @@ type Filesystem interface {
 	Open(name string) (*os.File, error)
 	MkdirAll(path string, perm os.FileMode) error
 	Create(name string) (*os.File, error)
-	Copy(dst io.Writer, src io.Reader) (written int64, err error)
+	Copy(dst io.Writer, src io.Reader) (written int64, method CopyMethod, err error)
 	CloseFile(file *os.File) error
 	SyncFile(file *os.File) error
 	SameFile(fi1, fi2 os.FileInfo) bool
 	WalkDir(root string, fn fs.WalkDirFunc) error
 	DeleteFile(path string) error
+	RemoveDir(path string) error
+	Rename(oldPath, newPath string) error
+	SyncDir(path string) error
+	Chmod(name string, mode os.FileMode) error
+	Chown(name string, uid, gid int) error
+	Chtimes(name string, atime, mtime time.Time) error
+	Readlink(name string) (string, error)
+	Symlink(oldname, newname string) error
+	Link(oldname, newname string) error
+	OpenFile(name string, flag int, perm os.FileMode) (*os.File, error)
+	Statfs(path string) (FilesystemStats, error)
+}
+
+// FilesystemStats describes the capacity of the filesystem containing a path.
+type FilesystemStats struct {
+	// Device identifies the filesystem.
+	Device uint64
+	// AvailableBytes is the free space available to unprivileged users.
+	AvailableBytes uint64
+	// AvailableInodes is the number of free inodes.
+	AvailableInodes uint64
+	// TotalInodes is the number of inodes of the filesystem. It is 0 for filesystems which allocate inodes
+	// dynamically, e.g. btrfs.
+	TotalInodes uint64
 }
 
 type FileSystem struct{}
@@ -64,14 +104,104 @@ func (f FileSystem) Create(name string) (*os.File, error) {
 	return os.Create(name)
 }
 
-func (f FileSystem) Copy(dst io.Writer, src io.Reader) (written int64, err error) {
-	return io.Copy(dst, src)
+// Copy copies src to dst. If both are files, the copy is done by the kernel with reflinks or copy_file_range if
+// possible. Otherwise, or if the kernel does not support it for the files, the content is streamed.
+// The returned method is the one which copied the remaining content.
+func (f FileSystem) Copy(dst io.Writer, src io.Reader) (written int64, method CopyMethod, err error) {
+	dstFile, dstIsFile := dst.(*os.File)
+	srcFile, srcIsFile := src.(*os.File)
+	if dstIsFile && srcIsFile {
+		written, method, err = copyFileAccelerated(dstFile, srcFile)
+		if !errors.Is(err, errors.ErrUnsupported) {
+			return written, method, err
+		}
+
+		log.Printf("%s, falling back to streaming copy", err)
+	}
+
+	// The offsets of the files are advanced by the bytes written so far. Therefore, the streaming copy continues
+	// where the accelerated copy stopped.
+	streamed, err := io.Copy(dst, src)
+	return written + streamed, CopyMethodStream, err
 }
 
 func (f FileSystem) DeleteFile(path string) error {
-	if _, err := f.Stat(path); err == nil {
+	// Lstat is used to remove symlinks even if their target does not exist.
+	if _, err := f.Lstat(path); err == nil {
 		return os.Remove(path)
 	}
 
 	return nil
 }
+
+// RemoveDir removes the dir if it is empty. Other files are never removed. A dir which does not exist is ignored.
+// Use isDirNotEmpty to check if the dir was kept because it is not empty.
+func (f FileSystem) RemoveDir(path string) error {
+	if _, err := f.Lstat(path); err != nil {
+		return nil
+	}
+
+	err := syscall.Rmdir(path)
+	if err != nil {
+		return &os.PathError{Op: "rmdir", Path: path, Err: err}
+	}
+
+	return nil
+}
+
+// isDirNotEmpty checks if the error of RemoveDir was caused by a dir which is not empty.
+func isDirNotEmpty(err error) bool {
+	return errors.Is(err, syscall.ENOTEMPTY) || errors.Is(err, syscall.EEXIST)
+}
+
+func (f FileSystem) Rename(oldPath, newPath string) error {
+	return os.Rename(oldPath, newPath)
+}
+
+// SyncDir flushes the directory entries of the given dir, e.g. to persist a rename.
+func (f FileSystem) SyncDir(path string) error {
+	dir, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+
+	err = dir.Sync()
+	closeErr := dir.Close()
+	if err != nil {
+		return err
+	}
+
+	return closeErr
+}
+
+func (f FileSystem) Chmod(name string, mode os.FileMode) error {
+	return os.Chmod(name, mode)
+}
+
+func (f FileSystem) Chown(name string, uid, gid int) error {
+	return os.Chown(name, uid, gid)
+}
+
+func (f FileSystem) Chtimes(name string, atime, mtime time.Time) error {
+	return os.Chtimes(name, atime, mtime)
+}
+
+func (f FileSystem) Readlink(name string) (string, error) {
+	return os.Readlink(name)
+}
+
+func (f FileSystem) Symlink(oldname, newname string) error {
+	return os.Symlink(oldname, newname)
+}
+
+func (f FileSystem) Link(oldname, newname string) error {
+	return os.Link(oldname, newname)
+}
+
+func (f FileSystem) OpenFile(name string, flag int, perm os.FileMode) (*os.File, error) {
+	return os.OpenFile(name, flag, perm)
+}
+
+func (f FileSystem) Statfs(path string) (FilesystemStats, error) {
+	return getFilesystemStats(path)
+}
@@ -0,0 +1,106 @@
+package copy
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileSystem_Copy(t *testing.T) {
+	t.Run("should copy between files", func(t *testing.T) {
+		// given
+		dir := t.TempDir()
+		content := strings.Repeat("content", 100000)
+		writeTestFile(t, filepath.Join(dir, "src"), content)
+		src, err := os.Open(filepath.Join(dir, "src"))
+		require.NoError(t, err)
+		defer src.Close()
+		dst, err := os.Create(filepath.Join(dir, "dst"))
+		require.NoError(t, err)
+		defer dst.Close()
+
+		// when
+		written, _, err := FileSystem{}.Copy(dst, src)
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(content)), written)
+		actual, err := os.ReadFile(filepath.Join(dir, "dst"))
+		require.NoError(t, err)
+		assert.Equal(t, content, string(actual))
+	})
+
+	t.Run("should stream if the destination is no file", func(t *testing.T) {
+		// given
+		dir := t.TempDir()
+		writeTestFile(t, filepath.Join(dir, "src"), "content")
+		src, err := os.Open(filepath.Join(dir, "src"))
+		require.NoError(t, err)
+		defer src.Close()
+		dst := &bytes.Buffer{}
+
+		// when
+		written, method, err := FileSystem{}.Copy(dst, src)
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, int64(7), written)
+		assert.Equal(t, CopyMethodStream, method)
+		assert.Equal(t, "content", dst.String())
+	})
+}
+
+func TestFileSystem_RemoveDir(t *testing.T) {
+	t.Run("should remove empty dir", func(t *testing.T) {
+		// given
+		dir := filepath.Join(t.TempDir(), "dir")
+		require.NoError(t, os.Mkdir(dir, 0755))
+
+		// when
+		err := FileSystem{}.RemoveDir(dir)
+
+		// then
+		require.NoError(t, err)
+		assert.NoDirExists(t, dir)
+	})
+
+	t.Run("should keep dir which is not empty", func(t *testing.T) {
+		// given
+		dir := t.TempDir()
+		writeTestFile(t, filepath.Join(dir, "file"), "content")
+
+		// when
+		err := FileSystem{}.RemoveDir(dir)
+
+		// then
+		require.Error(t, err)
+		assert.True(t, isDirNotEmpty(err))
+		assert.FileExists(t, filepath.Join(dir, "file"))
+	})
+
+	t.Run("should not remove file", func(t *testing.T) {
+		// given
+		file := filepath.Join(t.TempDir(), "file")
+		writeTestFile(t, file, "content")
+
+		// when
+		err := FileSystem{}.RemoveDir(file)
+
+		// then
+		require.Error(t, err)
+		assert.False(t, isDirNotEmpty(err))
+		assert.FileExists(t, file)
+	})
+
+	t.Run("should ignore missing dir", func(t *testing.T) {
+		// when
+		err := FileSystem{}.RemoveDir(filepath.Join(t.TempDir(), "missing"))
+
+		// then
+		require.NoError(t, err)
+	})
+}
@@ -0,0 +1,41 @@
+package copy
+
+import (
+	"fmt"
+	"github.com/bmatcuk/doublestar/v4"
+	"path/filepath"
+)
+
+// ValidatePatterns checks if all patterns are valid doublestar glob patterns.
+func ValidatePatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if !doublestar.ValidatePattern(pattern) {
+			return fmt.Errorf("invalid glob pattern %q", pattern)
+		}
+	}
+
+	return nil
+}
+
+// isIncluded checks if the path relative to the source of the mount passes the include and exclude patterns.
+// A path is included if it matches at least one include pattern or if no include patterns are defined.
+// Exclude patterns take precedence over include patterns.
+func (m SrcAndDestination) isIncluded(relPath string) bool {
+	relPath = filepath.ToSlash(relPath)
+	if len(m.Include) > 0 && !matchesAny(m.Include, relPath) {
+		return false
+	}
+
+	return !matchesAny(m.Exclude, relPath)
+}
+
+func matchesAny(patterns []string, relPath string) bool {
+	for _, pattern := range patterns {
+		// Invalid patterns are rejected beforehand by ValidatePatterns and just never match here.
+		if doublestar.MatchUnvalidated(pattern, relPath) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,45 @@
+package copy
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestSrcAndDestination_isIncluded(t *testing.T) {
+	tests := []struct {
+		name    string
+		include []string
+		exclude []string
+		relPath string
+		want    bool
+	}{
+		{name: "should include everything without patterns", relPath: "dir/config.xml", want: true},
+		{name: "should include matching file", include: []string{"*.xml"}, relPath: "config.xml", want: true},
+		{name: "should not include file in sub dir with single star", include: []string{"*.xml"}, relPath: "dir/config.xml", want: false},
+		{name: "should include file in sub dir with double star", include: []string{"**/*.xml"}, relPath: "dir/sub/config.xml", want: true},
+		{name: "should not include non matching file", include: []string{"**/*.xml"}, relPath: "README", want: false},
+		{name: "should include file matching one of several patterns", include: []string{"*.yaml", "*.xml"}, relPath: "config.xml", want: true},
+		{name: "should exclude matching file", exclude: []string{"README*"}, relPath: "README.md", want: false},
+		{name: "should exclude file in excluded dir", exclude: []string{"cache/**"}, relPath: "cache/dir/file", want: false},
+		{name: "should prefer exclude over include", include: []string{"**/*.xml"}, exclude: []string{"test/**"}, relPath: "test/config.xml", want: false},
+		{name: "should match alternatives", include: []string{"*.{yaml,yml}"}, relPath: "config.yml", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sut := SrcAndDestination{Include: tt.include, Exclude: tt.exclude}
+			assert.Equal(t, tt.want, sut.isIncluded(tt.relPath))
+		})
+	}
+}
+
+func TestValidatePatterns(t *testing.T) {
+	t.Run("should accept valid patterns", func(t *testing.T) {
+		assert.NoError(t, ValidatePatterns([]string{"**/*.xml", "dir/{a,b}", "file[0-9]"}))
+	})
+
+	t.Run("should return error on invalid pattern", func(t *testing.T) {
+		err := ValidatePatterns([]string{"*.xml", "dir/[a"})
+
+		assert.ErrorContains(t, err, `invalid glob pattern "dir/[a"`)
+	})
+}
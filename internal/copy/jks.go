@@ -0,0 +1,276 @@
+package copy
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"unicode/utf16"
+)
+
+const (
+	jksMagic          = 0xfeedfeed
+	jksVersion        = 2
+	jksPrivateKeyTag  = 1
+	jksTrustedCertTag = 2
+	jksCertType       = "X.509"
+	// jksDigestSalt is appended to the password for the integrity check of Java keystores.
+	jksDigestSalt = "Mighty Aphrodite"
+)
+
+// truststoreEntry is a trusted certificate of a truststore.
+type truststoreEntry struct {
+	alias string
+	cert  *x509.Certificate
+}
+
+// encodeJKS encodes the certificates as trusted certificate entries of a Java keystore protected with the password.
+// The creation date of an entry is the start of the validity of its certificate, so that the same entries result in
+// the same keystore.
+func encodeJKS(entries []truststoreEntry, password string) ([]byte, error) {
+	var content bytes.Buffer
+	writeUint32 := func(value uint32) {
+		_ = binary.Write(&content, binary.BigEndian, value)
+	}
+
+	writeUint32(jksMagic)
+	writeUint32(jksVersion)
+	writeUint32(uint32(len(entries)))
+	for _, entry := range entries {
+		writeUint32(jksTrustedCertTag)
+		err := writeJavaUTF(&content, entry.alias)
+		if err != nil {
+			return nil, fmt.Errorf("invalid alias %q: %w", entry.alias, err)
+		}
+
+		_ = binary.Write(&content, binary.BigEndian, entry.cert.NotBefore.UnixMilli())
+		err = writeJavaUTF(&content, jksCertType)
+		if err != nil {
+			return nil, err
+		}
+
+		writeUint32(uint32(len(entry.cert.Raw)))
+		content.Write(entry.cert.Raw)
+	}
+
+	content.Write(getJKSDigest(content.Bytes(), password))
+
+	return content.Bytes(), nil
+}
+
+// decodeJKS returns the trusted certificate entries of the Java keystore after checking its integrity with the
+// password. Private key entries are skipped.
+func decodeJKS(data []byte, password string) ([]truststoreEntry, error) {
+	if len(data) < sha1.Size {
+		return nil, errors.New("keystore is too short")
+	}
+
+	content, digest := data[:len(data)-sha1.Size], data[len(data)-sha1.Size:]
+	if !bytes.Equal(digest, getJKSDigest(content, password)) {
+		return nil, errors.New("keystore was tampered with or password was incorrect")
+	}
+
+	reader := bytes.NewReader(content)
+	var header struct {
+		Magic   uint32
+		Version uint32
+		Count   uint32
+	}
+
+	err := binary.Read(reader, binary.BigEndian, &header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keystore header: %w", err)
+	}
+
+	if header.Magic != jksMagic || (header.Version != 1 && header.Version != jksVersion) {
+		return nil, errors.New("no Java keystore")
+	}
+
+	var entries []truststoreEntry
+	for i := uint32(0); i < header.Count; i++ {
+		entry, err := readJKSEntry(reader, header.Version)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read keystore entry %d: %w", i, err)
+		}
+
+		if entry != nil {
+			entries = append(entries, *entry)
+		}
+	}
+
+	return entries, nil
+}
+
+// readJKSEntry reads the next entry. It returns nil for private key entries.
+func readJKSEntry(reader *bytes.Reader, version uint32) (*truststoreEntry, error) {
+	var tag uint32
+	err := binary.Read(reader, binary.BigEndian, &tag)
+	if err != nil {
+		return nil, err
+	}
+
+	alias, err := readJavaUTF(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	var date int64
+	err = binary.Read(reader, binary.BigEndian, &date)
+	if err != nil {
+		return nil, err
+	}
+
+	switch tag {
+	case jksTrustedCertTag:
+		cert, err := readJKSCertificate(reader, version)
+		if err != nil {
+			return nil, err
+		}
+
+		return &truststoreEntry{alias: alias, cert: cert}, nil
+	case jksPrivateKeyTag:
+		err = skipJKSPrivateKey(reader, version)
+		if err != nil {
+			return nil, err
+		}
+
+		log.Printf("skip private key entry %s of keystore", alias)
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown entry type %d", tag)
+	}
+}
+
+func skipJKSPrivateKey(reader *bytes.Reader, version uint32) error {
+	_, err := readJKSBytes(reader)
+	if err != nil {
+		return err
+	}
+
+	var chainLength uint32
+	err = binary.Read(reader, binary.BigEndian, &chainLength)
+	if err != nil {
+		return err
+	}
+
+	for i := uint32(0); i < chainLength; i++ {
+		_, err = readJKSCertificate(reader, version)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func readJKSCertificate(reader *bytes.Reader, version uint32) (*x509.Certificate, error) {
+	if version == jksVersion {
+		certType, err := readJavaUTF(reader)
+		if err != nil {
+			return nil, err
+		}
+
+		if certType != jksCertType {
+			return nil, fmt.Errorf("unsupported certificate type %s", certType)
+		}
+	}
+
+	raw, err := readJKSBytes(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	return x509.ParseCertificate(raw)
+}
+
+func readJKSBytes(reader *bytes.Reader) ([]byte, error) {
+	var length uint32
+	err := binary.Read(reader, binary.BigEndian, &length)
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(length) > int64(reader.Len()) {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	data := make([]byte, length)
+	_, err = io.ReadFull(reader, data)
+	return data, err
+}
+
+// getJKSDigest returns the SHA-1 hash of the password as UTF-16 characters, the salt and the content.
+func getJKSDigest(content []byte, password string) []byte {
+	hash := sha1.New()
+	for _, char := range utf16.Encode([]rune(password)) {
+		hash.Write([]byte{byte(char >> 8), byte(char)})
+	}
+
+	hash.Write([]byte(jksDigestSalt))
+	hash.Write(content)
+
+	return hash.Sum(nil)
+}
+
+// writeJavaUTF writes the string in the modified UTF-8 encoding of DataOutput.writeUTF with its length.
+func writeJavaUTF(writer *bytes.Buffer, text string) error {
+	var encoded []byte
+	for _, char := range utf16.Encode([]rune(text)) {
+		switch {
+		case char != 0 && char < 0x80:
+			encoded = append(encoded, byte(char))
+		case char < 0x800:
+			encoded = append(encoded, byte(0xc0|char>>6), byte(0x80|char&0x3f))
+		default:
+			encoded = append(encoded, byte(0xe0|char>>12), byte(0x80|char>>6&0x3f), byte(0x80|char&0x3f))
+		}
+	}
+
+	if len(encoded) > 0xffff {
+		return errors.New("string is too long")
+	}
+
+	_ = binary.Write(writer, binary.BigEndian, uint16(len(encoded)))
+	writer.Write(encoded)
+
+	return nil
+}
+
+// readJavaUTF reads a string written with DataOutput.writeUTF.
+func readJavaUTF(reader *bytes.Reader) (string, error) {
+	var length uint16
+	err := binary.Read(reader, binary.BigEndian, &length)
+	if err != nil {
+		return "", err
+	}
+
+	encoded := make([]byte, length)
+	_, err = io.ReadFull(reader, encoded)
+	if err != nil {
+		return "", err
+	}
+
+	var chars []uint16
+	for i := 0; i < len(encoded); {
+		b := encoded[i]
+		switch {
+		case b < 0x80:
+			chars = append(chars, uint16(b))
+			i++
+		case b&0xe0 == 0xc0 && i+1 < len(encoded):
+			chars = append(chars, uint16(b&0x1f)<<6|uint16(encoded[i+1]&0x3f))
+			i += 2
+		case b&0xf0 == 0xe0 && i+2 < len(encoded):
+			chars = append(chars, uint16(b&0x0f)<<12|uint16(encoded[i+1]&0x3f)<<6|uint16(encoded[i+2]&0x3f))
+			i += 3
+		default:
+			return "", errors.New("invalid modified UTF-8 string")
+		}
+	}
+
+	return string(utf16.Decode(chars)), nil
+}
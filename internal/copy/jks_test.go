@@ -0,0 +1,60 @@
+package copy
+
+import (
+	"bytes"
+	"crypto/x509/pkix"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func Test_encodeJKS(t *testing.T) {
+	t.Run("should decode encoded entries", func(t *testing.T) {
+		// given
+		entries := []truststoreEntry{
+			{alias: "root", cert: newTestCertificate(t, pkix.Name{CommonName: "Root CA"})},
+			{alias: "zwischen-ca-ä", cert: newTestCertificate(t, pkix.Name{CommonName: "Zwischen CA"})},
+		}
+
+		// when
+		content, err := encodeJKS(entries, "changeit")
+
+		// then
+		require.NoError(t, err)
+		decoded, err := decodeJKS(content, "changeit")
+		require.NoError(t, err)
+		assert.Equal(t, entries, decoded)
+		again, err := encodeJKS(entries, "changeit")
+		require.NoError(t, err)
+		assert.Equal(t, content, again)
+	})
+
+	t.Run("should return error on wrong password", func(t *testing.T) {
+		// given
+		content, err := encodeJKS([]truststoreEntry{{alias: "root", cert: newTestCertificate(t, pkix.Name{CommonName: "Root CA"})}}, "changeit")
+		require.NoError(t, err)
+
+		// when
+		_, err = decodeJKS(content, "secret")
+
+		// then
+		assert.ErrorContains(t, err, "keystore was tampered with or password was incorrect")
+	})
+}
+
+func Test_javaUTF(t *testing.T) {
+	t.Run("should encode zero and supplementary characters like Java", func(t *testing.T) {
+		// given
+		var buffer bytes.Buffer
+
+		// when
+		err := writeJavaUTF(&buffer, "a\x00😀")
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, []byte{0, 9, 'a', 0xc0, 0x80, 0xed, 0xa0, 0xbd, 0xed, 0xb8, 0x80}, buffer.Bytes())
+		text, err := readJavaUTF(bytes.NewReader(buffer.Bytes()))
+		require.NoError(t, err)
+		assert.Equal(t, "a\x00😀", text)
+	})
+}
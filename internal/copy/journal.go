@@ -0,0 +1,660 @@
+package copy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"sync"
+	"time"
+)
+
+// metadataModeMask contains the mode bits which are changed by Chmod and restored on rollback.
+const metadataModeMask = fs.ModePerm | fs.ModeSetuid | fs.ModeSetgid | fs.ModeSticky
+
+// journalBackupSuffix is appended to the hard links which keep replaced and deleted files until the run is committed.
+const journalBackupSuffix = ".txn"
+
+type journalOperation string
+
+const (
+	// journalBegin starts a run and contains the snapshot of the local config keys of the file tracker.
+	journalBegin journalOperation = "begin"
+	// journalCreate records a file, symlink or dir which is created.
+	journalCreate journalOperation = "create"
+	// journalRename records a rename. An existing target is kept as backup.
+	journalRename journalOperation = "rename"
+	// journalDelete records a deleted file which is kept as backup.
+	journalDelete journalOperation = "delete"
+	// journalRemoveDir records an empty dir which is removed. It is recreated with its mode and owner.
+	journalRemoveDir journalOperation = "rmdir"
+	// journalMetadata records the mode, owner and modification time of a file or dir before they are changed.
+	journalMetadata journalOperation = "metadata"
+	// journalUndone marks the entry with the index as rolled back.
+	journalUndone journalOperation = "undone"
+	// journalCommit marks the run as successful. Only the backups have to be removed afterward.
+	journalCommit journalOperation = "commit"
+)
+
+// trackerConfigKeys are the local config keys of the file tracker which are restored on rollback.
+var trackerConfigKeys = []string{additionalMountsConfigKey, additionalMountsChecksumsConfigKey, additionalMountsBackupsConfigKey, additionalMountsDirsConfigKey}
+
+type journalEntry struct {
+	Operation journalOperation `json:"op"`
+	Path      string           `json:"path,omitempty"`
+	Target    string           `json:"target,omitempty"`
+	Backup    string           `json:"backup,omitempty"`
+	Index     int              `json:"index,omitempty"`
+	Mode      os.FileMode      `json:"mode,omitempty"`
+	UID       *int             `json:"uid,omitempty"`
+	GID       *int             `json:"gid,omitempty"`
+	ModTime   *time.Time       `json:"mtime,omitempty"`
+	// Config maps the local config keys to their values. Missing keys have a nil value.
+	Config map[string]*string `json:"config,omitempty"`
+}
+
+// Journal makes a copy run transactional. Every modification of the filesystem is appended to the journal file
+// and flushed before it is applied. Replaced and deleted files are kept as hard links until the run is committed.
+// If the run fails, all modifications are rolled back in reverse order and the local config keys of the file
+// tracker are restored. If the process is killed, the next start recovers from the journal with [Journal.Recover].
+type Journal struct {
+	filePath   string
+	fileSystem Filesystem
+	doguConfig doguConfigReaderWriter
+	mutex      sync.Mutex
+	file       *os.File
+	entries    []journalEntry
+}
+
+// NewJournal creates a journal with the journal file at the path. The file system and the dogu config must not be
+// wrapped by a TransactionalFileSystem or a dry run.
+func NewJournal(filePath string, fileSystem Filesystem, doguConfig doguConfigReaderWriter) *Journal {
+	return &Journal{filePath: filePath, fileSystem: fileSystem, doguConfig: doguConfig}
+}
+
+// Run executes the function in a transaction. If the function returns an error, all its modifications done with a
+// TransactionalFileSystem of this journal are rolled back.
+func (j *Journal) Run(fn func() error) error {
+	err := j.begin()
+	if err != nil {
+		return err
+	}
+
+	runErr := fn()
+	if runErr == nil {
+		return j.commit()
+	}
+
+	log.Printf("Rolling back the copy run because of errors")
+	rollbackErr := j.rollback()
+	if rollbackErr != nil {
+		return errors.Join(runErr, fmt.Errorf("failed to roll back the copy run, the rollback is retried on the next start: %w", rollbackErr))
+	}
+
+	return runErr
+}
+
+// Recover completes a run which was interrupted, e.g. because the process was killed. Uncommitted runs are rolled
+// back. Committed runs only have their backups removed. Recover does nothing if there is no journal file.
+func (j *Journal) Recover() error {
+	_, err := j.fileSystem.Lstat(j.filePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to check journal %s: %w", j.filePath, err)
+	}
+
+	log.Printf("Recovering interrupted copy run from journal %s", j.filePath)
+	err = j.open()
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range j.entries {
+		if entry.Operation == journalCommit {
+			return j.removeBackups()
+		}
+	}
+
+	return j.rollback()
+}
+
+func (j *Journal) begin() error {
+	snapshot := map[string]*string{}
+	for _, key := range trackerConfigKeys {
+		value, err := j.getConfigValue(key)
+		if err != nil {
+			return err
+		}
+
+		snapshot[key] = value
+	}
+
+	file, err := j.fileSystem.OpenFile(j.filePath, os.O_WRONLY|os.O_CREATE|os.O_EXCL|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create journal %s: %w", j.filePath, err)
+	}
+
+	j.file = file
+	j.entries = nil
+	err = j.record(journalEntry{Operation: journalBegin, Config: snapshot})
+	if err != nil {
+		return err
+	}
+
+	err = j.fileSystem.SyncDir(path.Dir(j.filePath))
+	if err != nil {
+		return fmt.Errorf("failed to sync dir of journal %s: %w", j.filePath, err)
+	}
+
+	return nil
+}
+
+// open reads the entries of the journal file and opens it for appending. An incomplete last entry, e.g. because the
+// process was killed while writing it, belongs to a modification which was not applied and is truncated.
+func (j *Journal) open() error {
+	file, err := j.fileSystem.Open(j.filePath)
+	if err != nil {
+		return fmt.Errorf("failed to open journal %s: %w", j.filePath, err)
+	}
+
+	var entries []journalEntry
+	var validSize int64
+	decoder := json.NewDecoder(file)
+	for {
+		var entry journalEntry
+		err = decoder.Decode(&entry)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			log.Printf("ignore incomplete entries at offset %d of journal %s: %s", validSize, j.filePath, err)
+			break
+		}
+
+		entries = append(entries, entry)
+		validSize = decoder.InputOffset()
+	}
+
+	closeErr := j.fileSystem.CloseFile(file)
+	if closeErr != nil {
+		log.Println(fmt.Errorf("failed to close fd: %w", closeErr))
+	}
+
+	j.file, err = j.fileSystem.OpenFile(j.filePath, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open journal %s: %w", j.filePath, err)
+	}
+
+	err = j.file.Truncate(validSize)
+	if err != nil {
+		return fmt.Errorf("failed to truncate journal %s: %w", j.filePath, err)
+	}
+
+	j.entries = entries
+
+	return nil
+}
+
+// record appends the entry to the journal file and flushes it.
+func (j *Journal) record(entry journalEntry) error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	return j.recordLocked(entry)
+}
+
+func (j *Journal) recordLocked(entry journalEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal journal entry: %w", err)
+	}
+
+	_, err = j.file.Write(append(line, '\n'))
+	if err != nil {
+		return fmt.Errorf("failed to write journal %s: %w", j.filePath, err)
+	}
+
+	err = j.fileSystem.SyncFile(j.file)
+	if err != nil {
+		return fmt.Errorf("failed to flush journal %s: %w", j.filePath, err)
+	}
+
+	j.entries = append(j.entries, entry)
+
+	return nil
+}
+
+// recordWithBackup appends an entry whose file is kept as backup. The backup path is unique within the journal.
+func (j *Journal) recordWithBackup(entry journalEntry, filePath string) (journalEntry, error) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	dir, file := path.Split(filePath)
+	entry.Backup = path.Join(dir, fmt.Sprintf(".%s.%d%s", file, len(j.entries), journalBackupSuffix))
+
+	return entry, j.recordLocked(entry)
+}
+
+func (j *Journal) commit() error {
+	err := j.record(journalEntry{Operation: journalCommit})
+	if err != nil {
+		return err
+	}
+
+	return j.removeBackups()
+}
+
+// removeBackups deletes the backups of a committed run and the journal.
+func (j *Journal) removeBackups() error {
+	var multiErr []error
+	for _, entry := range j.entries {
+		if entry.Backup != "" {
+			multiErr = append(multiErr, j.fileSystem.DeleteFile(entry.Backup))
+		}
+	}
+
+	err := errors.Join(multiErr...)
+	if err != nil {
+		return fmt.Errorf("failed to remove backups of journal %s: %w", j.filePath, err)
+	}
+
+	return j.remove()
+}
+
+// rollback undoes all entries in reverse order. Every undone entry is marked in the journal, so that an interrupted
+// rollback continues with the next entry. The rollback stops at the first error and is retried on the next start.
+func (j *Journal) rollback() error {
+	undone := map[int]bool{}
+	for _, entry := range j.entries {
+		if entry.Operation == journalUndone {
+			undone[entry.Index] = true
+		}
+	}
+
+	entries := j.entries
+	for i := len(entries) - 1; i >= 0; i-- {
+		if undone[i] || entries[i].Operation == journalUndone || entries[i].Operation == journalCommit {
+			continue
+		}
+
+		err := j.undo(entries[i])
+		if err != nil {
+			return err
+		}
+
+		err = j.record(journalEntry{Operation: journalUndone, Index: i})
+		if err != nil {
+			return err
+		}
+	}
+
+	log.Printf("Rolled back copy run of journal %s", j.filePath)
+
+	return j.remove()
+}
+
+// undo reverts the entry. It can be applied repeatedly, e.g. if the process is killed during the rollback.
+func (j *Journal) undo(entry journalEntry) error {
+	switch entry.Operation {
+	case journalBegin:
+		return j.restoreConfig(entry.Config)
+	case journalCreate:
+		return j.undoCreate(entry.Path)
+	case journalRename:
+		if j.exists(entry.Target) && !j.exists(entry.Path) {
+			err := j.fileSystem.Rename(entry.Target, entry.Path)
+			if err != nil {
+				return fmt.Errorf("failed to move %s back to %s: %w", entry.Target, entry.Path, err)
+			}
+		}
+
+		return j.restoreBackup(entry.Backup, entry.Target)
+	case journalDelete:
+		return j.restoreBackup(entry.Backup, entry.Path)
+	case journalRemoveDir:
+		return j.undoRemoveDir(entry)
+	case journalMetadata:
+		return j.undoMetadata(entry)
+	default:
+		return nil
+	}
+}
+
+func (j *Journal) undoCreate(filePath string) error {
+	fileInfo, err := j.fileSystem.Lstat(filePath)
+	if err != nil {
+		return nil
+	}
+
+	err = j.fileSystem.DeleteFile(filePath)
+	if err != nil && fileInfo.IsDir() {
+		log.Printf("keep dir %s created by the copy run: %s", filePath, err)
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to remove %s: %w", filePath, err)
+	}
+
+	return nil
+}
+
+// undoRemoveDir recreates the removed dir with its mode and owner.
+func (j *Journal) undoRemoveDir(entry journalEntry) error {
+	if j.exists(entry.Path) {
+		return nil
+	}
+
+	err := j.fileSystem.MkdirAll(entry.Path, entry.Mode)
+	if err != nil {
+		return fmt.Errorf("failed to recreate dir %s: %w", entry.Path, err)
+	}
+
+	// MkdirAll is subject to the umask.
+	err = j.fileSystem.Chmod(entry.Path, entry.Mode)
+	if err != nil {
+		return fmt.Errorf("failed to change mode of dir %s: %w", entry.Path, err)
+	}
+
+	if entry.UID != nil && entry.GID != nil {
+		err = j.fileSystem.Chown(entry.Path, *entry.UID, *entry.GID)
+		if err != nil {
+			return fmt.Errorf("failed to change owner of dir %s: %w", entry.Path, err)
+		}
+	}
+
+	return nil
+}
+
+// undoMetadata restores the recorded mode, owner and modification time if they were changed.
+// Files which do not exist anymore are ignored because their creation or rename is undone separately.
+func (j *Journal) undoMetadata(entry journalEntry) error {
+	fileInfo, err := j.fileSystem.Stat(entry.Path)
+	if err != nil {
+		return nil
+	}
+
+	if fileInfo.Mode()&metadataModeMask != entry.Mode {
+		err = j.fileSystem.Chmod(entry.Path, entry.Mode)
+		if err != nil {
+			return fmt.Errorf("failed to restore mode of %s: %w", entry.Path, err)
+		}
+	}
+
+	uid, gid, ok := getFileOwner(fileInfo)
+	if entry.UID != nil && entry.GID != nil && (!ok || uid != *entry.UID || gid != *entry.GID) {
+		err = j.fileSystem.Chown(entry.Path, *entry.UID, *entry.GID)
+		if err != nil {
+			return fmt.Errorf("failed to restore owner of %s: %w", entry.Path, err)
+		}
+	}
+
+	if entry.ModTime != nil && !fileInfo.ModTime().Equal(*entry.ModTime) {
+		// The zero access time keeps the current one.
+		err = j.fileSystem.Chtimes(entry.Path, time.Time{}, *entry.ModTime)
+		if err != nil {
+			return fmt.Errorf("failed to restore modification time of %s: %w", entry.Path, err)
+		}
+	}
+
+	return nil
+}
+
+// restoreBackup moves the backup back to the file path. If the file still exists, the modification was not applied
+// and the backup is just removed.
+func (j *Journal) restoreBackup(backup, filePath string) error {
+	if backup == "" || !j.exists(backup) {
+		return nil
+	}
+
+	if j.exists(filePath) {
+		return j.fileSystem.DeleteFile(backup)
+	}
+
+	err := j.fileSystem.Rename(backup, filePath)
+	if err != nil {
+		return fmt.Errorf("failed to restore %s from %s: %w", filePath, backup, err)
+	}
+
+	return nil
+}
+
+func (j *Journal) restoreConfig(snapshot map[string]*string) error {
+	for _, key := range trackerConfigKeys {
+		current, err := j.getConfigValue(key)
+		if err != nil {
+			return err
+		}
+
+		value := snapshot[key]
+		if (value == nil && current == nil) || (value != nil && current != nil && *value == *current) {
+			continue
+		}
+
+		// The file tracker treats empty values like missing keys.
+		restored := ""
+		if value != nil {
+			restored = *value
+		}
+
+		err = j.doguConfig.Set(key, restored)
+		if err != nil {
+			return fmt.Errorf("failed to restore local config key %s: %w", key, err)
+		}
+	}
+
+	return nil
+}
+
+func (j *Journal) getConfigValue(key string) (*string, error) {
+	exists, err := j.doguConfig.Exists(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check if local config key %s exists: %w", key, err)
+	}
+
+	if !exists {
+		return nil, nil
+	}
+
+	value, err := j.doguConfig.Get(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get local config key %s: %w", key, err)
+	}
+
+	return &value, nil
+}
+
+func (j *Journal) exists(filePath string) bool {
+	_, err := j.fileSystem.Lstat(filePath)
+	return err == nil
+}
+
+// remove closes and deletes the journal file.
+func (j *Journal) remove() error {
+	closeErr := j.fileSystem.CloseFile(j.file)
+	if closeErr != nil {
+		log.Println(fmt.Errorf("failed to close fd: %w", closeErr))
+	}
+
+	j.file = nil
+	j.entries = nil
+	err := j.fileSystem.DeleteFile(j.filePath)
+	if err != nil {
+		return fmt.Errorf("failed to remove journal %s: %w", j.filePath, err)
+	}
+
+	return nil
+}
+
+// TransactionalFileSystem wraps a Filesystem and records all modifications in the journal before they are applied.
+// Changes of the metadata are recorded with the previous mode, owner and modification time because they are also
+// applied to existing files and dirs, e.g. to unchanged files whose mode option changed.
+type TransactionalFileSystem struct {
+	Filesystem
+	journal *Journal
+}
+
+func NewTransactionalFileSystem(fileSystem Filesystem, journal *Journal) TransactionalFileSystem {
+	return TransactionalFileSystem{Filesystem: fileSystem, journal: journal}
+}
+
+func (f TransactionalFileSystem) Create(name string) (*os.File, error) {
+	err := f.journal.record(journalEntry{Operation: journalCreate, Path: name})
+	if err != nil {
+		return nil, err
+	}
+
+	return f.Filesystem.Create(name)
+}
+
+func (f TransactionalFileSystem) Symlink(oldname, newname string) error {
+	err := f.journal.record(journalEntry{Operation: journalCreate, Path: newname})
+	if err != nil {
+		return err
+	}
+
+	return f.Filesystem.Symlink(oldname, newname)
+}
+
+func (f TransactionalFileSystem) Link(oldname, newname string) error {
+	err := f.journal.record(journalEntry{Operation: journalCreate, Path: newname})
+	if err != nil {
+		return err
+	}
+
+	return f.Filesystem.Link(oldname, newname)
+}
+
+// MkdirAll records every missing dir from top to bottom, so that the rollback removes them from bottom to top.
+func (f TransactionalFileSystem) MkdirAll(dirPath string, perm os.FileMode) error {
+	missingDirs, err := getMissingDirs(dirPath, f.Filesystem)
+	if err != nil {
+		return err
+	}
+
+	for _, missingDir := range missingDirs {
+		err = f.journal.record(journalEntry{Operation: journalCreate, Path: missingDir})
+		if err != nil {
+			return err
+		}
+	}
+
+	return f.Filesystem.MkdirAll(dirPath, perm)
+}
+
+// Rename keeps an existing file at the new path as backup.
+func (f TransactionalFileSystem) Rename(oldPath, newPath string) error {
+	entry := journalEntry{Operation: journalRename, Path: oldPath, Target: newPath}
+	if _, err := f.Lstat(newPath); err != nil {
+		err = f.journal.record(entry)
+		if err != nil {
+			return err
+		}
+
+		return f.Filesystem.Rename(oldPath, newPath)
+	}
+
+	entry, err := f.journal.recordWithBackup(entry, newPath)
+	if err != nil {
+		return err
+	}
+
+	err = f.Filesystem.Link(newPath, entry.Backup)
+	if err != nil {
+		return fmt.Errorf("failed to keep %s as %s: %w", newPath, entry.Backup, err)
+	}
+
+	return f.Filesystem.Rename(oldPath, newPath)
+}
+
+// RemoveDir records the mode and owner of the dir, so that the rollback recreates it.
+func (f TransactionalFileSystem) RemoveDir(dirPath string) error {
+	fileInfo, err := f.Lstat(dirPath)
+	if err != nil {
+		return nil
+	}
+
+	entry := journalEntry{Operation: journalRemoveDir, Path: dirPath, Mode: fileInfo.Mode() & metadataModeMask}
+	if uid, gid, ok := getFileOwner(fileInfo); ok {
+		entry.UID, entry.GID = &uid, &gid
+	}
+
+	err = f.journal.record(entry)
+	if err != nil {
+		return err
+	}
+
+	return f.Filesystem.RemoveDir(dirPath)
+}
+
+// DeleteFile keeps the deleted file as backup.
+func (f TransactionalFileSystem) DeleteFile(filePath string) error {
+	if _, err := f.Lstat(filePath); err != nil {
+		return nil
+	}
+
+	entry, err := f.journal.recordWithBackup(journalEntry{Operation: journalDelete, Path: filePath}, filePath)
+	if err != nil {
+		return err
+	}
+
+	err = f.Filesystem.Link(filePath, entry.Backup)
+	if err != nil {
+		return fmt.Errorf("failed to keep %s as %s: %w", filePath, entry.Backup, err)
+	}
+
+	return f.Filesystem.DeleteFile(filePath)
+}
+
+func (f TransactionalFileSystem) Chmod(name string, mode os.FileMode) error {
+	err := f.recordMetadata(name)
+	if err != nil {
+		return err
+	}
+
+	return f.Filesystem.Chmod(name, mode)
+}
+
+func (f TransactionalFileSystem) Chown(name string, uid, gid int) error {
+	err := f.recordMetadata(name)
+	if err != nil {
+		return err
+	}
+
+	return f.Filesystem.Chown(name, uid, gid)
+}
+
+func (f TransactionalFileSystem) Chtimes(name string, atime, mtime time.Time) error {
+	err := f.recordMetadata(name)
+	if err != nil {
+		return err
+	}
+
+	return f.Filesystem.Chtimes(name, atime, mtime)
+}
+
+// recordMetadata records the current mode, owner and modification time of the file, so that the rollback restores
+// them. Like the metadata changes, it follows symlinks. Files which do not exist are not recorded because the change
+// fails anyway.
+func (f TransactionalFileSystem) recordMetadata(name string) error {
+	fileInfo, err := f.Stat(name)
+	if err != nil {
+		return nil
+	}
+
+	modTime := fileInfo.ModTime()
+	entry := journalEntry{Operation: journalMetadata, Path: name, Mode: fileInfo.Mode() & metadataModeMask, ModTime: &modTime}
+	if uid, gid, ok := getFileOwner(fileInfo); ok {
+		entry.UID, entry.GID = &uid, &gid
+	}
+
+	return f.journal.record(entry)
+}
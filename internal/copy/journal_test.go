@@ -0,0 +1,250 @@
+package copy
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJournal_Run(t *testing.T) {
+	type fixture struct {
+		dir         string
+		journalPath string
+		doguConfig  *memoryDoguConfig
+		sut         *Journal
+		fileSystem  TransactionalFileSystem
+	}
+	setUp := func(t *testing.T) fixture {
+		dir := t.TempDir()
+		writeTestFile(t, filepath.Join(dir, "overwritten"), "original")
+		writeTestFile(t, filepath.Join(dir, "renamed"), "renamed")
+		writeTestFile(t, filepath.Join(dir, "deleted"), "deleted")
+		require.NoError(t, os.Mkdir(filepath.Join(dir, "empty"), 0700))
+		require.NoError(t, os.Chmod(filepath.Join(dir, "empty"), 0750))
+		doguConfig := newMemoryDoguConfig()
+		doguConfig.values[additionalMountsConfigKey] = "- " + filepath.Join(dir, "deleted") + "\n"
+		journalPath := filepath.Join(t.TempDir(), "journal")
+		sut := NewJournal(journalPath, FileSystem{}, doguConfig)
+		return fixture{dir: dir, journalPath: journalPath, doguConfig: doguConfig, sut: sut, fileSystem: NewTransactionalFileSystem(FileSystem{}, sut)}
+	}
+	modify := func(t *testing.T, f fixture) {
+		require.NoError(t, writeAtomically("src", filepath.Join(f.dir, "sub", "dir", "created"), strings.NewReader("created"), f.fileSystem, FileAttributes{}))
+		require.NoError(t, writeAtomically("src", filepath.Join(f.dir, "overwritten"), strings.NewReader("new"), f.fileSystem, FileAttributes{}))
+		require.NoError(t, f.fileSystem.Rename(filepath.Join(f.dir, "renamed"), filepath.Join(f.dir, "renamed.bak")))
+		require.NoError(t, f.fileSystem.DeleteFile(filepath.Join(f.dir, "deleted")))
+		require.NoError(t, f.fileSystem.RemoveDir(filepath.Join(f.dir, "empty")))
+		require.NoError(t, createSymlink("overwritten", filepath.Join(f.dir, "link"), f.fileSystem, FileAttributes{}))
+		require.NoError(t, f.fileSystem.Link(filepath.Join(f.dir, "overwritten"), filepath.Join(f.dir, ".overwritten.orig")))
+		require.NoError(t, f.doguConfig.Set(additionalMountsConfigKey, "- "+filepath.Join(f.dir, "sub", "dir", "created")+"\n"))
+		require.NoError(t, f.doguConfig.Set(additionalMountsChecksumsConfigKey, "checksums"))
+	}
+	readDir := func(t *testing.T, dir string) map[string]string {
+		files := map[string]string{}
+		require.NoError(t, filepath.WalkDir(dir, func(filePath string, d os.DirEntry, err error) error {
+			require.NoError(t, err)
+			rel, err := filepath.Rel(dir, filePath)
+			require.NoError(t, err)
+			switch {
+			case d.Type()&os.ModeSymlink != 0:
+				target, err := os.Readlink(filePath)
+				require.NoError(t, err)
+				files[rel] = "-> " + target
+			case d.IsDir():
+				files[rel] = "dir"
+			default:
+				content, err := os.ReadFile(filePath)
+				require.NoError(t, err)
+				files[rel] = string(content)
+			}
+			return nil
+		}))
+		return files
+	}
+
+	t.Run("should keep the modifications and remove backups and journal on success", func(t *testing.T) {
+		// given
+		f := setUp(t)
+
+		// when
+		err := f.sut.Run(func() error {
+			modify(t, f)
+			return nil
+		})
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{
+			".":                 "dir",
+			"sub":               "dir",
+			"sub/dir":           "dir",
+			"sub/dir/created":   "created",
+			"overwritten":       "new",
+			".overwritten.orig": "new",
+			"renamed.bak":       "renamed",
+			"link":              "-> overwritten",
+		}, readDir(t, f.dir))
+		assert.NoFileExists(t, f.journalPath)
+		assert.Equal(t, "checksums", f.doguConfig.values[additionalMountsChecksumsConfigKey])
+	})
+
+	t.Run("should roll back all modifications and the local config on error", func(t *testing.T) {
+		// given
+		f := setUp(t)
+		before := readDir(t, f.dir)
+
+		// when
+		err := f.sut.Run(func() error {
+			modify(t, f)
+			return assert.AnError
+		})
+
+		// then
+		require.ErrorIs(t, err, assert.AnError)
+		assert.Equal(t, before, readDir(t, f.dir))
+		emptyInfo, err := os.Stat(filepath.Join(f.dir, "empty"))
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0750), emptyInfo.Mode().Perm())
+		assert.NoFileExists(t, f.journalPath)
+		assert.Equal(t, "- "+filepath.Join(f.dir, "deleted")+"\n", f.doguConfig.values[additionalMountsConfigKey])
+		assert.Equal(t, "", f.doguConfig.values[additionalMountsChecksumsConfigKey])
+	})
+
+	t.Run("should restore the metadata of existing files on error", func(t *testing.T) {
+		// given
+		f := setUp(t)
+		filePath := filepath.Join(f.dir, "overwritten")
+		require.NoError(t, os.Chmod(filePath, 0640))
+		modTime := time.Date(2025, 5, 7, 12, 0, 0, 0, time.UTC)
+		require.NoError(t, os.Chtimes(filePath, modTime, modTime))
+
+		// when
+		err := f.sut.Run(func() error {
+			require.NoError(t, f.fileSystem.Chmod(filePath, 0600))
+			require.NoError(t, f.fileSystem.Chtimes(filePath, time.Now(), time.Now()))
+			require.NoError(t, f.fileSystem.Chmod(filePath, 0644))
+			return assert.AnError
+		})
+
+		// then
+		require.ErrorIs(t, err, assert.AnError)
+		fileInfo, err := os.Stat(filePath)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0640), fileInfo.Mode().Perm())
+		assert.True(t, modTime.Equal(fileInfo.ModTime()))
+		assert.NoFileExists(t, f.journalPath)
+	})
+
+	t.Run("should return error if a journal already exists", func(t *testing.T) {
+		// given
+		f := setUp(t)
+		writeTestFile(t, f.journalPath, "")
+
+		// when
+		err := f.sut.Run(func() error {
+			return nil
+		})
+
+		// then
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "failed to create journal")
+	})
+}
+
+func TestJournal_Recover(t *testing.T) {
+	t.Run("should do nothing without journal", func(t *testing.T) {
+		// given
+		sut := NewJournal(filepath.Join(t.TempDir(), "journal"), FileSystem{}, newMemoryDoguConfig())
+
+		// when
+		err := sut.Recover()
+
+		// then
+		require.NoError(t, err)
+	})
+
+	t.Run("should roll back an interrupted run with an incomplete last entry", func(t *testing.T) {
+		// given
+		dir := t.TempDir()
+		writeTestFile(t, filepath.Join(dir, "overwritten"), "original")
+		journalPath := filepath.Join(t.TempDir(), "journal")
+		interrupted := NewJournal(journalPath, FileSystem{}, newMemoryDoguConfig())
+		require.NoError(t, interrupted.begin())
+		fileSystem := NewTransactionalFileSystem(FileSystem{}, interrupted)
+		require.NoError(t, writeAtomically("src", filepath.Join(dir, "created"), strings.NewReader("created"), fileSystem, FileAttributes{}))
+		require.NoError(t, writeAtomically("src", filepath.Join(dir, "overwritten"), strings.NewReader("new"), fileSystem, FileAttributes{}))
+		// the process is killed while writing the next entry
+		_, err := interrupted.file.WriteString(`{"op":"crea`)
+		require.NoError(t, err)
+		require.NoError(t, interrupted.file.Close())
+
+		sut := NewJournal(journalPath, FileSystem{}, newMemoryDoguConfig())
+
+		// when
+		err = sut.Recover()
+
+		// then
+		require.NoError(t, err)
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		content, err := os.ReadFile(filepath.Join(dir, "overwritten"))
+		require.NoError(t, err)
+		assert.Equal(t, "original", string(content))
+		assert.NoFileExists(t, journalPath)
+	})
+
+	t.Run("should keep the file if the process was killed before the recorded rename", func(t *testing.T) {
+		// given
+		dir := t.TempDir()
+		dest := filepath.Join(dir, "dest")
+		writeTestFile(t, dest, "original")
+		writeTestFile(t, filepath.Join(dir, ".dest.tmp"), "new")
+		journalPath := filepath.Join(t.TempDir(), "journal")
+		interrupted := NewJournal(journalPath, FileSystem{}, newMemoryDoguConfig())
+		require.NoError(t, interrupted.begin())
+		entry, err := interrupted.recordWithBackup(journalEntry{Operation: journalRename, Path: filepath.Join(dir, ".dest.tmp"), Target: dest}, dest)
+		require.NoError(t, err)
+		require.NoError(t, os.Link(dest, entry.Backup))
+		require.NoError(t, interrupted.file.Close())
+
+		sut := NewJournal(journalPath, FileSystem{}, newMemoryDoguConfig())
+
+		// when
+		err = sut.Recover()
+
+		// then
+		require.NoError(t, err)
+		content, err := os.ReadFile(dest)
+		require.NoError(t, err)
+		assert.Equal(t, "original", string(content))
+		assert.NoFileExists(t, entry.Backup)
+	})
+
+	t.Run("should only remove the backups of a committed run", func(t *testing.T) {
+		// given
+		dir := t.TempDir()
+		writeTestFile(t, filepath.Join(dir, "deleted"), "deleted")
+		journalPath := filepath.Join(t.TempDir(), "journal")
+		interrupted := NewJournal(journalPath, FileSystem{}, newMemoryDoguConfig())
+		require.NoError(t, interrupted.begin())
+		require.NoError(t, NewTransactionalFileSystem(FileSystem{}, interrupted).DeleteFile(filepath.Join(dir, "deleted")))
+		require.NoError(t, interrupted.record(journalEntry{Operation: journalCommit}))
+		require.NoError(t, interrupted.file.Close())
+
+		sut := NewJournal(journalPath, FileSystem{}, newMemoryDoguConfig())
+
+		// when
+		err := sut.Recover()
+
+		// then
+		require.NoError(t, err)
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+		assert.NoFileExists(t, journalPath)
+	})
+}
@@ -4,11 +4,19 @@ import (
 	"errors"
 	"fmt"
 	"gopkg.in/yaml.v3"
+	"log"
+	"maps"
+	"os"
 	"slices"
+	"sync"
+	"syscall"
 )
 
 const (
-	additionalMountsConfigKey = "additionalMounts"
+	additionalMountsConfigKey          = "additionalMounts"
+	additionalMountsChecksumsConfigKey = "additionalMountsChecksums"
+	additionalMountsBackupsConfigKey   = "additionalMountsBackups"
+	additionalMountsDirsConfigKey      = "additionalMountsDirs"
 )
 
 type doguConfigReaderWriter interface {
@@ -17,26 +25,85 @@ type doguConfigReaderWriter interface {
 	Exists(key string) (bool, error)
 }
 
+// LocalConfigFileTracker tracks the copied files in the local dogu config. It is safe for concurrent use.
+// The tracked files and checksums are read once from the config and cached afterward, so that adding an already
+// tracked file does not cause any config access.
 type LocalConfigFileTracker struct {
 	doguConfig doguConfigReaderWriter
 	fileSystem Filesystem
+	mutex      sync.Mutex
+	// trackedFiles caches the tracked files from the config. It is nil until the first access.
+	trackedFiles []string
+	// checksums caches the checksums from the config. It is nil until the first access.
+	checksums map[string]FileChecksum
+	// backups caches the backups of overwritten files from the config. It is nil until the first access.
+	backups map[string]string
+	// trackedDirs caches the dirs created by the copier from the config. It is nil until the first access.
+	trackedDirs []string
+	// addedFiles contains all files added by this instance. They are kept on cleanup of stale files.
+	addedFiles map[string]bool
+	// checkedFiles contains all files whose checksums were read or written by this instance. Their checksums are kept
+	// on cleanup of stale files even if they are not tracked, e.g. for existing destination files with the same content.
+	checkedFiles map[string]bool
 }
 
 type PathSlice []string
 
 func NewLocalConfigFileTracker(doguConfig doguConfigReaderWriter, system Filesystem) *LocalConfigFileTracker {
-	return &LocalConfigFileTracker{doguConfig: doguConfig, fileSystem: system}
+	return &LocalConfigFileTracker{doguConfig: doguConfig, fileSystem: system, addedFiles: map[string]bool{}, checkedFiles: map[string]bool{}}
 }
 
+// DeleteAllTrackedFiles deletes all tracked files and afterward the tracked dirs which are empty.
 func (t *LocalConfigFileTracker) DeleteAllTrackedFiles() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	err := t.deleteAllFiles()
+
+	return errors.Join(err, t.deleteEmptyDirs())
+}
+
+func (t *LocalConfigFileTracker) deleteAllFiles() error {
 	additionalMounts, err := t.getAdditionalMounts()
 	if err != nil {
 		return err
 	}
 
+	backups, err := t.getBackups()
+	if err != nil {
+		return err
+	}
+
 	var multiErr []error
+	var remaining, deleted []string
 	for _, path := range additionalMounts {
-		multiErr = append(multiErr, t.fileSystem.DeleteFile(path))
+		deleteErr := t.deleteTrackedFile(path, backups)
+		if deleteErr != nil {
+			multiErr = append(multiErr, deleteErr)
+			remaining = append(remaining, path)
+			continue
+		}
+
+		deleted = append(deleted, path)
+	}
+
+	err = t.updateBackups(backups)
+	if err != nil {
+		multiErr = append(multiErr, err)
+	}
+
+	// Deleted files have to be untracked even if other files fail, because a restored backup must not be deleted
+	// in the next run.
+	if len(remaining) > 0 && len(deleted) > 0 {
+		err = t.setAdditionalMounts(remaining)
+		if err != nil {
+			return errors.Join(append(multiErr, err)...)
+		}
+
+		err = t.pruneChecksums(remaining)
+		if err != nil {
+			return errors.Join(append(multiErr, err)...)
+		}
 	}
 
 	// Only delete all files from config if they are really deleted.
@@ -45,18 +112,98 @@ func (t *LocalConfigFileTracker) DeleteAllTrackedFiles() error {
 		if err != nil {
 			return fmt.Errorf("failed to reset local config key %s: %w", additionalMounts, err)
 		}
+		t.trackedFiles = []string{}
+
+		err = t.resetChecksums()
+		if err != nil {
+			return err
+		}
+	}
+
+	return errors.Join(multiErr...)
+}
+
+// DeleteStaleTrackedFiles deletes all tracked files which were not added by this tracker.
+// These are files from previous runs whose sources are not part of the volume mounts anymore.
+// Files which could not be deleted remain tracked. Afterward, the tracked dirs which are empty are deleted.
+func (t *LocalConfigFileTracker) DeleteStaleTrackedFiles() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	err := t.deleteStaleFiles()
+
+	return errors.Join(err, t.deleteEmptyDirs())
+}
+
+func (t *LocalConfigFileTracker) deleteStaleFiles() error {
+	additionalMounts, err := t.getAdditionalMounts()
+	if err != nil {
+		return err
+	}
+
+	var multiErr []error
+	var remaining, stale, deleted []string
+	for _, path := range additionalMounts {
+		if t.addedFiles[path] {
+			remaining = append(remaining, path)
+			continue
+		}
+
+		stale = append(stale, path)
+	}
+
+	if len(stale) == 0 {
+		return t.pruneChecksums(remaining)
+	}
+
+	backups, err := t.getBackups()
+	if err != nil {
+		return err
+	}
+
+	for _, path := range stale {
+		deleteErr := t.deleteTrackedFile(path, backups)
+		if deleteErr != nil {
+			multiErr = append(multiErr, deleteErr)
+			remaining = append(remaining, path)
+			continue
+		}
+
+		deleted = append(deleted, path)
+	}
+
+	err = t.updateBackups(backups)
+	if err != nil {
+		multiErr = append(multiErr, err)
+	}
+
+	if len(deleted) > 0 {
+		err = t.setAdditionalMounts(remaining)
+		if err != nil {
+			return errors.Join(append(multiErr, err)...)
+		}
+	}
+
+	err = t.pruneChecksums(remaining)
+	if err != nil {
+		return errors.Join(append(multiErr, err)...)
 	}
 
 	return errors.Join(multiErr...)
 }
 
 func (t *LocalConfigFileTracker) getAdditionalMounts() ([]string, error) {
+	if t.trackedFiles != nil {
+		return slices.Clone(t.trackedFiles), nil
+	}
+
 	exists, err := t.doguConfig.Exists(additionalMountsConfigKey)
 	if err != nil {
 		return nil, fmt.Errorf("failed to check if local config key %s exists: %w", additionalMountsConfigKey, err)
 	}
 
 	if !exists {
+		t.trackedFiles = []string{}
 		return []string{}, nil
 	}
 
@@ -71,10 +218,40 @@ func (t *LocalConfigFileTracker) getAdditionalMounts() ([]string, error) {
 		return nil, fmt.Errorf("failed to unmarshal local config key value %s from key %s: %w", get, additionalMountsConfigKey, err)
 	}
 
+	t.trackedFiles = slices.Clone(paths)
 	return paths, nil
 }
 
+func (t *LocalConfigFileTracker) setAdditionalMounts(additionalMounts []string) error {
+	if len(additionalMounts) == 0 {
+		err := t.doguConfig.Set(additionalMountsConfigKey, "")
+		if err != nil {
+			return fmt.Errorf("failed to reset local config key %s: %w", additionalMountsConfigKey, err)
+		}
+
+		t.trackedFiles = []string{}
+		return nil
+	}
+
+	out, err := yaml.Marshal(additionalMounts)
+	if err != nil {
+		return fmt.Errorf("failed to marshal additionalMounts %s to yaml: %w", additionalMounts, err)
+	}
+
+	value := string(out)
+	err = t.doguConfig.Set(additionalMountsConfigKey, value)
+	if err != nil {
+		return fmt.Errorf("failed to set value %s to key %s: %w", value, additionalMounts, err)
+	}
+
+	t.trackedFiles = slices.Clone(additionalMounts)
+	return nil
+}
+
 func (t *LocalConfigFileTracker) AddFile(path string) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
 	additionalMounts, err := t.getAdditionalMounts()
 	if err != nil {
 		return err
@@ -82,18 +259,441 @@ func (t *LocalConfigFileTracker) AddFile(path string) error {
 
 	if !slices.Contains(additionalMounts, path) {
 		additionalMounts = append(additionalMounts, path)
+		err = t.setAdditionalMounts(additionalMounts)
+		if err != nil {
+			return err
+		}
 	}
 
-	out, err := yaml.Marshal(additionalMounts)
+	if t.addedFiles == nil {
+		t.addedFiles = map[string]bool{}
+	}
+	t.addedFiles[path] = true
+
+	return nil
+}
+
+// RemoveFile stops tracking a file which was deleted by the copier itself, e.g. the partial output of a failed
+// extraction, together with its cached checksum.
+func (t *LocalConfigFileTracker) RemoveFile(path string) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	delete(t.addedFiles, path)
+	delete(t.checkedFiles, path)
+
+	additionalMounts, err := t.getAdditionalMounts()
 	if err != nil {
-		return fmt.Errorf("failed to marshal additionalMounts %s to yaml: %w", additionalMounts, err)
+		return err
 	}
 
-	value := string(out)
-	err = t.doguConfig.Set(additionalMountsConfigKey, value)
+	if slices.Contains(additionalMounts, path) {
+		err = t.setAdditionalMounts(slices.DeleteFunc(additionalMounts, func(trackedFile string) bool {
+			return trackedFile == path
+		}))
+		if err != nil {
+			return err
+		}
+	}
+
+	checksums, err := t.getChecksums()
 	if err != nil {
-		return fmt.Errorf("failed to set value %s to key %s: %w", value, additionalMounts, err)
+		return err
+	}
+
+	if _, ok := checksums[path]; !ok {
+		return nil
+	}
+
+	delete(checksums, path)
+	return t.setChecksums(checksums)
+}
+
+// AddDir tracks a dir created by the copier, so that it is deleted on cleanup if it is empty.
+func (t *LocalConfigFileTracker) AddDir(path string) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	dirs, err := t.getDirs()
+	if err != nil {
+		return err
+	}
+
+	if slices.Contains(dirs, path) {
+		return nil
+	}
+
+	return t.setDirs(append(dirs, path))
+}
+
+// IsTracked checks if the file was copied in this or a previous run.
+func (t *LocalConfigFileTracker) IsTracked(path string) (bool, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.addedFiles[path] {
+		return true, nil
+	}
+
+	additionalMounts, err := t.getAdditionalMounts()
+	if err != nil {
+		return false, err
+	}
+
+	return slices.Contains(additionalMounts, path), nil
+}
+
+// SetBackup records the backup of a file which existed before it was overwritten.
+// The backup is restored when the file is deleted on cleanup.
+func (t *LocalConfigFileTracker) SetBackup(path, backupPath string) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	backups, err := t.getBackups()
+	if err != nil {
+		return err
+	}
+
+	backups[path] = backupPath
+	return t.setBackups(backups)
+}
+
+// GetBackup returns the recorded backup of a file which existed before it was overwritten.
+func (t *LocalConfigFileTracker) GetBackup(path string) (string, bool, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	backups, err := t.getBackups()
+	if err != nil {
+		return "", false, err
+	}
+
+	backupPath, ok := backups[path]
+	return backupPath, ok, nil
+}
+
+// deleteTrackedFile deletes the tracked file and restores its backup if there is one.
+// Restored backups are removed from the given backups.
+func (t *LocalConfigFileTracker) deleteTrackedFile(path string, backups map[string]string) error {
+	err := t.fileSystem.DeleteFile(path)
+	if err != nil {
+		return err
+	}
+
+	backupPath, ok := backups[path]
+	if !ok {
+		return nil
+	}
+
+	err = t.fileSystem.Rename(backupPath, path)
+	if errors.Is(err, syscall.EXDEV) {
+		// The original was kept on another filesystem.
+		err = t.moveAcrossFilesystems(backupPath, path)
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to restore backup %s to %s: %w", backupPath, path, err)
+	}
+
+	log.Printf("Restored backup %s to %s", backupPath, path)
+	delete(backups, path)
+
+	return nil
+}
+
+// moveAcrossFilesystems copies the backup with its metadata to the path and deletes it afterward.
+func (t *LocalConfigFileTracker) moveAcrossFilesystems(backupPath, path string) error {
+	fileInfo, err := t.fileSystem.Lstat(backupPath)
+	if err != nil {
+		return fmt.Errorf("failed to get file info of %s: %w", backupPath, err)
+	}
+
+	if fileInfo.Mode()&os.ModeSymlink == 0 {
+		err = copyFile(backupPath, path, t.fileSystem, FileAttributes{PreserveMetadata: true})
+	} else {
+		var target string
+		target, err = t.fileSystem.Readlink(backupPath)
+		if err == nil {
+			err = createSymlink(target, path, t.fileSystem, FileAttributes{})
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return t.fileSystem.DeleteFile(backupPath)
+}
+
+// GetChecksum returns the cached checksum of the file.
+func (t *LocalConfigFileTracker) GetChecksum(path string) (FileChecksum, bool, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	checksums, err := t.getChecksums()
+	if err != nil {
+		return FileChecksum{}, false, err
+	}
+
+	t.checkedFiles[path] = true
+	checksum, ok := checksums[path]
+	return checksum, ok, nil
+}
+
+// SetChecksum caches the checksum of the file.
+func (t *LocalConfigFileTracker) SetChecksum(path string, checksum FileChecksum) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	checksums, err := t.getChecksums()
+	if err != nil {
+		return err
+	}
+
+	t.checkedFiles[path] = true
+	checksums[path] = checksum
+	return t.setChecksums(checksums)
+}
+
+// pruneChecksums deletes the checksums of all files which are neither tracked nor checked by this instance. These are
+// the checksums of deleted files and of untracked destination files whose sources are not copied anymore.
+func (t *LocalConfigFileTracker) pruneChecksums(trackedFiles []string) error {
+	checksums, err := t.getChecksums()
+	if err != nil {
+		return err
+	}
+
+	tracked := make(map[string]bool, len(trackedFiles))
+	for _, path := range trackedFiles {
+		tracked[path] = true
+	}
+
+	maps.DeleteFunc(checksums, func(path string, _ FileChecksum) bool {
+		return !t.checkedFiles[path] && !tracked[path]
+	})
+	if len(checksums) == len(t.checksums) {
+		return nil
+	}
+
+	return t.setChecksums(checksums)
+}
+
+func (t *LocalConfigFileTracker) resetChecksums() error {
+	err := t.doguConfig.Set(additionalMountsChecksumsConfigKey, "")
+	if err != nil {
+		return fmt.Errorf("failed to reset local config key %s: %w", additionalMountsChecksumsConfigKey, err)
+	}
+
+	t.checksums = map[string]FileChecksum{}
+	return nil
+}
+
+func (t *LocalConfigFileTracker) getChecksums() (map[string]FileChecksum, error) {
+	if t.checksums != nil {
+		return maps.Clone(t.checksums), nil
+	}
+
+	exists, err := t.doguConfig.Exists(additionalMountsChecksumsConfigKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check if local config key %s exists: %w", additionalMountsChecksumsConfigKey, err)
+	}
+
+	checksums := map[string]FileChecksum{}
+	if !exists {
+		t.checksums = checksums
+		return maps.Clone(checksums), nil
+	}
+
+	value, err := t.doguConfig.Get(additionalMountsChecksumsConfigKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get local config key %s: %w", additionalMountsChecksumsConfigKey, err)
+	}
+
+	err = yaml.Unmarshal([]byte(value), &checksums)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal local config key value %s from key %s: %w", value, additionalMountsChecksumsConfigKey, err)
+	}
+
+	if checksums == nil {
+		checksums = map[string]FileChecksum{}
+	}
+
+	t.checksums = checksums
+	return maps.Clone(checksums), nil
+}
+
+func (t *LocalConfigFileTracker) setChecksums(checksums map[string]FileChecksum) error {
+	out, err := yaml.Marshal(checksums)
+	if err != nil {
+		return fmt.Errorf("failed to marshal checksums to yaml: %w", err)
+	}
+
+	err = t.doguConfig.Set(additionalMountsChecksumsConfigKey, string(out))
+	if err != nil {
+		return fmt.Errorf("failed to set checksums to key %s: %w", additionalMountsChecksumsConfigKey, err)
+	}
+
+	t.checksums = checksums
+	return nil
+}
+
+// updateBackups writes the backups to the config if they changed.
+func (t *LocalConfigFileTracker) updateBackups(backups map[string]string) error {
+	if maps.Equal(backups, t.backups) {
+		return nil
+	}
+
+	return t.setBackups(backups)
+}
+
+func (t *LocalConfigFileTracker) getBackups() (map[string]string, error) {
+	if t.backups != nil {
+		return maps.Clone(t.backups), nil
+	}
+
+	exists, err := t.doguConfig.Exists(additionalMountsBackupsConfigKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check if local config key %s exists: %w", additionalMountsBackupsConfigKey, err)
+	}
+
+	backups := map[string]string{}
+	if !exists {
+		t.backups = backups
+		return maps.Clone(backups), nil
+	}
+
+	value, err := t.doguConfig.Get(additionalMountsBackupsConfigKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get local config key %s: %w", additionalMountsBackupsConfigKey, err)
+	}
+
+	err = yaml.Unmarshal([]byte(value), &backups)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal local config key value %s from key %s: %w", value, additionalMountsBackupsConfigKey, err)
+	}
+
+	if backups == nil {
+		backups = map[string]string{}
+	}
+
+	t.backups = backups
+	return maps.Clone(backups), nil
+}
+
+func (t *LocalConfigFileTracker) setBackups(backups map[string]string) error {
+	value := ""
+	if len(backups) > 0 {
+		out, err := yaml.Marshal(backups)
+		if err != nil {
+			return fmt.Errorf("failed to marshal backups to yaml: %w", err)
+		}
+
+		value = string(out)
+	}
+
+	err := t.doguConfig.Set(additionalMountsBackupsConfigKey, value)
+	if err != nil {
+		return fmt.Errorf("failed to set backups to key %s: %w", additionalMountsBackupsConfigKey, err)
+	}
+
+	t.backups = backups
+	return nil
+}
+
+// deleteEmptyDirs deletes the tracked dirs which are empty. Dirs are sorted in reverse order, so that sub dirs are
+// deleted before their parents. Dirs which are not empty or could not be deleted remain tracked.
+func (t *LocalConfigFileTracker) deleteEmptyDirs() error {
+	dirs, err := t.getDirs()
+	if err != nil {
+		return err
+	}
+
+	if len(dirs) == 0 {
+		return nil
+	}
+
+	slices.Sort(dirs)
+	slices.Reverse(dirs)
+
+	var multiErr []error
+	var remaining []string
+	for _, dir := range dirs {
+		removeErr := t.fileSystem.RemoveDir(dir)
+		if isDirNotEmpty(removeErr) {
+			remaining = append(remaining, dir)
+			continue
+		}
+
+		if removeErr != nil {
+			multiErr = append(multiErr, fmt.Errorf("failed to delete dir %s: %w", dir, removeErr))
+			remaining = append(remaining, dir)
+			continue
+		}
+
+		log.Printf("Deleted empty dir %s", dir)
+	}
+
+	if len(remaining) < len(dirs) {
+		slices.Reverse(remaining)
+		err = t.setDirs(remaining)
+		if err != nil {
+			multiErr = append(multiErr, err)
+		}
+	}
+
+	return errors.Join(multiErr...)
+}
+
+func (t *LocalConfigFileTracker) getDirs() ([]string, error) {
+	if t.trackedDirs != nil {
+		return slices.Clone(t.trackedDirs), nil
+	}
+
+	exists, err := t.doguConfig.Exists(additionalMountsDirsConfigKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check if local config key %s exists: %w", additionalMountsDirsConfigKey, err)
+	}
+
+	dirs := []string{}
+	if !exists {
+		t.trackedDirs = dirs
+		return slices.Clone(dirs), nil
+	}
+
+	value, err := t.doguConfig.Get(additionalMountsDirsConfigKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get local config key %s: %w", additionalMountsDirsConfigKey, err)
+	}
+
+	err = yaml.Unmarshal([]byte(value), &dirs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal local config key value %s from key %s: %w", value, additionalMountsDirsConfigKey, err)
+	}
+
+	if dirs == nil {
+		dirs = []string{}
+	}
+
+	t.trackedDirs = dirs
+	return slices.Clone(dirs), nil
+}
+
+func (t *LocalConfigFileTracker) setDirs(dirs []string) error {
+	value := ""
+	if len(dirs) > 0 {
+		out, err := yaml.Marshal(dirs)
+		if err != nil {
+			return fmt.Errorf("failed to marshal dirs to yaml: %w", err)
+		}
+
+		value = string(out)
+	}
+
+	err := t.doguConfig.Set(additionalMountsDirsConfigKey, value)
+	if err != nil {
+		return fmt.Errorf("failed to set dirs to key %s: %w", additionalMountsDirsConfigKey, err)
 	}
 
+	t.trackedDirs = slices.Clone(dirs)
 	return nil
 }
@@ -1,13 +1,19 @@
 package copy
 
 import (
+	"errors"
 	"fmt"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"syscall"
 	"testing"
 )
 
 func TestLocalConfigFileTracker_DeleteAllTrackedFiles(t1 *testing.T) {
 	keyAdditionalMounts := "additionalMounts"
+	keyBackups := "additionalMountsBackups"
 	yamlFiles := "- /path/database\n- /path/config\n"
 
 	type fields struct {
@@ -26,7 +32,9 @@ func TestLocalConfigFileTracker_DeleteAllTrackedFiles(t1 *testing.T) {
 					doguConfigMock := newMockDoguConfigReaderWriter(t)
 					doguConfigMock.EXPECT().Exists(keyAdditionalMounts).Return(true, nil)
 					doguConfigMock.EXPECT().Get(keyAdditionalMounts).Return(yamlFiles, nil)
+					doguConfigMock.EXPECT().Exists(keyBackups).Return(false, nil)
 					doguConfigMock.EXPECT().Set(keyAdditionalMounts, "").Return(nil)
+					doguConfigMock.EXPECT().Set("additionalMountsChecksums", "").Return(nil)
 
 					return doguConfigMock
 				},
@@ -46,6 +54,7 @@ func TestLocalConfigFileTracker_DeleteAllTrackedFiles(t1 *testing.T) {
 					doguConfigMock := newMockDoguConfigReaderWriter(t)
 					doguConfigMock.EXPECT().Exists(keyAdditionalMounts).Return(true, nil)
 					doguConfigMock.EXPECT().Get(keyAdditionalMounts).Return(yamlFiles, nil)
+					doguConfigMock.EXPECT().Exists(keyBackups).Return(false, nil)
 					doguConfigMock.EXPECT().Set(keyAdditionalMounts, "").Return(assert.AnError)
 
 					return doguConfigMock
@@ -70,6 +79,9 @@ func TestLocalConfigFileTracker_DeleteAllTrackedFiles(t1 *testing.T) {
 					doguConfigMock := newMockDoguConfigReaderWriter(t)
 					doguConfigMock.EXPECT().Exists(keyAdditionalMounts).Return(true, nil)
 					doguConfigMock.EXPECT().Get(keyAdditionalMounts).Return(yamlFiles, nil)
+					doguConfigMock.EXPECT().Exists(keyBackups).Return(false, nil)
+					doguConfigMock.EXPECT().Set(keyAdditionalMounts, "- /path/config\n").Return(nil)
+					doguConfigMock.EXPECT().Exists("additionalMountsChecksums").Return(false, nil)
 
 					return doguConfigMock
 				},
@@ -113,8 +125,9 @@ func TestLocalConfigFileTracker_DeleteAllTrackedFiles(t1 *testing.T) {
 			}
 
 			sut := &LocalConfigFileTracker{
-				doguConfig: doguConfig,
-				fileSystem: filesystem,
+				doguConfig:  doguConfig,
+				fileSystem:  filesystem,
+				trackedDirs: []string{},
 			}
 			tt.wantErr(t, sut.DeleteAllTrackedFiles(), fmt.Sprintf("DeleteAllTrackedFiles()"))
 		})
@@ -155,6 +168,22 @@ func TestLocalConfigFileTracker_AddFile(t1 *testing.T) {
 			},
 			wantErr: assert.NoError,
 		},
+		{
+			name: "should not write config if file is already tracked",
+			fields: fields{
+				doguConfig: func(t *testing.T) doguConfigReaderWriter {
+					doguConfigMock := newMockDoguConfigReaderWriter(t)
+					doguConfigMock.EXPECT().Exists(keyAdditionalMounts).Return(true, nil)
+					doguConfigMock.EXPECT().Get(keyAdditionalMounts).Return(actualYamlFiles, nil)
+
+					return doguConfigMock
+				},
+			},
+			args: args{
+				path: "/path/config",
+			},
+			wantErr: assert.NoError,
+		},
 		{
 			name: "should return error on error setting config",
 			fields: fields{
@@ -209,3 +238,532 @@ func TestLocalConfigFileTracker_AddFile(t1 *testing.T) {
 		})
 	}
 }
+
+func TestLocalConfigFileTracker_DeleteStaleTrackedFiles(t1 *testing.T) {
+	keyAdditionalMounts := "additionalMounts"
+	keyChecksums := "additionalMountsChecksums"
+	keyBackups := "additionalMountsBackups"
+	yamlFiles := "- /path/database\n- /path/config\n"
+	checksums := "/path/config:\n    sha256: abc\n    size: 3\n    modTime: 0001-01-01T00:00:00Z\n/path/database:\n    sha256: def\n    size: 3\n    modTime: 0001-01-01T00:00:00Z\n"
+	remainingChecksums := "/path/database:\n    sha256: def\n    size: 3\n    modTime: 0001-01-01T00:00:00Z\n"
+
+	type fields struct {
+		doguConfig func(t *testing.T) doguConfigReaderWriter
+		fileSystem func(t *testing.T) Filesystem
+		addedFiles map[string]bool
+	}
+	tests := []struct {
+		name    string
+		fields  fields
+		wantErr assert.ErrorAssertionFunc
+	}{
+		{
+			name: "should only delete files which were not added",
+			fields: fields{
+				doguConfig: func(t *testing.T) doguConfigReaderWriter {
+					doguConfigMock := newMockDoguConfigReaderWriter(t)
+					doguConfigMock.EXPECT().Exists(keyAdditionalMounts).Return(true, nil)
+					doguConfigMock.EXPECT().Get(keyAdditionalMounts).Return(yamlFiles, nil)
+					doguConfigMock.EXPECT().Exists(keyBackups).Return(false, nil)
+					doguConfigMock.EXPECT().Set(keyAdditionalMounts, "- /path/database\n").Return(nil)
+					doguConfigMock.EXPECT().Exists(keyChecksums).Return(true, nil)
+					doguConfigMock.EXPECT().Get(keyChecksums).Return(checksums, nil)
+					doguConfigMock.EXPECT().Set(keyChecksums, remainingChecksums).Return(nil)
+
+					return doguConfigMock
+				},
+				fileSystem: func(t *testing.T) Filesystem {
+					filesystemMock := NewMockFilesystem(t)
+					filesystemMock.EXPECT().DeleteFile("/path/config").Return(nil)
+					return filesystemMock
+				},
+				addedFiles: map[string]bool{"/path/database": true},
+			},
+			wantErr: assert.NoError,
+		},
+		{
+			name: "should not change the config if all files were added",
+			fields: fields{
+				doguConfig: func(t *testing.T) doguConfigReaderWriter {
+					doguConfigMock := newMockDoguConfigReaderWriter(t)
+					doguConfigMock.EXPECT().Exists(keyAdditionalMounts).Return(true, nil)
+					doguConfigMock.EXPECT().Get(keyAdditionalMounts).Return(yamlFiles, nil)
+					doguConfigMock.EXPECT().Exists(keyChecksums).Return(true, nil)
+					doguConfigMock.EXPECT().Get(keyChecksums).Return(checksums, nil)
+
+					return doguConfigMock
+				},
+				addedFiles: map[string]bool{"/path/database": true, "/path/config": true},
+			},
+			wantErr: assert.NoError,
+		},
+		{
+			name: "should delete checksums of untracked files",
+			fields: fields{
+				doguConfig: func(t *testing.T) doguConfigReaderWriter {
+					doguConfigMock := newMockDoguConfigReaderWriter(t)
+					doguConfigMock.EXPECT().Exists(keyAdditionalMounts).Return(true, nil)
+					doguConfigMock.EXPECT().Get(keyAdditionalMounts).Return("- /path/database\n", nil)
+					doguConfigMock.EXPECT().Exists(keyChecksums).Return(true, nil)
+					doguConfigMock.EXPECT().Get(keyChecksums).Return(checksums, nil)
+					doguConfigMock.EXPECT().Set(keyChecksums, remainingChecksums).Return(nil)
+
+					return doguConfigMock
+				},
+				addedFiles: map[string]bool{"/path/database": true},
+			},
+			wantErr: assert.NoError,
+		},
+		{
+			name: "should keep files tracked which could not be deleted",
+			fields: fields{
+				doguConfig: func(t *testing.T) doguConfigReaderWriter {
+					doguConfigMock := newMockDoguConfigReaderWriter(t)
+					doguConfigMock.EXPECT().Exists(keyAdditionalMounts).Return(true, nil)
+					doguConfigMock.EXPECT().Get(keyAdditionalMounts).Return(yamlFiles, nil)
+					doguConfigMock.EXPECT().Exists(keyBackups).Return(false, nil)
+					doguConfigMock.EXPECT().Set(keyAdditionalMounts, "- /path/config\n").Return(nil)
+					doguConfigMock.EXPECT().Exists(keyChecksums).Return(false, nil)
+
+					return doguConfigMock
+				},
+				fileSystem: func(t *testing.T) Filesystem {
+					filesystemMock := NewMockFilesystem(t)
+					filesystemMock.EXPECT().DeleteFile("/path/database").Return(nil)
+					filesystemMock.EXPECT().DeleteFile("/path/config").Return(assert.AnError)
+					return filesystemMock
+				},
+			},
+			wantErr: func(t assert.TestingT, err error, i ...interface{}) bool {
+				assert.ErrorIs(t, err, assert.AnError)
+				return true
+			},
+		},
+		{
+			name: "should return error on error updating the config",
+			fields: fields{
+				doguConfig: func(t *testing.T) doguConfigReaderWriter {
+					doguConfigMock := newMockDoguConfigReaderWriter(t)
+					doguConfigMock.EXPECT().Exists(keyAdditionalMounts).Return(true, nil)
+					doguConfigMock.EXPECT().Get(keyAdditionalMounts).Return(yamlFiles, nil)
+					doguConfigMock.EXPECT().Exists(keyBackups).Return(false, nil)
+					doguConfigMock.EXPECT().Set(keyAdditionalMounts, "").Return(assert.AnError)
+
+					return doguConfigMock
+				},
+				fileSystem: func(t *testing.T) Filesystem {
+					filesystemMock := NewMockFilesystem(t)
+					filesystemMock.EXPECT().DeleteFile("/path/database").Return(nil)
+					filesystemMock.EXPECT().DeleteFile("/path/config").Return(nil)
+					return filesystemMock
+				},
+			},
+			wantErr: func(t assert.TestingT, err error, i ...interface{}) bool {
+				assert.ErrorIs(t, err, assert.AnError)
+				assert.ErrorContains(t, err, "failed to reset local config key additionalMounts")
+				return true
+			},
+		},
+		{
+			name: "should return error on error getting config",
+			fields: fields{
+				doguConfig: func(t *testing.T) doguConfigReaderWriter {
+					doguConfigMock := newMockDoguConfigReaderWriter(t)
+					doguConfigMock.EXPECT().Exists(keyAdditionalMounts).Return(false, assert.AnError)
+
+					return doguConfigMock
+				},
+			},
+			wantErr: func(t assert.TestingT, err error, i ...interface{}) bool {
+				assert.ErrorIs(t, err, assert.AnError)
+				return true
+			},
+		},
+	}
+	for _, tt := range tests {
+		t1.Run(tt.name, func(t *testing.T) {
+			var doguConfig doguConfigReaderWriter
+			if tt.fields.doguConfig != nil {
+				doguConfig = tt.fields.doguConfig(t)
+			}
+			var filesystem Filesystem
+			if tt.fields.fileSystem != nil {
+				filesystem = tt.fields.fileSystem(t)
+			}
+
+			sut := &LocalConfigFileTracker{
+				doguConfig:  doguConfig,
+				fileSystem:  filesystem,
+				addedFiles:  tt.fields.addedFiles,
+				trackedDirs: []string{},
+			}
+			tt.wantErr(t, sut.DeleteStaleTrackedFiles(), "DeleteStaleTrackedFiles()")
+		})
+	}
+}
+
+func TestLocalConfigFileTracker_Checksums(t *testing.T) {
+	keyChecksums := "additionalMountsChecksums"
+	checksums := "/path/config:\n    sha256: abc\n    size: 3\n    modTime: 0001-01-01T00:00:00Z\n"
+
+	t.Run("should get cached checksum", func(t *testing.T) {
+		// given
+		doguConfigMock := newMockDoguConfigReaderWriter(t)
+		doguConfigMock.EXPECT().Exists(keyChecksums).Return(true, nil)
+		doguConfigMock.EXPECT().Get(keyChecksums).Return(checksums, nil)
+		sut := NewLocalConfigFileTracker(doguConfigMock, nil)
+
+		// when
+		checksum, ok, err := sut.GetChecksum("/path/config")
+
+		// then
+		require.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, FileChecksum{Digest: "abc", Size: 3}, checksum)
+	})
+
+	t.Run("should return false if no checksum is cached", func(t *testing.T) {
+		// given
+		doguConfigMock := newMockDoguConfigReaderWriter(t)
+		doguConfigMock.EXPECT().Exists(keyChecksums).Return(false, nil)
+		sut := NewLocalConfigFileTracker(doguConfigMock, nil)
+
+		// when
+		_, ok, err := sut.GetChecksum("/path/config")
+
+		// then
+		require.NoError(t, err)
+		assert.False(t, ok)
+	})
+
+	t.Run("should return error on invalid cached checksums", func(t *testing.T) {
+		// given
+		doguConfigMock := newMockDoguConfigReaderWriter(t)
+		doguConfigMock.EXPECT().Exists(keyChecksums).Return(true, nil)
+		doguConfigMock.EXPECT().Get(keyChecksums).Return("- invalid", nil)
+		sut := NewLocalConfigFileTracker(doguConfigMock, nil)
+
+		// when
+		_, _, err := sut.GetChecksum("/path/config")
+
+		// then
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "failed to unmarshal local config key value - invalid from key additionalMountsChecksums")
+	})
+
+	t.Run("should set checksum", func(t *testing.T) {
+		// given
+		doguConfigMock := newMockDoguConfigReaderWriter(t)
+		doguConfigMock.EXPECT().Exists(keyChecksums).Return(false, nil)
+		doguConfigMock.EXPECT().Set(keyChecksums, checksums).Return(nil)
+		sut := NewLocalConfigFileTracker(doguConfigMock, nil)
+
+		// when
+		err := sut.SetChecksum("/path/config", FileChecksum{Digest: "abc", Size: 3})
+
+		// then
+		require.NoError(t, err)
+	})
+
+	t.Run("should return error on error setting checksum", func(t *testing.T) {
+		// given
+		doguConfigMock := newMockDoguConfigReaderWriter(t)
+		doguConfigMock.EXPECT().Exists(keyChecksums).Return(false, nil)
+		doguConfigMock.EXPECT().Set(keyChecksums, checksums).Return(assert.AnError)
+		sut := NewLocalConfigFileTracker(doguConfigMock, nil)
+
+		// when
+		err := sut.SetChecksum("/path/config", FileChecksum{Digest: "abc", Size: 3})
+
+		// then
+		require.Error(t, err)
+		assert.ErrorIs(t, err, assert.AnError)
+	})
+}
+
+func TestLocalConfigFileTracker_AddFile_cache(t *testing.T) {
+	t.Run("should read the config only once", func(t *testing.T) {
+		// given
+		doguConfigMock := newMockDoguConfigReaderWriter(t)
+		doguConfigMock.EXPECT().Exists("additionalMounts").Return(false, nil).Once()
+		doguConfigMock.EXPECT().Set("additionalMounts", "- /path/a\n").Return(nil).Once()
+		doguConfigMock.EXPECT().Set("additionalMounts", "- /path/a\n- /path/b\n").Return(nil).Once()
+		sut := NewLocalConfigFileTracker(doguConfigMock, nil)
+
+		// when
+		errA := sut.AddFile("/path/a")
+		errB := sut.AddFile("/path/b")
+		errC := sut.AddFile("/path/a")
+
+		// then
+		require.NoError(t, errA)
+		require.NoError(t, errB)
+		require.NoError(t, errC)
+		assert.Equal(t, map[string]bool{"/path/a": true, "/path/b": true}, sut.addedFiles)
+	})
+}
+
+func TestLocalConfigFileTracker_IsTracked(t *testing.T) {
+	t.Run("should return true for tracked and added files", func(t *testing.T) {
+		// given
+		doguConfigMock := newMockDoguConfigReaderWriter(t)
+		doguConfigMock.EXPECT().Exists("additionalMounts").Return(true, nil)
+		doguConfigMock.EXPECT().Get("additionalMounts").Return("- /path/config\n", nil)
+		sut := &LocalConfigFileTracker{doguConfig: doguConfigMock, addedFiles: map[string]bool{"/path/added": true}}
+
+		// when
+		trackedConfig, configErr := sut.IsTracked("/path/config")
+		trackedAdded, addedErr := sut.IsTracked("/path/added")
+		trackedOther, otherErr := sut.IsTracked("/path/other")
+
+		// then
+		require.NoError(t, errors.Join(configErr, addedErr, otherErr))
+		assert.True(t, trackedConfig)
+		assert.True(t, trackedAdded)
+		assert.False(t, trackedOther)
+	})
+
+	t.Run("should return error on error getting config", func(t *testing.T) {
+		// given
+		doguConfigMock := newMockDoguConfigReaderWriter(t)
+		doguConfigMock.EXPECT().Exists("additionalMounts").Return(false, assert.AnError)
+		sut := &LocalConfigFileTracker{doguConfig: doguConfigMock}
+
+		// when
+		_, err := sut.IsTracked("/path/config")
+
+		// then
+		assert.ErrorIs(t, err, assert.AnError)
+	})
+}
+
+func TestLocalConfigFileTracker_RemoveFile(t *testing.T) {
+	t.Run("should untrack the file and delete its checksum", func(t *testing.T) {
+		// given
+		doguConfigMock := newMockDoguConfigReaderWriter(t)
+		doguConfigMock.EXPECT().Exists("additionalMounts").Return(true, nil)
+		doguConfigMock.EXPECT().Get("additionalMounts").Return("- /path/config\n- /path/other\n", nil)
+		doguConfigMock.EXPECT().Set("additionalMounts", "- /path/other\n").Return(nil)
+		doguConfigMock.EXPECT().Exists("additionalMountsChecksums").Return(true, nil)
+		doguConfigMock.EXPECT().Get("additionalMountsChecksums").Return("/path/config:\n    sha256: abc\n    size: 3\n    modTime: 0001-01-01T00:00:00Z\n", nil)
+		doguConfigMock.EXPECT().Set("additionalMountsChecksums", "{}\n").Return(nil)
+		sut := &LocalConfigFileTracker{doguConfig: doguConfigMock, addedFiles: map[string]bool{"/path/config": true}, checkedFiles: map[string]bool{"/path/config": true}}
+
+		// when
+		err := sut.RemoveFile("/path/config")
+
+		// then
+		require.NoError(t, err)
+		tracked, err := sut.IsTracked("/path/config")
+		require.NoError(t, err)
+		assert.False(t, tracked)
+		assert.Empty(t, sut.checkedFiles)
+	})
+
+	t.Run("should return error on error setting config", func(t *testing.T) {
+		// given
+		doguConfigMock := newMockDoguConfigReaderWriter(t)
+		doguConfigMock.EXPECT().Exists("additionalMounts").Return(true, nil)
+		doguConfigMock.EXPECT().Get("additionalMounts").Return("- /path/config\n", nil)
+		doguConfigMock.EXPECT().Set("additionalMounts", "").Return(assert.AnError)
+		sut := &LocalConfigFileTracker{doguConfig: doguConfigMock}
+
+		// when
+		err := sut.RemoveFile("/path/config")
+
+		// then
+		assert.ErrorIs(t, err, assert.AnError)
+	})
+}
+
+func TestLocalConfigFileTracker_Backups(t *testing.T) {
+	t.Run("should set backup", func(t *testing.T) {
+		// given
+		doguConfigMock := newMockDoguConfigReaderWriter(t)
+		doguConfigMock.EXPECT().Exists("additionalMountsBackups").Return(false, nil)
+		doguConfigMock.EXPECT().Set("additionalMountsBackups", "/path/config: /path/config.bak\n").Return(nil)
+		sut := &LocalConfigFileTracker{doguConfig: doguConfigMock}
+
+		// when
+		err := sut.SetBackup("/path/config", "/path/config.bak")
+
+		// then
+		require.NoError(t, err)
+	})
+
+	t.Run("should get backup", func(t *testing.T) {
+		// given
+		doguConfigMock := newMockDoguConfigReaderWriter(t)
+		doguConfigMock.EXPECT().Exists("additionalMountsBackups").Return(true, nil)
+		doguConfigMock.EXPECT().Get("additionalMountsBackups").Return("/path/config: /path/config.bak\n", nil)
+		sut := &LocalConfigFileTracker{doguConfig: doguConfigMock}
+
+		// when
+		backupPath, ok, err := sut.GetBackup("/path/config")
+		_, otherOk, otherErr := sut.GetBackup("/path/other")
+
+		// then
+		require.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, "/path/config.bak", backupPath)
+		require.NoError(t, otherErr)
+		assert.False(t, otherOk)
+	})
+
+	t.Run("should restore backup of stale file", func(t *testing.T) {
+		// given
+		doguConfigMock := newMockDoguConfigReaderWriter(t)
+		doguConfigMock.EXPECT().Exists("additionalMounts").Return(true, nil)
+		doguConfigMock.EXPECT().Get("additionalMounts").Return("- /path/config\n", nil)
+		doguConfigMock.EXPECT().Exists("additionalMountsBackups").Return(true, nil)
+		doguConfigMock.EXPECT().Get("additionalMountsBackups").Return("/path/config: /path/config.bak\n", nil)
+		doguConfigMock.EXPECT().Set("additionalMountsBackups", "").Return(nil)
+		doguConfigMock.EXPECT().Set("additionalMounts", "").Return(nil)
+		doguConfigMock.EXPECT().Exists("additionalMountsChecksums").Return(false, nil)
+		doguConfigMock.EXPECT().Exists("additionalMountsDirs").Return(false, nil)
+		filesystemMock := NewMockFilesystem(t)
+		filesystemMock.EXPECT().DeleteFile("/path/config").Return(nil)
+		filesystemMock.EXPECT().Rename("/path/config.bak", "/path/config").Return(nil)
+		sut := NewLocalConfigFileTracker(doguConfigMock, filesystemMock)
+
+		// when
+		err := sut.DeleteStaleTrackedFiles()
+
+		// then
+		require.NoError(t, err)
+	})
+
+	t.Run("should keep file tracked if backup can not be restored", func(t *testing.T) {
+		// given
+		doguConfigMock := newMockDoguConfigReaderWriter(t)
+		doguConfigMock.EXPECT().Exists("additionalMounts").Return(true, nil)
+		doguConfigMock.EXPECT().Get("additionalMounts").Return("- /path/config\n", nil)
+		doguConfigMock.EXPECT().Exists("additionalMountsBackups").Return(true, nil)
+		doguConfigMock.EXPECT().Get("additionalMountsBackups").Return("/path/config: /path/config.bak\n", nil)
+		doguConfigMock.EXPECT().Exists("additionalMountsChecksums").Return(false, nil)
+		doguConfigMock.EXPECT().Exists("additionalMountsDirs").Return(false, nil)
+		filesystemMock := NewMockFilesystem(t)
+		filesystemMock.EXPECT().DeleteFile("/path/config").Return(nil)
+		filesystemMock.EXPECT().Rename("/path/config.bak", "/path/config").Return(assert.AnError)
+		sut := NewLocalConfigFileTracker(doguConfigMock, filesystemMock)
+
+		// when
+		err := sut.DeleteStaleTrackedFiles()
+
+		// then
+		require.Error(t, err)
+		assert.ErrorIs(t, err, assert.AnError)
+		assert.ErrorContains(t, err, "failed to restore backup /path/config.bak to /path/config")
+	})
+
+	t.Run("should copy backup from another filesystem", func(t *testing.T) {
+		// given
+		dir := t.TempDir()
+		filePath := filepath.Join(dir, "config")
+		backupPath := filepath.Join(dir, "originals", "config")
+		writeTestFile(t, filePath, "copied")
+		writeTestFile(t, backupPath, "original")
+		sut := NewLocalConfigFileTracker(newMemoryDoguConfig(), crossDeviceFileSystem{})
+		require.NoError(t, sut.AddFile(filePath))
+		require.NoError(t, sut.SetBackup(filePath, backupPath))
+
+		// when
+		err := sut.DeleteAllTrackedFiles()
+
+		// then
+		require.NoError(t, err)
+		content, err := os.ReadFile(filePath)
+		require.NoError(t, err)
+		assert.Equal(t, "original", string(content))
+		assert.NoFileExists(t, backupPath)
+	})
+}
+
+// crossDeviceFileSystem fails renames between different dirs like a rename between different filesystems.
+type crossDeviceFileSystem struct {
+	FileSystem
+}
+
+func (f crossDeviceFileSystem) Rename(oldPath, newPath string) error {
+	if filepath.Dir(oldPath) != filepath.Dir(newPath) {
+		return &os.LinkError{Op: "rename", Old: oldPath, New: newPath, Err: syscall.EXDEV}
+	}
+
+	return f.FileSystem.Rename(oldPath, newPath)
+}
+
+func TestLocalConfigFileTracker_Dirs(t *testing.T) {
+	t.Run("should track dir only once", func(t *testing.T) {
+		// given
+		doguConfig := newMemoryDoguConfig()
+		sut := NewLocalConfigFileTracker(doguConfig, FileSystem{})
+
+		// when
+		err := sut.AddDir("/dest/sub")
+		require.NoError(t, err)
+		err = sut.AddDir("/dest/sub")
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, "- /dest/sub\n", doguConfig.values[additionalMountsDirsConfigKey])
+	})
+
+	t.Run("should delete empty dirs bottom-up and keep dirs which are not empty", func(t *testing.T) {
+		// given
+		dest := t.TempDir()
+		writeTestFile(t, filepath.Join(dest, "a", "b", "c", "copied"), "copied")
+		writeTestFile(t, filepath.Join(dest, "other", "foreign"), "foreign")
+		doguConfig := newMemoryDoguConfig()
+		sut := NewLocalConfigFileTracker(doguConfig, FileSystem{})
+		for _, dir := range []string{"a", "a/b", "a/b/c", "other"} {
+			require.NoError(t, sut.AddDir(filepath.Join(dest, dir)))
+		}
+		require.NoError(t, sut.AddFile(filepath.Join(dest, "a", "b", "c", "copied")))
+
+		// when
+		err := sut.DeleteAllTrackedFiles()
+
+		// then
+		require.NoError(t, err)
+		assert.NoDirExists(t, filepath.Join(dest, "a"))
+		assert.FileExists(t, filepath.Join(dest, "other", "foreign"))
+		assert.Equal(t, "- "+filepath.Join(dest, "other")+"\n", doguConfig.values[additionalMountsDirsConfigKey])
+	})
+
+	t.Run("should delete dirs emptied by deleting stale files", func(t *testing.T) {
+		// given
+		dest := t.TempDir()
+		writeTestFile(t, filepath.Join(dest, "stale", "file"), "stale")
+		writeTestFile(t, filepath.Join(dest, "current", "file"), "current")
+		doguConfig := newMemoryDoguConfig()
+		doguConfig.values[additionalMountsConfigKey] = "- " + filepath.Join(dest, "stale", "file") + "\n"
+		doguConfig.values[additionalMountsDirsConfigKey] = "- " + filepath.Join(dest, "stale") + "\n- " + filepath.Join(dest, "current") + "\n"
+		sut := NewLocalConfigFileTracker(doguConfig, FileSystem{})
+		require.NoError(t, sut.AddFile(filepath.Join(dest, "current", "file")))
+
+		// when
+		err := sut.DeleteStaleTrackedFiles()
+
+		// then
+		require.NoError(t, err)
+		assert.NoDirExists(t, filepath.Join(dest, "stale"))
+		assert.FileExists(t, filepath.Join(dest, "current", "file"))
+		assert.Equal(t, "- "+filepath.Join(dest, "current")+"\n", doguConfig.values[additionalMountsDirsConfigKey])
+	})
+
+	t.Run("should keep dir tracked if it can not be deleted", func(t *testing.T) {
+		// given
+		doguConfigMock := newMockDoguConfigReaderWriter(t)
+		filesystemMock := NewMockFilesystem(t)
+		filesystemMock.EXPECT().RemoveDir("/dest/sub").Return(assert.AnError)
+		sut := &LocalConfigFileTracker{doguConfig: doguConfigMock, fileSystem: filesystemMock, trackedFiles: []string{}, checksums: map[string]FileChecksum{}, trackedDirs: []string{"/dest/sub"}}
+
+		// when
+		err := sut.DeleteStaleTrackedFiles()
+
+		// then
+		require.ErrorIs(t, err, assert.AnError)
+		assert.ErrorContains(t, err, "failed to delete dir /dest/sub")
+		assert.Equal(t, []string{"/dest/sub"}, sut.trackedDirs)
+	})
+}
@@ -0,0 +1,292 @@
+package copy
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// VerifyPolicy defines how the source files of a mount are verified against the checksum manifest of the source.
+type VerifyPolicy string
+
+const (
+	// VerifyReport logs files which do not match the manifest but copies them nevertheless.
+	VerifyReport VerifyPolicy = "report"
+	// VerifyEnforce refuses to copy anything if a file does not match the manifest.
+	VerifyEnforce VerifyPolicy = "enforce"
+)
+
+// DefaultManifest is the name of the checksum manifest in the root of the source if no other name is defined.
+const DefaultManifest = "SHA256SUMS"
+
+// ErrVerificationFailed is returned if the source of a mount with VerifyEnforce does not match its manifest.
+// Nothing was copied in this case.
+var ErrVerificationFailed = errors.New("verification of sources failed")
+
+// ParseVerifyPolicy returns the verify policy with the given name.
+func ParseVerifyPolicy(name string) (VerifyPolicy, error) {
+	policy := VerifyPolicy(name)
+	switch policy {
+	case VerifyReport, VerifyEnforce:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown verify policy %q, expected one of %s, %s", name, VerifyReport, VerifyEnforce)
+	}
+}
+
+// ValidateManifest checks if the manifest is the name of a file in the root of the source.
+func ValidateManifest(manifest string) error {
+	if manifest == "" || strings.Contains(manifest, "/") || strings.HasPrefix(manifest, "..") {
+		return fmt.Errorf("manifest %q must be the name of a file in the root of the source", manifest)
+	}
+
+	return nil
+}
+
+func (m SrcAndDestination) manifest() string {
+	if m.Manifest == "" {
+		return DefaultManifest
+	}
+
+	return m.Manifest
+}
+
+// isManifest checks if the path relative to the source is the manifest of a mount with enabled verification.
+// The manifest is not copied.
+func (m SrcAndDestination) isManifest(rel string) bool {
+	return m.Verify != "" && rel == m.manifest()
+}
+
+// verifyMounts verifies the sources of all mounts with enabled verification before anything is copied.
+// It returns an error wrapping ErrVerificationFailed if the source of a mount with VerifyEnforce does not match
+// its manifest. Mismatches of mounts with VerifyReport are only logged.
+func (v *VolumeMountCopier) verifyMounts(srcToDest []SrcAndDestination) error {
+	var multiErr []error
+	for _, mount := range srcToDest {
+		if mount.Verify == "" {
+			continue
+		}
+
+		err := v.verifyMount(mount)
+		if err == nil {
+			log.Printf("Verified source %s with manifest %s", mount.Src, mount.manifest())
+			continue
+		}
+
+		if mount.Verify == VerifyReport {
+			log.Printf("verification of source %s failed: %s", mount.Src, err)
+			continue
+		}
+
+		multiErr = append(multiErr, fmt.Errorf("%w: %w", ErrVerificationFailed, err))
+	}
+
+	return errors.Join(multiErr...)
+}
+
+// verifyMount checks that every regular file of the source is listed in the manifest with its SHA-256 digest and
+// that every listed file exists. Dereferenced symlinks are verified with the content of their targets.
+func (v *VolumeMountCopier) verifyMount(mount SrcAndDestination) error {
+	manifestPath := filepath.Join(mount.Src, mount.manifest())
+	digests, err := v.readManifest(manifestPath)
+	if err != nil {
+		return err
+	}
+
+	files, err := v.getSourceFiles(mount.Src, mount.sourceSymlinkPolicy())
+	if err != nil {
+		return err
+	}
+
+	var multiErr []error
+	for _, rel := range slices.Sorted(maps.Keys(files)) {
+		if rel == mount.manifest() {
+			continue
+		}
+
+		expected, ok := digests[rel]
+		if !ok {
+			multiErr = append(multiErr, fmt.Errorf("file %s is not listed in manifest %s", files[rel], manifestPath))
+			continue
+		}
+
+		digest, err := getFileDigest(files[rel], v.fileSystem)
+		if err != nil {
+			multiErr = append(multiErr, err)
+			continue
+		}
+
+		if digest != expected {
+			multiErr = append(multiErr, fmt.Errorf("digest %s of file %s does not match %s of manifest %s", digest, files[rel], expected, manifestPath))
+		}
+	}
+
+	for _, rel := range slices.Sorted(maps.Keys(digests)) {
+		if _, ok := files[rel]; !ok {
+			multiErr = append(multiErr, fmt.Errorf("file %s of manifest %s does not exist in source %s", rel, manifestPath, mount.Src))
+		}
+	}
+
+	return errors.Join(multiErr...)
+}
+
+// readManifest parses a manifest in the format of sha256sum, i.e. lines of the hex encoded digest and the path
+// relative to the source separated by two spaces or a space and an asterisk. Empty lines and comments are ignored.
+func (v *VolumeMountCopier) readManifest(manifestPath string) (map[string]string, error) {
+	file, err := v.fileSystem.Open(manifestPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open manifest %s: %w", manifestPath, err)
+	}
+
+	defer func() {
+		closeErr := v.fileSystem.CloseFile(file)
+		if closeErr != nil {
+			log.Println(fmt.Errorf("failed to close fd: %w", closeErr))
+		}
+	}()
+
+	digests := map[string]string{}
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		digest, name, ok := strings.Cut(line, " ")
+		name = strings.TrimPrefix(strings.TrimPrefix(name, " "), "*")
+		decoded, decodeErr := hex.DecodeString(digest)
+		if !ok || decodeErr != nil || len(decoded) != 32 || name == "" {
+			return nil, fmt.Errorf("invalid line %d of manifest %s", lineNumber, manifestPath)
+		}
+
+		digests[path.Clean(strings.TrimPrefix(name, "./"))] = strings.ToLower(digest)
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest %s: %w", manifestPath, err)
+	}
+
+	return digests, nil
+}
+
+// getSourceFiles returns the paths of all regular files of the source by their path relative to the source volume.
+// Symlinks which cannot be dereferenced result in an error.
+func (v *VolumeMountCopier) getSourceFiles(src string, symlinks SymlinkPolicy) (map[string]string, error) {
+	collected, err := v.collectSourceFiles(src, symlinks)
+	if err != nil {
+		return nil, err
+	}
+
+	err = errors.Join(collected.symlinkErrs...)
+	if err != nil {
+		return nil, err
+	}
+
+	return collected.files, nil
+}
+
+// sourceFiles contains the regular files of a source by their path relative to the source volume.
+type sourceFiles struct {
+	copier      *VolumeMountCopier
+	dereference bool
+	files       map[string]string
+	// symlinkErrs contains the errors of symlinks which cannot be dereferenced. Their files are missing.
+	symlinkErrs []error
+}
+
+// collectSourceFiles collects the regular files of the source. Like [walkVolumeMounts], the files of configmap and
+// secret volumes mounted without subPath are taken from the resolved data dir. With SymlinkDereference, symlinks are
+// resolved like they are copied, i.e. the path of the symlink maps to its target and the files of dirs behind
+// symlinks are added recursively. Other symlinks are ignored.
+func (v *VolumeMountCopier) collectSourceFiles(src string, symlinks SymlinkPolicy) (*sourceFiles, error) {
+	collected := &sourceFiles{copier: v, dereference: symlinks == SymlinkDereference, files: map[string]string{}}
+	data := filepath.Join(src, "..data")
+	dataFileInfo, err := v.fileSystem.Lstat(data)
+	if err == nil && dataFileInfo.Mode()&os.ModeSymlink != 0 {
+		realDir, err := v.resolveDataSymlink(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve data dir symlink %s: %w", data, err)
+		}
+
+		err = collected.addDir(realDir, realDir, "", false, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		// The symlinks in the root of the mount point to the files in the data dir which are already collected.
+		collected.dereference = false
+	}
+
+	err = collected.addDir(src, src, "", true, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return collected, nil
+}
+
+// addDir adds the regular files of the dir. rel is the path of the dir relative to the source volume if it is the
+// target of a dereferenced symlink.
+func (s *sourceFiles) addDir(srcVolume, dir, rel string, skipDataDirs bool, visited []string) error {
+	return s.copier.fileSystem.WalkDir(dir, func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return fmt.Errorf("error during filepath walk for path %s: %w", filePath, err)
+		}
+
+		if d.IsDir() {
+			if skipDataDirs && strings.HasPrefix(d.Name(), "..") {
+				return fs.SkipDir
+			}
+
+			return nil
+		}
+
+		fileRel, err := filepath.Rel(dir, filePath)
+		if err != nil {
+			return fmt.Errorf("can't get the relative path of the source file %s and the source volume %s: %w", filePath, dir, err)
+		}
+		fileRel = path.Join(rel, filepath.ToSlash(fileRel))
+
+		if s.dereference && d.Type()&os.ModeSymlink != 0 {
+			return s.addSymlinkTarget(srcVolume, filePath, fileRel, visited)
+		}
+
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		s.files[fileRel] = filePath
+		return nil
+	})
+}
+
+// addSymlinkTarget adds the target of the dereferenced symlink like [dereferenceSymlink] copies it.
+func (s *sourceFiles) addSymlinkTarget(srcVolume, linkPath, rel string, visited []string) error {
+	target, targetFileInfo, err := s.copier.resolveSymlinkTarget(srcVolume, linkPath, visited)
+	if err != nil {
+		s.symlinkErrs = append(s.symlinkErrs, err)
+		return nil
+	}
+
+	if targetFileInfo.Mode().IsRegular() {
+		s.files[rel] = target
+		return nil
+	}
+
+	if !targetFileInfo.IsDir() {
+		return nil
+	}
+
+	return s.addDir(srcVolume, target, rel, false, append(visited, target))
+}
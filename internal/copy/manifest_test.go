@@ -0,0 +1,213 @@
+package copy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseVerifyPolicy(t *testing.T) {
+	t.Run("should parse known policies", func(t *testing.T) {
+		for _, name := range []string{"report", "enforce"} {
+			policy, err := ParseVerifyPolicy(name)
+
+			require.NoError(t, err)
+			assert.Equal(t, VerifyPolicy(name), policy)
+		}
+	})
+
+	t.Run("should return error on unknown policy", func(t *testing.T) {
+		_, err := ParseVerifyPolicy("strict")
+
+		assert.ErrorContains(t, err, `unknown verify policy "strict"`)
+	})
+}
+
+func TestVolumeMountCopier_CopyVolumeMount_verify(t *testing.T) {
+	digest := func(content string) string {
+		sum := sha256.Sum256([]byte(content))
+		return hex.EncodeToString(sum[:])
+	}
+	writeManifest := func(t *testing.T, filePath string, files map[string]string) {
+		var lines []string
+		for name, content := range files {
+			lines = append(lines, fmt.Sprintf("%s  %s", digest(content), name))
+		}
+		writeTestFile(t, filePath, "# checksums\n"+strings.Join(lines, "\n")+"\n")
+	}
+	copyMounts := func(t *testing.T, mounts ...SrcAndDestination) (*VolumeMountCopier, error) {
+		fileSystem := FileSystem{}
+		sut := NewVolumeMountCopier(fileSystem, NewLocalConfigFileTracker(newMemoryDoguConfig(), fileSystem), Options{})
+		return sut, sut.CopyVolumeMount(mounts)
+	}
+
+	t.Run("should copy verified files without the manifest", func(t *testing.T) {
+		// given
+		src := t.TempDir()
+		dest := t.TempDir()
+		writeTestFile(t, filepath.Join(src, "app.conf"), "app")
+		writeTestFile(t, filepath.Join(src, "sub", "log.xml"), "log")
+		writeManifest(t, filepath.Join(src, "SHA256SUMS"), map[string]string{"app.conf": "app", "./sub/log.xml": "log"})
+
+		// when
+		sut, err := copyMounts(t, SrcAndDestination{Src: src, Dest: dest, Verify: VerifyEnforce})
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, 2, sut.summary.copied)
+		assert.FileExists(t, filepath.Join(dest, "sub", "log.xml"))
+		assert.NoFileExists(t, filepath.Join(dest, "SHA256SUMS"))
+	})
+
+	t.Run("should not copy anything if a mount does not match its manifest", func(t *testing.T) {
+		// given
+		verified := t.TempDir()
+		writeTestFile(t, filepath.Join(verified, "other.conf"), "other")
+		src := t.TempDir()
+		dest := t.TempDir()
+		writeTestFile(t, filepath.Join(src, "app.conf"), "tampered")
+		writeTestFile(t, filepath.Join(src, "unlisted.conf"), "unlisted")
+		writeManifest(t, filepath.Join(src, "checksums.txt"), map[string]string{"app.conf": "app", "missing.conf": "missing"})
+
+		// when
+		_, err := copyMounts(t,
+			SrcAndDestination{Src: verified, Dest: dest},
+			SrcAndDestination{Src: src, Dest: dest, Verify: VerifyEnforce, Manifest: "checksums.txt"},
+		)
+
+		// then
+		require.Error(t, err)
+		assert.ErrorIs(t, err, ErrVerificationFailed)
+		assert.ErrorContains(t, err, fmt.Sprintf("digest %s of file %s does not match", digest("tampered"), filepath.Join(src, "app.conf")))
+		assert.ErrorContains(t, err, fmt.Sprintf("file %s is not listed in manifest", filepath.Join(src, "unlisted.conf")))
+		assert.ErrorContains(t, err, "file missing.conf of manifest")
+		entries, err := os.ReadDir(dest)
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+
+	t.Run("should copy files nevertheless if mismatches are only reported", func(t *testing.T) {
+		// given
+		src := t.TempDir()
+		dest := t.TempDir()
+		writeTestFile(t, filepath.Join(src, "app.conf"), "tampered")
+		writeManifest(t, filepath.Join(src, "SHA256SUMS"), map[string]string{"app.conf": "app"})
+
+		// when
+		_, err := copyMounts(t, SrcAndDestination{Src: src, Dest: dest, Verify: VerifyReport})
+
+		// then
+		require.NoError(t, err)
+		assert.FileExists(t, filepath.Join(dest, "app.conf"))
+	})
+
+	t.Run("should fail if the manifest is missing", func(t *testing.T) {
+		// given
+		src := t.TempDir()
+		writeTestFile(t, filepath.Join(src, "app.conf"), "app")
+
+		// when
+		_, err := copyMounts(t, SrcAndDestination{Src: src, Dest: t.TempDir(), Verify: VerifyEnforce})
+
+		// then
+		require.Error(t, err)
+		assert.ErrorIs(t, err, ErrVerificationFailed)
+		assert.ErrorContains(t, err, "failed to open manifest")
+	})
+
+	t.Run("should fail on invalid manifest line", func(t *testing.T) {
+		// given
+		src := t.TempDir()
+		writeTestFile(t, filepath.Join(src, "app.conf"), "app")
+		writeTestFile(t, filepath.Join(src, "SHA256SUMS"), "abc  app.conf\n")
+
+		// when
+		_, err := copyMounts(t, SrcAndDestination{Src: src, Dest: t.TempDir(), Verify: VerifyEnforce})
+
+		// then
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "invalid line 1 of manifest")
+	})
+
+	t.Run("should verify the files of projected volumes", func(t *testing.T) {
+		// given
+		src := t.TempDir()
+		dest := t.TempDir()
+		writeTestFile(t, filepath.Join(src, "..2025_05_07", "app.conf"), "app")
+		writeManifest(t, filepath.Join(src, "..2025_05_07", "SHA256SUMS"), map[string]string{"app.conf": "app"})
+		require.NoError(t, os.Symlink("..2025_05_07", filepath.Join(src, "..data")))
+		require.NoError(t, os.Symlink("..data/app.conf", filepath.Join(src, "app.conf")))
+		require.NoError(t, os.Symlink("..data/SHA256SUMS", filepath.Join(src, "SHA256SUMS")))
+
+		// when
+		sut, err := copyMounts(t, SrcAndDestination{Src: src, Dest: dest, Verify: VerifyEnforce})
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, 1, sut.summary.copied)
+		assert.NoFileExists(t, filepath.Join(dest, "SHA256SUMS"))
+	})
+
+	t.Run("should verify the targets of dereferenced symlinks", func(t *testing.T) {
+		// given
+		src := t.TempDir()
+		dest := t.TempDir()
+		writeTestFile(t, filepath.Join(src, "shared", "app.conf"), "app")
+		require.NoError(t, os.Symlink("shared/app.conf", filepath.Join(src, "link.conf")))
+		require.NoError(t, os.Symlink("shared", filepath.Join(src, "linked")))
+		writeManifest(t, filepath.Join(src, "SHA256SUMS"), map[string]string{"shared/app.conf": "app", "link.conf": "app", "linked/app.conf": "app"})
+
+		// when
+		sut, err := copyMounts(t, SrcAndDestination{Src: src, Dest: dest, Verify: VerifyEnforce, Symlinks: SymlinkDereference})
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, 3, sut.summary.copied)
+		assert.FileExists(t, filepath.Join(dest, "linked", "app.conf"))
+	})
+
+	t.Run("should not copy anything if the target of a dereferenced symlink is not listed", func(t *testing.T) {
+		// given
+		src := t.TempDir()
+		dest := t.TempDir()
+		writeTestFile(t, filepath.Join(src, "app.conf"), "app")
+		writeTestFile(t, filepath.Join(src, "..hidden", "unlisted.conf"), "unlisted")
+		require.NoError(t, os.Symlink("..hidden/unlisted.conf", filepath.Join(src, "link.conf")))
+		writeManifest(t, filepath.Join(src, "SHA256SUMS"), map[string]string{"app.conf": "app"})
+
+		// when
+		_, err := copyMounts(t, SrcAndDestination{Src: src, Dest: dest, Verify: VerifyEnforce, Symlinks: SymlinkDereference})
+
+		// then
+		require.Error(t, err)
+		assert.ErrorIs(t, err, ErrVerificationFailed)
+		assert.ErrorContains(t, err, fmt.Sprintf("file %s is not listed in manifest", filepath.Join(src, "..hidden", "unlisted.conf")))
+		entries, err := os.ReadDir(dest)
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+	t.Run("should not verify symlinks which are skipped by assemblies", func(t *testing.T) {
+		// given
+		src := t.TempDir()
+		dest := filepath.Join(t.TempDir(), "app.conf")
+		writeTestFile(t, filepath.Join(src, "app.conf"), "app")
+		writeTestFile(t, filepath.Join(src, "..hidden", "unlisted.conf"), "unlisted")
+		require.NoError(t, os.Symlink("..hidden/unlisted.conf", filepath.Join(src, "link.conf")))
+		writeManifest(t, filepath.Join(src, "SHA256SUMS"), map[string]string{"app.conf": "app"})
+
+		// when
+		_, err := copyMounts(t, SrcAndDestination{Src: src, Dest: dest, Verify: VerifyEnforce, Symlinks: SymlinkDereference, Assemble: true})
+
+		// then
+		require.NoError(t, err)
+		content, err := os.ReadFile(dest)
+		require.NoError(t, err)
+		assert.Equal(t, "app\n", string(content))
+	})
+}
@@ -0,0 +1,363 @@
+package copy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io"
+	"log"
+	"path"
+	"reflect"
+	"strings"
+)
+
+// ListMergeStrategy defines how lists of YAML and JSON files are merged.
+type ListMergeStrategy string
+
+const (
+	// ListReplace replaces the list of the destination with the list of the source. This is the default.
+	ListReplace ListMergeStrategy = "replace"
+	// ListAppend appends the items of the source to the list of the destination.
+	ListAppend ListMergeStrategy = "append"
+	// ListUnique appends the items of the source which are not contained in the list of the destination yet.
+	ListUnique ListMergeStrategy = "unique"
+)
+
+// ParseListMergeStrategy returns the list merge strategy with the given name.
+func ParseListMergeStrategy(name string) (ListMergeStrategy, error) {
+	strategy := ListMergeStrategy(name)
+	switch strategy {
+	case ListReplace, ListAppend, ListUnique:
+		return strategy, nil
+	default:
+		return "", fmt.Errorf("unknown list merge strategy %q, expected one of %s, %s, %s", name, ListReplace, ListAppend, ListUnique)
+	}
+}
+
+type mergeFormat int
+
+const (
+	mergeNone mergeFormat = iota
+	mergeYAML
+	mergeJSON
+	mergeINI
+	mergeProperties
+)
+
+// getMergeFormat returns the format of the file by its extension.
+func getMergeFormat(filePath string) mergeFormat {
+	switch strings.ToLower(path.Ext(filePath)) {
+	case ".yaml", ".yml":
+		return mergeYAML
+	case ".json":
+		return mergeJSON
+	case ".ini":
+		return mergeINI
+	case ".properties":
+		return mergeProperties
+	default:
+		return mergeNone
+	}
+}
+
+func (m SrcAndDestination) listMergeStrategy() ListMergeStrategy {
+	if m.MergeLists == "" {
+		return ListReplace
+	}
+
+	return m.MergeLists
+}
+
+// isMerge checks if the source file is merged into the destination file. Only files with a supported format are merged.
+func (m SrcAndDestination) isMerge(destinationFilePath string) bool {
+	return m.Merge && getMergeFormat(destinationFilePath) != mergeNone
+}
+
+// mergeFile merges the source file into the original destination file and writes the result atomically to the
+// destination. The original is the backup recorded when the destination was overwritten for the first time, so that
+// every run merges into the content shipped with the dogu and not into the result of the previous merge.
+// Without original, the source file is written as it is. Templates are rendered before they are merged.
+// It returns whether the destination file was written.
+func (v *VolumeMountCopier) mergeFile(mount SrcAndDestination, srcFilePath, destFilePath string, attributes FileAttributes) (bool, error) {
+	var content *bytes.Buffer
+	var err error
+	if mount.isTemplate(srcFilePath) {
+		content, err = v.options.TemplateRenderer.render(srcFilePath, v.fileSystem)
+	} else {
+		content, err = readFile(srcFilePath, v.fileSystem)
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	originalPath, ok, err := v.fileTracker.GetBackup(destFilePath)
+	if err != nil {
+		return false, fmt.Errorf("failed to get original of destination file %s: %w", destFilePath, err)
+	}
+
+	if !ok {
+		return v.writeMergedFile(srcFilePath, destFilePath, content.Bytes(), attributes)
+	}
+
+	original, err := readFile(originalPath, v.fileSystem)
+	if err != nil {
+		return false, err
+	}
+
+	merged, err := mergeContent(getMergeFormat(destFilePath), original.Bytes(), content.Bytes(), mount.listMergeStrategy())
+	if err != nil {
+		return false, fmt.Errorf("failed to merge file %s into %s: %w", srcFilePath, originalPath, err)
+	}
+
+	log.Printf("Merged file %s into original %s", srcFilePath, originalPath)
+
+	return v.writeMergedFile(srcFilePath, destFilePath, merged, attributes)
+}
+
+// writeMergedFile writes the merged content unless the destination file already has it, so that the destination file
+// only changes if the source or the original changed. The attributes are applied to an unchanged destination file
+// nevertheless. It returns whether the destination file was written.
+func (v *VolumeMountCopier) writeMergedFile(srcFilePath, destFilePath string, content []byte, attributes FileAttributes) (bool, error) {
+	destFileInfo, err := v.fileSystem.Stat(destFilePath)
+	if err == nil {
+		existing, err := readFile(destFilePath, v.fileSystem)
+		if err != nil {
+			return false, err
+		}
+
+		if bytes.Equal(existing.Bytes(), content) {
+			log.Printf("skip source file %s because destination file %s already has the merged content", srcFilePath, destFilePath)
+			sourceFileInfo, err := v.fileSystem.Stat(srcFilePath)
+			if err != nil {
+				return false, fmt.Errorf("failed to get file info of source file %s: %w", srcFilePath, err)
+			}
+
+			return false, v.updateFileAttributes(attributes, srcFilePath, sourceFileInfo, destFilePath, destFileInfo)
+		}
+	}
+
+	return true, writeAtomically(srcFilePath, destFilePath, bytes.NewReader(content), v.fileSystem, attributes)
+}
+
+func mergeContent(format mergeFormat, original, src []byte, lists ListMergeStrategy) ([]byte, error) {
+	switch format {
+	case mergeYAML:
+		return mergeYAMLContent(original, src, lists)
+	case mergeJSON:
+		return mergeJSONContent(original, src, lists)
+	case mergeINI:
+		return mergeLines(parseINILines(original), parseINILines(src)), nil
+	case mergeProperties:
+		return mergeLines(parsePropertiesLines(original), parsePropertiesLines(src)), nil
+	default:
+		return nil, errors.New("unsupported merge format")
+	}
+}
+
+// mergeYAMLContent deep merges the source into the original. The order and the comments of the original are kept.
+// Only the first document of a file is merged.
+func mergeYAMLContent(original, src []byte, lists ListMergeStrategy) ([]byte, error) {
+	var originalDoc, srcDoc yaml.Node
+	err := yaml.Unmarshal(original, &originalDoc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse original: %w", err)
+	}
+
+	err = yaml.Unmarshal(src, &srcDoc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse source: %w", err)
+	}
+
+	if len(originalDoc.Content) == 0 {
+		return src, nil
+	}
+
+	if len(srcDoc.Content) == 0 {
+		return original, nil
+	}
+
+	err = mergeYAMLNodes(originalDoc.Content[0], srcDoc.Content[0], lists)
+	if err != nil {
+		return nil, err
+	}
+
+	var merged bytes.Buffer
+	encoder := yaml.NewEncoder(&merged)
+	encoder.SetIndent(2)
+	err = encoder.Encode(&originalDoc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode merged yaml: %w", err)
+	}
+
+	err = encoder.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode merged yaml: %w", err)
+	}
+
+	return merged.Bytes(), nil
+}
+
+func mergeYAMLNodes(dst, src *yaml.Node, lists ListMergeStrategy) error {
+	switch {
+	case dst.Kind == yaml.MappingNode && src.Kind == yaml.MappingNode:
+		for i := 0; i+1 < len(src.Content); i += 2 {
+			key, value := src.Content[i], src.Content[i+1]
+			index := findYAMLKey(dst, key.Value)
+			if index < 0 {
+				dst.Content = append(dst.Content, key, value)
+				continue
+			}
+
+			err := mergeYAMLNodes(dst.Content[index+1], value, lists)
+			if err != nil {
+				return err
+			}
+		}
+	case dst.Kind == yaml.SequenceNode && src.Kind == yaml.SequenceNode && lists == ListAppend:
+		dst.Content = append(dst.Content, src.Content...)
+	case dst.Kind == yaml.SequenceNode && src.Kind == yaml.SequenceNode && lists == ListUnique:
+		for _, item := range src.Content {
+			contained, err := containsYAMLNode(dst.Content, item)
+			if err != nil {
+				return err
+			}
+
+			if !contained {
+				dst.Content = append(dst.Content, item)
+			}
+		}
+	default:
+		// Keep the comments of the original if the source has none.
+		headComment, lineComment := dst.HeadComment, dst.LineComment
+		*dst = *src
+		if dst.HeadComment == "" {
+			dst.HeadComment = headComment
+		}
+
+		if dst.LineComment == "" {
+			dst.LineComment = lineComment
+		}
+	}
+
+	return nil
+}
+
+// findYAMLKey returns the index of the key in the content of the mapping node or -1.
+func findYAMLKey(mapping *yaml.Node, key string) int {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func containsYAMLNode(nodes []*yaml.Node, node *yaml.Node) (bool, error) {
+	var value any
+	err := node.Decode(&value)
+	if err != nil {
+		return false, fmt.Errorf("failed to decode list item: %w", err)
+	}
+
+	for _, existing := range nodes {
+		var existingValue any
+		err = existing.Decode(&existingValue)
+		if err != nil {
+			return false, fmt.Errorf("failed to decode list item: %w", err)
+		}
+
+		if reflect.DeepEqual(existingValue, value) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// mergeJSONContent deep merges the source into the original. The merged object is written with sorted keys.
+func mergeJSONContent(original, src []byte, lists ListMergeStrategy) ([]byte, error) {
+	originalValue, err := decodeJSON(original)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse original: %w", err)
+	}
+
+	srcValue, err := decodeJSON(src)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse source: %w", err)
+	}
+
+	var merged bytes.Buffer
+	encoder := json.NewEncoder(&merged)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	err = encoder.Encode(mergeJSONValues(originalValue, srcValue, lists))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode merged json: %w", err)
+	}
+
+	return merged.Bytes(), nil
+}
+
+func decodeJSON(content []byte) (any, error) {
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	// Keep numbers as they are instead of converting them to float64.
+	decoder.UseNumber()
+	var value any
+	err := decoder.Decode(&value)
+	if errors.Is(err, io.EOF) {
+		return nil, nil
+	}
+
+	return value, err
+}
+
+func mergeJSONValues(dst, src any, lists ListMergeStrategy) any {
+	switch srcValue := src.(type) {
+	case map[string]any:
+		dstMap, ok := dst.(map[string]any)
+		if !ok {
+			return src
+		}
+
+		for key, value := range srcValue {
+			if existing, ok := dstMap[key]; ok {
+				dstMap[key] = mergeJSONValues(existing, value, lists)
+			} else {
+				dstMap[key] = value
+			}
+		}
+
+		return dstMap
+	case []any:
+		dstList, ok := dst.([]any)
+		if !ok || lists == ListReplace {
+			return src
+		}
+
+		for _, item := range srcValue {
+			if lists == ListUnique && containsJSONValue(dstList, item) {
+				continue
+			}
+
+			dstList = append(dstList, item)
+		}
+
+		return dstList
+	default:
+		return src
+	}
+}
+
+func containsJSONValue(values []any, value any) bool {
+	for _, existing := range values {
+		if reflect.DeepEqual(existing, value) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,227 @@
+package copy
+
+import (
+	"bytes"
+	"strings"
+)
+
+type lineKind int
+
+const (
+	lineOther lineKind = iota
+	lineSection
+	lineEntry
+)
+
+// logicalLine is a line of an INI or properties file. Properties entries may span several physical lines.
+type logicalLine struct {
+	kind    lineKind
+	section string
+	key     string
+	// raw contains the physical lines without line breaks.
+	raw []string
+}
+
+func splitLines(content []byte) []string {
+	content = bytes.TrimSuffix(content, []byte("\n"))
+	if len(content) == 0 {
+		return nil
+	}
+
+	lines := strings.Split(string(content), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSuffix(line, "\r")
+	}
+
+	return lines
+}
+
+// parseINILines parses sections like `[name]` and entries like `key = value` or `key: value`.
+// Lines starting with `;` or `#` are comments.
+func parseINILines(content []byte) []logicalLine {
+	var lines []logicalLine
+	section := ""
+	for _, raw := range splitLines(content) {
+		trimmed := strings.TrimSpace(raw)
+		line := logicalLine{kind: lineOther, section: section, raw: []string{raw}}
+		switch {
+		case trimmed == "" || strings.HasPrefix(trimmed, ";") || strings.HasPrefix(trimmed, "#"):
+		case strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]"):
+			section = strings.TrimSpace(trimmed[1 : len(trimmed)-1])
+			line.kind = lineSection
+			line.section = section
+		default:
+			key, _, _ := strings.Cut(trimmed, "=")
+			key, _, _ = strings.Cut(key, ":")
+			line.kind = lineEntry
+			line.key = strings.TrimSpace(key)
+		}
+
+		lines = append(lines, line)
+	}
+
+	return lines
+}
+
+// parsePropertiesLines parses Java properties. The key ends at the first unescaped `=`, `:` or whitespace and lines
+// ending with an odd number of backslashes are continued on the next line. Lines starting with `#` or `!` are comments.
+func parsePropertiesLines(content []byte) []logicalLine {
+	var lines []logicalLine
+	var current *logicalLine
+	for _, raw := range splitLines(content) {
+		if current != nil {
+			current.raw = append(current.raw, raw)
+		} else {
+			trimmed := strings.TrimLeft(raw, " \t\f")
+			line := logicalLine{kind: lineOther, raw: []string{raw}}
+			if trimmed != "" && trimmed[0] != '#' && trimmed[0] != '!' {
+				line.kind = lineEntry
+				line.key = getPropertiesKey(trimmed)
+			}
+
+			lines = append(lines, line)
+			current = &lines[len(lines)-1]
+		}
+
+		if current.kind != lineEntry || !isContinued(raw) {
+			current = nil
+		}
+	}
+
+	return lines
+}
+
+func getPropertiesKey(line string) string {
+	escaped := false
+	for i, char := range line {
+		switch {
+		case escaped:
+			escaped = false
+		case char == '\\':
+			escaped = true
+		case char == '=' || char == ':' || char == ' ' || char == '\t' || char == '\f':
+			return line[:i]
+		}
+	}
+
+	return line
+}
+
+// isContinued checks if the line ends with an odd number of backslashes.
+func isContinued(line string) bool {
+	backslashes := len(line) - len(strings.TrimRight(line, "\\"))
+	return backslashes%2 == 1
+}
+
+// mergeLines merges the entries of the source into the original. Entries of the original are replaced with the
+// entries of the source with the same section and key. Other entries of the source are added at the end of their
+// section, unknown sections at the end of the file. Comments and the order of the original are kept.
+func mergeLines(original, src []logicalLine) []byte {
+	srcEntries := map[string]map[string]logicalLine{}
+	var srcSections []string
+	srcKeys := map[string][]string{}
+	srcHeaders := map[string]logicalLine{}
+	for _, line := range src {
+		if _, ok := srcEntries[line.section]; !ok {
+			srcEntries[line.section] = map[string]logicalLine{}
+			srcSections = append(srcSections, line.section)
+		}
+
+		switch line.kind {
+		case lineSection:
+			if _, ok := srcHeaders[line.section]; !ok {
+				srcHeaders[line.section] = line
+			}
+		case lineEntry:
+			if _, ok := srcEntries[line.section][line.key]; !ok {
+				srcKeys[line.section] = append(srcKeys[line.section], line.key)
+			}
+
+			srcEntries[line.section][line.key] = line
+		default:
+		}
+	}
+
+	var merged []string
+	added := map[string]map[string]bool{}
+	addRemaining := func(section string) {
+		var remaining []string
+		for _, key := range srcKeys[section] {
+			if !added[section][key] {
+				remaining = append(remaining, srcEntries[section][key].raw...)
+			}
+		}
+
+		merged = insertBeforeTrailingBlankLines(merged, remaining)
+		added[section] = map[string]bool{}
+		for _, key := range srcKeys[section] {
+			added[section][key] = true
+		}
+	}
+
+	section := ""
+	added[section] = map[string]bool{}
+	for _, line := range original {
+		switch line.kind {
+		case lineSection:
+			addRemaining(section)
+			section = line.section
+			if added[section] == nil {
+				added[section] = map[string]bool{}
+			}
+
+			merged = append(merged, line.raw...)
+		case lineEntry:
+			srcLine, ok := srcEntries[section][line.key]
+			if !ok {
+				merged = append(merged, line.raw...)
+				continue
+			}
+
+			// Duplicate keys of the original are all replaced.
+			merged = append(merged, srcLine.raw...)
+			added[section][line.key] = true
+		default:
+			merged = append(merged, line.raw...)
+		}
+	}
+
+	addRemaining(section)
+
+	for _, srcSection := range srcSections {
+		if _, ok := added[srcSection]; ok || len(srcKeys[srcSection]) == 0 {
+			continue
+		}
+
+		if len(merged) > 0 {
+			merged = append(merged, "")
+		}
+
+		merged = append(merged, srcHeaders[srcSection].raw...)
+		addRemaining(srcSection)
+	}
+
+	if len(merged) == 0 {
+		return nil
+	}
+
+	return []byte(strings.Join(merged, "\n") + "\n")
+}
+
+// insertBeforeTrailingBlankLines inserts the lines before the blank lines at the end, so that added entries stay in
+// their section instead of being separated by the blank line before the next section.
+func insertBeforeTrailingBlankLines(lines, inserted []string) []string {
+	if len(inserted) == 0 {
+		return lines
+	}
+
+	index := len(lines)
+	for index > 0 && strings.TrimSpace(lines[index-1]) == "" {
+		index--
+	}
+
+	result := make([]string, 0, len(lines)+len(inserted))
+	result = append(result, lines[:index]...)
+	result = append(result, inserted...)
+	return append(result, lines[index:]...)
+}
@@ -0,0 +1,260 @@
+package copy
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseListMergeStrategy(t *testing.T) {
+	t.Run("should parse known strategies", func(t *testing.T) {
+		for _, name := range []string{"replace", "append", "unique"} {
+			strategy, err := ParseListMergeStrategy(name)
+
+			require.NoError(t, err)
+			assert.Equal(t, ListMergeStrategy(name), strategy)
+		}
+	})
+
+	t.Run("should return error on unknown strategy", func(t *testing.T) {
+		_, err := ParseListMergeStrategy("merge")
+
+		assert.ErrorContains(t, err, `unknown list merge strategy "merge"`)
+	})
+}
+
+func Test_mergeContent(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   mergeFormat
+		lists    ListMergeStrategy
+		original string
+		src      string
+		expected string
+	}{
+		{
+			name:   "should deep merge yaml and keep order and comments of the original",
+			format: mergeYAML,
+			lists:  ListReplace,
+			original: `# server settings
+server:
+  host: localhost # the host
+  port: 8080
+users:
+  - admin
+log: info
+`,
+			src: `server:
+  port: 9090
+  tls: true
+users:
+  - guest
+`,
+			expected: `# server settings
+server:
+  host: localhost # the host
+  port: 9090
+  tls: true
+users:
+  - guest
+log: info
+`,
+		},
+		{
+			name:     "should append yaml lists",
+			format:   mergeYAML,
+			lists:    ListAppend,
+			original: "users:\n  - admin\n  - guest\n",
+			src:      "users:\n  - guest\n  - dev\n",
+			expected: "users:\n  - admin\n  - guest\n  - guest\n  - dev\n",
+		},
+		{
+			name:     "should append unique yaml list items",
+			format:   mergeYAML,
+			lists:    ListUnique,
+			original: "users:\n  - name: admin\n  - name: guest\n",
+			src:      "users:\n  - name: guest\n  - name: dev\n",
+			expected: "users:\n  - name: admin\n  - name: guest\n  - name: dev\n",
+		},
+		{
+			name:     "should deep merge json with sorted keys",
+			format:   mergeJSON,
+			lists:    ListUnique,
+			original: `{"server": {"port": 8080, "host": "localhost"}, "users": ["admin"], "limit": 10000000000000000001}`,
+			src:      `{"server": {"port": 9090}, "users": ["admin", "<dev>"]}`,
+			expected: "{\n  \"limit\": 10000000000000000001,\n  \"server\": {\n    \"host\": \"localhost\",\n    \"port\": 9090\n  },\n  \"users\": [\n    \"admin\",\n    \"<dev>\"\n  ]\n}\n",
+		},
+		{
+			name:   "should merge ini entries into their sections",
+			format: mergeINI,
+			original: `; global settings
+name = app
+
+[server]
+host = localhost
+port = 8080
+
+[log]
+level = info
+`,
+			src: `name = dogu
+debug = true
+[server]
+port: 9090
+tls = true
+[mail]
+relay = postfix
+`,
+			expected: `; global settings
+name = dogu
+debug = true
+
+[server]
+host = localhost
+port: 9090
+tls = true
+
+[log]
+level = info
+
+[mail]
+relay = postfix
+`,
+		},
+		{
+			name:   "should merge properties with continuation lines",
+			format: mergeProperties,
+			original: `# database
+db.url=jdbc:postgresql://localhost/app
+db.hosts=a,\
+  b
+db\=weird : value
+`,
+			src: `db.hosts=c,\
+  d
+db.pool.size 10
+`,
+			expected: `# database
+db.url=jdbc:postgresql://localhost/app
+db.hosts=c,\
+  d
+db\=weird : value
+db.pool.size 10
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// when
+			merged, err := mergeContent(tt.format, []byte(tt.original), []byte(tt.src), tt.lists)
+
+			// then
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, string(merged))
+		})
+	}
+
+	t.Run("should return error on invalid source", func(t *testing.T) {
+		// when
+		_, err := mergeContent(mergeJSON, []byte(`{}`), []byte(`{`), ListReplace)
+
+		// then
+		assert.ErrorContains(t, err, "failed to parse source")
+	})
+}
+
+func TestVolumeMountCopier_CopyVolumeMount_merge(t *testing.T) {
+	t.Run("should merge into the original on every run and restore it on cleanup", func(t *testing.T) {
+		// given
+		src := t.TempDir()
+		dest := t.TempDir()
+		original := "server:\n  host: localhost\n  port: 8080\n"
+		writeTestFile(t, filepath.Join(dest, "config.yaml"), original)
+		writeTestFile(t, filepath.Join(dest, "other.txt"), "original")
+		writeTestFile(t, filepath.Join(src, "config.yaml"), "server:\n  port: 9090\n")
+		writeTestFile(t, filepath.Join(src, "other.txt"), "copied")
+		fileSystem := FileSystem{}
+		tracker := NewLocalConfigFileTracker(newMemoryDoguConfig(), fileSystem)
+		mount := SrcAndDestination{Src: src, Dest: dest, Merge: true}
+
+		// when
+		err := NewVolumeMountCopier(fileSystem, tracker, Options{}).CopyVolumeMount([]SrcAndDestination{mount})
+
+		// then
+		require.NoError(t, err)
+		content, err := os.ReadFile(filepath.Join(dest, "config.yaml"))
+		require.NoError(t, err)
+		assert.Equal(t, "server:\n  host: localhost\n  port: 9090\n", string(content))
+		content, err = os.ReadFile(filepath.Join(dest, "other.txt"))
+		require.NoError(t, err)
+		assert.Equal(t, "copied", string(content))
+
+		// when
+		writeTestFile(t, filepath.Join(src, "config.yaml"), "server:\n  tls: true\n")
+		err = NewVolumeMountCopier(fileSystem, tracker, Options{}).CopyVolumeMount([]SrcAndDestination{mount})
+
+		// then
+		require.NoError(t, err)
+		content, err = os.ReadFile(filepath.Join(dest, "config.yaml"))
+		require.NoError(t, err)
+		assert.Equal(t, "server:\n  host: localhost\n  port: 8080\n  tls: true\n", string(content))
+
+		// when
+		err = tracker.DeleteAllTrackedFiles()
+
+		// then
+		require.NoError(t, err)
+		content, err = os.ReadFile(filepath.Join(dest, "config.yaml"))
+		require.NoError(t, err)
+		assert.Equal(t, original, string(content))
+	})
+
+	t.Run("should copy the source if the destination does not exist", func(t *testing.T) {
+		// given
+		src := t.TempDir()
+		dest := t.TempDir()
+		writeTestFile(t, filepath.Join(src, "app.properties"), "key=value\n")
+		fileSystem := FileSystem{}
+		tracker := NewLocalConfigFileTracker(newMemoryDoguConfig(), fileSystem)
+
+		// when
+		err := NewVolumeMountCopier(fileSystem, tracker, Options{}).CopyVolumeMount([]SrcAndDestination{{Src: src, Dest: dest, Merge: true}})
+
+		// then
+		require.NoError(t, err)
+		content, err := os.ReadFile(filepath.Join(dest, "app.properties"))
+		require.NoError(t, err)
+		assert.Equal(t, "key=value\n", string(content))
+	})
+	t.Run("should not write the destination if the merged content did not change", func(t *testing.T) {
+		// given
+		src := t.TempDir()
+		dest := t.TempDir()
+		writeTestFile(t, filepath.Join(dest, "config.yaml"), "server:\n  host: localhost\n  port: 8080\n")
+		writeTestFile(t, filepath.Join(src, "config.yaml"), "server:\n  port: 9090\n")
+		fileSystem := FileSystem{}
+		tracker := NewLocalConfigFileTracker(newMemoryDoguConfig(), fileSystem)
+		mount := SrcAndDestination{Src: src, Dest: dest, Merge: true}
+		require.NoError(t, NewVolumeMountCopier(fileSystem, tracker, Options{}).CopyVolumeMount([]SrcAndDestination{mount}))
+		modTime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		require.NoError(t, os.Chtimes(filepath.Join(dest, "config.yaml"), modTime, modTime))
+		sut := NewVolumeMountCopier(fileSystem, tracker, Options{})
+
+		// when
+		err := sut.CopyVolumeMount([]SrcAndDestination{mount})
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, 1, sut.summary.unchanged)
+		assert.Equal(t, 0, sut.summary.copied)
+		fileInfo, err := os.Stat(filepath.Join(dest, "config.yaml"))
+		require.NoError(t, err)
+		assert.True(t, modTime.Equal(fileInfo.ModTime()))
+		tracked, err := tracker.IsTracked(filepath.Join(dest, "config.yaml"))
+		require.NoError(t, err)
+		assert.True(t, tracked)
+	})
+}
@@ -17,17 +17,17 @@ func (_m *MockCopier) EXPECT() *MockCopier_Expecter {
 	return &MockCopier_Expecter{mock: &_m.Mock}
 }
 
-// Execute provides a mock function with given fields: src, dest, filesystem
-func (_m *MockCopier) Execute(src string, dest string, filesystem Filesystem) error {
-	ret := _m.Called(src, dest, filesystem)
+// Execute provides a mock function with given fields: src, dest, filesystem, attributes
+func (_m *MockCopier) Execute(src string, dest string, filesystem Filesystem, attributes FileAttributes) error {
+	ret := _m.Called(src, dest, filesystem, attributes)
 
 	if len(ret) == 0 {
 		panic("no return value specified for Execute")
 	}
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(string, string, Filesystem) error); ok {
-		r0 = rf(src, dest, filesystem)
+	if rf, ok := ret.Get(0).(func(string, string, Filesystem, FileAttributes) error); ok {
+		r0 = rf(src, dest, filesystem, attributes)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -44,13 +44,14 @@ type MockCopier_Execute_Call struct {
 //   - src string
 //   - dest string
 //   - filesystem Filesystem
-func (_e *MockCopier_Expecter) Execute(src interface{}, dest interface{}, filesystem interface{}) *MockCopier_Execute_Call {
-	return &MockCopier_Execute_Call{Call: _e.mock.On("Execute", src, dest, filesystem)}
+//   - attributes FileAttributes
+func (_e *MockCopier_Expecter) Execute(src interface{}, dest interface{}, filesystem interface{}, attributes interface{}) *MockCopier_Execute_Call {
+	return &MockCopier_Execute_Call{Call: _e.mock.On("Execute", src, dest, filesystem, attributes)}
 }
 
-func (_c *MockCopier_Execute_Call) Run(run func(src string, dest string, filesystem Filesystem)) *MockCopier_Execute_Call {
+func (_c *MockCopier_Execute_Call) Run(run func(src string, dest string, filesystem Filesystem, attributes FileAttributes)) *MockCopier_Execute_Call {
 	_c.Call.Run(func(args mock.Arguments) {
-		run(args[0].(string), args[1].(string), args[2].(Filesystem))
+		run(args[0].(string), args[1].(string), args[2].(Filesystem), args[3].(FileAttributes))
 	})
 	return _c
 }
@@ -60,7 +61,7 @@ func (_c *MockCopier_Execute_Call) Return(_a0 error) *MockCopier_Execute_Call {
 	return _c
 }
 
-func (_c *MockCopier_Execute_Call) RunAndReturn(run func(string, string, Filesystem) error) *MockCopier_Execute_Call {
+func (_c *MockCopier_Execute_Call) RunAndReturn(run func(string, string, Filesystem, FileAttributes) error) *MockCopier_Execute_Call {
 	_c.Call.Return(run)
 	return _c
 }
@@ -17,6 +17,52 @@ func (_m *mockFileTracker) EXPECT() *mockFileTracker_Expecter {
 	return &mockFileTracker_Expecter{mock: &_m.Mock}
 }
 
+// AddDir provides a mock function with given fields: path
+func (_m *mockFileTracker) AddDir(path string) error {
+	ret := _m.Called(path)
+
+	if len(ret) == 0 {
+		panic("no return value specified for AddDir")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string) error); ok {
+		r0 = rf(path)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// mockFileTracker_AddDir_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'AddDir'
+type mockFileTracker_AddDir_Call struct {
+	*mock.Call
+}
+
+// AddDir is a helper method to define mock.On call
+//   - path string
+func (_e *mockFileTracker_Expecter) AddDir(path interface{}) *mockFileTracker_AddDir_Call {
+	return &mockFileTracker_AddDir_Call{Call: _e.mock.On("AddDir", path)}
+}
+
+func (_c *mockFileTracker_AddDir_Call) Run(run func(path string)) *mockFileTracker_AddDir_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(string))
+	})
+	return _c
+}
+
+func (_c *mockFileTracker_AddDir_Call) Return(_a0 error) *mockFileTracker_AddDir_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *mockFileTracker_AddDir_Call) RunAndReturn(run func(string) error) *mockFileTracker_AddDir_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // AddFile provides a mock function with given fields: path
 func (_m *mockFileTracker) AddFile(path string) error {
 	ret := _m.Called(path)
@@ -63,6 +109,328 @@ func (_c *mockFileTracker_AddFile_Call) RunAndReturn(run func(string) error) *mo
 	return _c
 }
 
+// GetBackup provides a mock function with given fields: path
+func (_m *mockFileTracker) GetBackup(path string) (string, bool, error) {
+	ret := _m.Called(path)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetBackup")
+	}
+
+	var r0 string
+	var r1 bool
+	var r2 error
+	if rf, ok := ret.Get(0).(func(string) (string, bool, error)); ok {
+		return rf(path)
+	}
+	if rf, ok := ret.Get(0).(func(string) string); ok {
+		r0 = rf(path)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	if rf, ok := ret.Get(1).(func(string) bool); ok {
+		r1 = rf(path)
+	} else {
+		r1 = ret.Get(1).(bool)
+	}
+
+	if rf, ok := ret.Get(2).(func(string) error); ok {
+		r2 = rf(path)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
+// mockFileTracker_GetBackup_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'GetBackup'
+type mockFileTracker_GetBackup_Call struct {
+	*mock.Call
+}
+
+// GetBackup is a helper method to define mock.On call
+//   - path string
+func (_e *mockFileTracker_Expecter) GetBackup(path interface{}) *mockFileTracker_GetBackup_Call {
+	return &mockFileTracker_GetBackup_Call{Call: _e.mock.On("GetBackup", path)}
+}
+
+func (_c *mockFileTracker_GetBackup_Call) Run(run func(path string)) *mockFileTracker_GetBackup_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(string))
+	})
+	return _c
+}
+
+func (_c *mockFileTracker_GetBackup_Call) Return(_a0 string, _a1 bool, _a2 error) *mockFileTracker_GetBackup_Call {
+	_c.Call.Return(_a0, _a1, _a2)
+	return _c
+}
+
+func (_c *mockFileTracker_GetBackup_Call) RunAndReturn(run func(string) (string, bool, error)) *mockFileTracker_GetBackup_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// GetChecksum provides a mock function with given fields: path
+func (_m *mockFileTracker) GetChecksum(path string) (FileChecksum, bool, error) {
+	ret := _m.Called(path)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetChecksum")
+	}
+
+	var r0 FileChecksum
+	var r1 bool
+	var r2 error
+	if rf, ok := ret.Get(0).(func(string) (FileChecksum, bool, error)); ok {
+		return rf(path)
+	}
+	if rf, ok := ret.Get(0).(func(string) FileChecksum); ok {
+		r0 = rf(path)
+	} else {
+		r0 = ret.Get(0).(FileChecksum)
+	}
+
+	if rf, ok := ret.Get(1).(func(string) bool); ok {
+		r1 = rf(path)
+	} else {
+		r1 = ret.Get(1).(bool)
+	}
+
+	if rf, ok := ret.Get(2).(func(string) error); ok {
+		r2 = rf(path)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
+// mockFileTracker_GetChecksum_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'GetChecksum'
+type mockFileTracker_GetChecksum_Call struct {
+	*mock.Call
+}
+
+// GetChecksum is a helper method to define mock.On call
+//   - path string
+func (_e *mockFileTracker_Expecter) GetChecksum(path interface{}) *mockFileTracker_GetChecksum_Call {
+	return &mockFileTracker_GetChecksum_Call{Call: _e.mock.On("GetChecksum", path)}
+}
+
+func (_c *mockFileTracker_GetChecksum_Call) Run(run func(path string)) *mockFileTracker_GetChecksum_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(string))
+	})
+	return _c
+}
+
+func (_c *mockFileTracker_GetChecksum_Call) Return(_a0 FileChecksum, _a1 bool, _a2 error) *mockFileTracker_GetChecksum_Call {
+	_c.Call.Return(_a0, _a1, _a2)
+	return _c
+}
+
+func (_c *mockFileTracker_GetChecksum_Call) RunAndReturn(run func(string) (FileChecksum, bool, error)) *mockFileTracker_GetChecksum_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// IsTracked provides a mock function with given fields: path
+func (_m *mockFileTracker) IsTracked(path string) (bool, error) {
+	ret := _m.Called(path)
+
+	if len(ret) == 0 {
+		panic("no return value specified for IsTracked")
+	}
+
+	var r0 bool
+	var r1 error
+	if rf, ok := ret.Get(0).(func(string) (bool, error)); ok {
+		return rf(path)
+	}
+	if rf, ok := ret.Get(0).(func(string) bool); ok {
+		r0 = rf(path)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(path)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// mockFileTracker_IsTracked_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'IsTracked'
+type mockFileTracker_IsTracked_Call struct {
+	*mock.Call
+}
+
+// IsTracked is a helper method to define mock.On call
+//   - path string
+func (_e *mockFileTracker_Expecter) IsTracked(path interface{}) *mockFileTracker_IsTracked_Call {
+	return &mockFileTracker_IsTracked_Call{Call: _e.mock.On("IsTracked", path)}
+}
+
+func (_c *mockFileTracker_IsTracked_Call) Run(run func(path string)) *mockFileTracker_IsTracked_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(string))
+	})
+	return _c
+}
+
+func (_c *mockFileTracker_IsTracked_Call) Return(_a0 bool, _a1 error) *mockFileTracker_IsTracked_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *mockFileTracker_IsTracked_Call) RunAndReturn(run func(string) (bool, error)) *mockFileTracker_IsTracked_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// RemoveFile provides a mock function with given fields: path
+func (_m *mockFileTracker) RemoveFile(path string) error {
+	ret := _m.Called(path)
+
+	if len(ret) == 0 {
+		panic("no return value specified for RemoveFile")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string) error); ok {
+		r0 = rf(path)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// mockFileTracker_RemoveFile_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'RemoveFile'
+type mockFileTracker_RemoveFile_Call struct {
+	*mock.Call
+}
+
+// RemoveFile is a helper method to define mock.On call
+//   - path string
+func (_e *mockFileTracker_Expecter) RemoveFile(path interface{}) *mockFileTracker_RemoveFile_Call {
+	return &mockFileTracker_RemoveFile_Call{Call: _e.mock.On("RemoveFile", path)}
+}
+
+func (_c *mockFileTracker_RemoveFile_Call) Run(run func(path string)) *mockFileTracker_RemoveFile_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(string))
+	})
+	return _c
+}
+
+func (_c *mockFileTracker_RemoveFile_Call) Return(_a0 error) *mockFileTracker_RemoveFile_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *mockFileTracker_RemoveFile_Call) RunAndReturn(run func(string) error) *mockFileTracker_RemoveFile_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// SetBackup provides a mock function with given fields: path, backupPath
+func (_m *mockFileTracker) SetBackup(path string, backupPath string) error {
+	ret := _m.Called(path, backupPath)
+
+	if len(ret) == 0 {
+		panic("no return value specified for SetBackup")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, string) error); ok {
+		r0 = rf(path, backupPath)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// mockFileTracker_SetBackup_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'SetBackup'
+type mockFileTracker_SetBackup_Call struct {
+	*mock.Call
+}
+
+// SetBackup is a helper method to define mock.On call
+//   - path string
+//   - backupPath string
+func (_e *mockFileTracker_Expecter) SetBackup(path interface{}, backupPath interface{}) *mockFileTracker_SetBackup_Call {
+	return &mockFileTracker_SetBackup_Call{Call: _e.mock.On("SetBackup", path, backupPath)}
+}
+
+func (_c *mockFileTracker_SetBackup_Call) Run(run func(path string, backupPath string)) *mockFileTracker_SetBackup_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(string), args[1].(string))
+	})
+	return _c
+}
+
+func (_c *mockFileTracker_SetBackup_Call) Return(_a0 error) *mockFileTracker_SetBackup_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *mockFileTracker_SetBackup_Call) RunAndReturn(run func(string, string) error) *mockFileTracker_SetBackup_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// SetChecksum provides a mock function with given fields: path, checksum
+func (_m *mockFileTracker) SetChecksum(path string, checksum FileChecksum) error {
+	ret := _m.Called(path, checksum)
+
+	if len(ret) == 0 {
+		panic("no return value specified for SetChecksum")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, FileChecksum) error); ok {
+		r0 = rf(path, checksum)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// mockFileTracker_SetChecksum_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'SetChecksum'
+type mockFileTracker_SetChecksum_Call struct {
+	*mock.Call
+}
+
+// SetChecksum is a helper method to define mock.On call
+//   - path string
+//   - checksum FileChecksum
+func (_e *mockFileTracker_Expecter) SetChecksum(path interface{}, checksum interface{}) *mockFileTracker_SetChecksum_Call {
+	return &mockFileTracker_SetChecksum_Call{Call: _e.mock.On("SetChecksum", path, checksum)}
+}
+
+func (_c *mockFileTracker_SetChecksum_Call) Run(run func(path string, checksum FileChecksum)) *mockFileTracker_SetChecksum_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(string), args[1].(FileChecksum))
+	})
+	return _c
+}
+
+func (_c *mockFileTracker_SetChecksum_Call) Return(_a0 error) *mockFileTracker_SetChecksum_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *mockFileTracker_SetChecksum_Call) RunAndReturn(run func(string, FileChecksum) error) *mockFileTracker_SetChecksum_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // newMockFileTracker creates a new instance of mockFileTracker. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
 // The first argument is typically a *testing.T value.
 func newMockFileTracker(t interface {
@@ -0,0 +1,66 @@
+package copy
+
+import (
+	"errors"
+	"sync"
+)
+
+// workerPool executes tasks with a bounded number of goroutines and collects their errors.
+type workerPool struct {
+	tasks    chan func() error
+	wg       sync.WaitGroup
+	errMutex sync.Mutex
+	errs     []error
+}
+
+// newWorkerPool starts a pool with the given number of workers. At least one worker is started.
+func newWorkerPool(size int) *workerPool {
+	if size < 1 {
+		size = 1
+	}
+
+	pool := &workerPool{tasks: make(chan func() error)}
+	for i := 0; i < size; i++ {
+		pool.wg.Add(1)
+		go pool.work()
+	}
+
+	return pool
+}
+
+func (p *workerPool) work() {
+	defer p.wg.Done()
+	for task := range p.tasks {
+		err := task()
+		if err != nil {
+			p.errMutex.Lock()
+			p.errs = append(p.errs, err)
+			p.errMutex.Unlock()
+		}
+	}
+}
+
+// submit blocks until a worker accepts the task.
+func (p *workerPool) submit(task func() error) {
+	p.tasks <- task
+}
+
+// wait stops accepting tasks, waits for all running tasks and returns their joined errors.
+func (p *workerPool) wait() error {
+	close(p.tasks)
+	p.wg.Wait()
+	return errors.Join(p.errs...)
+}
+
+// keyedMutex provides a separate lock for every key.
+type keyedMutex struct {
+	locks sync.Map
+}
+
+// lock locks the key and returns the function to unlock it.
+func (m *keyedMutex) lock(key string) func() {
+	value, _ := m.locks.LoadOrStore(key, &sync.Mutex{})
+	mutex := value.(*sync.Mutex)
+	mutex.Lock()
+	return mutex.Unlock
+}
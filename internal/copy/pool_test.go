@@ -0,0 +1,102 @@
+package copy
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_workerPool(t *testing.T) {
+	t.Run("should execute all tasks and collect errors", func(t *testing.T) {
+		// given
+		sut := newWorkerPool(3)
+		var executed atomic.Int32
+
+		// when
+		for i := 0; i < 10; i++ {
+			sut.submit(func() error {
+				executed.Add(1)
+				if i%5 == 0 {
+					return assert.AnError
+				}
+				return nil
+			})
+		}
+		err := sut.wait()
+
+		// then
+		require.Error(t, err)
+		assert.ErrorIs(t, err, assert.AnError)
+		assert.Len(t, err.(interface{ Unwrap() []error }).Unwrap(), 2)
+		assert.Equal(t, int32(10), executed.Load())
+	})
+
+	t.Run("should not exceed the number of workers", func(t *testing.T) {
+		// given
+		sut := newWorkerPool(2)
+		var running, maxRunning atomic.Int32
+
+		// when
+		for i := 0; i < 6; i++ {
+			sut.submit(func() error {
+				current := running.Add(1)
+				for {
+					observed := maxRunning.Load()
+					if current <= observed || maxRunning.CompareAndSwap(observed, current) {
+						break
+					}
+				}
+				time.Sleep(10 * time.Millisecond)
+				running.Add(-1)
+				return nil
+			})
+		}
+
+		// then
+		require.NoError(t, sut.wait())
+		assert.Equal(t, int32(2), maxRunning.Load())
+	})
+
+	t.Run("should start at least one worker", func(t *testing.T) {
+		// given
+		sut := newWorkerPool(0)
+		executed := false
+
+		// when
+		sut.submit(func() error {
+			executed = true
+			return nil
+		})
+
+		// then
+		require.NoError(t, sut.wait())
+		assert.True(t, executed)
+	})
+}
+
+func Test_keyedMutex(t *testing.T) {
+	t.Run("should serialize access per key", func(t *testing.T) {
+		// given
+		sut := &keyedMutex{}
+		counter := map[string]int{}
+		var wg sync.WaitGroup
+
+		// when
+		for i := 0; i < 100; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				unlock := sut.lock("key")
+				defer unlock()
+				counter["key"]++
+			}()
+		}
+		wg.Wait()
+
+		// then
+		assert.Equal(t, 100, counter["key"])
+	})
+}
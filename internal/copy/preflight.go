@@ -0,0 +1,168 @@
+package copy
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// ErrPreflightFailed is returned if the destinations do not have enough capacity for the sources.
+// Nothing is copied in this case.
+var ErrPreflightFailed = errors.New("preflight check failed")
+
+// capacityDemand sums up the space and inodes needed on one destination filesystem.
+type capacityDemand struct {
+	stats FilesystemStats
+	dests []string
+	bytes uint64
+	// inodes counts the new files and dirs.
+	inodes uint64
+	// largestFile is needed additionally for the temporary file while an existing file is replaced.
+	largestFile uint64
+}
+
+// checkCapacity estimates the bytes and inodes needed to copy all mounts and compares them with the free space and
+// inodes of the destination filesystems. Mounts whose destinations are on the same filesystem are summed up.
+// Destination files which already exist only need the space by which the source file is larger.
+// Dereferenced symlinks are counted with the size of their targets. Archives of mounts with enabled extraction are
+// read to count the extracted files with their uncompressed size. The check is skipped if the platform does not
+// support it.
+func (v *VolumeMountCopier) checkCapacity(srcToDest []SrcAndDestination) error {
+	demands := map[uint64]*capacityDemand{}
+	checkedDirs := map[string]bool{}
+	for _, mount := range srcToDest {
+		demand, err := v.getCapacityDemand(mount.Dest, demands)
+		if errors.Is(err, errors.ErrUnsupported) {
+			log.Println("skip checking the capacity of the destinations because it is not supported on this platform")
+			return nil
+		}
+
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrPreflightFailed, err)
+		}
+
+		err = v.addMountDemand(mount, demand, checkedDirs)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrPreflightFailed, err)
+		}
+	}
+
+	var multiErr []error
+	for _, device := range slices.Sorted(maps.Keys(demands)) {
+		demand := demands[device]
+		neededBytes := demand.bytes + demand.largestFile
+		log.Printf("Destinations %s need %d bytes and %d inodes on their filesystem", strings.Join(demand.dests, ", "), neededBytes, demand.inodes)
+		if neededBytes > demand.stats.AvailableBytes || (demand.stats.TotalInodes > 0 && demand.inodes > demand.stats.AvailableInodes) {
+			multiErr = append(multiErr, fmt.Errorf("%w: the volume of %s needs %d bytes and %d inodes but only %d bytes and %d inodes are available",
+				ErrPreflightFailed, strings.Join(demand.dests, ", "), neededBytes, demand.inodes, demand.stats.AvailableBytes, demand.stats.AvailableInodes))
+		}
+	}
+
+	return errors.Join(multiErr...)
+}
+
+// getCapacityDemand returns the demand of the filesystem containing the destination. The destination does not need
+// to exist yet, in that case its nearest existing parent dir is used.
+func (v *VolumeMountCopier) getCapacityDemand(dest string, demands map[uint64]*capacityDemand) (*capacityDemand, error) {
+	existing := dest
+	for {
+		_, err := v.fileSystem.Stat(existing)
+		if err == nil || filepath.Dir(existing) == existing {
+			break
+		}
+
+		existing = filepath.Dir(existing)
+	}
+
+	stats, err := v.fileSystem.Statfs(existing)
+	if err != nil {
+		return nil, err
+	}
+
+	demand, ok := demands[stats.Device]
+	if !ok {
+		demand = &capacityDemand{stats: stats}
+		demands[stats.Device] = demand
+	}
+
+	demand.dests = append(demand.dests, dest)
+	return demand, nil
+}
+
+func (v *VolumeMountCopier) addMountDemand(mount SrcAndDestination, demand *capacityDemand, checkedDirs map[string]bool) error {
+	// The fragments of an assembled mount and the certificates of a bundle or truststore are counted as one file.
+	assembled := mount.Assemble || mount.Certificates == CertificatesBundle || mount.Certificates == CertificatesTruststore
+	// Dereferenced symlinks are copied with the content of their targets. Symlinks which cannot be dereferenced are
+	// not counted because they fail when they are copied.
+	collected, err := v.collectSourceFiles(mount.Src, mount.sourceSymlinkPolicy())
+	if err != nil {
+		return err
+	}
+
+	files := collected.files
+
+	var assembledSize uint64
+	for _, rel := range slices.Sorted(maps.Keys(files)) {
+		if !mount.isCandidate(rel) {
+			continue
+		}
+
+		if mount.isExtracted(rel) {
+			extracted, err := v.scanArchive(mount, files[rel], rel)
+			if err != nil {
+				return err
+			}
+
+			for _, file := range extracted {
+				v.addFileDemand(demand, path.Join(mount.Dest, file.rel), uint64(file.size), checkedDirs)
+			}
+			continue
+		}
+
+		fileInfo, err := v.fileSystem.Stat(files[rel])
+		if err != nil {
+			return fmt.Errorf("failed to get file info of source file %s: %w", files[rel], err)
+		}
+
+		if assembled {
+			assembledSize += uint64(fileInfo.Size())
+			continue
+		}
+
+		v.addFileDemand(demand, path.Join(mount.Dest, mount.destinationRel(rel)), uint64(fileInfo.Size()), checkedDirs)
+	}
+
+	if assembled {
+		v.addFileDemand(demand, path.Clean(mount.Dest), assembledSize, checkedDirs)
+	}
+
+	return nil
+}
+
+func (v *VolumeMountCopier) addFileDemand(demand *capacityDemand, destinationFilePath string, size uint64, checkedDirs map[string]bool) {
+	demand.largestFile = max(demand.largestFile, size)
+	destFileInfo, err := v.fileSystem.Lstat(destinationFilePath)
+	if err == nil && destFileInfo.Mode().IsRegular() {
+		if destSize := uint64(destFileInfo.Size()); size > destSize {
+			demand.bytes += size - destSize
+		}
+
+		return
+	}
+
+	demand.bytes += size
+	demand.inodes++
+	for dir := path.Dir(destinationFilePath); !checkedDirs[dir]; dir = path.Dir(dir) {
+		checkedDirs[dir] = true
+		if _, err := v.fileSystem.Lstat(dir); err == nil {
+			break
+		}
+
+		demand.inodes++
+	}
+}
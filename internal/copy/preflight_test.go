@@ -0,0 +1,186 @@
+package copy
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// statfsFileSystem reports fixed filesystem stats for all paths.
+type statfsFileSystem struct {
+	FileSystem
+	stats FilesystemStats
+	err   error
+}
+
+func (f statfsFileSystem) Statfs(_ string) (FilesystemStats, error) {
+	return f.stats, f.err
+}
+
+func TestVolumeMountCopier_CopyVolumeMount_preflight(t *testing.T) {
+	copyMounts := func(t *testing.T, fileSystem Filesystem, mounts ...SrcAndDestination) (*VolumeMountCopier, error) {
+		sut := NewVolumeMountCopier(fileSystem, NewLocalConfigFileTracker(newMemoryDoguConfig(), fileSystem), Options{})
+		return sut, sut.CopyVolumeMount(mounts)
+	}
+
+	t.Run("should copy if the capacity is sufficient", func(t *testing.T) {
+		// given
+		src := t.TempDir()
+		dest := t.TempDir()
+		writeTestFile(t, filepath.Join(src, "app.conf"), "app")
+		writeTestFile(t, filepath.Join(src, "sub", "log.xml"), "log")
+		// 3 bytes per file plus 3 bytes for the temporary file, 2 files and the sub dir
+		fileSystem := statfsFileSystem{stats: FilesystemStats{AvailableBytes: 9, AvailableInodes: 3, TotalInodes: 100}}
+
+		// when
+		sut, err := copyMounts(t, fileSystem, SrcAndDestination{Src: src, Dest: dest})
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, 2, sut.summary.copied)
+	})
+
+	t.Run("should not copy anything if the space of the volume is insufficient", func(t *testing.T) {
+		// given
+		src := t.TempDir()
+		otherSrc := t.TempDir()
+		dest := t.TempDir()
+		writeTestFile(t, filepath.Join(src, "app.conf"), strings.Repeat("a", 100))
+		writeTestFile(t, filepath.Join(otherSrc, "log.xml"), strings.Repeat("l", 100))
+		fileSystem := statfsFileSystem{stats: FilesystemStats{AvailableBytes: 250, AvailableInodes: 100, TotalInodes: 100}}
+
+		// when
+		_, err := copyMounts(t, fileSystem,
+			SrcAndDestination{Src: src, Dest: filepath.Join(dest, "conf")},
+			SrcAndDestination{Src: otherSrc, Dest: filepath.Join(dest, "log")},
+		)
+
+		// then
+		require.ErrorIs(t, err, ErrPreflightFailed)
+		assert.ErrorContains(t, err, "the volume of "+filepath.Join(dest, "conf")+", "+filepath.Join(dest, "log")+" needs 300 bytes and 4 inodes but only 250 bytes and 100 inodes are available")
+		entries, err := os.ReadDir(dest)
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+
+	t.Run("should count dereferenced symlinks with the size of their targets", func(t *testing.T) {
+		// given
+		src := t.TempDir()
+		dest := t.TempDir()
+		writeTestFile(t, filepath.Join(src, "shared", "app.conf"), strings.Repeat("a", 100))
+		require.NoError(t, os.Symlink("shared/app.conf", filepath.Join(src, "link.conf")))
+		require.NoError(t, os.Symlink("shared", filepath.Join(src, "linked")))
+		fileSystem := statfsFileSystem{stats: FilesystemStats{AvailableBytes: 350, AvailableInodes: 100, TotalInodes: 100}}
+
+		// when
+		_, err := copyMounts(t, fileSystem, SrcAndDestination{Src: src, Dest: filepath.Join(dest, "conf"), Symlinks: SymlinkDereference})
+
+		// then
+		require.ErrorIs(t, err, ErrPreflightFailed)
+		assert.ErrorContains(t, err, "needs 400 bytes")
+		assert.NoDirExists(t, filepath.Join(dest, "conf"))
+	})
+
+	t.Run("should count extracted files with their uncompressed size", func(t *testing.T) {
+		// given
+		src := t.TempDir()
+		dest := t.TempDir()
+		createTarGz(t, filepath.Join(src, "conf.tar.gz"), testArchiveEntry{"app.conf", strings.Repeat("a", 1000)}, testArchiveEntry{"log.xml", strings.Repeat("l", 1000)})
+		fileSystem := statfsFileSystem{stats: FilesystemStats{AvailableBytes: 2500, AvailableInodes: 100, TotalInodes: 100}}
+
+		// when
+		_, err := copyMounts(t, fileSystem, SrcAndDestination{Src: src, Dest: filepath.Join(dest, "conf"), Extract: true})
+
+		// then
+		require.ErrorIs(t, err, ErrPreflightFailed)
+		assert.ErrorContains(t, err, "needs 3000 bytes and 3 inodes")
+		assert.NoDirExists(t, filepath.Join(dest, "conf"))
+	})
+
+	t.Run("should not copy anything if the inodes of the volume are insufficient", func(t *testing.T) {
+		// given
+		src := t.TempDir()
+		dest := t.TempDir()
+		writeTestFile(t, filepath.Join(src, "app.conf"), "app")
+		writeTestFile(t, filepath.Join(src, "log.xml"), "log")
+		fileSystem := statfsFileSystem{stats: FilesystemStats{AvailableBytes: 1 << 20, AvailableInodes: 1, TotalInodes: 100}}
+
+		// when
+		_, err := copyMounts(t, fileSystem, SrcAndDestination{Src: src, Dest: dest})
+
+		// then
+		require.ErrorIs(t, err, ErrPreflightFailed)
+		assert.ErrorContains(t, err, "needs 9 bytes and 2 inodes but only 1048576 bytes and 1 inodes are available")
+		assert.NoFileExists(t, filepath.Join(dest, "app.conf"))
+	})
+
+	t.Run("should only count the growth of existing files and ignore inodes of dynamic filesystems", func(t *testing.T) {
+		// given
+		src := t.TempDir()
+		dest := t.TempDir()
+		writeTestFile(t, filepath.Join(src, "app.conf"), "app-new")
+		writeTestFile(t, filepath.Join(src, "log.xml"), "log")
+		writeTestFile(t, filepath.Join(dest, "app.conf"), "app")
+		writeTestFile(t, filepath.Join(dest, "log.xml"), "log")
+		// 4 bytes growth plus 7 bytes for the temporary file
+		fileSystem := statfsFileSystem{stats: FilesystemStats{AvailableBytes: 11}}
+
+		// when
+		_, err := copyMounts(t, fileSystem, SrcAndDestination{Src: src, Dest: dest})
+
+		// then
+		require.NoError(t, err)
+		content, err := os.ReadFile(filepath.Join(dest, "app.conf"))
+		require.NoError(t, err)
+		assert.Equal(t, "app-new", string(content))
+	})
+
+	t.Run("should skip the check if it is not supported", func(t *testing.T) {
+		// given
+		src := t.TempDir()
+		dest := t.TempDir()
+		writeTestFile(t, filepath.Join(src, "app.conf"), "app")
+		fileSystem := statfsFileSystem{err: errors.ErrUnsupported}
+
+		// when
+		_, err := copyMounts(t, fileSystem, SrcAndDestination{Src: src, Dest: dest})
+
+		// then
+		require.NoError(t, err)
+		assert.FileExists(t, filepath.Join(dest, "app.conf"))
+	})
+
+	t.Run("should return error if the stats cannot be read", func(t *testing.T) {
+		// given
+		src := t.TempDir()
+		writeTestFile(t, filepath.Join(src, "app.conf"), "app")
+		fileSystem := statfsFileSystem{err: assert.AnError}
+
+		// when
+		_, err := copyMounts(t, fileSystem, SrcAndDestination{Src: src, Dest: t.TempDir()})
+
+		// then
+		require.ErrorIs(t, err, ErrPreflightFailed)
+		assert.ErrorIs(t, err, assert.AnError)
+	})
+}
+
+func TestFileSystem_Statfs(t *testing.T) {
+	t.Run("should return the capacity of the filesystem", func(t *testing.T) {
+		// when
+		stats, err := FileSystem{}.Statfs(t.TempDir())
+
+		// then
+		if errors.Is(err, errors.ErrUnsupported) {
+			t.Skip("statfs is not supported on this platform")
+		}
+
+		require.NoError(t, err)
+		assert.NotZero(t, stats.Device)
+		assert.NotZero(t, stats.AvailableBytes)
+	})
+}
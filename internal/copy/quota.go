@@ -0,0 +1,152 @@
+package copy
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// ErrQuotaExceeded is returned if a file, a mount or all mounts together exceed a quota.
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// Quota limits the regular files copied from sources. The quotas are checked before anything is copied. Dereferenced
+// symlinks count with the size of their targets. Archives of mounts with enabled extraction are read to count the
+// extracted files with their uncompressed size instead. Files skipped by the filters are not counted. Values which are
+// not positive are unlimited.
+type Quota struct {
+	// MaxFileSize is the maximum size in bytes of a single file.
+	MaxFileSize int64
+	// MaxBytes is the maximum size in bytes of all files.
+	MaxBytes int64
+	// MaxFiles is the maximum number of files.
+	MaxFiles int
+}
+
+// quotaUsage sums up the files counted for a Quota.
+type quotaUsage struct {
+	bytes int64
+	files int
+	// exceeded is set if MaxBytes or MaxFiles was exceeded.
+	exceeded bool
+}
+
+// add adds the file to the usage if it does not exceed the quota.
+func (u *quotaUsage) add(quota Quota, filePath string, size int64) error {
+	if quota.MaxFileSize > 0 && size > quota.MaxFileSize {
+		return fmt.Errorf("%w: file %s with %d bytes exceeds the maximum file size of %d bytes", ErrQuotaExceeded, filePath, size, quota.MaxFileSize)
+	}
+
+	if quota.MaxFiles > 0 && u.files+1 > quota.MaxFiles {
+		u.exceeded = true
+		return fmt.Errorf("%w: file %s exceeds the maximum number of %d files", ErrQuotaExceeded, filePath, quota.MaxFiles)
+	}
+
+	if quota.MaxBytes > 0 && u.bytes+size > quota.MaxBytes {
+		u.exceeded = true
+		return fmt.Errorf("%w: file %s with %d bytes exceeds the maximum total size of %d bytes after %d bytes", ErrQuotaExceeded, filePath, size, quota.MaxBytes, u.bytes)
+	}
+
+	u.files++
+	u.bytes += size
+	return nil
+}
+
+// checkQuotas counts the source files of all mounts before anything is copied and compares them with the quota of
+// their mount and the global quota of all mounts. Dereferenced symlinks are counted with the size of their targets.
+// Every file exceeding the maximum file size is reported. The counting of a mount stops at the first file exceeding
+// its total size or number of files, the counting of all mounts at the first file exceeding the global ones.
+func (v *VolumeMountCopier) checkQuotas(srcToDest []SrcAndDestination) error {
+	globalUsage := &quotaUsage{}
+	var multiErr []error
+	for _, mount := range srcToDest {
+		if mount.Quota == (Quota{}) && v.options.Quota == (Quota{}) {
+			continue
+		}
+
+		err := v.checkMountQuota(mount, globalUsage)
+		if err != nil {
+			multiErr = append(multiErr, err)
+		}
+
+		if globalUsage.exceeded {
+			break
+		}
+	}
+
+	return errors.Join(multiErr...)
+}
+
+// checkMountQuota adds the candidates of the mount to the usage of the mount and to the global usage of all mounts.
+// The manifest and filtered files are not counted. Symlinks which cannot be dereferenced are not counted because
+// they fail when they are copied.
+func (v *VolumeMountCopier) checkMountQuota(mount SrcAndDestination, globalUsage *quotaUsage) error {
+	collected, err := v.collectSourceFiles(mount.Src, mount.sourceSymlinkPolicy())
+	if err != nil {
+		return fmt.Errorf("failed to check the quota of mount %s to %s: %w", mount.Src, mount.Dest, err)
+	}
+
+	usage := &quotaUsage{}
+	var multiErr []error
+	for _, rel := range slices.Sorted(maps.Keys(collected.files)) {
+		if !mount.isCandidate(rel) {
+			continue
+		}
+
+		files, err := v.getCountedFiles(mount, collected.files[rel], rel)
+		if err != nil {
+			return err
+		}
+
+		for _, file := range files {
+			err = usage.add(mount.Quota, file.entryPath, file.size)
+			if err != nil {
+				multiErr = append(multiErr, fmt.Errorf("quota of mount %s to %s: %w", mount.Src, mount.Dest, err))
+				if usage.exceeded {
+					return errors.Join(multiErr...)
+				}
+
+				continue
+			}
+
+			err = globalUsage.add(v.options.Quota, file.entryPath, file.size)
+			if err != nil {
+				multiErr = append(multiErr, fmt.Errorf("global quota of all mounts: %w", err))
+				if globalUsage.exceeded {
+					return errors.Join(multiErr...)
+				}
+			}
+		}
+	}
+
+	return errors.Join(multiErr...)
+}
+
+// getCountedFiles returns the files which are written for the source file, i.e. the extracted files of archives of
+// mounts with enabled extraction and the source file itself otherwise.
+func (v *VolumeMountCopier) getCountedFiles(mount SrcAndDestination, filePath, rel string) ([]extractedFile, error) {
+	if mount.isExtracted(rel) {
+		return v.scanArchive(mount, filePath, rel)
+	}
+
+	fileInfo, err := v.fileSystem.Stat(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file info of source file %s: %w", filePath, err)
+	}
+
+	return []extractedFile{{entryPath: filePath, rel: mount.destinationRel(rel), size: fileInfo.Size()}}, nil
+}
+
+// isCandidate returns true if the regular source file is copied or extracted unless it is unchanged.
+// The filters do not apply to archives of mounts with enabled extraction but to the extracted files.
+func (m SrcAndDestination) isCandidate(rel string) bool {
+	if m.isManifest(rel) {
+		return false
+	}
+
+	if m.isExtracted(rel) {
+		return true
+	}
+
+	return m.isIncluded(rel)
+}
@@ -0,0 +1,133 @@
+package copy
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVolumeMountCopier_CopyVolumeMount_quota(t *testing.T) {
+	copyMounts := func(t *testing.T, options Options, mounts ...SrcAndDestination) (*VolumeMountCopier, error) {
+		fileSystem := FileSystem{}
+		sut := NewVolumeMountCopier(fileSystem, NewLocalConfigFileTracker(newMemoryDoguConfig(), fileSystem), options)
+		return sut, sut.CopyVolumeMount(mounts)
+	}
+
+	t.Run("should not copy anything if a file exceeds the maximum file size", func(t *testing.T) {
+		// given
+		src := t.TempDir()
+		dest := t.TempDir()
+		writeTestFile(t, filepath.Join(src, "app.conf"), "app")
+		writeTestFile(t, filepath.Join(src, "large.bin"), strings.Repeat("l", 100))
+
+		// when
+		sut, err := copyMounts(t, Options{}, SrcAndDestination{Src: src, Dest: dest, Quota: Quota{MaxFileSize: 10}})
+
+		// then
+		require.ErrorIs(t, err, ErrQuotaExceeded)
+		assert.ErrorContains(t, err, "quota of mount "+src+" to "+dest+": quota exceeded: file "+filepath.Join(src, "large.bin")+" with 100 bytes exceeds the maximum file size of 10 bytes")
+		assert.Equal(t, 0, sut.summary.copied)
+		assert.NoFileExists(t, filepath.Join(dest, "app.conf"))
+		assert.NoFileExists(t, filepath.Join(dest, "large.bin"))
+	})
+
+	t.Run("should not copy any mount if a mount exceeds the maximum number of files", func(t *testing.T) {
+		// given
+		src := t.TempDir()
+		otherSrc := t.TempDir()
+		dest := t.TempDir()
+		otherDest := t.TempDir()
+		writeTestFile(t, filepath.Join(src, "a.conf"), "a")
+		writeTestFile(t, filepath.Join(src, "b.conf"), "b")
+		writeTestFile(t, filepath.Join(src, "c.conf"), "c")
+		writeTestFile(t, filepath.Join(src, "skipped.txt"), "skipped")
+		writeTestFile(t, filepath.Join(otherSrc, "d.conf"), "d")
+
+		// when
+		sut, err := copyMounts(t, Options{},
+			SrcAndDestination{Src: src, Dest: dest, Include: []string{"*.conf"}, Quota: Quota{MaxFiles: 2}},
+			SrcAndDestination{Src: otherSrc, Dest: otherDest, Quota: Quota{MaxFiles: 2}},
+		)
+
+		// then
+		require.ErrorIs(t, err, ErrQuotaExceeded)
+		assert.ErrorContains(t, err, "quota of mount "+src+" to "+dest+": quota exceeded: file "+filepath.Join(src, "c.conf")+" exceeds the maximum number of 2 files")
+		assert.Equal(t, 0, sut.summary.copied)
+		assert.NoFileExists(t, filepath.Join(dest, "a.conf"))
+		assert.NoFileExists(t, filepath.Join(otherDest, "d.conf"))
+	})
+
+	t.Run("should not copy any mount if the global total size is exceeded", func(t *testing.T) {
+		// given
+		src := t.TempDir()
+		otherSrc := t.TempDir()
+		dest := t.TempDir()
+		otherDest := t.TempDir()
+		writeTestFile(t, filepath.Join(src, "a.conf"), strings.Repeat("a", 6))
+		writeTestFile(t, filepath.Join(otherSrc, "b.conf"), strings.Repeat("b", 6))
+		writeTestFile(t, filepath.Join(otherSrc, "c.conf"), strings.Repeat("c", 6))
+
+		// when
+		sut, err := copyMounts(t, Options{Quota: Quota{MaxBytes: 10}},
+			SrcAndDestination{Src: src, Dest: dest},
+			SrcAndDestination{Src: otherSrc, Dest: otherDest},
+		)
+
+		// then
+		require.ErrorIs(t, err, ErrQuotaExceeded)
+		assert.ErrorContains(t, err, "global quota of all mounts: quota exceeded: file "+filepath.Join(otherSrc, "b.conf")+" with 6 bytes exceeds the maximum total size of 10 bytes after 6 bytes")
+		assert.NotContains(t, err.Error(), "c.conf")
+		assert.Equal(t, 0, sut.summary.copied)
+		assert.NoFileExists(t, filepath.Join(dest, "a.conf"))
+	})
+
+	t.Run("should count dereferenced symlinks with the size of their targets", func(t *testing.T) {
+		// given
+		src := t.TempDir()
+		dest := t.TempDir()
+		writeTestFile(t, filepath.Join(src, "shared", "app.conf"), strings.Repeat("a", 100))
+		require.NoError(t, os.Symlink("shared/app.conf", filepath.Join(src, "link.conf")))
+		require.NoError(t, os.Symlink("shared", filepath.Join(src, "linked")))
+
+		// when
+		_, err := copyMounts(t, Options{}, SrcAndDestination{Src: src, Dest: dest, Symlinks: SymlinkDereference, Quota: Quota{MaxBytes: 250}})
+
+		// then
+		require.ErrorIs(t, err, ErrQuotaExceeded)
+		assert.ErrorContains(t, err, "quota exceeded: file "+filepath.Join(src, "shared", "app.conf")+" with 100 bytes exceeds the maximum total size of 250 bytes after 200 bytes")
+		assert.NoFileExists(t, filepath.Join(dest, "link.conf"))
+		assert.NoDirExists(t, filepath.Join(dest, "shared"))
+	})
+	t.Run("should count extracted files with their uncompressed size", func(t *testing.T) {
+		tests := []struct {
+			name     string
+			quota    Quota
+			expected string
+		}{
+			{"maximum file size", Quota{MaxFileSize: 1000}, ":large.bin with 10000 bytes exceeds the maximum file size of 1000 bytes"},
+			{"maximum total size", Quota{MaxBytes: 5000}, ":large.bin with 10000 bytes exceeds the maximum total size of 5000 bytes after 3 bytes"},
+			{"maximum number of files", Quota{MaxFiles: 1}, ":large.bin exceeds the maximum number of 1 files"},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				// given
+				src := t.TempDir()
+				dest := t.TempDir()
+				archivePath := filepath.Join(src, "conf.tar.gz")
+				createTarGz(t, archivePath, testArchiveEntry{"app.conf", "app"}, testArchiveEntry{"large.bin", strings.Repeat("l", 10000)})
+
+				// when
+				sut, err := copyMounts(t, Options{}, SrcAndDestination{Src: src, Dest: dest, Extract: true, Quota: tt.quota})
+
+				// then
+				require.ErrorIs(t, err, ErrQuotaExceeded)
+				assert.ErrorContains(t, err, "quota exceeded: file "+archivePath+tt.expected)
+				assert.Equal(t, 0, sut.summary.copied)
+				assert.NoFileExists(t, filepath.Join(dest, "app.conf"))
+			})
+		}
+	})
+}
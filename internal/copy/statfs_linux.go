@@ -0,0 +1,36 @@
+//go:build linux
+
+package copy
+
+import (
+	"fmt"
+	"golang.org/x/sys/unix"
+)
+
+// getFilesystemStats returns the capacity of the filesystem containing the existing path.
+func getFilesystemStats(path string) (FilesystemStats, error) {
+	var statfs unix.Statfs_t
+	err := unix.Statfs(path, &statfs)
+	if err != nil {
+		return FilesystemStats{}, fmt.Errorf("failed to get filesystem stats of %s: %w", path, err)
+	}
+
+	var stat unix.Stat_t
+	err = unix.Stat(path, &stat)
+	if err != nil {
+		return FilesystemStats{}, fmt.Errorf("failed to get file info of %s: %w", path, err)
+	}
+
+	// The free blocks are counted in fragments. Old kernels do not report the fragment size.
+	blockSize := uint64(statfs.Frsize)
+	if blockSize == 0 {
+		blockSize = uint64(statfs.Bsize)
+	}
+
+	return FilesystemStats{
+		Device:          uint64(stat.Dev),
+		AvailableBytes:  statfs.Bavail * blockSize,
+		AvailableInodes: statfs.Ffree,
+		TotalInodes:     statfs.Files,
+	}, nil
+}
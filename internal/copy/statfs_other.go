@@ -0,0 +1,12 @@
+//go:build !linux
+
+package copy
+
+import (
+	"errors"
+)
+
+// getFilesystemStats is only supported on linux. The capacity of the destinations is not checked on other platforms.
+func getFilesystemStats(_ string) (FilesystemStats, error) {
+	return FilesystemStats{}, errors.ErrUnsupported
+}
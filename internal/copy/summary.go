@@ -0,0 +1,77 @@
+package copy
+
+import (
+	"log"
+	"slices"
+	"sync"
+	"time"
+)
+
+// runSummary counts the results of all files processed in a copy run.
+// It is safe for concurrent use.
+type runSummary struct {
+	mutex     sync.Mutex
+	dryRun    bool
+	copied    int
+	unchanged int
+	filtered  int
+	kept      int
+	failed    int
+	// expiries contains the validated certificates, whose remaining days are reported.
+	expiries []certificateExpiry
+}
+
+func (s *runSummary) addCopied() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.copied++
+}
+
+func (s *runSummary) addUnchanged() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.unchanged++
+}
+
+func (s *runSummary) addFiltered() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.filtered++
+}
+
+func (s *runSummary) addKept() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.kept++
+}
+
+func (s *runSummary) addFailed() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.failed++
+}
+
+func (s *runSummary) log() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	prefix := "Copy summary"
+	if s.dryRun {
+		prefix = "Dry run summary"
+	}
+
+	log.Printf("%s: %d file(s) copied, %d unchanged file(s) skipped, %d filtered file(s) skipped, %d existing file(s) kept, %d file(s) failed",
+		prefix, s.copied, s.unchanged, s.filtered, s.kept, s.failed)
+
+	now := time.Now()
+	expiries := slices.SortedStableFunc(slices.Values(s.expiries), func(a, b certificateExpiry) int {
+		return a.notAfter.Compare(b.notAfter)
+	})
+	for _, expiry := range expiries {
+		remaining := expiry.notAfter.Sub(now)
+		if remaining < 0 {
+			log.Printf("%s: certificate %q of %s expired %d day(s) ago", prefix, expiry.subject, expiry.filePath, int(-remaining.Hours()/24))
+		} else {
+			log.Printf("%s: certificate %q of %s expires in %d day(s)", prefix, expiry.subject, expiry.filePath, int(remaining.Hours()/24))
+		}
+	}
+}
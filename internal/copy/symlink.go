@@ -0,0 +1,307 @@
+package copy
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// SymlinkPolicy defines how symlinks in the source of a mount are handled.
+type SymlinkPolicy string
+
+const (
+	// SymlinkSkip ignores symlinks. This is the default.
+	SymlinkSkip SymlinkPolicy = "skip"
+	// SymlinkPreserve recreates the symlink with the same target at the destination.
+	SymlinkPreserve SymlinkPolicy = "preserve"
+	// SymlinkDereference copies the content of the symlink target. Dirs are copied recursively.
+	SymlinkDereference SymlinkPolicy = "dereference"
+)
+
+// ParseSymlinkPolicy returns the symlink policy with the given name.
+func ParseSymlinkPolicy(name string) (SymlinkPolicy, error) {
+	policy := SymlinkPolicy(name)
+	switch policy {
+	case SymlinkSkip, SymlinkPreserve, SymlinkDereference:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown symlink policy %q, expected one of %s, %s, %s", name, SymlinkSkip, SymlinkPreserve, SymlinkDereference)
+	}
+}
+
+func (m SrcAndDestination) symlinkPolicy() SymlinkPolicy {
+	if m.Symlinks == "" {
+		return SymlinkSkip
+	}
+
+	return m.Symlinks
+}
+
+// sourceSymlinkPolicy returns the symlink policy with which the source files of the mount are collected.
+// Assemblies and certificates skip symlinks.
+func (m SrcAndDestination) sourceSymlinkPolicy() SymlinkPolicy {
+	if m.Assemble || m.Certificates != "" {
+		return SymlinkSkip
+	}
+
+	return m.symlinkPolicy()
+}
+
+// walkSymlink handles the symlink according to the symlink policy of the mount.
+// visited contains the resolved dirs which are currently dereferenced to detect loops over several symlinks.
+func (v *VolumeMountCopier) walkSymlink(mount SrcAndDestination, srcVolume, linkPath, rel string, visited []string) error {
+	switch mount.symlinkPolicy() {
+	case SymlinkPreserve:
+		return v.preserveSymlink(mount, srcVolume, linkPath, rel)
+	case SymlinkDereference:
+		return v.dereferenceSymlink(mount, srcVolume, linkPath, rel, visited)
+	default:
+		log.Printf("skip source file %s because it is a symlink", linkPath)
+		return nil
+	}
+}
+
+// preserveSymlink recreates the symlink at the destination.
+// Only links pointing into the source volume are allowed. Absolute targets are converted to relative ones, so that
+// the link still points to the copied file at the destination.
+func (v *VolumeMountCopier) preserveSymlink(mount SrcAndDestination, srcVolume, linkPath, rel string) error {
+	if !mount.isIncluded(rel) {
+		log.Printf("skip source file %s because it does not match the include and exclude patterns", linkPath)
+		v.summary.addFiltered()
+		return nil
+	}
+
+	target, err := v.fileSystem.Readlink(linkPath)
+	if err != nil {
+		return fmt.Errorf("failed to read symlink %s: %w", linkPath, err)
+	}
+
+	linkDir := filepath.Dir(linkPath)
+	resolvedTarget := resolveLinkTarget(linkPath, target)
+
+	if !isWithin(srcVolume, resolvedTarget) {
+		return fmt.Errorf("symlink %s points to %s outside of the source volume %s", linkPath, target, srcVolume)
+	}
+
+	if filepath.IsAbs(target) {
+		target, err = filepath.Rel(linkDir, resolvedTarget)
+		if err != nil {
+			return fmt.Errorf("failed to get relative target of symlink %s: %w", linkPath, err)
+		}
+	}
+
+	destinationFilePath := path.Join(mount.Dest, rel)
+	unlock := v.destinationLocks.lock(destinationFilePath)
+	defer unlock()
+
+	destFileInfo, err := v.fileSystem.Lstat(destinationFilePath)
+	if err == nil {
+		if destFileInfo.IsDir() {
+			return fmt.Errorf("destination file %s exists and is a dir", destinationFilePath)
+		}
+
+		conflict, err := v.isConflict(destinationFilePath)
+		if err != nil {
+			return err
+		}
+
+		if destFileInfo.Mode()&os.ModeSymlink != 0 {
+			existingTarget, err := v.fileSystem.Readlink(destinationFilePath)
+			if err != nil {
+				return fmt.Errorf("failed to read symlink %s: %w", destinationFilePath, err)
+			}
+
+			if resolveLinkTarget(destinationFilePath, existingTarget) == resolveLinkTarget(destinationFilePath, target) {
+				log.Printf("skip symlink %s because destination symlink %s has the same target", linkPath, destinationFilePath)
+				v.summary.addUnchanged()
+				if conflict {
+					// The symlink was not created by this application and is not tracked, so that it is not removed
+					// on cleanup.
+					return nil
+				}
+
+				return v.fileTracker.AddFile(destinationFilePath)
+			}
+		}
+
+		if conflict {
+			write, err := v.resolveConflict(mount, linkPath, destinationFilePath)
+			if err != nil || !write {
+				return err
+			}
+		}
+	}
+
+	if v.options.DryRun {
+		log.Printf("Dry run: would create symlink %s to %s", destinationFilePath, target)
+		v.summary.addCopied()
+		return v.fileTracker.AddFile(destinationFilePath)
+	}
+
+	attributes := FileAttributes{Owner: mount.Owner, Group: mount.Group, DirMode: mount.DirMode}
+	err = createSymlink(target, destinationFilePath, v.fileSystem, attributes)
+	if err != nil {
+		return err
+	}
+
+	v.summary.addCopied()
+
+	return v.fileTracker.AddFile(destinationFilePath)
+}
+
+// dereferenceSymlink copies the content of the symlink target to the destination of the symlink.
+// The target has to be inside the source volume. Dirs are walked recursively whereby symlinks forming a loop
+// result in an error.
+func (v *VolumeMountCopier) dereferenceSymlink(mount SrcAndDestination, srcVolume, linkPath, rel string, visited []string) error {
+	target, targetFileInfo, err := v.resolveSymlinkTarget(srcVolume, linkPath, visited)
+	if err != nil {
+		return err
+	}
+
+	if targetFileInfo.Mode().IsRegular() {
+		return v.copyRegularFile(mount, target, targetFileInfo, rel)
+	}
+
+	if !targetFileInfo.IsDir() {
+		log.Printf("skip symlink %s because its target %s is neither a regular file nor a dir", linkPath, target)
+		return nil
+	}
+
+	return v.walkDereferencedDir(mount, srcVolume, target, rel, append(visited, target))
+}
+
+// resolveSymlinkTarget returns the resolved target of the symlink and its file info. The target has to be inside
+// the source volume. Dirs containing the symlink or already being dereferenced form a loop and result in an error.
+func (v *VolumeMountCopier) resolveSymlinkTarget(srcVolume, linkPath string, visited []string) (string, os.FileInfo, error) {
+	target, err := v.fileSystem.EvalSymlinks(linkPath)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to resolve symlink %s: %w", linkPath, err)
+	}
+
+	resolvedVolume, err := v.fileSystem.EvalSymlinks(srcVolume)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to resolve source volume %s: %w", srcVolume, err)
+	}
+
+	if !isWithin(resolvedVolume, target) {
+		return "", nil, fmt.Errorf("symlink %s points to %s outside of the source volume %s", linkPath, target, srcVolume)
+	}
+
+	targetFileInfo, err := v.fileSystem.Stat(target)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to get file info of symlink target %s: %w", target, err)
+	}
+
+	if !targetFileInfo.IsDir() {
+		return target, targetFileInfo, nil
+	}
+
+	resolvedLinkDir, err := v.fileSystem.EvalSymlinks(filepath.Dir(linkPath))
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to resolve dir of symlink %s: %w", linkPath, err)
+	}
+
+	if isWithin(target, resolvedLinkDir) || slices.Contains(visited, target) {
+		return "", nil, fmt.Errorf("symlink %s to %s forms a loop", linkPath, target)
+	}
+
+	return target, targetFileInfo, nil
+}
+
+// walkDereferencedDir copies all files of the dir behind a symlink to the destination of the symlink.
+// In contrast to [walkDir], the files are copied sequentially because the walk already runs in a worker of the pool.
+func (v *VolumeMountCopier) walkDereferencedDir(mount SrcAndDestination, srcVolume, dir, rel string, visited []string) error {
+	var multiErr []error
+
+	err := v.fileSystem.WalkDir(dir, func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			multiErr = append(multiErr, fmt.Errorf("error during filepath walk for path %s: %w", filePath, err))
+			return nil
+		}
+
+		if d.IsDir() {
+			return nil
+		}
+
+		fileInfo, err := d.Info()
+		if err != nil {
+			multiErr = append(multiErr, err)
+			return nil
+		}
+
+		subRel, err := filepath.Rel(dir, filePath)
+		if err != nil {
+			multiErr = append(multiErr, fmt.Errorf("can't get the relative path of the source file %s and the dir %s: %w", filePath, dir, err))
+			return nil
+		}
+
+		fileRel := path.Join(rel, filepath.ToSlash(subRel))
+		switch {
+		case fileInfo.Mode()&os.ModeSymlink != 0:
+			multiErr = append(multiErr, v.walkSymlink(mount, srcVolume, filePath, fileRel, visited))
+		case fileInfo.Mode().IsRegular():
+			multiErr = append(multiErr, v.copyRegularFile(mount, filePath, fileInfo, fileRel))
+		default:
+			log.Printf("skip source file %s because it is not a regular file", filePath)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		multiErr = append(multiErr, err)
+	}
+
+	return errors.Join(multiErr...)
+}
+
+// createSymlink creates the symlink atomically by creating a temporary symlink and renaming it to the destination.
+func createSymlink(target, destFilePath string, fileSystem Filesystem, attributes FileAttributes) error {
+	destDir := path.Dir(destFilePath)
+	err := createDirs(destDir, attributes, fileSystem)
+	if err != nil {
+		return fmt.Errorf("failed to create dirs for path %s: %w", destFilePath, err)
+	}
+
+	tempFilePath := getTempFilePath(destFilePath)
+	err = fileSystem.Symlink(target, tempFilePath)
+	if err != nil {
+		return fmt.Errorf("failed to create symlink %s to %s: %w", tempFilePath, target, err)
+	}
+
+	err = fileSystem.Rename(tempFilePath, destFilePath)
+	if err != nil {
+		removeTempFile(tempFilePath, fileSystem)
+		return fmt.Errorf("failed to rename temporary symlink %s to %s: %w", tempFilePath, destFilePath, err)
+	}
+
+	log.Printf("Created symlink %s to %s", destFilePath, target)
+
+	return nil
+}
+
+// resolveLinkTarget returns the cleaned absolute path the target of the symlink points to. Relative targets are
+// resolved against the dir of the symlink. Symlinks in the target are not followed.
+func resolveLinkTarget(linkPath, target string) string {
+	if filepath.IsAbs(target) {
+		return filepath.Clean(target)
+	}
+
+	return filepath.Join(filepath.Dir(linkPath), target)
+}
+
+// isWithin checks if the path is the dir itself or lies beneath it.
+func isWithin(dir, filePath string) bool {
+	rel, err := filepath.Rel(dir, filePath)
+	if err != nil {
+		return false
+	}
+
+	return rel != ".." && !strings.HasPrefix(rel, "../")
+}
@@ -0,0 +1,221 @@
+package copy
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseSymlinkPolicy(t *testing.T) {
+	t.Run("should parse known policies", func(t *testing.T) {
+		for _, name := range []string{"skip", "preserve", "dereference"} {
+			policy, err := ParseSymlinkPolicy(name)
+
+			require.NoError(t, err)
+			assert.Equal(t, SymlinkPolicy(name), policy)
+		}
+	})
+
+	t.Run("should return error on unknown policy", func(t *testing.T) {
+		_, err := ParseSymlinkPolicy("follow")
+
+		assert.ErrorContains(t, err, `unknown symlink policy "follow"`)
+	})
+}
+
+func TestVolumeMountCopier_CopyVolumeMount_symlinks(t *testing.T) {
+	copyMount := func(t *testing.T, mount SrcAndDestination) (*VolumeMountCopier, error) {
+		fileSystem := FileSystem{}
+		sut := NewVolumeMountCopier(fileSystem, NewLocalConfigFileTracker(newMemoryDoguConfig(), fileSystem), Options{})
+		return sut, sut.CopyVolumeMount([]SrcAndDestination{mount})
+	}
+
+	t.Run("should skip symlinks by default", func(t *testing.T) {
+		// given
+		src := t.TempDir()
+		dest := t.TempDir()
+		writeTestFile(t, filepath.Join(src, "file"), "content")
+		require.NoError(t, os.Symlink("file", filepath.Join(src, "link")))
+
+		// when
+		sut, err := copyMount(t, SrcAndDestination{Src: src, Dest: dest})
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, 1, sut.summary.copied)
+		assert.NoFileExists(t, filepath.Join(dest, "link"))
+	})
+
+	t.Run("should preserve symlinks and convert absolute targets", func(t *testing.T) {
+		// given
+		src := t.TempDir()
+		dest := t.TempDir()
+		writeTestFile(t, filepath.Join(src, "dir", "file"), "content")
+		require.NoError(t, os.Symlink("dir/file", filepath.Join(src, "relative")))
+		require.NoError(t, os.Symlink(filepath.Join(src, "dir", "file"), filepath.Join(src, "dir", "absolute")))
+
+		// when
+		sut, err := copyMount(t, SrcAndDestination{Src: src, Dest: dest, Symlinks: SymlinkPreserve})
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, 3, sut.summary.copied)
+		target, err := os.Readlink(filepath.Join(dest, "relative"))
+		require.NoError(t, err)
+		assert.Equal(t, "dir/file", target)
+		target, err = os.Readlink(filepath.Join(dest, "dir", "absolute"))
+		require.NoError(t, err)
+		assert.Equal(t, "file", target)
+	})
+
+	t.Run("should not recreate preserved symlink with the same target", func(t *testing.T) {
+		// given
+		src := t.TempDir()
+		dest := t.TempDir()
+		require.NoError(t, os.Symlink("file", filepath.Join(src, "link")))
+		require.NoError(t, os.Symlink("./dir/../file", filepath.Join(dest, "link")))
+
+		// when
+		sut, err := copyMount(t, SrcAndDestination{Src: src, Dest: dest, Symlinks: SymlinkPreserve})
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, 1, sut.summary.unchanged)
+		target, err := os.Readlink(filepath.Join(dest, "link"))
+		require.NoError(t, err)
+		assert.Equal(t, "./dir/../file", target)
+		tracked, err := sut.fileTracker.IsTracked(filepath.Join(dest, "link"))
+		require.NoError(t, err)
+		assert.False(t, tracked, "an existing symlink must not be removed on cleanup")
+	})
+
+	t.Run("should return error if preserved symlink points outside of the source volume", func(t *testing.T) {
+		// given
+		src := t.TempDir()
+		dest := t.TempDir()
+		require.NoError(t, os.Symlink("../outside", filepath.Join(src, "link")))
+
+		// when
+		sut, err := copyMount(t, SrcAndDestination{Src: src, Dest: dest, Symlinks: SymlinkPreserve})
+
+		// then
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "outside of the source volume")
+		assert.Equal(t, 1, sut.summary.failed)
+		assert.NoFileExists(t, filepath.Join(dest, "link"))
+	})
+
+	t.Run("should dereference symlinks to files and dirs", func(t *testing.T) {
+		// given
+		src := t.TempDir()
+		dest := t.TempDir()
+		writeTestFile(t, filepath.Join(src, "real", "file"), "content")
+		writeTestFile(t, filepath.Join(src, "real", "sub", "other"), "other")
+		require.NoError(t, os.Symlink("real/file", filepath.Join(src, "fileLink")))
+		require.NoError(t, os.Symlink("real", filepath.Join(src, "dirLink")))
+
+		// when
+		sut, err := copyMount(t, SrcAndDestination{Src: src, Dest: dest, Symlinks: SymlinkDereference})
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, 5, sut.summary.copied)
+		for file, content := range map[string]string{"fileLink": "content", "dirLink/file": "content", "dirLink/sub/other": "other"} {
+			fileInfo, err := os.Lstat(filepath.Join(dest, file))
+			require.NoError(t, err)
+			assert.True(t, fileInfo.Mode().IsRegular())
+			actual, err := os.ReadFile(filepath.Join(dest, file))
+			require.NoError(t, err)
+			assert.Equal(t, content, string(actual))
+		}
+	})
+
+	t.Run("should apply filters to the files of dereferenced dirs", func(t *testing.T) {
+		// given
+		src := t.TempDir()
+		dest := t.TempDir()
+		writeTestFile(t, filepath.Join(src, "real", "config.xml"), "content")
+		writeTestFile(t, filepath.Join(src, "real", "README"), "readme")
+		require.NoError(t, os.Symlink("real", filepath.Join(src, "dirLink")))
+
+		// when
+		_, err := copyMount(t, SrcAndDestination{Src: src, Dest: dest, Symlinks: SymlinkDereference, Include: []string{"dirLink/*.xml"}})
+
+		// then
+		require.NoError(t, err)
+		assert.FileExists(t, filepath.Join(dest, "dirLink", "config.xml"))
+		assert.NoFileExists(t, filepath.Join(dest, "dirLink", "README"))
+	})
+
+	t.Run("should return error on symlink loop", func(t *testing.T) {
+		// given
+		src := t.TempDir()
+		dest := t.TempDir()
+		writeTestFile(t, filepath.Join(src, "dir", "file"), "content")
+		require.NoError(t, os.Symlink("..", filepath.Join(src, "dir", "parent")))
+
+		// when
+		_, err := copyMount(t, SrcAndDestination{Src: src, Dest: dest, Symlinks: SymlinkDereference})
+
+		// then
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "forms a loop")
+		assert.FileExists(t, filepath.Join(dest, "dir", "file"))
+	})
+
+	t.Run("should return error on symlink loop over several links", func(t *testing.T) {
+		// given
+		src := t.TempDir()
+		dest := t.TempDir()
+		require.NoError(t, os.MkdirAll(filepath.Join(src, "a"), 0755))
+		require.NoError(t, os.MkdirAll(filepath.Join(src, "b"), 0755))
+		require.NoError(t, os.Symlink("../b", filepath.Join(src, "a", "toB")))
+		require.NoError(t, os.Symlink("../a", filepath.Join(src, "b", "toA")))
+
+		// when
+		_, err := copyMount(t, SrcAndDestination{Src: src, Dest: dest, Symlinks: SymlinkDereference})
+
+		// then
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "forms a loop")
+	})
+
+	t.Run("should return error if dereferenced symlink points outside of the source volume", func(t *testing.T) {
+		// given
+		src := t.TempDir()
+		dest := t.TempDir()
+		outside := filepath.Join(t.TempDir(), "secret")
+		writeTestFile(t, outside, "secret")
+		require.NoError(t, os.Symlink(outside, filepath.Join(src, "link")))
+
+		// when
+		_, err := copyMount(t, SrcAndDestination{Src: src, Dest: dest, Symlinks: SymlinkDereference})
+
+		// then
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "outside of the source volume")
+		assert.NoFileExists(t, filepath.Join(dest, "link"))
+	})
+
+	t.Run("should ignore the symlinks of projected volumes", func(t *testing.T) {
+		// given
+		src := t.TempDir()
+		dest := t.TempDir()
+		writeTestFile(t, filepath.Join(src, "..2025_05_07", "config.yaml"), "content")
+		require.NoError(t, os.Symlink("..2025_05_07", filepath.Join(src, "..data")))
+		require.NoError(t, os.Symlink("..data/config.yaml", filepath.Join(src, "config.yaml")))
+
+		// when
+		sut, err := copyMount(t, SrcAndDestination{Src: src, Dest: dest, Symlinks: SymlinkPreserve})
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, 1, sut.summary.copied)
+		fileInfo, err := os.Lstat(filepath.Join(dest, "config.yaml"))
+		require.NoError(t, err)
+		assert.True(t, fileInfo.Mode().IsRegular())
+		assert.NoFileExists(t, filepath.Join(dest, "..data"))
+	})
+}
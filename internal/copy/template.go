@@ -0,0 +1,206 @@
+package copy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// ConfigReader provides the values of a config, e.g. the dogu config or the global config.
+type ConfigReader interface {
+	Get(key string) (string, error)
+}
+
+// TemplateRenderer renders source files as Go text/template.
+// The templates can access config values and environment variables with the following functions:
+//
+//	{{ dogu "key" }}   value of the key from the dogu config
+//	{{ global "key" }} value of the key from the global config, e.g. fqdn
+//	{{ env "NAME" }}   value of the environment variable
+//
+// Rendering fails if a config key does not exist.
+type TemplateRenderer struct {
+	doguConfig   ConfigReader
+	globalConfig ConfigReader
+}
+
+func NewTemplateRenderer(doguConfig, globalConfig ConfigReader) *TemplateRenderer {
+	return &TemplateRenderer{doguConfig: doguConfig, globalConfig: globalConfig}
+}
+
+func (r *TemplateRenderer) funcs() template.FuncMap {
+	return template.FuncMap{
+		"dogu": func(key string) (string, error) {
+			return getConfigValue(r.doguConfig, "dogu", key)
+		},
+		"global": func(key string) (string, error) {
+			return getConfigValue(r.globalConfig, "global", key)
+		},
+		"env": os.Getenv,
+	}
+}
+
+func getConfigValue(config ConfigReader, name, key string) (string, error) {
+	value, err := config.Get(key)
+	if err != nil {
+		return "", fmt.Errorf("failed to get key %s from %s config: %w", key, name, err)
+	}
+
+	return value, nil
+}
+
+// renderFile renders the source file and writes the result atomically to the destination.
+// It has the signature of a Copier.
+func (r *TemplateRenderer) renderFile(srcfilePath, destFilePath string, fileSystem Filesystem, attributes FileAttributes) error {
+	rendered, err := r.render(srcfilePath, fileSystem)
+	if err != nil {
+		return err
+	}
+
+	return writeAtomically(srcfilePath, destFilePath, rendered, fileSystem, attributes)
+}
+
+// render renders the source file.
+func (r *TemplateRenderer) render(srcfilePath string, fileSystem Filesystem) (*bytes.Buffer, error) {
+	content, err := readFile(srcfilePath, fileSystem)
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl, err := template.New(path.Base(srcfilePath)).Funcs(r.funcs()).Parse(content.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template %s: %w", srcfilePath, err)
+	}
+
+	var rendered bytes.Buffer
+	err = tmpl.Execute(&rendered, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render template %s: %w", srcfilePath, err)
+	}
+
+	log.Printf("Rendered template %s", srcfilePath)
+
+	return &rendered, nil
+}
+
+// readFile reads the whole content of the file.
+func readFile(filePath string, fileSystem Filesystem) (*bytes.Buffer, error) {
+	file, err := fileSystem.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file %s: %w", filePath, err)
+	}
+
+	defer func() {
+		closeErr := fileSystem.CloseFile(file)
+		if closeErr != nil {
+			log.Println(fmt.Errorf("failed to close fd: %w", closeErr))
+		}
+	}()
+
+	var content bytes.Buffer
+	_, _, err = fileSystem.Copy(&content, file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file %s: %w", filePath, err)
+	}
+
+	return &content, nil
+}
+
+// isTemplate checks if the source file has to be rendered as template.
+func (m SrcAndDestination) isTemplate(filePath string) bool {
+	return m.Templates && strings.HasSuffix(filePath, m.TemplateSuffix)
+}
+
+// destinationRel returns the path relative to the destination of the mount for the relative source path.
+// The template suffix is removed from templates, e.g. config.yaml.tpl is rendered to config.yaml.
+func (m SrcAndDestination) destinationRel(rel string) string {
+	if m.isTemplate(rel) {
+		return strings.TrimSuffix(rel, m.TemplateSuffix)
+	}
+
+	return rel
+}
+
+// GlobalFileConfig reads the global config from a yaml file. Nested keys are joined with a slash, e.g. mail/relayhost.
+// The file is read on the first access. A missing file results in an empty config.
+type GlobalFileConfig struct {
+	filePath   string
+	fileSystem Filesystem
+	once       sync.Once
+	values     map[string]string
+	err        error
+}
+
+func NewGlobalFileConfig(filePath string, fileSystem Filesystem) *GlobalFileConfig {
+	return &GlobalFileConfig{filePath: filePath, fileSystem: fileSystem}
+}
+
+func (c *GlobalFileConfig) Get(key string) (string, error) {
+	c.once.Do(c.load)
+	if c.err != nil {
+		return "", c.err
+	}
+
+	value, ok := c.values[key]
+	if !ok {
+		return "", fmt.Errorf("key %s does not exist in global config %s", key, c.filePath)
+	}
+
+	return value, nil
+}
+
+func (c *GlobalFileConfig) load() {
+	c.values = map[string]string{}
+
+	file, err := c.fileSystem.Open(c.filePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return
+	}
+
+	if err != nil {
+		c.err = fmt.Errorf("failed to open global config %s: %w", c.filePath, err)
+		return
+	}
+
+	defer func() {
+		closeErr := c.fileSystem.CloseFile(file)
+		if closeErr != nil {
+			log.Println(fmt.Errorf("failed to close fd: %w", closeErr))
+		}
+	}()
+
+	var config map[string]any
+	err = yaml.NewDecoder(file).Decode(&config)
+	if err != nil && !errors.Is(err, io.EOF) {
+		c.err = fmt.Errorf("failed to unmarshal global config %s: %w", c.filePath, err)
+		return
+	}
+
+	flattenConfig("", config, c.values)
+}
+
+func flattenConfig(prefix string, config map[string]any, values map[string]string) {
+	for key, value := range config {
+		if prefix != "" {
+			key = prefix + "/" + key
+		}
+
+		switch typed := value.(type) {
+		case map[string]any:
+			flattenConfig(key, typed, values)
+		case nil:
+			values[key] = ""
+		default:
+			values[key] = fmt.Sprint(typed)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package copy
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVolumeMountCopier_CopyVolumeMount_templates(t *testing.T) {
+	newRenderer := func() *TemplateRenderer {
+		doguConfig := newMemoryDoguConfig()
+		doguConfig.values["logging/root"] = "WARN"
+		globalConfig := newMemoryDoguConfig()
+		globalConfig.values["fqdn"] = "ces.example.com"
+		return NewTemplateRenderer(doguConfig, globalConfig)
+	}
+	copyMount := func(t *testing.T, mount SrcAndDestination) (*VolumeMountCopier, error) {
+		fileSystem := FileSystem{}
+		sut := NewVolumeMountCopier(fileSystem, NewLocalConfigFileTracker(newMemoryDoguConfig(), fileSystem), Options{TemplateRenderer: newRenderer()})
+		return sut, sut.CopyVolumeMount([]SrcAndDestination{mount})
+	}
+	readFile := func(t *testing.T, filePath string) string {
+		content, err := os.ReadFile(filePath)
+		require.NoError(t, err)
+		return string(content)
+	}
+
+	t.Run("should render all files with config values and environment variables", func(t *testing.T) {
+		// given
+		t.Setenv("TEMPLATE_TEST_USER", "admin")
+		src := t.TempDir()
+		dest := t.TempDir()
+		writeTestFile(t, filepath.Join(src, "app.conf"), `level={{ dogu "logging/root" }} url=https://{{ global "fqdn" }} user={{ env "TEMPLATE_TEST_USER" }}`)
+
+		// when
+		_, err := copyMount(t, SrcAndDestination{Src: src, Dest: dest, Templates: true})
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, "level=WARN url=https://ces.example.com user=admin", readFile(t, filepath.Join(dest, "app.conf")))
+	})
+
+	t.Run("should only render files with the suffix and remove it", func(t *testing.T) {
+		// given
+		src := t.TempDir()
+		dest := t.TempDir()
+		writeTestFile(t, filepath.Join(src, "dir", "app.conf.tpl"), `url={{ global "fqdn" }}`)
+		writeTestFile(t, filepath.Join(src, "plain.conf"), `url={{ global "fqdn" }}`)
+
+		// when
+		sut, err := copyMount(t, SrcAndDestination{Src: src, Dest: dest, Templates: true, TemplateSuffix: ".tpl"})
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, 2, sut.summary.copied)
+		assert.Equal(t, "url=ces.example.com", readFile(t, filepath.Join(dest, "dir", "app.conf")))
+		assert.NoFileExists(t, filepath.Join(dest, "dir", "app.conf.tpl"))
+		assert.Equal(t, `url={{ global "fqdn" }}`, readFile(t, filepath.Join(dest, "plain.conf")))
+	})
+
+	t.Run("should not copy files verbatim without templates", func(t *testing.T) {
+		// given
+		src := t.TempDir()
+		dest := t.TempDir()
+		writeTestFile(t, filepath.Join(src, "app.conf"), `{{ dogu "key" }}`)
+
+		// when
+		_, err := copyMount(t, SrcAndDestination{Src: src, Dest: dest})
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, `{{ dogu "key" }}`, readFile(t, filepath.Join(dest, "app.conf")))
+	})
+
+	t.Run("should fail on missing config key and keep the destination", func(t *testing.T) {
+		// given
+		src := t.TempDir()
+		dest := t.TempDir()
+		writeTestFile(t, filepath.Join(src, "app.conf"), `{{ dogu "missing" }}`)
+
+		// when
+		_, err := copyMount(t, SrcAndDestination{Src: src, Dest: dest, Templates: true})
+
+		// then
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "failed to render template")
+		assert.ErrorContains(t, err, "failed to get key missing from dogu config")
+		assert.NoFileExists(t, filepath.Join(dest, "app.conf"))
+	})
+
+	t.Run("should fail on invalid template", func(t *testing.T) {
+		// given
+		src := t.TempDir()
+		dest := t.TempDir()
+		writeTestFile(t, filepath.Join(src, "app.conf"), `{{ dogu "key" `)
+
+		// when
+		_, err := copyMount(t, SrcAndDestination{Src: src, Dest: dest, Templates: true})
+
+		// then
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "failed to parse template")
+	})
+}
+
+func TestGlobalFileConfig_Get(t *testing.T) {
+	t.Run("should get flat and nested keys", func(t *testing.T) {
+		// given
+		file := filepath.Join(t.TempDir(), "config.yaml")
+		writeTestFile(t, file, "fqdn: ces.example.com\nmail:\n  relayhost: postfix\nport: 25\n")
+		sut := NewGlobalFileConfig(file, FileSystem{})
+
+		// when
+		fqdn, fqdnErr := sut.Get("fqdn")
+		relayhost, relayhostErr := sut.Get("mail/relayhost")
+		port, portErr := sut.Get("port")
+
+		// then
+		require.NoError(t, fqdnErr)
+		require.NoError(t, relayhostErr)
+		require.NoError(t, portErr)
+		assert.Equal(t, "ces.example.com", fqdn)
+		assert.Equal(t, "postfix", relayhost)
+		assert.Equal(t, "25", port)
+	})
+
+	t.Run("should return error on missing key", func(t *testing.T) {
+		// given
+		sut := NewGlobalFileConfig(filepath.Join(t.TempDir(), "missing.yaml"), FileSystem{})
+
+		// when
+		_, err := sut.Get("fqdn")
+
+		// then
+		assert.ErrorContains(t, err, "key fqdn does not exist in global config")
+	})
+
+	t.Run("should return error on invalid yaml", func(t *testing.T) {
+		// given
+		file := filepath.Join(t.TempDir(), "config.yaml")
+		writeTestFile(t, file, "fqdn: [")
+		sut := NewGlobalFileConfig(file, FileSystem{})
+
+		// when
+		_, err := sut.Get("fqdn")
+
+		// then
+		assert.ErrorContains(t, err, "failed to unmarshal global config")
+	})
+}
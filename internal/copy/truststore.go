@@ -0,0 +1,281 @@
+package copy
+
+import (
+	"bytes"
+	"cmp"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"path"
+	"software.sslmate.com/src/go-pkcs12"
+	"strings"
+)
+
+// TruststoreFormat defines the format of a truststore.
+type TruststoreFormat string
+
+const (
+	// TruststorePKCS12 is a PKCS#12 truststore encrypted with AES-256 and PBKDF2, which can be read by Java 8u301,
+	// 11.0.12 and newer. Older versions have to use TruststoreJKS. This is the default.
+	TruststorePKCS12 TruststoreFormat = "pkcs12"
+	// TruststoreJKS is a Java keystore.
+	TruststoreJKS TruststoreFormat = "jks"
+)
+
+// ParseTruststoreFormat returns the truststore format with the given name.
+func ParseTruststoreFormat(name string) (TruststoreFormat, error) {
+	format := TruststoreFormat(name)
+	switch format {
+	case TruststorePKCS12, TruststoreJKS:
+		return format, nil
+	default:
+		return "", fmt.Errorf("unknown truststore format %q, expected one of %s, %s", name, TruststorePKCS12, TruststoreJKS)
+	}
+}
+
+// Truststore configures the truststore generated from the certificates of mounts with CertificatesTruststore.
+type Truststore struct {
+	// Format is the format of the truststore. If empty, TruststorePKCS12 is used.
+	Format TruststoreFormat
+	// Base is the path of a PKCS#12 or JKS truststore whose certificates are added first, e.g. the truststore of the
+	// JDK. If it is the destination, its original is used.
+	Base string
+	// BasePassword is the password of the base truststore, e.g. changeit for the truststore of the JDK. If empty, the
+	// password of the truststore is used.
+	BasePassword string
+	// PasswordFile is the path of a file containing the password. Trailing line breaks are removed.
+	PasswordFile string
+	// PasswordKey is the key of the password in the dogu config. It is used if no PasswordFile is given.
+	PasswordKey string
+}
+
+func (t Truststore) format() TruststoreFormat {
+	if t.Format == "" {
+		return TruststorePKCS12
+	}
+
+	return t.Format
+}
+
+// getTruststore returns the truststore options of the mounts. Mounts may omit them, but different options are rejected.
+func (a *assembly) getTruststore() (Truststore, error) {
+	var truststore Truststore
+	for _, mount := range a.mounts {
+		if mount.Truststore == (Truststore{}) {
+			continue
+		}
+
+		if truststore != (Truststore{}) && truststore != mount.Truststore {
+			return Truststore{}, fmt.Errorf("mounts of truststore %s define different truststore options", a.dest)
+		}
+
+		truststore = mount.Truststore
+	}
+
+	return truststore, nil
+}
+
+// writeTruststore writes the certificates of the base truststore and the certificates of the sources to the
+// truststore at the destination. Certificates contained in the base truststore are not added again.
+// The truststore is not written if it already contains the same certificates and can be opened with the password.
+func (v *VolumeMountCopier) writeTruststore(group *assembly, certificates []certificate) error {
+	truststore, err := group.getTruststore()
+	if err != nil {
+		return err
+	}
+
+	destMount, err := group.getDestinationMount("truststore")
+	if err != nil {
+		return err
+	}
+
+	password, err := v.getTruststorePassword(truststore)
+	if err != nil {
+		return err
+	}
+
+	var entries []truststoreEntry
+	if truststore.Base != "" {
+		basePassword := cmp.Or(truststore.BasePassword, password)
+		entries, err = v.readBaseTruststore(truststore.Base, group.dest, basePassword)
+		if err != nil {
+			return fmt.Errorf("failed to read base truststore %s: %w", truststore.Base, err)
+		}
+	}
+
+	entries = addTruststoreEntries(entries, certificates)
+	if v.isTruststoreUnchanged(group.dest, truststore.format(), password, entries) {
+		log.Printf("skip certificates of %s because the truststore contains the same certificates", group.dest)
+		v.summary.addUnchanged()
+		return v.fileTracker.AddFile(group.dest)
+	}
+
+	var content []byte
+	if truststore.format() == TruststoreJKS {
+		content, err = encodeJKS(entries, password)
+	} else {
+		var pkcs12Entries []pkcs12.TrustStoreEntry
+		for _, entry := range entries {
+			pkcs12Entries = append(pkcs12Entries, pkcs12.TrustStoreEntry{Cert: entry.cert, FriendlyName: entry.alias})
+		}
+
+		content, err = pkcs12.Modern2023.EncodeTrustStoreEntries(pkcs12Entries, password)
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to encode truststore %s: %w", group.dest, err)
+	}
+
+	log.Printf("Generated truststore %s with %d certificate(s)", group.dest, len(entries))
+
+	return v.writeGeneratedFile(destMount, "certificates of "+group.dest, group.dest, content)
+}
+
+func (v *VolumeMountCopier) getTruststorePassword(truststore Truststore) (string, error) {
+	switch {
+	case truststore.PasswordFile != "":
+		content, err := readFile(truststore.PasswordFile, v.fileSystem)
+		if err != nil {
+			return "", fmt.Errorf("failed to read truststore password: %w", err)
+		}
+
+		return strings.TrimRight(content.String(), "\r\n"), nil
+	case truststore.PasswordKey != "":
+		if v.options.DoguConfig == nil {
+			return "", errors.New("failed to read truststore password because no dogu config is configured")
+		}
+
+		return getConfigValue(v.options.DoguConfig, "dogu", truststore.PasswordKey)
+	default:
+		return "", errors.New("no password file or password key is configured for the truststore")
+	}
+}
+
+// readBaseTruststore returns the certificates of the base truststore. If the base is the destination, its original
+// is used, so that the certificates added by previous runs are not kept.
+func (v *VolumeMountCopier) readBaseTruststore(base, dest, password string) ([]truststoreEntry, error) {
+	var content []byte
+	if path.Clean(base) == dest {
+		original, err := v.getOriginal(dest)
+		if err != nil || original == nil {
+			return nil, err
+		}
+
+		content = original
+	} else {
+		buffer, err := readFile(base, v.fileSystem)
+		if err != nil {
+			return nil, err
+		}
+
+		content = buffer.Bytes()
+	}
+
+	return decodeTruststore(content, password)
+}
+
+// decodeTruststore returns the certificates of the PKCS#12 or JKS truststore. The format is detected by its content.
+// PKCS#12 aliases are not kept.
+func decodeTruststore(content []byte, password string) ([]truststoreEntry, error) {
+	if getTruststoreFormat(content) == TruststoreJKS {
+		return decodeJKS(content, password)
+	}
+
+	certs, err := pkcs12.DecodeTrustStore(content, password)
+	if err != nil {
+		return nil, err
+	}
+
+	used := map[string]bool{}
+	entries := make([]truststoreEntry, 0, len(certs))
+	for _, cert := range certs {
+		alias := strings.ToLower(cert.Subject.CommonName)
+		if alias == "" {
+			fingerprint := sha256.Sum256(cert.Raw)
+			alias = hex.EncodeToString(fingerprint[:8])
+		}
+
+		entries = append(entries, truststoreEntry{alias: getUniqueAlias(used, alias), cert: cert})
+	}
+
+	return entries, nil
+}
+
+func getTruststoreFormat(content []byte) TruststoreFormat {
+	if len(content) >= 4 && binary.BigEndian.Uint32(content) == jksMagic {
+		return TruststoreJKS
+	}
+
+	return TruststorePKCS12
+}
+
+// addTruststoreEntries adds the certificates which are not contained in the entries yet. Their aliases are derived
+// from their file names.
+func addTruststoreEntries(entries []truststoreEntry, certificates []certificate) []truststoreEntry {
+	used := map[string]bool{}
+	contained := map[[sha256.Size]byte]bool{}
+	for _, entry := range entries {
+		used[entry.alias] = true
+		contained[sha256.Sum256(entry.cert.Raw)] = true
+	}
+
+	for _, c := range certificates {
+		if contained[sha256.Sum256(c.cert.Raw)] {
+			log.Printf("skip certificate %q of %s because the base truststore already contains it", c.cert.Subject, c.source.filePath)
+			continue
+		}
+
+		alias := strings.ToLower(strings.ReplaceAll(strings.TrimSuffix(c.name, ".pem"), "/", "-"))
+		entries = append(entries, truststoreEntry{alias: getUniqueAlias(used, alias), cert: c.cert})
+	}
+
+	return entries
+}
+
+// getUniqueAlias numbers the alias if it is already used.
+func getUniqueAlias(used map[string]bool, alias string) string {
+	unique := alias
+	for i := 2; used[unique]; i++ {
+		unique = fmt.Sprintf("%s-%d", alias, i)
+	}
+
+	used[unique] = true
+
+	return unique
+}
+
+// isTruststoreUnchanged checks if the destination was written by this application and contains the same
+// certificates in the same format. PKCS#12 truststores are encrypted with a random salt, so their content cannot be
+// compared.
+func (v *VolumeMountCopier) isTruststoreUnchanged(dest string, format TruststoreFormat, password string, entries []truststoreEntry) bool {
+	_, err := v.fileSystem.Stat(dest)
+	if err != nil {
+		return false
+	}
+
+	conflict, err := v.isConflict(dest)
+	if err != nil || conflict {
+		return false
+	}
+
+	content, err := readFile(dest, v.fileSystem)
+	if err != nil || getTruststoreFormat(content.Bytes()) != format {
+		return false
+	}
+
+	existing, err := decodeTruststore(content.Bytes(), password)
+	if err != nil || len(existing) != len(entries) {
+		return false
+	}
+
+	for i := range entries {
+		if !bytes.Equal(existing[i].cert.Raw, entries[i].cert.Raw) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,154 @@
+package copy
+
+import (
+	"crypto/x509/pkix"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"software.sslmate.com/src/go-pkcs12"
+	"testing"
+)
+
+func TestParseTruststoreFormat(t *testing.T) {
+	t.Run("should parse known formats", func(t *testing.T) {
+		for _, name := range []string{"pkcs12", "jks"} {
+			format, err := ParseTruststoreFormat(name)
+
+			require.NoError(t, err)
+			assert.Equal(t, TruststoreFormat(name), format)
+		}
+	})
+
+	t.Run("should return error on unknown format", func(t *testing.T) {
+		_, err := ParseTruststoreFormat("pem")
+
+		assert.ErrorContains(t, err, `unknown truststore format "pem"`)
+	})
+}
+
+func TestVolumeMountCopier_CopyVolumeMount_truststore(t *testing.T) {
+	t.Run("should write pkcs12 truststore with the certificates of the base and the password of the dogu config", func(t *testing.T) {
+		// given
+		src := t.TempDir()
+		destDir := t.TempDir()
+		dest := filepath.Join(destDir, "truststore.p12")
+		base := filepath.Join(destDir, "cacerts")
+		jdk := newTestCertificate(t, pkix.Name{CommonName: "JDK CA"})
+		internal := newTestCertificate(t, pkix.Name{CommonName: "Internal CA"})
+		baseContent, err := encodeJKS([]truststoreEntry{{alias: "jdk [jdk]", cert: jdk}}, "changeit")
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(base, baseContent, 0644))
+		writeTestFile(t, filepath.Join(src, "jdk.crt"), string(encodeCertificate(jdk)))
+		writeTestFile(t, filepath.Join(src, "Internal.crt"), string(encodeCertificate(internal)))
+		doguConfig := newMemoryDoguConfig()
+		require.NoError(t, doguConfig.Set("truststore_password", "secret"))
+		fileSystem := FileSystem{}
+		tracker := NewLocalConfigFileTracker(newMemoryDoguConfig(), fileSystem)
+		mount := SrcAndDestination{Src: src, Dest: dest, Certificates: CertificatesTruststore, Truststore: Truststore{Base: base, BasePassword: "changeit", PasswordKey: "truststore_password"}}
+
+		// when
+		sut := NewVolumeMountCopier(fileSystem, tracker, Options{DoguConfig: doguConfig})
+		err = sut.CopyVolumeMount([]SrcAndDestination{mount})
+
+		// then
+		require.NoError(t, err)
+		content, err := os.ReadFile(dest)
+		require.NoError(t, err)
+		certs, err := pkcs12.DecodeTrustStore(content, "secret")
+		require.NoError(t, err)
+		require.Len(t, certs, 2)
+		assert.Equal(t, jdk.Raw, certs[0].Raw)
+		assert.Equal(t, internal.Raw, certs[1].Raw)
+		assert.Equal(t, 1, sut.summary.copied)
+
+		// when
+		sut = NewVolumeMountCopier(fileSystem, tracker, Options{DoguConfig: doguConfig})
+		err = sut.CopyVolumeMount([]SrcAndDestination{mount})
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, 1, sut.summary.unchanged)
+		unchanged, err := os.ReadFile(dest)
+		require.NoError(t, err)
+		assert.Equal(t, content, unchanged)
+	})
+
+	t.Run("should add certificates to the original jks truststore and restore it on cleanup", func(t *testing.T) {
+		// given
+		src := t.TempDir()
+		dest := filepath.Join(t.TempDir(), "cacerts")
+		passwordFile := filepath.Join(t.TempDir(), "password")
+		writeTestFile(t, passwordFile, "secret\n")
+		shipped := newTestCertificate(t, pkix.Name{CommonName: "Shipped CA"})
+		added := newTestCertificate(t, pkix.Name{CommonName: "Added CA"})
+		original, err := encodeJKS([]truststoreEntry{{alias: "shipped", cert: shipped}}, "secret")
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(dest, original, 0644))
+		writeTestFile(t, filepath.Join(src, "corp", "added.pem"), string(encodeCertificate(added)))
+		fileSystem := FileSystem{}
+		tracker := NewLocalConfigFileTracker(newMemoryDoguConfig(), fileSystem)
+		mount := SrcAndDestination{Src: src, Dest: dest, Certificates: CertificatesTruststore, Truststore: Truststore{Format: TruststoreJKS, Base: dest, PasswordFile: passwordFile}}
+
+		for i := 0; i < 2; i++ {
+			// when
+			err = NewVolumeMountCopier(fileSystem, tracker, Options{}).CopyVolumeMount([]SrcAndDestination{mount})
+
+			// then
+			require.NoError(t, err)
+			content, err := os.ReadFile(dest)
+			require.NoError(t, err)
+			entries, err := decodeJKS(content, "secret")
+			require.NoError(t, err)
+			assert.Equal(t, []truststoreEntry{{alias: "shipped", cert: shipped}, {alias: "corp-added", cert: added}}, entries)
+		}
+
+		// when
+		err = tracker.DeleteAllTrackedFiles()
+
+		// then
+		require.NoError(t, err)
+		content, err := os.ReadFile(dest)
+		require.NoError(t, err)
+		assert.Equal(t, original, content)
+	})
+
+	t.Run("should return error on different file modes", func(t *testing.T) {
+		// given
+		src := t.TempDir()
+		dest := filepath.Join(t.TempDir(), "truststore.p12")
+		passwordFile := filepath.Join(t.TempDir(), "password")
+		writeTestFile(t, passwordFile, "secret")
+		writeTestFile(t, filepath.Join(src, "ca.crt"), string(encodeCertificate(newTestCertificate(t, pkix.Name{CommonName: "Test CA"}))))
+		fileSystem := FileSystem{}
+		fileMode := os.FileMode(0600)
+		otherFileMode := os.FileMode(0644)
+		truststore := Truststore{PasswordFile: passwordFile}
+		mounts := []SrcAndDestination{
+			{Src: src, Dest: dest, Certificates: CertificatesTruststore, Truststore: truststore, FileMode: &fileMode},
+			{Src: src, Dest: dest, Certificates: CertificatesTruststore, Truststore: truststore, FileMode: &otherFileMode},
+		}
+
+		// when
+		err := NewVolumeMountCopier(fileSystem, NewLocalConfigFileTracker(newMemoryDoguConfig(), fileSystem), Options{}).CopyVolumeMount(mounts)
+
+		// then
+		assert.ErrorContains(t, err, "failed to install certificates to "+dest+": mounts of truststore "+dest+" define different file modes")
+		assert.NoFileExists(t, dest)
+	})
+
+	t.Run("should return error without password", func(t *testing.T) {
+		// given
+		src := t.TempDir()
+		dest := filepath.Join(t.TempDir(), "truststore.p12")
+		fileSystem := FileSystem{}
+		mount := SrcAndDestination{Src: src, Dest: dest, Certificates: CertificatesTruststore}
+
+		// when
+		err := NewVolumeMountCopier(fileSystem, NewLocalConfigFileTracker(newMemoryDoguConfig(), fileSystem), Options{}).CopyVolumeMount([]SrcAndDestination{mount})
+
+		// then
+		assert.ErrorContains(t, err, "failed to install certificates to "+dest+": no password file or password key is configured for the truststore")
+		assert.NoFileExists(t, dest)
+	})
+}
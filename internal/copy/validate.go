@@ -0,0 +1,276 @@
+package copy
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"time"
+)
+
+// ValidationPolicy defines how the certificates and keys of a mount are validated before anything is copied.
+type ValidationPolicy string
+
+const (
+	// ValidationReport logs invalid certificates and keys but copies them nevertheless.
+	ValidationReport ValidationPolicy = "report"
+	// ValidationEnforce refuses to copy anything if a certificate or key is invalid.
+	ValidationEnforce ValidationPolicy = "enforce"
+)
+
+// ErrValidationFailed is returned if the certificates or keys of a mount with ValidationEnforce are invalid.
+// Nothing is copied in this case.
+var ErrValidationFailed = errors.New("validation of certificates failed")
+
+// ParseValidationPolicy returns the validation policy with the given name.
+func ParseValidationPolicy(name string) (ValidationPolicy, error) {
+	policy := ValidationPolicy(name)
+	switch policy {
+	case ValidationReport, ValidationEnforce:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown validation policy %q, expected one of %s, %s", name, ValidationReport, ValidationEnforce)
+	}
+}
+
+// certificateExpiry is the expiry of a validated certificate reported in the run summary.
+type certificateExpiry struct {
+	subject  string
+	filePath string
+	notAfter time.Time
+}
+
+// pemFile contains the certificates and private keys of a source file.
+type pemFile struct {
+	filePath string
+	certs    []*x509.Certificate
+	keys     []crypto.Signer
+}
+
+// validateMounts validates the certificates and keys of all mounts with enabled validation before anything is copied.
+// It returns the expiries of the validated certificates and an error wrapping ErrValidationFailed if a mount with
+// ValidationEnforce contains invalid certificates or keys. Problems of mounts with ValidationReport are only logged.
+func (v *VolumeMountCopier) validateMounts(srcToDest []SrcAndDestination) ([]certificateExpiry, error) {
+	var expiries []certificateExpiry
+	var multiErr []error
+	now := time.Now()
+	for _, mount := range srcToDest {
+		if mount.ValidateCertificates == "" {
+			continue
+		}
+
+		files, err := v.readPEMFiles(mount)
+		if err != nil {
+			multiErr = append(multiErr, fmt.Errorf("failed to validate certificates of source %s: %w", mount.Src, err))
+			continue
+		}
+
+		for _, file := range files {
+			for _, cert := range file.certs {
+				expiries = append(expiries, certificateExpiry{subject: cert.Subject.String(), filePath: file.filePath, notAfter: cert.NotAfter})
+			}
+		}
+
+		err = validatePEMFiles(files, now)
+		if err == nil {
+			log.Printf("Validated certificates and keys of source %s", mount.Src)
+			continue
+		}
+
+		if mount.ValidateCertificates == ValidationReport {
+			log.Printf("validation of certificates of source %s failed: %s", mount.Src, err)
+			continue
+		}
+
+		multiErr = append(multiErr, fmt.Errorf("%w: %w", ErrValidationFailed, err))
+	}
+
+	return expiries, errors.Join(multiErr...)
+}
+
+// readPEMFiles parses the certificates and private keys of the files which would be copied from the source.
+// Dereferenced symlinks are read with the content of their targets. Files without certificates and keys are skipped.
+// Encrypted private keys cannot be validated and are skipped. Templates and archives are read as they are.
+func (v *VolumeMountCopier) readPEMFiles(mount SrcAndDestination) ([]pemFile, error) {
+	files, err := v.getSourceFiles(mount.Src, mount.sourceSymlinkPolicy())
+	if err != nil {
+		return nil, err
+	}
+
+	var pemFiles []pemFile
+	for _, rel := range slices.Sorted(maps.Keys(files)) {
+		if !mount.isCandidate(rel) {
+			continue
+		}
+
+		content, err := readFile(files[rel], v.fileSystem)
+		if err != nil {
+			return nil, err
+		}
+
+		file, err := parsePEMFile(files[rel], content.Bytes())
+		if err != nil {
+			return nil, err
+		}
+
+		if len(file.certs) > 0 || len(file.keys) > 0 {
+			pemFiles = append(pemFiles, file)
+		}
+	}
+
+	return pemFiles, nil
+}
+
+func parsePEMFile(filePath string, content []byte) (pemFile, error) {
+	file := pemFile{filePath: filePath}
+	for {
+		var block *pem.Block
+		block, content = pem.Decode(content)
+		if block == nil {
+			return file, nil
+		}
+
+		var key any
+		var err error
+		switch block.Type {
+		case pemCertificateType:
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return pemFile{}, fmt.Errorf("failed to parse certificate of %s: %w", filePath, err)
+			}
+
+			file.certs = append(file.certs, cert)
+			continue
+		case "PRIVATE KEY":
+			key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+		case "RSA PRIVATE KEY":
+			key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+		case "EC PRIVATE KEY":
+			key, err = x509.ParseECPrivateKey(block.Bytes)
+		case "ENCRYPTED PRIVATE KEY":
+			log.Printf("skip encrypted private key of %s", filePath)
+			continue
+		default:
+			continue
+		}
+
+		if err != nil {
+			return pemFile{}, fmt.Errorf("failed to parse private key of %s: %w", filePath, err)
+		}
+
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return pemFile{}, fmt.Errorf("unsupported private key type %T of %s", key, filePath)
+		}
+
+		file.keys = append(file.keys, signer)
+	}
+}
+
+// validatePEMFiles checks the validity period of every certificate, that every private key belongs to a certificate
+// and that the certificates form valid chains.
+func validatePEMFiles(files []pemFile, now time.Time) error {
+	var allCerts []*x509.Certificate
+	for _, file := range files {
+		allCerts = append(allCerts, file.certs...)
+	}
+
+	var multiErr []error
+	for _, file := range files {
+		for _, cert := range file.certs {
+			multiErr = append(multiErr, validatePeriod(cert, file.filePath, now))
+		}
+
+		for _, key := range file.keys {
+			multiErr = append(multiErr, validateKeyPair(key, file, allCerts))
+		}
+
+		multiErr = append(multiErr, validateChain(file, allCerts))
+	}
+
+	return errors.Join(multiErr...)
+}
+
+func validatePeriod(cert *x509.Certificate, filePath string, now time.Time) error {
+	if now.Before(cert.NotBefore) {
+		return fmt.Errorf("certificate %q of %s is not valid before %s", cert.Subject, filePath, cert.NotBefore.Format(time.RFC3339))
+	}
+
+	if now.After(cert.NotAfter) {
+		return fmt.Errorf("certificate %q of %s expired at %s", cert.Subject, filePath, cert.NotAfter.Format(time.RFC3339))
+	}
+
+	return nil
+}
+
+// validateKeyPair checks that the private key belongs to a certificate of the same file or, if the file contains no
+// certificates, to a certificate of the source. Keys of sources without certificates are not checked.
+func validateKeyPair(key crypto.Signer, file pemFile, allCerts []*x509.Certificate) error {
+	certs := file.certs
+	if len(certs) == 0 {
+		certs = allCerts
+	}
+
+	if len(certs) == 0 {
+		return nil
+	}
+
+	publicKey, ok := key.Public().(interface{ Equal(crypto.PublicKey) bool })
+	if !ok {
+		return fmt.Errorf("unsupported public key type %T of %s", key.Public(), file.filePath)
+	}
+
+	for _, cert := range certs {
+		if publicKey.Equal(cert.PublicKey) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("private key of %s does not match any certificate", file.filePath)
+}
+
+// validateChain checks the chain of a file starting with a leaf certificate. Every certificate has to be issued by
+// the following one. The last certificate has to be signed by one of the certificates of the source with the name of
+// its issuer, if there are any. Files starting with a CA certificate like bundles are not checked.
+func validateChain(file pemFile, allCerts []*x509.Certificate) error {
+	if len(file.certs) == 0 || file.certs[0].IsCA {
+		return nil
+	}
+
+	for i := 0; i+1 < len(file.certs); i++ {
+		cert, issuer := file.certs[i], file.certs[i+1]
+		if !bytes.Equal(cert.RawIssuer, issuer.RawSubject) || cert.CheckSignatureFrom(issuer) != nil {
+			return fmt.Errorf("broken chain in %s: certificate %q is not issued by the following certificate %q", file.filePath, cert.Subject, issuer.Subject)
+		}
+	}
+
+	last := file.certs[len(file.certs)-1]
+	if bytes.Equal(last.RawIssuer, last.RawSubject) {
+		return nil
+	}
+
+	var issuers []*x509.Certificate
+	for _, cert := range allCerts {
+		if bytes.Equal(cert.RawSubject, last.RawIssuer) {
+			issuers = append(issuers, cert)
+		}
+	}
+
+	if len(issuers) == 0 {
+		// The issuer is expected to be trusted by the system.
+		return nil
+	}
+
+	for _, issuer := range issuers {
+		if last.CheckSignatureFrom(issuer) == nil {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("broken chain in %s: certificate %q is not signed by any certificate of the source with the subject %q", file.filePath, last.Subject, last.Issuer)
+}
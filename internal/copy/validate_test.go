@@ -0,0 +1,213 @@
+package copy
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseValidationPolicy(t *testing.T) {
+	t.Run("should parse known policies", func(t *testing.T) {
+		for _, name := range []string{"report", "enforce"} {
+			policy, err := ParseValidationPolicy(name)
+
+			require.NoError(t, err)
+			assert.Equal(t, ValidationPolicy(name), policy)
+		}
+	})
+
+	t.Run("should return error on unknown policy", func(t *testing.T) {
+		_, err := ParseValidationPolicy("warn")
+
+		assert.ErrorContains(t, err, `unknown validation policy "warn"`)
+	})
+}
+
+type testIssuer struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// issueTestCertificate creates a certificate valid from notBefore to notAfter. It is self-signed if issuer is nil.
+func issueTestCertificate(t *testing.T, commonName string, isCA bool, notBefore, notAfter time.Time, issuer *testIssuer) testIssuer {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+	}
+	parent, parentKey := template, key
+	if issuer != nil {
+		parent, parentKey = issuer.cert, issuer.key
+	}
+
+	raw, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(raw)
+	require.NoError(t, err)
+
+	return testIssuer{cert: cert, key: key}
+}
+
+func encodeTestKey(t *testing.T, key *ecdsa.PrivateKey) string {
+	t.Helper()
+	raw, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: raw}))
+}
+
+func Test_validatePEMFiles(t *testing.T) {
+	now := time.Now()
+	valid := func(t *testing.T, commonName string, isCA bool, issuer *testIssuer) testIssuer {
+		return issueTestCertificate(t, commonName, isCA, now.Add(-time.Hour), now.Add(24*time.Hour), issuer)
+	}
+	root := valid(t, "Root CA", true, nil)
+	intermediate := valid(t, "Intermediate CA", true, &root)
+	leaf := valid(t, "app.example.com", false, &intermediate)
+	otherRoot := valid(t, "Root CA", true, nil)
+
+	t.Run("should accept valid chain with matching key in another file", func(t *testing.T) {
+		// given
+		files := []pemFile{
+			{filePath: "tls.crt", certs: []*x509.Certificate{leaf.cert, intermediate.cert}},
+			{filePath: "tls.key", keys: []crypto.Signer{leaf.key}},
+			{filePath: "ca.crt", certs: []*x509.Certificate{root.cert, otherRoot.cert}},
+		}
+
+		// when
+		err := validatePEMFiles(files, now)
+
+		// then
+		require.NoError(t, err)
+	})
+
+	t.Run("should return errors on invalid period", func(t *testing.T) {
+		// given
+		expired := issueTestCertificate(t, "expired", false, now.Add(-48*time.Hour), now.Add(-24*time.Hour), nil)
+		future := issueTestCertificate(t, "future", false, now.Add(24*time.Hour), now.Add(48*time.Hour), nil)
+		files := []pemFile{{filePath: "certs.pem", certs: []*x509.Certificate{expired.cert}}, {filePath: "future.pem", certs: []*x509.Certificate{future.cert}}}
+
+		// when
+		err := validatePEMFiles(files, now)
+
+		// then
+		assert.ErrorContains(t, err, `certificate "CN=expired" of certs.pem expired at`)
+		assert.ErrorContains(t, err, `certificate "CN=future" of future.pem is not valid before`)
+	})
+
+	t.Run("should return error on key of another certificate", func(t *testing.T) {
+		// given
+		files := []pemFile{{filePath: "tls.pem", certs: []*x509.Certificate{leaf.cert}, keys: []crypto.Signer{intermediate.key}}}
+
+		// when
+		err := validatePEMFiles(files, now)
+
+		// then
+		assert.ErrorContains(t, err, "private key of tls.pem does not match any certificate")
+	})
+
+	t.Run("should return error on chain in wrong order", func(t *testing.T) {
+		// given
+		files := []pemFile{{filePath: "tls.crt", certs: []*x509.Certificate{leaf.cert, root.cert, intermediate.cert}}}
+
+		// when
+		err := validatePEMFiles(files, now)
+
+		// then
+		assert.ErrorContains(t, err, `broken chain in tls.crt: certificate "CN=app.example.com" is not issued by the following certificate "CN=Root CA"`)
+	})
+
+	t.Run("should return error if the issuer of the source did not sign the chain", func(t *testing.T) {
+		// given
+		files := []pemFile{
+			{filePath: "tls.crt", certs: []*x509.Certificate{leaf.cert, intermediate.cert}},
+			{filePath: "ca.crt", certs: []*x509.Certificate{otherRoot.cert}},
+		}
+
+		// when
+		err := validatePEMFiles(files, now)
+
+		// then
+		assert.ErrorContains(t, err, `broken chain in tls.crt: certificate "CN=Intermediate CA" is not signed by any certificate of the source with the subject "CN=Root CA"`)
+	})
+}
+
+func TestVolumeMountCopier_CopyVolumeMount_validateCertificates(t *testing.T) {
+	now := time.Now()
+
+	t.Run("should copy nothing if an enforced validation fails", func(t *testing.T) {
+		// given
+		src := t.TempDir()
+		dest := t.TempDir()
+		expired := issueTestCertificate(t, "expired", false, now.Add(-48*time.Hour), now.Add(-24*time.Hour), nil)
+		writeTestFile(t, filepath.Join(src, "tls.crt"), string(encodeCertificate(expired.cert)))
+		writeTestFile(t, filepath.Join(src, "tls.key"), encodeTestKey(t, expired.key))
+		fileSystem := FileSystem{}
+		mount := SrcAndDestination{Src: src, Dest: dest, ValidateCertificates: ValidationEnforce}
+
+		// when
+		err := NewVolumeMountCopier(fileSystem, NewLocalConfigFileTracker(newMemoryDoguConfig(), fileSystem), Options{}).CopyVolumeMount([]SrcAndDestination{mount})
+
+		// then
+		require.ErrorIs(t, err, ErrValidationFailed)
+		assert.ErrorContains(t, err, `certificate "CN=expired" of `+filepath.Join(src, "tls.crt")+" expired at")
+		assert.NoFileExists(t, filepath.Join(dest, "tls.crt"))
+	})
+
+	t.Run("should copy and report the expiry if a reported validation fails", func(t *testing.T) {
+		// given
+		src := t.TempDir()
+		dest := t.TempDir()
+		cert := issueTestCertificate(t, "app", false, now.Add(-time.Hour), now.Add(10*24*time.Hour+time.Hour), nil)
+		other := issueTestCertificate(t, "other", false, now.Add(-time.Hour), now.Add(time.Hour), nil)
+		writeTestFile(t, filepath.Join(src, "tls.crt"), string(encodeCertificate(cert.cert)))
+		writeTestFile(t, filepath.Join(src, "tls.key"), encodeTestKey(t, other.key))
+		writeTestFile(t, filepath.Join(src, "README"), "no certificates")
+		fileSystem := FileSystem{}
+		mount := SrcAndDestination{Src: src, Dest: dest, ValidateCertificates: ValidationReport}
+
+		// when
+		sut := NewVolumeMountCopier(fileSystem, NewLocalConfigFileTracker(newMemoryDoguConfig(), fileSystem), Options{})
+		err := sut.CopyVolumeMount([]SrcAndDestination{mount})
+
+		// then
+		require.NoError(t, err)
+		assert.FileExists(t, filepath.Join(dest, "tls.key"))
+		assert.Equal(t, []certificateExpiry{{subject: "CN=app", filePath: filepath.Join(src, "tls.crt"), notAfter: cert.cert.NotAfter}}, sut.summary.expiries)
+	})
+	t.Run("should validate the targets of dereferenced symlinks", func(t *testing.T) {
+		// given
+		src := t.TempDir()
+		dest := t.TempDir()
+		expired := issueTestCertificate(t, "expired", false, now.Add(-48*time.Hour), now.Add(-24*time.Hour), nil)
+		writeTestFile(t, filepath.Join(src, "..data", "tls.crt"), string(encodeCertificate(expired.cert)))
+		require.NoError(t, os.Symlink("..data/tls.crt", filepath.Join(src, "tls.crt")))
+		fileSystem := FileSystem{}
+		mount := SrcAndDestination{Src: src, Dest: dest, ValidateCertificates: ValidationEnforce, Symlinks: SymlinkDereference}
+
+		// when
+		err := NewVolumeMountCopier(fileSystem, NewLocalConfigFileTracker(newMemoryDoguConfig(), fileSystem), Options{}).CopyVolumeMount([]SrcAndDestination{mount})
+
+		// then
+		require.ErrorIs(t, err, ErrValidationFailed)
+		assert.ErrorContains(t, err, `certificate "CN=expired" of `)
+		assert.NoFileExists(t, filepath.Join(dest, "tls.crt"))
+	})
+}
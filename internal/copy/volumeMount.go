@@ -14,35 +14,257 @@ import (
 type SrcAndDestination struct {
 	Src  string
 	Dest string
+	// Owner is the uid of the copied files and the created dirs. If nil, replaced files keep their owner if permitted
+	// and new files and dirs get the uid of the process.
+	Owner *int
+	// Group is the gid of the copied files and the created dirs. If nil, replaced files keep their group if permitted
+	// and new files and dirs get the gid of the process.
+	Group *int
+	// FileMode is the permission of the copied files. If nil, replaced files keep their permission and new files get the
+	// default permission of created files.
+	FileMode *os.FileMode
+	// DirMode is the permission of the created dirs. If nil, 0770 is used.
+	DirMode *os.FileMode
+	// Include contains doublestar glob patterns (e.g. `**/*.xml`) matched against the path relative to the source.
+	// If not empty, only matching files are copied.
+	Include []string
+	// Exclude contains doublestar glob patterns matched against the path relative to the source.
+	// Matching files are not copied even if they match an include pattern.
+	Exclude []string
+	// Symlinks defines how symlinks in the source are handled. If empty, SymlinkSkip is used.
+	Symlinks SymlinkPolicy
+	// Conflict defines how existing destination files are handled which were not copied by this application.
+	// If empty, ConflictOverwrite is used.
+	Conflict ConflictPolicy
+	// BackupSuffix is appended to the backups of existing files with ConflictBackup. If empty, DefaultBackupSuffix is used.
+	BackupSuffix string
+	// Templates enables rendering the source files with the TemplateRenderer of the Options.
+	Templates bool
+	// TemplateSuffix restricts the rendering to source files with this suffix, e.g. .tpl. The suffix is removed from
+	// the destination file name. If empty, all source files are rendered.
+	TemplateSuffix string
+	// Extract enables extracting archives (.tar, .tar.gz, .tgz, .tar.zst, .tzst, .zip) and decompressing single
+	// compressed files (.gz, .zst) into the destination instead of copying them.
+	Extract bool
+	// ExtractMaxSize limits the bytes written to the files extracted from one archive, i.e. their uncompressed size.
+	// If not positive, DefaultExtractMaxSize is used.
+	ExtractMaxSize int64
+	// Verify enables the verification of the source files against the checksum manifest in the root of the source
+	// before anything is copied. If empty, the source is not verified.
+	Verify VerifyPolicy
+	// Manifest is the name of the checksum manifest in the root of the source. It is not copied.
+	// If empty, DefaultManifest is used.
+	Manifest string
+	// Quota limits the files copied from the source.
+	Quota Quota
+	// Merge enables merging YAML, JSON, INI and properties files into existing destination files instead of replacing
+	// them. Files in other formats are copied.
+	Merge bool
+	// MergeLists defines how lists of merged YAML and JSON files are merged. If empty, ListReplace is used.
+	MergeLists ListMergeStrategy
+	// Assemble concatenates the regular files of the source and of all other assembled mounts with the same
+	// destination into the destination file instead of copying them one-to-one. Dest is the path of the file.
+	Assemble bool
+	// Priority orders the fragments of assembled mounts. Fragments of mounts with a lower priority come first.
+	// Fragments with the same priority are ordered lexically by their path relative to the source.
+	Priority int
+	// AssembleHeader is written at the beginning of the assembled file.
+	AssembleHeader string
+	// AssembleSeparator is written between the fragments of the assembled file.
+	AssembleSeparator string
+	// Certificates enables installing the PEM encoded certificates of the source and of all other certificate mounts
+	// with the same destination instead of copying the files. The certificates are deduplicated.
+	// If empty, the files are copied.
+	Certificates CertificateMode
+	// Truststore configures the truststore of mounts with CertificatesTruststore.
+	Truststore Truststore
+	// ValidateCertificates enables the validation of the PEM encoded certificates and private keys of the source
+	// before anything is copied. If empty, they are not validated.
+	ValidateCertificates ValidationPolicy
 }
 
-type Copier func(src, dest string, filesystem Filesystem) error
+type Copier func(src, dest string, filesystem Filesystem, attributes FileAttributes) error
+
+// Options configure the VolumeMountCopier for all volume mounts.
+type Options struct {
+	// PreserveMetadata enables FileAttributes.PreserveMetadata for every copied file.
+	PreserveMetadata bool
+	// Concurrency is the number of files copied in parallel. Values lower than 1 copy the files sequentially.
+	Concurrency int
+	// DryRun only logs the planned changes. The VolumeMountCopier has to be used with a DryRunFileSystem and a
+	// file tracker using a DryRunDoguConfig to make sure that nothing is modified.
+	DryRun bool
+	// TemplateRenderer renders the source files of mounts with enabled templates.
+	TemplateRenderer *TemplateRenderer
+	// Quota limits the files copied from all sources together.
+	Quota Quota
+	// DoguConfig provides the passwords of truststores.
+	DoguConfig ConfigReader
+	// OriginalsDir keeps the originals of files overwritten with ConflictOverwrite, so that they do not appear in the
+	// destination dirs. The absolute path of the destination file is mirrored below it. If empty, the originals are
+	// kept as hidden files next to the destination files.
+	OriginalsDir string
+}
 
 type fileTracker interface {
 	AddFile(path string) error
+	RemoveFile(path string) error
+	AddDir(path string) error
+	GetChecksum(path string) (FileChecksum, bool, error)
+	SetChecksum(path string, checksum FileChecksum) error
+	IsTracked(path string) (bool, error)
+	SetBackup(path, backupPath string) error
+	GetBackup(path string) (string, bool, error)
 }
 
 type VolumeMountCopier struct {
 	fileSystem  Filesystem
 	copier      Copier
 	fileTracker fileTracker
+	options     Options
+	summary     runSummary
+	// destinationLocks prevents parallel writes to the same destination file from overlapping mounts.
+	destinationLocks keyedMutex
 }
 
-func NewVolumeMountCopier(fileSystem Filesystem, fileTracker fileTracker) *VolumeMountCopier {
-	return &VolumeMountCopier{fileSystem, copyFile, fileTracker}
+// NewVolumeMountCopier creates a copier which tracks the copied files and the created dirs with the file tracker.
+func NewVolumeMountCopier(fileSystem Filesystem, fileTracker fileTracker, options Options) *VolumeMountCopier {
+	trackingFileSystem := dirTrackingFileSystem{Filesystem: fileSystem, fileTracker: fileTracker}
+	return &VolumeMountCopier{fileSystem: trackingFileSystem, copier: copyFile, fileTracker: fileTracker, options: options}
 }
 
 // CopyVolumeMount copies all files from the given src path in srcToDest parameter to the associate destination path.
 // It only handles regular files.
-// Existing files will be overwritten.
+// Existing files will be overwritten unless they already have the same content as the source file.
 // If the volume was mounted without the subPath attribute, it resolves the data symlink and copies the real files
 // from the mount. In such cases, it is possible that there are also subPath volume mounts in the directory.
 // Therefore, this method will walk through the dir behind the symlink and the root of the mount.
 // In the second run the symlinks will be ignored.
 // If only the subPath attribute was used, it just copies all regular files to the destination.
+// The files are copied in parallel according to the configured concurrency.
+// Sources with enabled verification are verified against their manifests first. If a verification with
+// VerifyEnforce fails, nothing is copied and an error wrapping ErrVerificationFailed is returned.
+// Then the certificates and keys of sources with enabled validation are validated. If a validation with
+// ValidationEnforce fails, nothing is copied and an error wrapping ErrValidationFailed is returned.
+// Afterward, the capacity of the destination filesystems is checked. If it is not sufficient, nothing is copied and an
+// error wrapping ErrPreflightFailed is returned. If the source files exceed a quota, nothing is copied and an error
+// wrapping ErrQuotaExceeded is returned.
+// Mounts with enabled assembly are not copied one-to-one but concatenated into their destination files.
+// The certificates of mounts with a certificate mode are installed into their destination bundles, dirs or truststores.
 func (v *VolumeMountCopier) CopyVolumeMount(srcToDest []SrcAndDestination) error {
+	err := v.verifyMounts(srcToDest)
+	if err != nil {
+		return err
+	}
+
+	expiries, err := v.validateMounts(srcToDest)
+	if err != nil {
+		return err
+	}
+
+	err = v.checkCapacity(srcToDest)
+	if err != nil {
+		return err
+	}
+
+	err = v.checkQuotas(srcToDest)
+	if err != nil {
+		return err
+	}
+
+	v.summary = runSummary{dryRun: v.options.DryRun, expiries: expiries}
+	defer v.summary.log()
+	cleanupErr := v.removeStaleTempFiles(srcToDest)
+
+	pool := newWorkerPool(v.options.Concurrency)
+	mounts, assemblies := splitAssemblies(srcToDest)
+	mounts, certificateGroups := splitCertificates(mounts)
+	err = v.walkVolumeMounts(mounts, pool)
+	assembleErr := v.assembleFiles(assemblies, pool)
+	certificateErr := v.installCertificates(certificateGroups, pool)
+
+	return errors.Join(cleanupErr, err, assembleErr, certificateErr, pool.wait())
+}
+
+// removeStaleTempFiles removes the temporary files which were left behind in the destinations by an interrupted run.
+// If the destination of a mount is a file, only the dir containing it is searched. Temporary files of previous
+// versions are only removed if their destination file is tracked because their names do not contain a random number.
+func (v *VolumeMountCopier) removeStaleTempFiles(srcToDest []SrcAndDestination) error {
 	var multiErr []error
+	searched := map[string]bool{}
+	for _, mount := range srcToDest {
+		root := path.Clean(mount.Dest)
+		fileInfo, err := v.fileSystem.Lstat(root)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+
+		if err != nil {
+			multiErr = append(multiErr, fmt.Errorf("failed to get file info of destination %s: %w", root, err))
+			continue
+		}
 
+		recursive := fileInfo.IsDir()
+		if !recursive {
+			root = path.Dir(root)
+		}
+
+		if searched[root] {
+			continue
+		}
+		searched[root] = true
+
+		err = v.fileSystem.WalkDir(root, func(filePath string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if d.IsDir() {
+				if filePath != root && !recursive {
+					return fs.SkipDir
+				}
+
+				return nil
+			}
+
+			stale, err := v.isStaleTempFile(filePath)
+			if err != nil || !stale {
+				return err
+			}
+
+			log.Printf("Remove stale temporary file %s", filePath)
+			return v.fileSystem.DeleteFile(filePath)
+		})
+		if err != nil {
+			multiErr = append(multiErr, fmt.Errorf("failed to remove stale temporary files in %s: %w", root, err))
+		}
+	}
+
+	return errors.Join(multiErr...)
+}
+
+func (v *VolumeMountCopier) isStaleTempFile(filePath string) (bool, error) {
+	dir, name := path.Split(filePath)
+	if tempFilePattern.MatchString(name) {
+		return true, nil
+	}
+
+	match := legacyTempFilePattern.FindStringSubmatch(name)
+	if match == nil {
+		return false, nil
+	}
+
+	tracked, err := v.fileTracker.IsTracked(path.Join(dir, match[1]))
+	if err != nil {
+		return false, fmt.Errorf("failed to check if destination file of %s is tracked: %w", filePath, err)
+	}
+
+	return tracked, nil
+}
+
+// walkVolumeMounts walks through all sources and submits every file to the pool.
+func (v *VolumeMountCopier) walkVolumeMounts(srcToDest []SrcAndDestination, pool *workerPool) error {
+	var multiErr []error
 	for _, obj := range srcToDest {
 		src := obj.Src
 		dest := obj.Dest
@@ -61,16 +283,20 @@ func (v *VolumeMountCopier) CopyVolumeMount(srcToDest []SrcAndDestination) error
 				return fmt.Errorf("failed to resolve data dir symlink %s: %w", data, err)
 			}
 
-			multiErr = append(multiErr, v.walkDir(realDir, dest, false))
+			multiErr = append(multiErr, v.walkDir(obj, realDir, false, pool))
+
+			// The symlinks in the root of the mount point to the files in the data dir which are already copied.
+			obj.Symlinks = SymlinkSkip
 		}
 
 		// Copy all files mounted as subpaths
-		multiErr = append(multiErr, v.walkDir(src, dest, true))
+		multiErr = append(multiErr, v.walkDir(obj, src, true, pool))
 	}
 	return errors.Join(multiErr...)
 }
 
-func (v *VolumeMountCopier) walkDir(src, dest string, copySubPathMounts bool) error {
+// walkDir submits all files of the dir to the pool.
+func (v *VolumeMountCopier) walkDir(mount SrcAndDestination, src string, copySubPathMounts bool, pool *workerPool) error {
 	var multiErr []error
 
 	err := v.fileSystem.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
@@ -84,7 +310,15 @@ func (v *VolumeMountCopier) walkDir(src, dest string, copySubPathMounts bool) er
 			return fs.SkipDir
 		}
 
-		multiErr = append(multiErr, v.walk(src, dest, path, copySubPathMounts, d))
+		pool.submit(func() error {
+			walkErr := v.walk(mount, src, path, d)
+			if walkErr != nil {
+				v.summary.addFailed()
+			}
+
+			return walkErr
+		})
+
 		return nil
 	})
 
@@ -96,11 +330,11 @@ func (v *VolumeMountCopier) walkDir(src, dest string, copySubPathMounts bool) er
 }
 
 // walk will be executed on every path in src by [CopyVolumeMount].
-// It only copies regular files and if symLinkChain is not empty it will remove this path from the base path.
-// This is needed in volumeMounts from configmaps and secrets without the subPath attributes. In this case
-// the files are behind symlinks and the resolved folder is used as source. This path from src to the resolved folder
-// should not be copied to the destination.
-func (v *VolumeMountCopier) walk(srcVolume, destVolume, filePath string, isSubPathMount bool, d fs.DirEntry) error {
+// It only copies regular files and handles symlinks according to the symlink policy of the mount.
+// The destination path is the path of the file relative to srcVolume. For volumeMounts from configmaps and secrets
+// without the subPath attributes, srcVolume is the resolved data dir. This way the path from src to the resolved
+// folder is not copied to the destination while nested dirs, e.g. from items with a path like sub/dir/file, are kept.
+func (v *VolumeMountCopier) walk(mount SrcAndDestination, srcVolume, filePath string, d fs.DirEntry) error {
 	log.Printf("Processing file %s", filePath)
 	if d.IsDir() {
 		log.Printf("Skip dir %s", filePath)
@@ -112,26 +346,59 @@ func (v *VolumeMountCopier) walk(srcVolume, destVolume, filePath string, isSubPa
 		return err
 	}
 
-	if !sourceFileInfo.Mode().IsRegular() {
+	isSymlink := sourceFileInfo.Mode()&os.ModeSymlink != 0
+	if isSymlink && mount.symlinkPolicy() == SymlinkSkip {
+		log.Printf("skip source file %s because it is a symlink", filePath)
+		return nil
+	}
+
+	if !isSymlink && !sourceFileInfo.Mode().IsRegular() {
 		log.Printf("skip source file %s because it is not a regular file", filePath)
 		return nil
 	}
 
-	var rel string
-	if isSubPathMount {
-		rel, err = filepath.Rel(srcVolume, filePath)
-		if err != nil {
-			return fmt.Errorf("can't get the relative path of the source file %s and the source volume %s: %w", filePath, srcVolume, err)
+	rel, err := filepath.Rel(srcVolume, filePath)
+	if err != nil {
+		return fmt.Errorf("can't get the relative path of the source file %s and the source volume %s: %w", filePath, srcVolume, err)
+	}
+	rel = filepath.ToSlash(rel)
+
+	if mount.isManifest(rel) {
+		log.Printf("skip source file %s because it is the manifest of the source", filePath)
+		return nil
+	}
+
+	if isSymlink {
+		return v.walkSymlink(mount, srcVolume, filePath, rel, nil)
+	}
+
+	return v.copyRegularFile(mount, filePath, sourceFileInfo, rel)
+}
+
+// copyRegularFile copies the regular source file to the path relative to the destination of the mount unless it is
+// filtered or the destination file already has the same content. Archives of mounts with enabled extraction are
+// extracted instead.
+func (v *VolumeMountCopier) copyRegularFile(mount SrcAndDestination, filePath string, sourceFileInfo os.FileInfo, rel string) error {
+	if mount.Extract {
+		// The filters apply to the extracted files and not to the archive.
+		if format, suffix := getArchiveFormat(rel); format != formatNone {
+			return v.extractArchive(mount, filePath, sourceFileInfo, rel, format, suffix)
 		}
-	} else {
-		// There can't be nested folders in the mount. Just use the file name from example /mount/..20250504/filename
-		// to determine destination path.
-		_, rel = path.Split(filePath)
 	}
 
-	destinationFilePath := path.Join(destVolume, rel)
+	if !mount.isIncluded(rel) {
+		log.Printf("skip source file %s because it does not match the include and exclude patterns", filePath)
+		v.summary.addFiltered()
+		return nil
+	}
+
+	destinationFilePath := path.Join(mount.Dest, mount.destinationRel(rel))
+	unlock := v.destinationLocks.lock(destinationFilePath)
+	defer unlock()
+
 	destFileInfo, err := v.fileSystem.Stat(destinationFilePath)
-	if err == nil {
+	destExists := err == nil
+	if destExists {
 		if !destFileInfo.Mode().IsRegular() {
 			return fmt.Errorf("destination file %s exists and is not a regular file", destinationFilePath)
 		}
@@ -140,13 +407,116 @@ func (v *VolumeMountCopier) walk(srcVolume, destVolume, filePath string, isSubPa
 			log.Printf("source file %s and destination file %s are equal", filePath, destinationFilePath)
 			return nil
 		}
+
+		conflict, err := v.isConflict(destinationFilePath)
+		if err != nil {
+			return err
+		}
+
+		if conflict && mount.conflictPolicy() != ConflictOverwrite {
+			return v.resolveConflictAndWrite(mount, filePath, destinationFilePath)
+		}
+
+		// Templates are rendered on every run because the config values may have changed.
+		// Merged files differ from their source, so they are merged on every run as well and are only written if the
+		// merged content changed.
+		unchanged := false
+		if !mount.isTemplate(filePath) && !mount.isMerge(destinationFilePath) {
+			unchanged, err = v.isUnchanged(filePath, sourceFileInfo, destinationFilePath, destFileInfo)
+			if err != nil {
+				return fmt.Errorf("failed to compare source file %s with destination file %s: %w", filePath, destinationFilePath, err)
+			}
+		}
+
+		if unchanged && conflict {
+			// The file was not copied before and is not tracked, so that it is not removed on cleanup.
+			log.Printf("skip source file %s because the existing destination file %s has the same content", filePath, destinationFilePath)
+			v.summary.addUnchanged()
+			return nil
+		}
+
+		if unchanged {
+			log.Printf("skip source file %s because destination file %s has the same content", filePath, destinationFilePath)
+			v.summary.addUnchanged()
+			err = v.updateFileAttributes(v.getFileAttributes(mount), filePath, sourceFileInfo, destinationFilePath, destFileInfo)
+			if err != nil {
+				return err
+			}
+
+			// Track the file nevertheless, so that it is not removed as stale file.
+			return v.fileTracker.AddFile(destinationFilePath)
+		}
+
+		if conflict {
+			return v.resolveConflictAndWrite(mount, filePath, destinationFilePath)
+		}
+	}
+
+	return v.writeFile(mount, filePath, destinationFilePath, destExists)
+}
+
+// resolveConflictAndWrite handles the existing destination file according to the conflict policy of the mount and
+// overwrites it with the source file if the policy allows it.
+func (v *VolumeMountCopier) resolveConflictAndWrite(mount SrcAndDestination, filePath, destinationFilePath string) error {
+	write, err := v.resolveConflict(mount, filePath, destinationFilePath)
+	if err != nil || !write {
+		return err
+	}
+
+	return v.writeFile(mount, filePath, destinationFilePath, true)
+}
+
+// writeFile copies the source file to the destination and tracks it.
+func (v *VolumeMountCopier) writeFile(mount SrcAndDestination, filePath, destinationFilePath string, destExists bool) error {
+	if mount.isTemplate(filePath) && v.options.TemplateRenderer == nil {
+		return fmt.Errorf("failed to render template %s because no template renderer is configured", filePath)
+	}
+
+	if v.options.DryRun {
+		if mount.isTemplate(filePath) {
+			// The template is rendered without writing the result to report errors, e.g. missing config keys.
+			_, err := v.options.TemplateRenderer.render(filePath, v.fileSystem)
+			if err != nil {
+				return err
+			}
+		}
+
+		if mount.isMerge(destinationFilePath) {
+			log.Printf("Dry run: would merge file %s into %s", filePath, destinationFilePath)
+		} else if destExists {
+			log.Printf("Dry run: would overwrite file %s with different content from %s", destinationFilePath, filePath)
+		} else {
+			log.Printf("Dry run: would create file %s from %s", destinationFilePath, filePath)
+		}
+
+		v.summary.addCopied()
+		return v.fileTracker.AddFile(destinationFilePath)
+	}
+
+	attributes := v.getFileAttributes(mount)
+	written := true
+	var err error
+	if mount.isMerge(destinationFilePath) {
+		written, err = v.mergeFile(mount, filePath, destinationFilePath, attributes)
+	} else {
+		copier := v.copier
+		if mount.isTemplate(filePath) {
+			copier = v.options.TemplateRenderer.renderFile
+		}
+
+		err = copier(filePath, destinationFilePath, v.fileSystem, attributes)
 	}
 
-	err = v.copier(filePath, destinationFilePath, v.fileSystem)
 	if err != nil {
 		return err
 	}
 
+	if written {
+		v.summary.addCopied()
+	} else {
+		v.summary.addUnchanged()
+	}
+
 	err = v.fileTracker.AddFile(destinationFilePath)
 	if err != nil {
 		return err
@@ -155,6 +525,38 @@ func (v *VolumeMountCopier) walk(srcVolume, destVolume, filePath string, isSubPa
 	return nil
 }
 
+// updateFileAttributes applies the metadata defined by the attributes to the unchanged destination file if it differs,
+// e.g. because the owner or the file mode of the mount changed since the file was copied.
+func (v *VolumeMountCopier) updateFileAttributes(attributes FileAttributes, filePath string, sourceFileInfo os.FileInfo, destinationFilePath string, destFileInfo os.FileInfo) error {
+	if hasFileAttributes(sourceFileInfo, destFileInfo, attributes) {
+		return nil
+	}
+
+	if v.options.DryRun {
+		log.Printf("Dry run: would update metadata of file %s", destinationFilePath)
+		return nil
+	}
+
+	err := applyFileAttributes(filePath, destinationFilePath, attributes, v.fileSystem)
+	if err != nil {
+		return fmt.Errorf("failed to update metadata of file %s: %w", destinationFilePath, err)
+	}
+
+	log.Printf("Updated metadata of file %s", destinationFilePath)
+
+	return nil
+}
+
+func (v *VolumeMountCopier) getFileAttributes(mount SrcAndDestination) FileAttributes {
+	return FileAttributes{
+		PreserveMetadata: v.options.PreserveMetadata,
+		Owner:            mount.Owner,
+		Group:            mount.Group,
+		FileMode:         mount.FileMode,
+		DirMode:          mount.DirMode,
+	}
+}
+
 // resolveDataSymlink follows the symlink and returns the path from the real file and the relative to the dir of the symlink
 func (v *VolumeMountCopier) resolveDataSymlink(symlink string) (string, error) {
 	resolvedDataLink, err := v.fileSystem.EvalSymlinks(symlink)
@@ -1,11 +1,14 @@
 package copy
 
 import (
+	"fmt"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 	"io/fs"
 	"os"
+	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 )
@@ -40,6 +43,9 @@ func TestVolumeMountCopier_CopyVolumeMount(t *testing.T) {
 		fileSystemMock.EXPECT().Lstat("/mount/..data").Return(dataFileInfo, nil)
 		fileSystemMock.EXPECT().EvalSymlinks("/mount/..data").Return("", assert.AnError)
 
+		fileSystemMock.EXPECT().Stat("/custom/config").Return(myFileInfo{isDir: true}, nil)
+		fileSystemMock.EXPECT().Statfs("/custom/config").Return(FilesystemStats{AvailableBytes: 1 << 30}, nil)
+
 		sut.fileSystem = fileSystemMock
 
 		// when
@@ -63,6 +69,11 @@ func TestVolumeMountCopier_CopyVolumeMount(t *testing.T) {
 		fileSystemMock.EXPECT().Lstat("/mount/..data").Return(nil, assert.AnError)
 		fileSystemMock.EXPECT().WalkDir("/mount", mock.AnythingOfType("fs.WalkDirFunc")).Return(nil)
 
+		fileSystemMock.EXPECT().Stat("/custom/config").Return(myFileInfo{isDir: true}, nil)
+		fileSystemMock.EXPECT().Statfs("/custom/config").Return(FilesystemStats{AvailableBytes: 1 << 30}, nil)
+		fileSystemMock.EXPECT().Lstat("/custom/config").Return(myFileInfo{isDir: true}, nil)
+		fileSystemMock.EXPECT().WalkDir("/custom/config", mock.AnythingOfType("fs.WalkDirFunc")).Return(nil)
+
 		sut.fileSystem = fileSystemMock
 
 		// when
@@ -100,6 +111,11 @@ func TestVolumeMountCopier_CopyVolumeMount(t *testing.T) {
 		fileSystemMock.EXPECT().WalkDir(realDirPath, mock.AnythingOfType("fs.WalkDirFunc")).Return(nil)
 		fileSystemMock.EXPECT().WalkDir("/mount", mock.AnythingOfType("fs.WalkDirFunc")).Return(nil)
 
+		fileSystemMock.EXPECT().Stat("/custom/config").Return(myFileInfo{isDir: true}, nil)
+		fileSystemMock.EXPECT().Statfs("/custom/config").Return(FilesystemStats{AvailableBytes: 1 << 30}, nil)
+		fileSystemMock.EXPECT().Lstat("/custom/config").Return(myFileInfo{isDir: true}, nil)
+		fileSystemMock.EXPECT().WalkDir("/custom/config", mock.AnythingOfType("fs.WalkDirFunc")).Return(nil)
+
 		sut.fileSystem = fileSystemMock
 
 		// when
@@ -110,6 +126,131 @@ func TestVolumeMountCopier_CopyVolumeMount(t *testing.T) {
 	})
 }
 
+func TestVolumeMountCopier_CopyVolumeMount_fileSystem(t *testing.T) {
+	t.Run("should copy files in parallel and skip unchanged files in the next run", func(t *testing.T) {
+		// given
+		src := t.TempDir()
+		dest := t.TempDir()
+		for i := 0; i < 50; i++ {
+			writeTestFile(t, filepath.Join(src, fmt.Sprintf("dir%d", i%5), fmt.Sprintf("file%d", i)), fmt.Sprintf("content %d", i))
+		}
+
+		doguConfig := newMemoryDoguConfig()
+		fileSystem := FileSystem{}
+		sut := NewVolumeMountCopier(fileSystem, NewLocalConfigFileTracker(doguConfig, fileSystem), Options{Concurrency: 4})
+
+		// when
+		err := sut.CopyVolumeMount([]SrcAndDestination{{Src: src, Dest: dest}})
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, 50, sut.summary.copied)
+		for i := 0; i < 50; i++ {
+			content, readErr := os.ReadFile(filepath.Join(dest, fmt.Sprintf("dir%d", i%5), fmt.Sprintf("file%d", i)))
+			require.NoError(t, readErr)
+			assert.Equal(t, fmt.Sprintf("content %d", i), string(content))
+		}
+		tracked, err := NewLocalConfigFileTracker(doguConfig, fileSystem).getAdditionalMounts()
+		require.NoError(t, err)
+		assert.Len(t, tracked, 50)
+
+		// when
+		sut = NewVolumeMountCopier(fileSystem, NewLocalConfigFileTracker(doguConfig, fileSystem), Options{Concurrency: 4})
+		err = sut.CopyVolumeMount([]SrcAndDestination{{Src: src, Dest: dest}})
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, 0, sut.summary.copied)
+		assert.Equal(t, 50, sut.summary.unchanged)
+	})
+
+	t.Run("should apply a changed file mode to unchanged files", func(t *testing.T) {
+		// given
+		src := t.TempDir()
+		dest := t.TempDir()
+		writeTestFile(t, filepath.Join(src, "config.yaml"), "content")
+		doguConfig := newMemoryDoguConfig()
+		fileSystem := FileSystem{}
+		oldMode, newMode := os.FileMode(0640), os.FileMode(0600)
+		sut := NewVolumeMountCopier(fileSystem, NewLocalConfigFileTracker(doguConfig, fileSystem), Options{})
+		require.NoError(t, sut.CopyVolumeMount([]SrcAndDestination{{Src: src, Dest: dest, FileMode: &oldMode}}))
+
+		// when
+		sut = NewVolumeMountCopier(fileSystem, NewLocalConfigFileTracker(doguConfig, fileSystem), Options{})
+		err := sut.CopyVolumeMount([]SrcAndDestination{{Src: src, Dest: dest, FileMode: &newMode}})
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, 1, sut.summary.unchanged)
+		fileInfo, err := os.Stat(filepath.Join(dest, "config.yaml"))
+		require.NoError(t, err)
+		assert.Equal(t, newMode, fileInfo.Mode().Perm())
+	})
+
+	t.Run("should remove stale temporary files and keep the mode of replaced files", func(t *testing.T) {
+		// given
+		src := t.TempDir()
+		dest := t.TempDir()
+		writeTestFile(t, filepath.Join(src, "tracked"), "new")
+		writeTestFile(t, filepath.Join(dest, "tracked"), "old")
+		require.NoError(t, os.Chmod(filepath.Join(dest, "tracked"), 0600))
+		writeTestFile(t, filepath.Join(dest, "sub", ".tracked.3840512.tmp"), "stale")
+		writeTestFile(t, filepath.Join(dest, ".tracked.tmp"), "stale from a previous version")
+		writeTestFile(t, filepath.Join(dest, ".other.tmp"), "not ours")
+
+		doguConfig := newMemoryDoguConfig()
+		fileSystem := FileSystem{}
+		tracker := NewLocalConfigFileTracker(doguConfig, fileSystem)
+		require.NoError(t, tracker.AddFile(filepath.Join(dest, "tracked")))
+		sut := NewVolumeMountCopier(fileSystem, tracker, Options{})
+
+		// when
+		err := sut.CopyVolumeMount([]SrcAndDestination{{Src: src, Dest: dest}})
+
+		// then
+		require.NoError(t, err)
+		assert.NoFileExists(t, filepath.Join(dest, "sub", ".tracked.3840512.tmp"))
+		assert.NoFileExists(t, filepath.Join(dest, ".tracked.tmp"))
+		assert.FileExists(t, filepath.Join(dest, ".other.tmp"))
+		fileInfo, err := os.Stat(filepath.Join(dest, "tracked"))
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0600), fileInfo.Mode().Perm())
+		content, err := os.ReadFile(filepath.Join(dest, "tracked"))
+		require.NoError(t, err)
+		assert.Equal(t, "new", string(content))
+	})
+}
+
+func TestVolumeMountCopier_CopyVolumeMount_projectedVolume(t *testing.T) {
+	t.Run("should keep nested dirs behind the data symlink", func(t *testing.T) {
+		// given
+		src := t.TempDir()
+		dest := t.TempDir()
+		dataDir := filepath.Join(src, "..2025_05_07_4643786234")
+		writeTestFile(t, filepath.Join(dataDir, "config.yaml"), "root")
+		writeTestFile(t, filepath.Join(dataDir, "sub", "dir", "config.yaml"), "nested")
+		require.NoError(t, os.Symlink("..2025_05_07_4643786234", filepath.Join(src, "..data")))
+		require.NoError(t, os.Symlink("..data/config.yaml", filepath.Join(src, "config.yaml")))
+		require.NoError(t, os.Symlink("..data/sub", filepath.Join(src, "sub")))
+
+		fileSystem := FileSystem{}
+		sut := NewVolumeMountCopier(fileSystem, NewLocalConfigFileTracker(newMemoryDoguConfig(), fileSystem), Options{})
+
+		// when
+		err := sut.CopyVolumeMount([]SrcAndDestination{{Src: src, Dest: dest}})
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, 2, sut.summary.copied)
+		content, err := os.ReadFile(filepath.Join(dest, "config.yaml"))
+		require.NoError(t, err)
+		assert.Equal(t, "root", string(content))
+		content, err = os.ReadFile(filepath.Join(dest, "sub", "dir", "config.yaml"))
+		require.NoError(t, err)
+		assert.Equal(t, "nested", string(content))
+	})
+}
+
 func TestCopier_resolveSymLinkChain(t *testing.T) {
 	t.Run("success", func(t *testing.T) {
 		// given
@@ -187,7 +328,7 @@ func TestCopier_walk(t *testing.T) {
 		sut := &VolumeMountCopier{}
 
 		// when
-		err := sut.walk("", "", srcFile, false, dirEntry)
+		err := sut.walk(SrcAndDestination{}, "", srcFile, dirEntry)
 
 		// then
 		require.NoError(t, err)
@@ -202,7 +343,7 @@ func TestCopier_walk(t *testing.T) {
 		sut := &VolumeMountCopier{}
 
 		// when
-		err := sut.walk("", "", srcFile, false, dirEntry)
+		err := sut.walk(SrcAndDestination{}, "", srcFile, dirEntry)
 
 		// then
 		require.Error(t, err)
@@ -218,7 +359,7 @@ func TestCopier_walk(t *testing.T) {
 		sut := &VolumeMountCopier{}
 
 		// when
-		err := sut.walk("", "", srcFile, false, dirEntry)
+		err := sut.walk(SrcAndDestination{}, "", srcFile, dirEntry)
 
 		// then
 		require.NoError(t, err)
@@ -241,7 +382,7 @@ func TestCopier_walk(t *testing.T) {
 		sut.fileSystem = filesystemMock
 
 		// when
-		err := sut.walk(srcVolume, destVolume, srcFile, true, dirEntry)
+		err := sut.walk(SrcAndDestination{Src: srcVolume, Dest: destVolume}, srcVolume, srcFile, dirEntry)
 
 		// then
 		require.Error(t, err)
@@ -262,7 +403,7 @@ func TestCopier_walk(t *testing.T) {
 		// return error to indicate that the srcFile is not existent in the destination
 		filesystemMock.EXPECT().Stat("/var/lib/custom/config").Return(destFileInfo, assert.AnError)
 		copyMock := NewMockCopier(t)
-		copyMock.EXPECT().Execute(srcFile, destFile, filesystemMock).Return(nil)
+		copyMock.EXPECT().Execute(srcFile, destFile, filesystemMock, FileAttributes{}).Return(nil)
 		fileTrackerMock := newMockFileTracker(t)
 		fileTrackerMock.EXPECT().AddFile("/var/lib/custom/config").Return(nil)
 
@@ -272,7 +413,55 @@ func TestCopier_walk(t *testing.T) {
 		sut.copier = copyMock.Execute
 
 		// when
-		err := sut.walk(src, dest, srcFile, false, dirEntry)
+		err := sut.walk(SrcAndDestination{Src: src, Dest: dest}, src, srcFile, dirEntry)
+
+		// then
+		require.NoError(t, err)
+	})
+
+	t.Run("should skip file not matching the patterns", func(t *testing.T) {
+		// given
+		mount := SrcAndDestination{Src: "/tmp/mount", Dest: "/var/lib/custom", Include: []string{"**/*.xml"}}
+		srcFileInfo := &myFileInfo{mode: os.ModePerm}
+		dirEntry := &myDirEntry{fileInfo: srcFileInfo}
+
+		sut := &VolumeMountCopier{}
+
+		// when
+		err := sut.walk(mount, mount.Src, "/tmp/mount/dir/README", dirEntry)
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, 1, sut.summary.filtered)
+	})
+
+	t.Run("should pass the attributes of the mount to the copier", func(t *testing.T) {
+		// given
+		owner := 1000
+		group := 1000
+		fileMode := os.FileMode(0640)
+		dirMode := os.FileMode(0750)
+		mount := SrcAndDestination{Src: "/tmp/mount", Dest: "/var/lib/custom", Owner: &owner, Group: &group, FileMode: &fileMode, DirMode: &dirMode}
+		srcFile := "/tmp/mount/config"
+		destFile := "/var/lib/custom/config"
+		srcFileInfo := &myFileInfo{mode: os.ModePerm}
+		dirEntry := &myDirEntry{fileInfo: srcFileInfo}
+		expectedAttributes := FileAttributes{PreserveMetadata: true, Owner: &owner, Group: &group, FileMode: &fileMode, DirMode: &dirMode}
+
+		filesystemMock := NewMockFilesystem(t)
+		filesystemMock.EXPECT().Stat(destFile).Return(nil, assert.AnError)
+		copyMock := NewMockCopier(t)
+		copyMock.EXPECT().Execute(srcFile, destFile, filesystemMock, expectedAttributes).Return(nil)
+		fileTrackerMock := newMockFileTracker(t)
+		fileTrackerMock.EXPECT().AddFile(destFile).Return(nil)
+
+		sut := &VolumeMountCopier{options: Options{PreserveMetadata: true}}
+		sut.fileSystem = filesystemMock
+		sut.fileTracker = fileTrackerMock
+		sut.copier = copyMock.Execute
+
+		// when
+		err := sut.walk(mount, mount.Src, srcFile, dirEntry)
 
 		// then
 		require.NoError(t, err)
@@ -284,16 +473,17 @@ func TestCopier_walk(t *testing.T) {
 		dest := "/var/lib/custom"
 		srcFile := "/tmp/mount/config"
 		destFile := "/var/lib/custom/config"
-		srcFileInfo := &myFileInfo{mode: os.ModePerm}
-		destFileInfo := &myFileInfo{mode: os.ModePerm}
+		srcFileInfo := &myFileInfo{mode: os.ModePerm, size: 2}
+		destFileInfo := &myFileInfo{mode: os.ModePerm, size: 1}
 		dirEntry := &myDirEntry{fileInfo: srcFileInfo}
 
 		filesystemMock := NewMockFilesystem(t)
 		filesystemMock.EXPECT().Stat("/var/lib/custom/config").Return(destFileInfo, nil)
 		filesystemMock.EXPECT().SameFile(srcFileInfo, destFileInfo).Return(false)
 		copyMock := NewMockCopier(t)
-		copyMock.EXPECT().Execute(srcFile, destFile, filesystemMock).Return(nil)
+		copyMock.EXPECT().Execute(srcFile, destFile, filesystemMock, FileAttributes{}).Return(nil)
 		fileTrackerMock := newMockFileTracker(t)
+		fileTrackerMock.EXPECT().IsTracked(destFile).Return(true, nil)
 		fileTrackerMock.EXPECT().AddFile("/var/lib/custom/config").Return(nil)
 
 		sut := &VolumeMountCopier{}
@@ -302,12 +492,149 @@ func TestCopier_walk(t *testing.T) {
 		sut.copier = copyMock.Execute
 
 		// when
-		err := sut.walk(src, dest, srcFile, false, dirEntry)
+		err := sut.walk(SrcAndDestination{Src: src, Dest: dest}, src, srcFile, dirEntry)
 
 		// then
 		require.NoError(t, err)
 	})
 
+	t.Run("should keep the original of an untracked file before overwriting it", func(t *testing.T) {
+		// given
+		src := "/tmp/mount"
+		dest := "/var/lib/custom"
+		srcFile := "/tmp/mount/config"
+		destFile := "/var/lib/custom/config"
+		originalFile := "/var/lib/custom/.config.orig"
+		srcFileInfo := &myFileInfo{mode: os.ModePerm, size: 2}
+		destFileInfo := &myFileInfo{mode: os.ModePerm, size: 1}
+		dirEntry := &myDirEntry{fileInfo: srcFileInfo}
+
+		filesystemMock := NewMockFilesystem(t)
+		filesystemMock.EXPECT().Stat(destFile).Return(destFileInfo, nil)
+		filesystemMock.EXPECT().SameFile(srcFileInfo, destFileInfo).Return(false)
+		filesystemMock.EXPECT().Lstat(originalFile).Return(nil, os.ErrNotExist)
+		filesystemMock.EXPECT().Link(destFile, originalFile).Return(nil)
+		copyMock := NewMockCopier(t)
+		copyMock.EXPECT().Execute(srcFile, destFile, filesystemMock, FileAttributes{}).Return(nil)
+		fileTrackerMock := newMockFileTracker(t)
+		fileTrackerMock.EXPECT().IsTracked(destFile).Return(false, nil)
+		fileTrackerMock.EXPECT().SetBackup(destFile, originalFile).Return(nil)
+		fileTrackerMock.EXPECT().AddFile(destFile).Return(nil)
+
+		sut := &VolumeMountCopier{}
+		sut.fileSystem = filesystemMock
+		sut.fileTracker = fileTrackerMock
+		sut.copier = copyMock.Execute
+
+		// when
+		err := sut.walk(SrcAndDestination{Src: src, Dest: dest}, src, srcFile, dirEntry)
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, 1, sut.summary.copied)
+	})
+
+	t.Run("should not track untracked destination file with the same content", func(t *testing.T) {
+		// given
+		src := "/tmp/mount"
+		dest := "/var/lib/custom"
+		srcFile := "/tmp/mount/config"
+		destFile := "/var/lib/custom/config"
+		srcFileInfo := &myFileInfo{mode: os.ModePerm, size: 7}
+		destFileInfo := &myFileInfo{mode: os.ModePerm, size: 7}
+		dirEntry := &myDirEntry{fileInfo: srcFileInfo}
+		checksum := FileChecksum{Digest: contentDigest, Size: 7}
+		srcOsFile := &os.File{}
+
+		filesystemMock := NewMockFilesystem(t)
+		filesystemMock.EXPECT().Stat(destFile).Return(destFileInfo, nil)
+		filesystemMock.EXPECT().SameFile(srcFileInfo, destFileInfo).Return(false)
+		filesystemMock.EXPECT().Open(srcFile).Return(srcOsFile, nil)
+		filesystemMock.EXPECT().Copy(mock.Anything, srcOsFile).RunAndReturn(writeContent("content"))
+		filesystemMock.EXPECT().CloseFile(srcOsFile).Return(nil)
+		fileTrackerMock := newMockFileTracker(t)
+		fileTrackerMock.EXPECT().IsTracked(destFile).Return(false, nil)
+		fileTrackerMock.EXPECT().GetChecksum(destFile).Return(checksum, true, nil)
+
+		sut := &VolumeMountCopier{}
+		sut.fileSystem = filesystemMock
+		sut.fileTracker = fileTrackerMock
+
+		// when
+		err := sut.walk(SrcAndDestination{Src: src, Dest: dest}, src, srcFile, dirEntry)
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, 1, sut.summary.unchanged)
+	})
+
+	t.Run("should skip and track destination file with the same content", func(t *testing.T) {
+		// given
+		src := "/tmp/mount"
+		dest := "/var/lib/custom"
+		srcFile := "/tmp/mount/config"
+		destFile := "/var/lib/custom/config"
+		srcFileInfo := &myFileInfo{mode: os.ModePerm, size: 7}
+		destFileInfo := &myFileInfo{mode: os.ModePerm, size: 7}
+		dirEntry := &myDirEntry{fileInfo: srcFileInfo}
+		checksum := FileChecksum{Digest: contentDigest, Size: 7}
+		srcOsFile := &os.File{}
+
+		filesystemMock := NewMockFilesystem(t)
+		filesystemMock.EXPECT().Stat(destFile).Return(destFileInfo, nil)
+		filesystemMock.EXPECT().SameFile(srcFileInfo, destFileInfo).Return(false)
+		filesystemMock.EXPECT().Open(srcFile).Return(srcOsFile, nil)
+		filesystemMock.EXPECT().Copy(mock.Anything, srcOsFile).RunAndReturn(writeContent("content"))
+		filesystemMock.EXPECT().CloseFile(srcOsFile).Return(nil)
+		copyMock := NewMockCopier(t)
+		fileTrackerMock := newMockFileTracker(t)
+		fileTrackerMock.EXPECT().IsTracked(destFile).Return(true, nil)
+		fileTrackerMock.EXPECT().GetChecksum(destFile).Return(checksum, true, nil)
+		fileTrackerMock.EXPECT().AddFile(destFile).Return(nil)
+
+		sut := &VolumeMountCopier{}
+		sut.fileSystem = filesystemMock
+		sut.fileTracker = fileTrackerMock
+		sut.copier = copyMock.Execute
+
+		// when
+		err := sut.walk(SrcAndDestination{Src: src, Dest: dest}, src, srcFile, dirEntry)
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, 1, sut.summary.unchanged)
+	})
+
+	t.Run("should return error on error comparing the content", func(t *testing.T) {
+		// given
+		src := "/tmp/mount"
+		dest := "/var/lib/custom"
+		srcFile := "/tmp/mount/config"
+		destFile := "/var/lib/custom/config"
+		srcFileInfo := &myFileInfo{mode: os.ModePerm, size: 7}
+		destFileInfo := &myFileInfo{mode: os.ModePerm, size: 7}
+		dirEntry := &myDirEntry{fileInfo: srcFileInfo}
+
+		filesystemMock := NewMockFilesystem(t)
+		filesystemMock.EXPECT().Stat(destFile).Return(destFileInfo, nil)
+		filesystemMock.EXPECT().SameFile(srcFileInfo, destFileInfo).Return(false)
+		filesystemMock.EXPECT().Open(srcFile).Return(nil, assert.AnError)
+		fileTrackerMock := newMockFileTracker(t)
+		fileTrackerMock.EXPECT().IsTracked(destFile).Return(true, nil)
+
+		sut := &VolumeMountCopier{}
+		sut.fileSystem = filesystemMock
+		sut.fileTracker = fileTrackerMock
+
+		// when
+		err := sut.walk(SrcAndDestination{Src: src, Dest: dest}, src, srcFile, dirEntry)
+
+		// then
+		require.Error(t, err)
+		assert.ErrorIs(t, err, assert.AnError)
+		assert.ErrorContains(t, err, "failed to compare source file /tmp/mount/config with destination file /var/lib/custom/config")
+	})
+
 	t.Run("should do nothing if fileinfo is equal", func(t *testing.T) {
 		// given
 		src := "/tmp/mount"
@@ -329,7 +656,7 @@ func TestCopier_walk(t *testing.T) {
 		sut.copier = copyMock.Execute
 
 		// when
-		err := sut.walk(src, dest, srcFile, false, dirEntry)
+		err := sut.walk(SrcAndDestination{Src: src, Dest: dest}, src, srcFile, dirEntry)
 
 		// then
 		require.NoError(t, err)
@@ -349,7 +676,7 @@ func TestCopier_walk(t *testing.T) {
 		// return error to indicate that the srcFile is not existent in the destination
 		filesystemMock.EXPECT().Stat("/var/lib/custom/dir1/dir2/config").Return(destFileInfo, assert.AnError)
 		copyMock := NewMockCopier(t)
-		copyMock.EXPECT().Execute(srcFile, destFile, filesystemMock).Return(nil)
+		copyMock.EXPECT().Execute(srcFile, destFile, filesystemMock, FileAttributes{}).Return(nil)
 		fileTrackerMock := newMockFileTracker(t)
 		fileTrackerMock.EXPECT().AddFile("/var/lib/custom/dir1/dir2/config").Return(nil)
 
@@ -359,7 +686,7 @@ func TestCopier_walk(t *testing.T) {
 		sut.copier = copyMock.Execute
 
 		// when
-		err := sut.walk(src, dest, srcFile, true, dirEntry)
+		err := sut.walk(SrcAndDestination{Src: src, Dest: dest}, src, srcFile, dirEntry)
 
 		// then
 		require.NoError(t, err)
@@ -390,8 +717,11 @@ func (m myDirEntry) Info() (fs.FileInfo, error) {
 }
 
 type myFileInfo struct {
-	isDir bool
-	mode  os.FileMode
+	isDir   bool
+	mode    os.FileMode
+	size    int64
+	modTime time.Time
+	sys     any
 }
 
 func (m myFileInfo) Name() string {
@@ -400,8 +730,7 @@ func (m myFileInfo) Name() string {
 }
 
 func (m myFileInfo) Size() int64 {
-	// TODO implement me
-	panic("implement me")
+	return m.size
 }
 
 func (m myFileInfo) Mode() fs.FileMode {
@@ -409,8 +738,7 @@ func (m myFileInfo) Mode() fs.FileMode {
 }
 
 func (m myFileInfo) ModTime() time.Time {
-	// TODO implement me
-	panic("implement me")
+	return m.modTime
 }
 
 func (m myFileInfo) IsDir() bool {
@@ -418,6 +746,45 @@ func (m myFileInfo) IsDir() bool {
 }
 
 func (m myFileInfo) Sys() any {
-	// TODO implement me
-	panic("implement me")
+	return m.sys
+}
+
+func writeTestFile(t *testing.T, filePath, content string) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Dir(filePath), 0755))
+	require.NoError(t, os.WriteFile(filePath, []byte(content), 0644))
+}
+
+// memoryDoguConfig is an in-memory dogu config for tests with the real file system.
+type memoryDoguConfig struct {
+	mutex  sync.Mutex
+	values map[string]string
+}
+
+func newMemoryDoguConfig() *memoryDoguConfig {
+	return &memoryDoguConfig{values: map[string]string{}}
+}
+
+func (m *memoryDoguConfig) Set(key, value string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.values[key] = value
+	return nil
+}
+
+func (m *memoryDoguConfig) Get(key string) (string, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	value, ok := m.values[key]
+	if !ok {
+		return "", fmt.Errorf("key %s does not exist", key)
+	}
+	return value, nil
+}
+
+func (m *memoryDoguConfig) Exists(key string) (bool, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	_, ok := m.values[key]
+	return ok, nil
 }